@@ -1,20 +1,31 @@
 package audioio
 
 import(
+  "encoding/binary"
   "fmt"
   "errors"
+  "io"
   "os"
+  "strings"
   "github.com/go-audio/aiff"
   "github.com/go-audio/audio"
 )
 
+// the FORM size counts 46 bytes of headers besides the samples
+const aiffMaxDataSize = 0xffffffff - 46
+
+// AIFC compression types that are uncompressed PCM, sowt is little endian
+var aifcPCMEncodings = map[string]bool{
+  "": true,
+  "NONE": true,
+  "twos": true,
+  "sowt": true,
+}
+
+// AIFF and uncompressed AIFC files, samples are big endian unless the AIFC
+// compression is sowt
 type AiffReader struct {
-  AudioFile
-  ReadBuffer *audio.IntBuffer
-  NumSampleFrames int
-  Duration float64
-  decoder *aiff.Decoder
-  fileIo *os.File
+  pcmReader
 }
 
 type AiffWriter struct {
@@ -22,117 +33,121 @@ type AiffWriter struct {
   WriteBuffer *audio.IntBuffer
   encoder *aiff.Encoder
   maxSampleValue int
+  dataSize int64 // bytes of samples written
   fileIo *os.File
 }
 
-// Getters
-func (ar *AiffReader) GetBitDepth() int {
-  return ar.BitDepth
-}
-
-func (ar *AiffReader) GetSampleRate() int {
-  return ar.SampleRate
-}
-
-func (ar *AiffReader) GetNumChans() int {
-  return ar.NumChans
-}
-
-func (ar *AiffReader) GetNumSampleFrames() int {
-  return ar.NumSampleFrames
-}
-
-func (ar *AiffReader) GetDuration() float64 {
-  return ar.Duration
-}
-
 // bufferLength: how many frames to read at one time
-func (ar *AiffReader) Open(bufferLength int) error {
-  var err error
-
+func (ar *AiffReader) Open(bufferLength int) (err error) {
   ar.fileIo, err = os.Open(ar.Filepath)
 
   if err != nil {
     return err
   }
 
-  ar.decoder = aiff.NewDecoder(ar.fileIo)
+  // the file isn't left open when its chunks can't be read
+  defer func() {
+    if err != nil {
+      ar.fileIo.Close()
+    }
+  }()
 
-  ar.decoder.ReadInfo()
+  header := make([]byte, 12)
 
-  if ar.decoder.NumChans == 0 {
-    return errors.New("AiffReader.decoder.NumChans is 0")
+  if _, err = io.ReadFull(ar.fileIo, header); err != nil {
+    return err
   }
 
-  if ar.decoder.SampleRate == 0 {
-    return errors.New("AiffReader.decoder.SampleRate is 0")
-  }
+  form := string(header[8:])
 
-  if ar.decoder.BitDepth == 0 {
-    return errors.New("AiffReader.decoder.BitDepth is 0")
+  if string(header[:4]) != "FORM" || (form != "AIFF" && form != "AIFC") {
+    return errors.New("Not an AIFF file")
   }
 
-  ar.NumChans = int(ar.decoder.NumChans)
-  ar.BitDepth = int(ar.decoder.BitDepth)
-  ar.SampleRate = int(ar.decoder.SampleRate)
-  ar.NumSampleFrames = int(ar.decoder.NumSampleFrames)
-  duration, err := ar.decoder.Duration()
+  offset := int64(12)
+  var dataOffset, dataSize int64 = -1, -1
+  numSampleFrames := -1
 
-  if err != nil {
-    return err
-  }
+  // the COMM and SSND chunks can come in either order
+  for numSampleFrames < 0 || dataOffset < 0 {
+    chunkHeader := make([]byte, 8)
 
-  ar.Duration = duration.Seconds()
+    if _, err = ar.fileIo.ReadAt(chunkHeader, offset); err != nil {
+      if numSampleFrames < 0 {
+        return fmt.Errorf("AIFF file has no COMM chunk: %v", err)
+      }
 
-  format := &audio.Format{
-    NumChannels: ar.NumChans,
-    SampleRate: ar.SampleRate,
+      return fmt.Errorf("AIFF file has no SSND chunk: %v", err)
+    }
+
+    chunkID := string(chunkHeader[:4])
+    chunkSize := int64(binary.BigEndian.Uint32(chunkHeader[4:]))
+    offset += 8
+
+    switch chunkID {
+    case "COMM":
+      if numSampleFrames, err = ar.readComm(offset, chunkSize, form == "AIFC"); err != nil {
+        return err
+      }
+    case "SSND":
+      // the samples follow the offset and block size fields, after offset
+      // bytes of padding
+      ssnd := make([]byte, 8)
+
+      if _, err = ar.fileIo.ReadAt(ssnd, offset); err != nil {
+        return err
+      }
+
+      skip := int64(binary.BigEndian.Uint32(ssnd))
+      dataOffset = offset + 8 + skip
+      dataSize = chunkSize - 8 - skip
+    }
+
+    // chunks are padded to an even size
+    offset += chunkSize + chunkSize % 2
   }
 
-  ar.ReadBuffer = &audio.IntBuffer{
-    Format: format,
-    Data: make([]int, bufferLength * ar.NumChans, bufferLength * ar.NumChans),
-    SourceBitDepth: ar.BitDepth,
+  // the sample frames of the COMM chunk, unless the file is cut short
+  blockAlign := int64(pcmSampleBytes(ar.BitDepth) * ar.NumChans)
+  if commSize := int64(numSampleFrames) * blockAlign; dataSize < 0 || dataSize > commSize {
+    dataSize = commSize
   }
 
-  return nil
+  return ar.openData(bufferLength, dataOffset, dataSize)
 }
 
-// channel is zero indexed
-func (ar *AiffReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
-  if ar.NumChans == 0 {
-    return nil, errors.New("AiffReader.has no channels to extract")
+// reads the format of the samples from the COMM chunk, returning its number
+// of sample frames
+func (ar *AiffReader) readComm(offset, chunkSize int64, aifc bool) (int, error) {
+  if chunkSize < 18 || (aifc && chunkSize < 22) {
+    return 0, fmt.Errorf("COMM chunk is %d bytes", chunkSize)
   }
 
-  if channel > ar.NumChans - 1 {
-    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, ar.NumChans - 1)
-  }
+  comm := make([]byte, chunkSize)
 
-  buffer := &audio.IntBuffer{
-    Format: ar.ReadBuffer.Format,
-    Data: make([]int, ar.ReadBuffer.NumFrames(), ar.ReadBuffer.NumFrames()),
-    SourceBitDepth: ar.ReadBuffer.SourceBitDepth,
+  if _, err := ar.fileIo.ReadAt(comm, offset); err != nil {
+    return 0, err
   }
 
-  x := 0
-  for i := channel; i < len(ar.ReadBuffer.Data); i += ar.NumChans {
-    buffer.Data[x] = ar.ReadBuffer.Data[i]
-    x++
-  }
+  var sampleRate [10]byte
+  copy(sampleRate[:], comm[8:18])
 
-  return buffer, nil
-}
+  ar.NumChans = int(binary.BigEndian.Uint16(comm))
+  ar.BitDepth = int(binary.BigEndian.Uint16(comm[6:]))
+  ar.SampleRate = audio.IEEEFloatToInt(sampleRate)
+  ar.format = pcmFormat{bigEndian: true}
 
-func (ar *AiffReader) Close() {
-  ar.fileIo.Close()
-}
+  if aifc {
+    encoding := strings.TrimRight(string(comm[18:22]), "\x00")
+
+    if !aifcPCMEncodings[encoding] {
+      return 0, fmt.Errorf("AIFC compression %q is not supported, only NONE, twos and sowt", encoding)
+    }
 
-// numSamples is the number of samples read across all channels
-// numFrames is the number of samples per channel
-func (ar *AiffReader) ReadNext() (numSamples, numFrames int, err error) {
-  numSamples, err = ar.decoder.PCMBuffer(ar.ReadBuffer)
-  numFrames = numSamples / ar.NumChans
-  return
+    ar.format.bigEndian = encoding != "sowt"
+  }
+
+  return int(binary.BigEndian.Uint32(comm[2:])), nil
 }
 
 // AiffWriter
@@ -166,7 +181,7 @@ func (aw *AiffWriter) Create(bufferLength int) error {
   aw.maxSampleValue = IntMaxSignedValue[aw.BitDepth]
 
   if aw.maxSampleValue == 0 {
-    return fmt.Errorf("BitDepth %d returned invalid integer max signed value of 0", aw.BitDepth)
+    return fmt.Errorf("Cannot write %d bit samples, only 8, 16, 24 or 32", aw.BitDepth)
   }
 
   return nil
@@ -178,6 +193,12 @@ func (aw *AiffWriter) Close() {
 }
 
 func (aw *AiffWriter) Write(buffer *audio.IntBuffer) error {
+  aw.dataSize += int64(len(buffer.Data) * aw.BitDepth / 8)
+
+  if aw.dataSize > aiffMaxDataSize {
+    return fmt.Errorf("AIFF files are limited to 4 GB, write a WAV, W64 or CAF file instead")
+  }
+
   // clip gaurd: if any sample in the int buffer exceeds maximum allowed for the
   // buffer's BitDepth, clip the sample instead of letting the encoder have it
   for i := 0; i < len(buffer.Data); i++ {
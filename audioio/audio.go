@@ -5,6 +5,8 @@ import(
   "fmt"
   "github.com/go-audio/audio"
   "bytes"
+  "io"
+  "math"
   "path/filepath"
   "strings"
 )
@@ -19,11 +21,22 @@ var IntMaxSignedValue = map[int]int {
 const TYPE_INVALID = -1
 const TYPE_AIFF = 1
 const TYPE_WAVE = 2
+const TYPE_FLAC = 3
+const TYPE_MP3 = 4
+const TYPE_VORBIS = 5
+const TYPE_W64 = 7
+const TYPE_CAF = 8
+const TYPE_RAW = 9
+const TYPE_NPY = 10
+
+// sample frames read at a time by ReadSignals
+const readSignalsBufferLength = 4096
 
 type Reader interface {
   Open(bufferLength int) error
   Close()
   ReadNext() (int, int, error)
+  Seek(sampleFrame int) error // the next ReadNext starts at sampleFrame
   ExtractChannel(channel int) (*audio.IntBuffer, error)
   GetBitDepth() int
   GetSampleRate() int
@@ -48,6 +61,14 @@ type AudioFile struct {
   SampleRate int
 }
 
+// describes how NewAudioWriter writes a file. The zero OutputFormat writes
+// the type the extension names
+type OutputFormat struct {
+  FileType int // 0 takes the type from the extension
+  Split bool // write a mono file per channel
+  SplitNames []string // of the split files, numbered from 1 if there are none for every channel
+}
+
 type AudioReader struct {
   Reader Reader
   fileType int
@@ -56,8 +77,14 @@ type AudioReader struct {
 type AudioWriter struct {
   Writer Writer
   fileType int
+  shift int // bits samples are shifted up by to the bit depth written
+  shifted []int
 }
 
+// bytes read by returnFileType, enough for the first Ogg page header and the
+// start of its packet
+const magicBytesLength = 64
+
 // determines a filetype based on the given file extension, the file does not have to exist
 func returnFileTypeFromExtension(filePath string) (int, error) {
   extension := strings.ToLower(filepath.Ext(filePath))
@@ -71,11 +98,107 @@ func returnFileTypeFromExtension(filePath string) (int, error) {
     return TYPE_WAVE, nil
   case ".wav":
     return TYPE_WAVE, nil
+  case ".flac":
+    return TYPE_FLAC, nil
+  case ".w64":
+    return TYPE_W64, nil
+  case ".caf":
+    return TYPE_CAF, nil
+  case ".raw", ".pcm":
+    return TYPE_RAW, nil
+  case ".npy":
+    return TYPE_NPY, nil
   }
 
   return TYPE_INVALID, fmt.Errorf("Invalid File Type")
 }
 
+// the formats gopvoc writes, by their -of name, the first extension is the
+// one given to files named after their format
+var outputFormats = []struct {
+  name string
+  fileType int
+  extensions []string
+}{
+  {"aiff", TYPE_AIFF, []string{".aif", ".aiff"}},
+  {"wav", TYPE_WAVE, []string{".wav", ".wave"}},
+  {"w64", TYPE_W64, []string{".w64"}},
+  {"caf", TYPE_CAF, []string{".caf"}},
+  {"flac", TYPE_FLAC, []string{".flac"}},
+  {"raw", TYPE_RAW, []string{".raw", ".pcm"}},
+  {"npy", TYPE_NPY, []string{".npy"}},
+}
+
+// OutputFormatsString lists the output format names
+func OutputFormatsString() string {
+  names := []string{}
+  for _, format := range outputFormats {
+    names = append(names, format.name)
+  }
+
+  return strings.Join(names, ", ")
+}
+
+// the output formats with their extensions, for messages
+func outputExtensionsString() string {
+  formats := []string{}
+  for _, format := range outputFormats {
+    formats = append(formats, fmt.Sprintf("%s (%s)", format.name, strings.Join(format.extensions, ", ")))
+  }
+
+  return strings.Join(formats, ", ")
+}
+
+// ParseOutputFormat returns the file type of an output format name
+func ParseOutputFormat(name string) (int, error) {
+  for _, format := range outputFormats {
+    if format.name == strings.ToLower(name) {
+      return format.fileType, nil
+    }
+  }
+
+  return TYPE_INVALID, fmt.Errorf("Output format must be one of: %s, got %s", OutputFormatsString(), name)
+}
+
+// OutputExtension is the extension of files of the type, empty for the types
+// gopvoc only reads
+func OutputExtension(fileType int) string {
+  for _, format := range outputFormats {
+    if format.fileType == fileType {
+      return format.extensions[0]
+    }
+  }
+
+  return ""
+}
+
+// OutputFileType is the type NewAudioWriter writes to filePath with the zero
+// OutputFormat, taken from the extension
+func OutputFileType(filePath string) (int, error) {
+  fileType, err := returnFileTypeFromExtension(filePath)
+
+  if err != nil {
+    return TYPE_INVALID, fmt.Errorf("Can't tell the output format of %s from its extension, the supported formats are: %s", filePath, outputExtensionsString())
+  }
+
+  return fileType, nil
+}
+
+// InputFileType is the type of an existing file, from its contents or its
+// input format
+func InputFileType(filePath string, format InputFormat) (int, error) {
+  if format.FileType == TYPE_RAW {
+    return TYPE_RAW, nil
+  }
+
+  // the split files are all of the same type
+  if format.SplitNames != nil {
+    filePath = SplitPaths(filePath, format.SplitNames)[0]
+  }
+
+  return returnFileType(filePath)
+}
+
 // Reades the magic bytes of the given file and returns the file type const.
 // File must exist on disk
 func returnFileType(filePath string) (int, error) {
@@ -88,42 +211,120 @@ func returnFileType(filePath string) (int, error) {
 
   defer file.Close()
 
-  headerBytes := make([]byte, 12)
-  if _, err := file.Read(headerBytes); err != nil {
+  headerBytes := make([]byte, magicBytesLength)
+  n, err := io.ReadFull(file, headerBytes)
+
+  if err != nil && err != io.ErrUnexpectedEOF {
     return TYPE_INVALID, err
   }
+
+  if n < 16 {
+    return TYPE_INVALID, fmt.Errorf("Invalid File Type")
+  }
+
+  headerBytes = headerBytes[:n]
   headerBytes8 := []byte{}
   headerBytes8 = append(headerBytes8, headerBytes[:4]...)
-  headerBytes8 = append(headerBytes8, headerBytes[8:]...)
+  headerBytes8 = append(headerBytes8, headerBytes[8:12]...)
 
-  if bytes.Equal(headerBytes8, []byte("FORMAIFF")) {
+  if bytes.Equal(headerBytes8, []byte("FORMAIFF")) || bytes.Equal(headerBytes8, []byte("FORMAIFC")) {
     return TYPE_AIFF, nil
-  } else if bytes.Equal(headerBytes8, []byte("RIFFWAVE")) {
+  } else if bytes.Equal(headerBytes8, []byte("RIFFWAVE")) || bytes.Equal(headerBytes8, []byte("RF64WAVE")) || bytes.Equal(headerBytes8, []byte("BW64WAVE")) {
     return TYPE_WAVE, nil
+  } else if bytes.Equal(headerBytes[:16], w64RiffGUID) {
+    return TYPE_W64, nil
+  } else if bytes.Equal(headerBytes[:4], []byte("caff")) {
+    return TYPE_CAF, nil
+  } else if bytes.Equal(headerBytes[:6], []byte(npyMagic)) {
+    return TYPE_NPY, nil
+  } else if bytes.Equal(headerBytes[:4], []byte("fLaC")) {
+    return TYPE_FLAC, nil
+  } else if bytes.Equal(headerBytes[:3], []byte("ID3")) || isMp3FrameSync(headerBytes) {
+    return TYPE_MP3, nil
+  }
+
+  if oggCodec(headerBytes) == "vorbis" {
+    return TYPE_VORBIS, nil
   }
 
   return TYPE_INVALID, fmt.Errorf("Invalid File Type")
 }
 
-func NewAudioReader(filePath string) (ar *AudioReader, err error) {
+// format describes a headerless file, the zero InputFormat for files whose
+// header describes them
+func NewAudioReader(filePath string, format InputFormat) (ar *AudioReader, err error) {
   ar = &AudioReader{}
 
+  // a split input is read from a mono file for each channel, in the format
+  // of the input
+  if format.SplitNames != nil {
+    paths := SplitPaths(filePath, format.SplitNames)
+    monoFormat := format
+    monoFormat.SplitNames = nil
+
+    if monoFormat.FileType == TYPE_RAW {
+      monoFormat.NumChans = 1
+    }
+
+    ar.Reader = &SplitReader{AudioFile: AudioFile{Filepath: filePath}, Paths: paths, Format: monoFormat}
+    ar.fileType, _ = InputFileType(paths[0], monoFormat)
+    return ar, nil
+  }
+
+  // raw PCM has no header to read its format from
+
+  if format.FileType == TYPE_RAW {
+    audioFile := AudioFile{Filepath: filePath, NumChans: format.NumChans, SampleRate: format.SampleRate}
+    ar.Reader = &RawReader{pcmReader: pcmReader{AudioFile: audioFile}, Encoding: format.Encoding}
+    ar.fileType = TYPE_RAW
+    return ar, nil
+  }
+
   // get file type
   fileType, err := returnFileType(filePath)
 
   if err != nil {
+    if extensionType, _ := returnFileTypeFromExtension(filePath); extensionType == TYPE_RAW {
+      return nil, fmt.Errorf("Raw PCM file %s needs its format, such as raw:s16le:48000:2", filePath)
+    }
+
     return nil, err
   }
 
   switch fileType {
   case TYPE_AIFF:
     audioFile := AudioFile{Filepath: filePath}
-    ar.Reader = &AiffReader{AudioFile: audioFile}
+    ar.Reader = &AiffReader{pcmReader{AudioFile: audioFile}}
     ar.fileType = TYPE_AIFF
   case TYPE_WAVE:
     audioFile := AudioFile{Filepath: filePath}
-    ar.Reader = &WaveReader{AudioFile: audioFile}
+    ar.Reader = &WaveReader{pcmReader{AudioFile: audioFile}}
     ar.fileType = TYPE_WAVE
+  case TYPE_FLAC:
+    audioFile := AudioFile{Filepath: filePath}
+    ar.Reader = &FlacReader{AudioFile: audioFile}
+    ar.fileType = TYPE_FLAC
+  case TYPE_W64:
+    audioFile := AudioFile{Filepath: filePath}
+    ar.Reader = &W64Reader{pcmReader{AudioFile: audioFile}}
+    ar.fileType = TYPE_W64
+  case TYPE_CAF:
+    audioFile := AudioFile{Filepath: filePath}
+    ar.Reader = &CafReader{pcmReader{AudioFile: audioFile}}
+    ar.fileType = TYPE_CAF
+  case TYPE_NPY:
+    // the sample rate isn't stored in the array
+    audioFile := AudioFile{Filepath: filePath, SampleRate: format.SampleRate}
+    ar.Reader = &NpyReader{pcmReader{AudioFile: audioFile}}
+    ar.fileType = TYPE_NPY
+  case TYPE_MP3:
+    audioFile := AudioFile{Filepath: filePath}
+    ar.Reader = &Mp3Reader{AudioFile: audioFile}
+    ar.fileType = TYPE_MP3
+  case TYPE_VORBIS:
+    audioFile := AudioFile{Filepath: filePath}
+    ar.Reader = &VorbisReader{AudioFile: audioFile}
+    ar.fileType = TYPE_VORBIS
   default:
     return nil, fmt.Errorf("AudioReader doesn't implement filetype %d", fileType)
   }
@@ -131,9 +332,17 @@ func NewAudioReader(filePath string) (ar *AudioReader, err error) {
   return ar, nil
 }
 
-// delegate to the reader
+// delegate to the reader, then check the sample rate is one gopvoc processes
 func (ar *AudioReader) Open(bufferLength int) (err error) {
-  return ar.Reader.Open(bufferLength)
+  if err = ar.Reader.Open(bufferLength); err != nil {
+    return err
+  }
+
+  if err = CheckInputSampleRate(ar.Reader.GetSampleRate()); err != nil {
+    ar.Reader.Close()
+  }
+
+  return err
 }
 
 func (ar *AudioReader) Close() {
@@ -168,24 +377,90 @@ func (ar *AudioReader) GetDuration() float64 {
   return ar.Reader.GetDuration()
 }
 
-// Audio Writer
-func NewAudioWriter(audioFile AudioFile) (aw *AudioWriter, err error) {
+func (ar *AudioReader) Seek(sampleFrame int) error {
+  return ar.Reader.Seek(sampleFrame)
+}
+
+// the metadata tags (name and value) of the file after Open, nil for formats
+// without them
+func (ar *AudioReader) GetTags() [][2]string {
+  reader := ar.Reader
+
+  if rr, ok := reader.(*rangeReader); ok {
+    reader = rr.Reader
+  }
+
+  switch reader := reader.(type) {
+  case *FlacReader:
+    return reader.Tags
+  case *VorbisReader:
+    return reader.Tags
+  }
+
+  return nil
+}
+
+// Audio Writer, format.FileType writes the file as that type whatever its
+// extension
+func NewAudioWriter(audioFile AudioFile, format OutputFormat) (aw *AudioWriter, err error) {
   aw = &AudioWriter{}
 
   // get file type
-  fileType, err := returnFileTypeFromExtension(audioFile.Filepath)
+  fileType := format.FileType
 
-  if err != nil {
+  if fileType == 0 {
+    if fileType, err = OutputFileType(audioFile.Filepath); err != nil {
+      return nil, err
+    }
+  }
+
+  capabilities, _ := Capabilities(fileType)
+
+  if err = capabilities.CheckSampleRate(audioFile.SampleRate); err != nil {
     return nil, err
   }
 
+  // a split output is written as a mono file for each channel
+  if format.Split {
+    aw.Writer = &SplitWriter{AudioFile: audioFile, Names: format.SplitNames, fileType: fileType}
+    aw.fileType = fileType
+    return aw, nil
+  }
+
+  // a bit depth the format doesn't have, such as 12 or 20 bit, is written at
+  // one it does and the samples are shifted to it
+  if !capabilities.SupportsBitDepth(audioFile.BitDepth) {
+    if audioFile.BitDepth < 1 || audioFile.BitDepth > 32 {
+      return nil, fmt.Errorf("Cannot write %d bit samples", audioFile.BitDepth)
+    }
+
+    writeBitDepth := capabilities.WriteBitDepth(audioFile.BitDepth)
+    aw.shift = writeBitDepth - audioFile.BitDepth
+    audioFile.BitDepth = writeBitDepth
+  }
+
   switch fileType {
   case TYPE_AIFF:
     aw.Writer = &AiffWriter{AudioFile: audioFile}
     aw.fileType = TYPE_AIFF
   case TYPE_WAVE:
-    aw.Writer = &WaveWriter{AudioFile: audioFile}
+    aw.Writer = &WaveWriter{pcmWriter{AudioFile: audioFile}}
     aw.fileType = TYPE_WAVE
+  case TYPE_FLAC:
+    aw.Writer = &FlacWriter{AudioFile: audioFile}
+    aw.fileType = TYPE_FLAC
+  case TYPE_W64:
+    aw.Writer = &W64Writer{pcmWriter{AudioFile: audioFile}}
+    aw.fileType = TYPE_W64
+  case TYPE_CAF:
+    aw.Writer = &CafWriter{pcmWriter{AudioFile: audioFile}}
+    aw.fileType = TYPE_CAF
+  case TYPE_RAW:
+    aw.Writer = &RawWriter{pcmWriter{AudioFile: audioFile}}
+    aw.fileType = TYPE_RAW
+  case TYPE_NPY:
+    aw.Writer = &NpyWriter{pcmWriter{AudioFile: audioFile}}
+    aw.fileType = TYPE_NPY
   default:
     return nil, fmt.Errorf("AudioWriter doesn't implement filetype %d", fileType)
   }
@@ -202,14 +477,157 @@ func (aw *AudioWriter) Close() {
   aw.Writer.Close()
 }
 
+// sets the metadata tags (name and value) written by formats that have them,
+// call before Create
+func (aw *AudioWriter) SetTags(tags [][2]string) {
+  switch writer := aw.Writer.(type) {
+  case *FlacWriter:
+    writer.Tags = tags
+  }
+}
+
 func (aw *AudioWriter) ZeroWriteBuffer() {
   aw.Writer.ZeroWriteBuffer()
 }
 
 func (aw *AudioWriter) InterleaveChannel(channel int, data []int) error {
-  return aw.Writer.InterleaveChannel(channel, data)
+  return aw.Writer.InterleaveChannel(channel, aw.shiftSamples(data))
+}
+
+// writes interleaved samples at the bit depth the writer was made with
+func (aw *AudioWriter) Write(buffer *audio.IntBuffer) error {
+  if aw.shift != 0 {
+    buffer = &audio.IntBuffer{
+      Format: buffer.Format,
+      Data: aw.shiftSamples(buffer.Data),
+      SourceBitDepth: buffer.SourceBitDepth + aw.shift,
+    }
+  }
+
+  return aw.Writer.Write(buffer)
+}
+
+// the samples at the bit depth written, shifted down ones are rounded
+func (aw *AudioWriter) shiftSamples(data []int) []int {
+  if aw.shift == 0 {
+    return data
+  }
+
+  if cap(aw.shifted) < len(data) {
+    aw.shifted = make([]int, len(data), len(data))
+  }
+
+  shifted := aw.shifted[:len(data)]
+
+  for i, sample := range data {
+    if aw.shift > 0 {
+      shifted[i] = sample << uint(aw.shift)
+    } else {
+      shifted[i] = (sample + 1 << uint(-aw.shift - 1)) >> uint(-aw.shift)
+    }
+  }
+
+  return shifted
 }
 
 func (aw *AudioWriter) WriteNext() error {
   return aw.Writer.WriteNext()
 }
+
+// WriteSignals creates the audio file and writes whole signals (one per
+// channel, all the same length) to it, samples are rounded to integers and
+// clipped by the writer. format is passed to NewAudioWriter
+func WriteSignals(audioFile AudioFile, format OutputFormat, signals [][]float64) error {
+  if len(signals) != audioFile.NumChans {
+    return fmt.Errorf("Got %d signals for %d channels", len(signals), audioFile.NumChans)
+  }
+
+  length := 0
+  if len(signals) > 0 {
+    length = len(signals[0])
+  }
+
+  audioWriter, err := NewAudioWriter(audioFile, format)
+
+  if err != nil {
+    return err
+  }
+
+  if err = audioWriter.Create(length); err != nil {
+    return err
+  }
+
+  defer audioWriter.Close()
+
+  data := make([]int, length, length)
+
+  for c, signal := range signals {
+    if len(signal) != length {
+      return fmt.Errorf("Signal for channel %d has %d samples, expected %d", c, len(signal), length)
+    }
+
+    for i, sample := range signal {
+      data[i] = int(math.Round(sample))
+    }
+
+    if err = audioWriter.InterleaveChannel(c, data); err != nil {
+      return err
+    }
+  }
+
+  return audioWriter.WriteNext()
+}
+
+// ReadSignals reads a whole audio file into signals (one per channel), along
+// with the file's format, format is passed to NewAudioReader
+func ReadSignals(filePath string, format InputFormat) ([][]float64, AudioFile, error) {
+  audioReader, err := NewAudioReader(filePath, format)
+
+  if err != nil {
+    return nil, AudioFile{}, err
+  }
+
+  if err = audioReader.Open(readSignalsBufferLength); err != nil {
+    return nil, AudioFile{}, err
+  }
+
+  defer audioReader.Close()
+
+  audioFile := AudioFile{
+    Filepath: filePath,
+    NumChans: audioReader.GetNumChans(),
+    SampleRate: audioReader.GetSampleRate(),
+    BitDepth: audioReader.GetBitDepth(),
+  }
+
+  signals := make([][]float64, audioFile.NumChans, audioFile.NumChans)
+  for c := 0; c < audioFile.NumChans; c++ {
+    signals[c] = make([]float64, 0, audioReader.GetNumSampleFrames())
+  }
+
+  for {
+    _, framesRead, err := audioReader.ReadNext()
+
+    if err != nil {
+      return nil, AudioFile{}, err
+    }
+
+    if framesRead == 0 {
+      break
+    }
+
+    for c := 0; c < audioFile.NumChans; c++ {
+      channelBuffer, err := audioReader.ExtractChannel(c)
+
+      if err != nil {
+        return nil, AudioFile{}, err
+      }
+
+      for _, sample := range channelBuffer.Data[:framesRead] {
+        signals[c] = append(signals[c], float64(sample))
+      }
+    }
+  }
+
+  return signals, audioFile, nil
+}
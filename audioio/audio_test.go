@@ -1,7 +1,14 @@
 package audioio
 
 import(
+  "bytes"
+  "encoding/binary"
+  "io"
+  "math"
+  "os"
+  "path/filepath"
   "testing"
+  "github.com/go-audio/audio"
   . "gopvoc/testing_utilities"
 )
 
@@ -84,3 +91,876 @@ func TestReturnFileTypeFromExtension_INVALID(t *testing.T) {
     "Error was incorrect",
   )
 }
+
+func TestOutputFileType(t *testing.T) {
+  fileType, err := OutputFileType("out.Wave")
+  Ok(t, err)
+  Equals(t, TYPE_WAVE, fileType)
+
+  _, err = OutputFileType("out.mp3")
+  Assert(t, err != nil, "mp3 output should error")
+  Equals(t, "", OutputExtension(TYPE_MP3))
+  Equals(t, ".aif", OutputExtension(TYPE_AIFF))
+
+  // the format's type wins over the extension
+  path := filepath.Join(t.TempDir(), "out.dat")
+  fileType, err = ParseOutputFormat("w64")
+  Ok(t, err)
+  Ok(t, WriteSignals(AudioFile{Filepath: path, NumChans: 1, SampleRate: 44100, BitDepth: 16}, OutputFormat{FileType: fileType}, [][]float64{{1, 2, 3}}))
+
+  _, err = NewAudioWriter(AudioFile{Filepath: path, NumChans: 1, SampleRate: 44100, BitDepth: 16}, OutputFormat{})
+  Assert(t, err != nil, "the zero format should take the type from the extension")
+
+  fileType, err = returnFileType(path)
+  Ok(t, err)
+  Equals(t, TYPE_W64, fileType)
+}
+
+func TestFlacRoundTrip(t *testing.T) {
+  tags := [][2]string{{"TITLE", "Sine"}, {"ARTIST", "gopvoc"}}
+
+  for _, bitDepth := range []int{8, 16, 24} {
+    // longer than a FLAC frame, with a shorter last frame
+    length := 10000
+    maxSampleValue := float64(IntMaxSignedValue[bitDepth])
+    signals := [][]float64{make([]float64, length), make([]float64, length), make([]float64, length)}
+
+    for i := 0; i < length; i++ {
+      signals[0][i] = math.Round(0.5 * maxSampleValue * math.Sin(float64(i) * 0.01))
+      signals[1][i] = math.Round(0.25 * maxSampleValue * math.Sin(float64(i) * 0.3))
+      // channel 2 is silent
+    }
+
+    path := filepath.Join(t.TempDir(), "sine.flac")
+    audioFile := AudioFile{Filepath: path, NumChans: 3, SampleRate: 44100, BitDepth: bitDepth}
+
+    audioWriter, err := NewAudioWriter(audioFile, OutputFormat{})
+    Ok(t, err)
+    audioWriter.SetTags(tags)
+    Ok(t, audioWriter.Create(length))
+
+    for c, signal := range signals {
+      data := make([]int, length)
+      for i, sample := range signal {
+        data[i] = int(sample)
+      }
+      Ok(t, audioWriter.InterleaveChannel(c, data))
+    }
+
+    Ok(t, audioWriter.WriteNext())
+    audioWriter.Close()
+
+    fileType, err := returnFileType(path)
+    Ok(t, err)
+    Equals(t, TYPE_FLAC, fileType)
+
+    read, readFile, err := ReadSignals(path, InputFormat{})
+    Ok(t, err)
+    Equals(t, audioFile, readFile)
+    Equals(t, signals, read)
+
+    audioReader, err := NewAudioReader(path, InputFormat{})
+    Ok(t, err)
+    Ok(t, audioReader.Open(100))
+    Equals(t, tags, audioReader.GetTags())
+    Equals(t, length, audioReader.GetNumSampleFrames())
+
+    // into the second frame, then to the end
+    Ok(t, audioReader.Seek(5000))
+    _, numFrames, err := audioReader.ReadNext()
+    Ok(t, err)
+    Equals(t, 100, numFrames)
+
+    channel, err := audioReader.ExtractChannel(1)
+    Ok(t, err)
+    Equals(t, int(signals[1][5000]), channel.Data[0])
+    Equals(t, int(signals[1][5099]), channel.Data[99])
+
+    Ok(t, audioReader.Seek(length))
+    _, numFrames, err = audioReader.ReadNext()
+    Ok(t, err)
+    Equals(t, 0, numFrames)
+    audioReader.Close()
+  }
+
+  // FLAC has no 32 bit samples, they are rounded to 24 bit
+  samples := make([]float64, 100)
+  copy(samples, []float64{0, 256, -512, 383, 2147483647})
+
+  path := filepath.Join(t.TempDir(), "sine.flac")
+  Ok(t, WriteSignals(AudioFile{Filepath: path, NumChans: 1, SampleRate: 44100, BitDepth: 32}, OutputFormat{}, [][]float64{samples}))
+
+  read, readFile, err := ReadSignals(path, InputFormat{})
+  Ok(t, err)
+  Equals(t, 24, readFile.BitDepth)
+  Equals(t, []float64{0, 1, -2, 1, 8388607}, read[0][:5])
+}
+
+func TestPcmRoundTrip(t *testing.T) {
+  formats := map[string]int{".aif": TYPE_AIFF, ".wav": TYPE_WAVE, ".w64": TYPE_W64, ".caf": TYPE_CAF}
+
+  for extension, expectedType := range formats {
+    for _, bitDepth := range []int{8, 16, 24, 32} {
+      length := 1000
+      maxSampleValue := float64(IntMaxSignedValue[bitDepth])
+      signals := [][]float64{make([]float64, length), make([]float64, length), make([]float64, length)}
+
+      for i := 0; i < length; i++ {
+        signals[0][i] = math.Round(maxSampleValue * math.Sin(float64(i) * 0.01))
+        signals[1][i] = math.Round(-0.25 * maxSampleValue * math.Sin(float64(i) * 0.3))
+        // channel 2 is silent
+      }
+
+      path := filepath.Join(t.TempDir(), "sine" + extension)
+      audioFile := AudioFile{Filepath: path, NumChans: 3, SampleRate: 48000, BitDepth: bitDepth}
+      Ok(t, WriteSignals(audioFile, OutputFormat{}, signals))
+
+      fileType, err := returnFileType(path)
+      Ok(t, err)
+      Equals(t, expectedType, fileType)
+
+      read, readFile, err := ReadSignals(path, InputFormat{})
+      Ok(t, err)
+      Equals(t, audioFile, readFile)
+      Equals(t, signals, read)
+
+      audioReader, err := NewAudioReader(path, InputFormat{})
+      Ok(t, err)
+      Ok(t, audioReader.Open(100))
+      Ok(t, audioReader.Seek(950))
+      _, numFrames, err := audioReader.ReadNext()
+      Ok(t, err)
+      Equals(t, 50, numFrames)
+
+      channel, err := audioReader.ExtractChannel(1)
+      Ok(t, err)
+      Equals(t, int(signals[1][950]), channel.Data[0])
+      Equals(t, 0, channel.Data[50])
+      audioReader.Close()
+    }
+  }
+}
+
+func TestTruncatedHeader(t *testing.T) {
+  signals := [][]float64{{1, 2, 3, 4}}
+
+  for _, extension := range []string{".aif", ".wav", ".w64", ".caf", ".npy"} {
+    path := filepath.Join(t.TempDir(), "truncated" + extension)
+    Ok(t, WriteSignals(AudioFile{Filepath: path, NumChans: 1, SampleRate: 44100, BitDepth: 16}, OutputFormat{}, signals))
+
+    // the magic bytes are there, the rest of the header isn't
+    data, err := os.ReadFile(path)
+    Ok(t, err)
+    Ok(t, os.WriteFile(path, data[:24], 0644))
+
+    audioReader, err := NewAudioReader(path, InputFormat{})
+    Ok(t, err)
+    Assert(t, audioReader.Open(16) != nil, "a truncated %s header should error", extension)
+
+    var file *os.File
+    switch reader := audioReader.Reader.(type) {
+    case *AiffReader:
+      file = reader.fileIo
+    case *WaveReader:
+      file = reader.fileIo
+    case *W64Reader:
+      file = reader.fileIo
+    case *CafReader:
+      file = reader.fileIo
+    case *NpyReader:
+      file = reader.fileIo
+    }
+
+    Assert(t, file != nil && file.Close() != nil, "the truncated %s file is left open", extension)
+  }
+}
+
+func TestRange(t *testing.T) {
+  positions := map[string]Position{
+    "1.5": {Seconds: 1.5},
+    "72000smp": {Frames: 72000, InFrames: true},
+    "01:02.5": {Seconds: 62.5},
+    "1:00:00": {Seconds: 3600},
+  }
+
+  for text, expected := range positions {
+    position, err := ParsePosition(text)
+    Ok(t, err)
+    Equals(t, expected, position)
+  }
+
+  for _, text := range []string{"", "-1", "1.5smp", "x", "1:60", "1:2:3:4"} {
+    _, err := ParsePosition(text)
+    Assert(t, err != nil, "position %q should error", text)
+  }
+
+  Equals(t, 66150, Position{Seconds: 1.5}.Frame(44100))
+  Equals(t, 100, Position{Frames: 100, InFrames: true}.Frame(44100))
+
+  signal := make([]float64, 1000)
+  for i := range signal {
+    signal[i] = float64(i)
+  }
+
+  path := filepath.Join(t.TempDir(), "ramp.wav")
+  Ok(t, WriteSignals(AudioFile{Filepath: path, NumChans: 1, SampleRate: 44100, BitDepth: 16}, OutputFormat{}, [][]float64{signal}))
+
+  audioReader, err := NewAudioReader(path, InputFormat{})
+  Ok(t, err)
+  Ok(t, audioReader.Open(64))
+  Assert(t, audioReader.SetRange(500, 1001) != nil, "range past the end should error")
+  Ok(t, audioReader.SetRange(300, 400))
+  Equals(t, 100, audioReader.GetNumSampleFrames())
+
+  _, numFrames, err := audioReader.ReadNext()
+  Ok(t, err)
+  Equals(t, 64, numFrames)
+  channel, err := audioReader.ExtractChannel(0)
+  Ok(t, err)
+  Equals(t, 300, channel.Data[0])
+
+  // the second read stops at the end of the range, followed by silence
+  _, numFrames, err = audioReader.ReadNext()
+  Ok(t, err)
+  Equals(t, 36, numFrames)
+  channel, err = audioReader.ExtractChannel(0)
+  Ok(t, err)
+  Equals(t, 399, channel.Data[35])
+  Equals(t, 0, channel.Data[36])
+
+  _, numFrames, err = audioReader.ReadNext()
+  Ok(t, err)
+  Equals(t, 0, numFrames)
+
+  // seeking is relative to the start of the range
+  Ok(t, audioReader.Seek(50))
+  _, _, err = audioReader.ReadNext()
+  Ok(t, err)
+  channel, err = audioReader.ExtractChannel(0)
+  Ok(t, err)
+  Equals(t, 350, channel.Data[0])
+  audioReader.Close()
+}
+
+func TestChannelRouting(t *testing.T) {
+  channels, err := ParseChannels("1,3-4")
+  Ok(t, err)
+  Equals(t, []int{0, 2, 3}, channels)
+
+  for _, text := range []string{"", "0", "2-1", "1,1", "a"} {
+    _, err := ParseChannels(text)
+    Assert(t, err != nil, "channels %q should error", text)
+  }
+
+  mix, err := ParseMix("0.5,0.5;1,0")
+  Ok(t, err)
+  Equals(t, [][]float64{{0.5, 0.5}, {1, 0}}, mix.Rows)
+
+  _, err = ParseMix("1,0;1")
+  Assert(t, err != nil, "rows of different lengths should error")
+
+  // three channels summed into two, the first and third to the left
+  stereo, err := Mix{Name: "stereo"}.matrix(3)
+  Ok(t, err)
+  Equals(t, [][]float64{{0.5, 0, 0.5}, {0, 1, 0}}, stereo)
+
+  // the second of three channels processed, the others passed through
+  routing, err := NewChannelRouting(3, nil, []int{1}, false, true)
+  Ok(t, err)
+  Equals(t, [][]float64{{0, 1, 0}}, routing.Encode)
+  Equals(t, [][]float64{{0}, {1}, {0}}, routing.Decode)
+  Equals(t, [][]float64{{1, 0, 0}, {0, 0, 0}, {0, 0, 1}}, routing.Pass)
+  Assert(t, routing.Passes(), "channels should be passed through")
+
+  // dropped instead
+  routing, err = NewChannelRouting(3, nil, []int{1}, false, false)
+  Ok(t, err)
+  Equals(t, [][]float64{{1}}, routing.Decode)
+  Assert(t, !routing.Passes(), "no channels should be passed through")
+
+  // mid and side decode to left and right again
+  routing, err = NewChannelRouting(2, nil, nil, true, false)
+  Ok(t, err)
+  Equals(t, [][]float64{{0.5, 0.5}, {0.5, -0.5}}, routing.Encode)
+  signals := [][]float64{{1000, -200}, {600, 400}}
+  Equals(t, signals, MixSignals(routing.Decode, MixSignals(routing.Encode, signals)))
+
+  _, err = NewChannelRouting(3, nil, nil, true, false)
+  Assert(t, err != nil, "mid/side of 3 channels should error")
+
+  _, err = NewChannelRouting(2, nil, []int{2}, false, false)
+  Assert(t, err != nil, "a channel past the last should error")
+
+  _, err = NewChannelRouting(3, &mix, nil, false, false)
+  Assert(t, err != nil, "a mix of 2 channels for 3 should error")
+
+  // a stereo file read as mono
+  path := filepath.Join(t.TempDir(), "stereo.wav")
+  Ok(t, WriteSignals(AudioFile{Filepath: path, NumChans: 2, SampleRate: 44100, BitDepth: 16}, OutputFormat{}, [][]float64{{100, 200}, {300, -200}}))
+
+  audioReader, err := NewAudioReader(path, InputFormat{})
+  Ok(t, err)
+  Ok(t, audioReader.Open(64))
+  Assert(t, audioReader.SetChannels([][]float64{{1}}) != nil, "a row for 1 channel should error")
+  Ok(t, audioReader.SetChannels([][]float64{{0.5, 0.5}}))
+  Equals(t, 1, audioReader.GetNumChans())
+
+  _, _, err = audioReader.ReadNext()
+  Ok(t, err)
+  channel, err := audioReader.ExtractChannel(0)
+  Ok(t, err)
+  Equals(t, []int{200, 0}, channel.Data[:2])
+  audioReader.Close()
+}
+
+func TestSplitFiles(t *testing.T) {
+  dir := t.TempDir()
+  mono := func(path string, signal []float64) {
+    Ok(t, WriteSignals(AudioFile{Filepath: path, NumChans: 1, SampleRate: 44100, BitDepth: 16}, OutputFormat{}, [][]float64{signal}))
+  }
+
+  Equals(t, []string{filepath.Join(dir, "stem.L.wav"), filepath.Join(dir, "stem.R.wav")}, SplitPaths(filepath.Join(dir, "stem.wav"), []string{"L", "R"}))
+
+  names, err := ParseSplitNames("L,R,C")
+  Ok(t, err)
+  Equals(t, []string{"L", "R", "C"}, names)
+
+  for _, text := range []string{"L,,R", "L,L", "a/b"} {
+    _, err := ParseSplitNames(text)
+    Assert(t, err != nil, "split names %q should error", text)
+  }
+
+  mono(filepath.Join(dir, "stem.L.wav"), []float64{1, 2, 3})
+  mono(filepath.Join(dir, "stem.R.wav"), []float64{-1, -2, -3})
+  stemPath := filepath.Join(dir, "stem.wav")
+  stemFormat := InputFormat{SplitNames: []string{"L", "R"}}
+  Equals(t, SplitPaths(stemPath, []string{"L", "R"}), InputPaths(stemPath, stemFormat))
+  Equals(t, []string{stemPath}, InputPaths(stemPath, InputFormat{}))
+
+  signals, audioFile, err := ReadSignals(stemPath, stemFormat)
+  Ok(t, err)
+  Equals(t, 2, audioFile.NumChans)
+  Equals(t, [][]float64{{1, 2, 3}, {-1, -2, -3}}, signals)
+
+  // the files must be mono and the same length
+  mono(filepath.Join(dir, "mixed.L.wav"), []float64{1, 2, 3})
+  mono(filepath.Join(dir, "mixed.R.wav"), []float64{1, 2})
+  _, _, err = ReadSignals(filepath.Join(dir, "mixed.wav"), stemFormat)
+  Assert(t, err != nil, "split files of different lengths should error")
+
+  Ok(t, WriteSignals(AudioFile{Filepath: filepath.Join(dir, "stereo.stem.wav"), NumChans: 2, SampleRate: 44100, BitDepth: 16}, OutputFormat{}, signals))
+  _, _, err = ReadSignals(filepath.Join(dir, "stereo.wav"), InputFormat{SplitNames: []string{"stem"}})
+  Assert(t, err != nil, "a split file with 2 channels should error")
+
+  // written back as a file per channel, numbered without names
+  outputPath := filepath.Join(dir, "out.aif")
+  Ok(t, WriteSignals(AudioFile{Filepath: outputPath, NumChans: 2, SampleRate: 44100, BitDepth: 16}, OutputFormat{Split: true}, signals))
+
+  for c, path := range SplitPaths(outputPath, []string{"1", "2"}) {
+    channel, audioFile, err := ReadSignals(path, InputFormat{})
+    Ok(t, err)
+    Equals(t, 1, audioFile.NumChans)
+    Equals(t, signals[c], channel[0])
+  }
+
+  // and read back together with the names they were written with
+  outputFile := AudioFile{Filepath: outputPath, NumChans: 2, SampleRate: 44100, BitDepth: 16}
+  format, err := OutputFormat{Split: true}.InputFormat(outputFile)
+  Ok(t, err)
+  Equals(t, []string{"1", "2"}, format.SplitNames)
+
+  readBack, _, err := ReadSignals(outputPath, format)
+  Ok(t, err)
+  Equals(t, signals, readBack)
+
+  rawPath := filepath.Join(dir, "out.raw")
+  rawFile := AudioFile{Filepath: rawPath, NumChans: 2, SampleRate: 44100, BitDepth: 16}
+  rawFormat := OutputFormat{Split: true, SplitNames: []string{"L", "R"}}
+  Ok(t, WriteSignals(rawFile, rawFormat, signals))
+
+  format, err = rawFormat.InputFormat(rawFile)
+  Ok(t, err)
+  Equals(t, []string{"L", "R"}, format.SplitNames)
+
+  readBack, _, err = ReadSignals(rawPath, format)
+  Ok(t, err)
+  Equals(t, signals, readBack)
+}
+
+func TestAifcReader(t *testing.T) {
+  samples := []int16{0, 1000, -1000, 32767, -32768, 12345}
+
+  // 2 channels of 16 bit samples in a little endian (sowt) AIFC file
+  aifc := func(compression string) []byte {
+    comm := &bytes.Buffer{}
+    binary.Write(comm, binary.BigEndian, int16(2))
+    binary.Write(comm, binary.BigEndian, uint32(len(samples) / 2))
+    binary.Write(comm, binary.BigEndian, int16(16))
+    sampleRate := audio.IntToIEEEFloat(44100)
+    comm.Write(sampleRate[:])
+    comm.WriteString(compression + "\x00\x00")
+
+    ssnd := &bytes.Buffer{}
+    binary.Write(ssnd, binary.BigEndian, []uint32{0, 0})
+    binary.Write(ssnd, binary.LittleEndian, samples)
+
+    file := &bytes.Buffer{}
+    file.WriteString("FORM")
+    binary.Write(file, binary.BigEndian, uint32(4 + 8 + comm.Len() + 8 + ssnd.Len()))
+    file.WriteString("AIFCCOMM")
+    binary.Write(file, binary.BigEndian, uint32(comm.Len()))
+    file.Write(comm.Bytes())
+    file.WriteString("SSND")
+    binary.Write(file, binary.BigEndian, uint32(ssnd.Len()))
+    file.Write(ssnd.Bytes())
+
+    return file.Bytes()
+  }
+
+  path := filepath.Join(t.TempDir(), "sowt.aifc")
+  Ok(t, os.WriteFile(path, aifc("sowt"), 0644))
+
+  fileType, err := returnFileType(path)
+  Ok(t, err)
+  Equals(t, TYPE_AIFF, fileType)
+
+  signals, audioFile, err := ReadSignals(path, InputFormat{})
+  Ok(t, err)
+  Equals(t, AudioFile{Filepath: path, NumChans: 2, SampleRate: 44100, BitDepth: 16}, audioFile)
+  Equals(t, [][]float64{{0, -1000, -32768}, {1000, 32767, 12345}}, signals)
+
+  floatPath := filepath.Join(t.TempDir(), "fl32.aifc")
+  Ok(t, os.WriteFile(floatPath, aifc("fl32"), 0644))
+
+  audioReader, err := NewAudioReader(floatPath, InputFormat{})
+  Ok(t, err)
+  Assert(t, audioReader.Open(100) != nil, "AIFC fl32 should error")
+  audioReader.Close()
+}
+
+func TestUnusualBitDepths(t *testing.T) {
+  // a mono WAV file of the fmt chunk and the sample bytes
+  wave := func(formatTag, bitDepth, blockAlign, validBits int, data []byte) []byte {
+    fmtChunk := &bytes.Buffer{}
+    binary.Write(fmtChunk, binary.LittleEndian, []uint16{uint16(formatTag), 1})
+    binary.Write(fmtChunk, binary.LittleEndian, []uint32{48000, uint32(48000 * blockAlign)})
+    binary.Write(fmtChunk, binary.LittleEndian, []uint16{uint16(blockAlign), uint16(bitDepth)})
+
+    if formatTag == waveFormatExtensible {
+      binary.Write(fmtChunk, binary.LittleEndian, []uint16{22, uint16(validBits)})
+      binary.Write(fmtChunk, binary.LittleEndian, uint32(4))
+      binary.Write(fmtChunk, binary.LittleEndian, []uint16{waveFormatPCM})
+      fmtChunk.Write(make([]byte, 14))
+    }
+
+    file := &bytes.Buffer{}
+    file.WriteString("RIFF")
+    binary.Write(file, binary.LittleEndian, uint32(4 + 8 + fmtChunk.Len() + 8 + len(data)))
+    file.WriteString("WAVEfmt ")
+    binary.Write(file, binary.LittleEndian, uint32(fmtChunk.Len()))
+    file.Write(fmtChunk.Bytes())
+    file.WriteString("data")
+    binary.Write(file, binary.LittleEndian, uint32(len(data)))
+    file.Write(data)
+
+    return file.Bytes()
+  }
+
+  files := []struct {
+    name string
+    contents []byte
+    bitDepth int
+    samples []float64
+  }{
+    // 8 bit WAV samples are unsigned, 128 is silence
+    {"unsigned.wav", wave(waveFormatPCM, 8, 1, 0, []byte{128, 255, 0, 129}), 8, []float64{0, 127, -128, 1}},
+    // 12 bit samples in the high bits of 2 bytes
+    {"12bit.wav", wave(waveFormatPCM, 12, 2, 0, []byte{0x00, 0x00, 0xf0, 0x7f, 0x00, 0x80, 0x40, 0x06}), 12, []float64{0, 2047, -2048, 100}},
+    {"20bit.wav", wave(waveFormatPCM, 20, 3, 0, []byte{0x00, 0x00, 0x00, 0xf0, 0xff, 0x7f, 0x00, 0x00, 0x80, 0x50, 0x00, 0x00}), 20, []float64{0, 524287, -524288, 5}},
+    // 20 valid bits of 24
+    {"extensible.wav", wave(waveFormatExtensible, 24, 3, 20, []byte{0x00, 0x00, 0x00, 0xf0, 0xff, 0x7f, 0x00, 0x00, 0x80, 0x50, 0x00, 0x00}), 20, []float64{0, 524287, -524288, 5}},
+  }
+
+  for _, file := range files {
+    path := filepath.Join(t.TempDir(), file.name)
+    Ok(t, os.WriteFile(path, file.contents, 0644))
+
+    read, readFile, err := ReadSignals(path, InputFormat{})
+    Ok(t, err)
+    Equals(t, AudioFile{Filepath: path, NumChans: 1, SampleRate: 48000, BitDepth: file.bitDepth}, readFile)
+    Equals(t, [][]float64{file.samples}, read)
+  }
+
+  // 12 bit AIFF samples are in the high bits too
+  aiff := &bytes.Buffer{}
+  aiff.WriteString("FORM")
+  binary.Write(aiff, binary.BigEndian, uint32(4 + 8 + 18 + 8 + 8 + 6))
+  aiff.WriteString("AIFFCOMM")
+  binary.Write(aiff, binary.BigEndian, uint32(18))
+  binary.Write(aiff, binary.BigEndian, int16(1))
+  binary.Write(aiff, binary.BigEndian, uint32(3))
+  binary.Write(aiff, binary.BigEndian, int16(12))
+  sampleRate := audio.IntToIEEEFloat(44100)
+  aiff.Write(sampleRate[:])
+  aiff.WriteString("SSND")
+  binary.Write(aiff, binary.BigEndian, []uint32{8 + 6, 0, 0})
+  binary.Write(aiff, binary.BigEndian, []int16{2047 << 4, -2047 << 4, -100 << 4})
+
+  aiffPath := filepath.Join(t.TempDir(), "12bit.aif")
+  Ok(t, os.WriteFile(aiffPath, aiff.Bytes(), 0644))
+
+  read, readFile, err := ReadSignals(aiffPath, InputFormat{})
+  Ok(t, err)
+  Equals(t, 12, readFile.BitDepth)
+  Equals(t, [][]float64{{2047, -2047, -100}}, read)
+
+  // written at the next bit depth the format has
+  for _, extension := range []string{".aif", ".wav", ".caf"} {
+    path := filepath.Join(t.TempDir(), "12bit" + extension)
+    readFile.Filepath = path
+    Ok(t, WriteSignals(readFile, OutputFormat{}, read))
+
+    written, writtenFile, err := ReadSignals(path, InputFormat{})
+    Ok(t, err)
+    Equals(t, 16, writtenFile.BitDepth)
+    Equals(t, [][]float64{{2047 << 4, -2047 << 4, -100 << 4}}, written)
+  }
+
+  // 8 bit WAV output is unsigned
+  unsignedPath := filepath.Join(t.TempDir(), "out.wav")
+  Ok(t, WriteSignals(AudioFile{Filepath: unsignedPath, NumChans: 1, SampleRate: 48000, BitDepth: 8}, OutputFormat{}, [][]float64{{0, 127, -127, 1}}))
+  contents, err := os.ReadFile(unsignedPath)
+  Ok(t, err)
+  Equals(t, []byte{128, 255, 1, 129}, contents[len(contents) - 4:])
+
+  capabilities, ok := Capabilities(TYPE_FLAC)
+  Assert(t, ok, "FLAC should have capabilities")
+  Equals(t, "8, 16 or 24", capabilities.BitDepthsString())
+  Equals(t, 24, capabilities.WriteBitDepth(20))
+  Equals(t, 24, capabilities.WriteBitDepth(32))
+  Ok(t, capabilities.CheckSampleRate(96000))
+  Ok(t, capabilities.CheckSampleRate(352800))
+  Assert(t, capabilities.CheckSampleRate(352801) != nil, "FLAC can't store 352801 Hz")
+  Assert(t, capabilities.CheckSampleRate(705600) != nil, "FLAC can't store 705600 Hz")
+
+  _, ok = Capabilities(TYPE_MP3)
+  Assert(t, !ok, "MP3 is only read")
+
+  _, err = NewAudioWriter(AudioFile{Filepath: "out.flac", NumChans: 1, SampleRate: 705600, BitDepth: 16}, OutputFormat{})
+  Assert(t, err != nil, "705600 Hz FLAC should error")
+
+  // input sample rates gopvoc doesn't process
+  for _, sampleRate := range []int{500, 1000000} {
+    path := filepath.Join(t.TempDir(), "rate.raw")
+    Ok(t, os.WriteFile(path, make([]byte, 100), 0644))
+    _, _, err = ReadSignals(path, InputFormat{FileType: TYPE_RAW, Encoding: "s16le", SampleRate: sampleRate, NumChans: 1})
+    Assert(t, err != nil, "a sample rate of %d Hz should error", sampleRate)
+  }
+}
+
+// the pcmWriter under an AudioWriter, for growing files without writing
+// every sample
+func testPcmWriter(audioWriter *AudioWriter) *pcmWriter {
+  switch writer := audioWriter.Writer.(type) {
+  case *WaveWriter:
+    return &writer.pcmWriter
+  case *W64Writer:
+    return &writer.pcmWriter
+  case *CafWriter:
+    return &writer.pcmWriter
+  }
+
+  return nil
+}
+
+// writes a buffer, skips size bytes of silence as a hole in a sparse file,
+// then writes a second buffer. Returns the number of frames
+func writeSparseFile(t *testing.T, audioFile AudioFile, first, last []int, skip int64) int {
+  audioWriter, err := NewAudioWriter(audioFile, OutputFormat{})
+  Ok(t, err)
+  Ok(t, audioWriter.Create(len(first) / audioFile.NumChans))
+  pw := testPcmWriter(audioWriter)
+
+  Ok(t, pw.Write(&audio.IntBuffer{Data: first}))
+  Ok(t, pw.writer.Flush())
+  _, err = pw.fileIo.Seek(skip, io.SeekCurrent)
+  Ok(t, err)
+  pw.dataSize += skip
+  Ok(t, pw.Write(&audio.IntBuffer{Data: last}))
+  audioWriter.Close()
+
+  return int(pw.dataSize) / (audioFile.BitDepth / 8 * audioFile.NumChans)
+}
+
+func TestLargeFileBoundary(t *testing.T) {
+  first := []int{1, -1, 2, -2, 3, -3, 4, -4}
+  last := []int{5, -5, 6, -6, 7, -7, 8, -8}
+  blockAlign := int64(4) // 2 channels of 16 bit samples
+
+  // the header before the samples is 80 bytes, 72 of them count towards
+  // the RIFF size
+  largestRiff := (riffMaxSize - 72) / blockAlign * blockAlign
+  skips := map[string]int64{
+    "riff.wav": largestRiff - 32,
+    "rf64.wav": largestRiff - 32 + blockAlign,
+    "large.w64": largestRiff,
+    "large.caf": largestRiff,
+  }
+  magicBytes := map[string]string{
+    "riff.wav": "RIFF",
+    "rf64.wav": "RF64",
+    "large.w64": string(w64RiffGUID[:4]),
+    "large.caf": "caff",
+  }
+
+  for name, skip := range skips {
+    path := filepath.Join(t.TempDir(), name)
+    audioFile := AudioFile{Filepath: path, NumChans: 2, SampleRate: 44100, BitDepth: 16}
+    numFrames := writeSparseFile(t, audioFile, first, last, skip)
+
+    fileIo, err := os.Open(path)
+    Ok(t, err)
+    header := make([]byte, 4)
+    _, err = io.ReadFull(fileIo, header)
+    Ok(t, err)
+    fileIo.Close()
+    Equals(t, magicBytes[name], string(header))
+
+    audioReader, err := NewAudioReader(path, InputFormat{})
+    Ok(t, err)
+    Ok(t, audioReader.Open(4))
+    Equals(t, numFrames, audioReader.GetNumSampleFrames())
+
+    _, _, err = audioReader.ReadNext()
+    Ok(t, err)
+    channel, err := audioReader.ExtractChannel(1)
+    Ok(t, err)
+    Equals(t, []int{-1, -2, -3, -4}, channel.Data)
+
+    Ok(t, audioReader.Seek(numFrames - 4))
+    _, n, err := audioReader.ReadNext()
+    Ok(t, err)
+    Equals(t, 4, n)
+    channel, err = audioReader.ExtractChannel(0)
+    Ok(t, err)
+    Equals(t, []int{5, 6, 7, 8}, channel.Data)
+    audioReader.Close()
+  }
+
+  // AIFF can't grow past its 32 bit sizes
+  path := filepath.Join(t.TempDir(), "large.aif")
+  audioWriter, err := NewAudioWriter(AudioFile{Filepath: path, NumChans: 2, SampleRate: 44100, BitDepth: 16}, OutputFormat{})
+  Ok(t, err)
+  Ok(t, audioWriter.Create(4))
+  aiffWriter := audioWriter.Writer.(*AiffWriter)
+  aiffWriter.dataSize = aiffMaxDataSize - 16
+  Ok(t, aiffWriter.Write(&audio.IntBuffer{Data: first}))
+  Assert(t, aiffWriter.Write(&audio.IntBuffer{Data: last}) != nil, "AIFF over 4 GB should error")
+  audioWriter.Close()
+}
+
+func TestRawAndNpy(t *testing.T) {
+  length := 500
+  signals := [][]float64{make([]float64, length), make([]float64, length)}
+
+  for i := 0; i < length; i++ {
+    signals[0][i] = math.Round(32767 * math.Sin(float64(i) * 0.05))
+    signals[1][i] = -signals[0][i]
+  }
+
+  // raw output is signed little endian at the bit depth
+  rawPath := filepath.Join(t.TempDir(), "sine.raw")
+  Ok(t, WriteSignals(AudioFile{Filepath: rawPath, NumChans: 2, SampleRate: 48000, BitDepth: 16}, OutputFormat{}, signals))
+
+  _, err := NewAudioReader(rawPath, InputFormat{})
+  Assert(t, err != nil, "raw input without a format should error")
+
+  format, err := ParseInputFormat("raw:s16le:48000:2")
+  Ok(t, err)
+  read, readFile, err := ReadSignals(rawPath, format)
+  Ok(t, err)
+  Equals(t, AudioFile{Filepath: rawPath, NumChans: 2, SampleRate: 48000, BitDepth: 16}, readFile)
+  Equals(t, signals, read)
+
+  // what was written is read back as it was written
+  for _, bitDepth := range []int{8, 12, 16} {
+    audioFile := AudioFile{Filepath: filepath.Join(t.TempDir(), "written.dat"), NumChans: 2, SampleRate: 22050, BitDepth: bitDepth}
+    written := OutputFormat{FileType: TYPE_RAW}
+    shifted := [][]float64{make([]float64, length), make([]float64, length)}
+
+    for c := range signals {
+      for i := range signals[c] {
+        shifted[c][i] = math.Round(signals[c][i] / math.Pow(2, float64(16 - bitDepth)))
+      }
+    }
+
+    Ok(t, WriteSignals(audioFile, written, shifted))
+    format, err = written.InputFormat(audioFile)
+    Ok(t, err)
+    read, readFile, err = ReadSignals(audioFile.Filepath, format)
+    Ok(t, err)
+    Equals(t, 2, readFile.NumChans)
+    Equals(t, 22050, readFile.SampleRate)
+
+    // 12 bit samples are written at 16 bits
+    scale := math.Pow(2, float64(readFile.BitDepth - bitDepth))
+    Equals(t, shifted[1][10] * scale, read[1][10])
+  }
+
+  format, err = OutputFormat{}.InputFormat(AudioFile{Filepath: "out.wav", NumChans: 2, SampleRate: 48000, BitDepth: 16})
+  Ok(t, err)
+  Equals(t, InputFormat{}, format)
+
+  // the same bytes as 8 bit unsigned mono
+  format, err = ParseInputFormat("raw:u8:8000:1")
+  Ok(t, err)
+  read, _, err = ReadSignals(rawPath, format)
+  Ok(t, err)
+  Equals(t, length * 4, len(read[0]))
+  Equals(t, float64(0 - 128), read[0][0])
+
+  for _, spec := range []string{"raw:s16le:48000", "raw:s20le:48000:2", "raw:s16le:0:2", "raw:s16le:48000:x", "npy", "wav:48000"} {
+    _, err = ParseInputFormat(spec)
+    Assert(t, err != nil, "input format %s should error", spec)
+  }
+
+  // .npy arrays are float32, frames x channels
+  npyPath := filepath.Join(t.TempDir(), "sine.npy")
+  Ok(t, WriteSignals(AudioFile{Filepath: npyPath, NumChans: 2, SampleRate: 44100, BitDepth: 16}, OutputFormat{}, signals))
+
+  fileType, err := returnFileType(npyPath)
+  Ok(t, err)
+  Equals(t, TYPE_NPY, fileType)
+
+  npyBytes, err := os.ReadFile(npyPath)
+  Ok(t, err)
+  Equals(t, npyHeaderLength + length * 2 * 4, len(npyBytes))
+  Equals(t, "(500, 2)", npyHeaderValue(string(npyBytes[10:npyHeaderLength]), "shape"))
+  // channel 1 of frame 10
+  Equals(t, float32(signals[1][10] / 32767), math.Float32frombits(binary.LittleEndian.Uint32(npyBytes[npyHeaderLength + 4 * 21:])))
+
+  read, readFile, err = ReadSignals(npyPath, InputFormat{})
+  Ok(t, err)
+  Equals(t, AudioFile{Filepath: npyPath, NumChans: 2, SampleRate: defaultNpySampleRate, BitDepth: 24}, readFile)
+
+  // read back at the rate it was written at
+  writtenFile := AudioFile{Filepath: filepath.Join(t.TempDir(), "written.npy"), NumChans: 2, SampleRate: 48000, BitDepth: 16}
+  Ok(t, WriteSignals(writtenFile, OutputFormat{}, signals))
+  format, err = OutputFormat{}.InputFormat(writtenFile)
+  Ok(t, err)
+  _, readFile, err = ReadSignals(writtenFile.Filepath, format)
+  Ok(t, err)
+  Equals(t, 48000, readFile.SampleRate)
+
+  for c := range signals {
+    for i := range signals[c] {
+      Assert(t, math.Abs(read[c][i] - signals[c][i] * 256) <= 256, "npy sample %d of channel %d is %g", i, c, read[c][i])
+    }
+  }
+
+  // a one dimensional array is mono, the sample rate comes from the format
+  mono := append([]byte(nil), npyBytes...)
+  copy(mono[10:], "{'descr': '<f4', 'fortran_order': False, 'shape': (1000,), }        ")
+  monoPath := filepath.Join(t.TempDir(), "mono.npy")
+  Ok(t, os.WriteFile(monoPath, mono, 0644))
+
+  format, err = ParseInputFormat("npy:16000")
+  Ok(t, err)
+  read, readFile, err = ReadSignals(monoPath, format)
+  Ok(t, err)
+  Equals(t, AudioFile{Filepath: monoPath, NumChans: 1, SampleRate: 16000, BitDepth: 24}, readFile)
+  Equals(t, 1000, len(read[0]))
+
+  copy(mono[10:], "{'descr': '<f8',")
+  Ok(t, os.WriteFile(monoPath, mono, 0644))
+  audioReader, err := NewAudioReader(monoPath, format)
+  Ok(t, err)
+  Assert(t, audioReader.Open(100) != nil, "float64 arrays should error")
+  audioReader.Close()
+}
+
+func TestMp3Reader(t *testing.T) {
+  // 40 frames of 576 samples behind an Info frame with a LAME tag, delay 576
+  // and padding 1000
+  path := "../fixtures/speech_1_chan.mp3"
+
+  fileType, err := returnFileType(path)
+  Ok(t, err)
+  Equals(t, TYPE_MP3, fileType)
+
+  tagged, audioFile, err := ReadSignals(path, InputFormat{})
+  Ok(t, err)
+  Equals(t, AudioFile{Filepath: path, NumChans: 1, SampleRate: 22050, BitDepth: 24}, audioFile)
+  Equals(t, 40 * 576 - 576 - 1000, len(tagged[0]))
+
+  // the same frames without the Info frame keep the delays
+  fileBytes, err := os.ReadFile(path)
+  Ok(t, err)
+  untaggedPath := filepath.Join(t.TempDir(), "untagged.mp3")
+  Ok(t, os.WriteFile(untaggedPath, fileBytes[156:], 0644))
+
+  untagged, _, err := ReadSignals(untaggedPath, InputFormat{})
+  Ok(t, err)
+  Equals(t, 40 * 576, len(untagged[0]))
+  Equals(t, untagged[0][576 + mp3DecoderDelay:40 * 576 - 1000 + mp3DecoderDelay], tagged[0])
+
+  audioReader, err := NewAudioReader(path, InputFormat{})
+  Ok(t, err)
+  Ok(t, audioReader.Open(100))
+  // far enough in that decoding starts at a later frame
+  Ok(t, audioReader.Seek(20000))
+  _, numFrames, err := audioReader.ReadNext()
+  Ok(t, err)
+  Equals(t, 100, numFrames)
+
+  channel, err := audioReader.ExtractChannel(0)
+  Ok(t, err)
+  Equals(t, int(tagged[0][20000]), channel.Data[0])
+  Equals(t, int(tagged[0][20099]), channel.Data[99])
+  audioReader.Close()
+}
+
+func TestVorbisReader(t *testing.T) {
+  path := "../fixtures/vorbis_1_chan.ogg"
+
+  fileType, err := returnFileType(path)
+  Ok(t, err)
+  Equals(t, TYPE_VORBIS, fileType)
+
+  signals, audioFile, err := ReadSignals(path, InputFormat{})
+  Ok(t, err)
+  Equals(t, AudioFile{Filepath: path, NumChans: 1, SampleRate: 44100, BitDepth: 24}, audioFile)
+  Equals(t, 44100, len(signals[0]))
+
+  audioReader, err := NewAudioReader(path, InputFormat{})
+  Ok(t, err)
+  Ok(t, audioReader.Open(100))
+  Equals(t, 1.0, audioReader.GetDuration())
+  Ok(t, audioReader.Seek(20000))
+  _, numFrames, err := audioReader.ReadNext()
+  Ok(t, err)
+  Equals(t, 100, numFrames)
+
+  channel, err := audioReader.ExtractChannel(0)
+  Ok(t, err)
+  Equals(t, int(signals[0][20000]), channel.Data[0])
+  Equals(t, int(signals[0][20099]), channel.Data[99])
+
+  Ok(t, audioReader.Seek(44100))
+  _, numFrames, err = audioReader.ReadNext()
+  Ok(t, err)
+  Equals(t, 0, numFrames)
+  audioReader.Close()
+
+  // Ogg streams of other codecs, such as Opus, aren't read
+  page := append([]byte("OggS"), make([]byte, 22)...)
+  page = append(page, 1, 19)
+  page = append(page, []byte("OpusHead")...)
+  page = append(page, make([]byte, 11)...)
+
+  opusPath := filepath.Join(t.TempDir(), "tone.opus")
+  Ok(t, os.WriteFile(opusPath, page, 0644))
+
+  _, err = returnFileType(opusPath)
+  Assert(t, err != nil, "Opus should error")
+}
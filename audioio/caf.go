@@ -0,0 +1,164 @@
+package audioio
+
+import(
+  "bytes"
+  "fmt"
+  "encoding/binary"
+  "errors"
+  "io"
+  "math"
+  "os"
+)
+
+// format flags of the desc chunk
+const cafFlagFloat = 1
+const cafFlagLittleEndian = 2
+
+// type and size
+const cafChunkHeaderSize = 12
+
+// Apple Core Audio Format files with integer linear PCM, the chunk sizes are
+// 64 bit. Samples are written big endian, both byte orders are read
+type CafReader struct {
+  pcmReader
+}
+
+type CafWriter struct {
+  pcmWriter
+}
+
+// bufferLength: how many frames to read at one time
+func (cr *CafReader) Open(bufferLength int) (err error) {
+  cr.fileIo, err = os.Open(cr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  // the file isn't left open when its chunks can't be read
+  defer func() {
+    if err != nil {
+      cr.fileIo.Close()
+    }
+  }()
+
+  header := make([]byte, 8)
+
+  if _, err = io.ReadFull(cr.fileIo, header); err != nil {
+    return err
+  }
+
+  if string(header[:4]) != "caff" || binary.BigEndian.Uint16(header[4:]) != 1 {
+    return errors.New("Not a CAF file")
+  }
+
+  offset := int64(8)
+  foundDesc := false
+
+  // the chunks up to the samples
+  for {
+    chunkHeader := make([]byte, cafChunkHeaderSize)
+
+    if _, err = cr.fileIo.ReadAt(chunkHeader, offset); err != nil {
+      return fmt.Errorf("CAF file has no data chunk: %v", err)
+    }
+
+    chunkType := string(chunkHeader[:4])
+    chunkSize := int64(binary.BigEndian.Uint64(chunkHeader[4:]))
+    offset += cafChunkHeaderSize
+
+    switch chunkType {
+    case "desc":
+      if err = cr.readDesc(offset); err != nil {
+        return err
+      }
+
+      foundDesc = true
+    case "data":
+      if !foundDesc {
+        return errors.New("CAF data chunk comes before the desc chunk")
+      }
+
+      // the samples follow an edit count, a size of -1 runs to the end of
+      // the file
+      if chunkSize >= 4 {
+        chunkSize -= 4
+      }
+
+      return cr.openData(bufferLength, offset + 4, chunkSize)
+    }
+
+    if chunkSize < 0 {
+      return fmt.Errorf("CAF %s chunk has an unknown size", chunkType)
+    }
+
+    offset += chunkSize
+  }
+}
+
+// reads the format of the samples from the desc chunk
+func (cr *CafReader) readDesc(offset int64) error {
+  desc := make([]byte, 32)
+
+  if _, err := cr.fileIo.ReadAt(desc, offset); err != nil {
+    return err
+  }
+
+  sampleRate := math.Float64frombits(binary.BigEndian.Uint64(desc))
+  formatID := string(desc[8:12])
+  formatFlags := binary.BigEndian.Uint32(desc[12:])
+  bytesPerPacket := binary.BigEndian.Uint32(desc[16:])
+  framesPerPacket := binary.BigEndian.Uint32(desc[20:])
+  cr.NumChans = int(binary.BigEndian.Uint32(desc[24:]))
+  cr.BitDepth = int(binary.BigEndian.Uint32(desc[28:]))
+  cr.SampleRate = int(math.Round(sampleRate))
+
+  if formatID != "lpcm" || formatFlags & cafFlagFloat != 0 {
+    return fmt.Errorf("CAF format %q is not supported, only integer linear PCM", formatID)
+  }
+
+  // one frame per packet, the samples are the same size
+  if framesPerPacket != 1 || cr.NumChans < 1 || int(bytesPerPacket) % cr.NumChans != 0 {
+    return fmt.Errorf("CAF files with %d bit samples in %d byte packets are not supported", cr.BitDepth, bytesPerPacket)
+  }
+
+  cr.format = pcmFormat{
+    bigEndian: formatFlags & cafFlagLittleEndian == 0,
+    sampleSize: int(bytesPerPacket) / cr.NumChans,
+  }
+  return nil
+}
+
+// CafWriter
+func (cw *CafWriter) Create(bufferLength int) error {
+  cw.format = pcmFormat{bigEndian: true}
+
+  header := &bytes.Buffer{}
+  header.WriteString("caff")
+  binary.Write(header, binary.BigEndian, []uint16{1, 0})
+
+  header.WriteString("desc")
+  binary.Write(header, binary.BigEndian, int64(32))
+  binary.Write(header, binary.BigEndian, float64(cw.SampleRate))
+  header.WriteString("lpcm")
+  binary.Write(header, binary.BigEndian, []uint32{
+    0, // signed integer, big endian
+    uint32(cw.BitDepth / 8 * cw.NumChans),
+    1,
+    uint32(cw.NumChans),
+    uint32(cw.BitDepth),
+  })
+
+  // the size is written on Close, the edit count stays 0
+  header.WriteString("data")
+  binary.Write(header, binary.BigEndian, int64(-1))
+  binary.Write(header, binary.BigEndian, uint32(0))
+
+  return cw.createData(bufferLength, header.Bytes())
+}
+
+func (cw *CafWriter) Close() {
+  cw.closeData(
+    pcmPatch{cw.dataOffset - 12, bigEndian(4 + cw.dataSize)},
+  )
+}
@@ -0,0 +1,303 @@
+package audioio
+
+import(
+  "errors"
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+  "github.com/go-audio/audio"
+)
+
+// a downmix or upmix of the input channels: mono, stereo or rows of gains
+type Mix struct {
+  Name string // empty for a matrix
+  Rows [][]float64 // one row per mixed channel, one gain per input channel
+}
+
+// ChannelRouting is how the channels of an input are processed and written.
+// Encode makes the processed channels out of the input channels, Decode and
+// Pass make the output channels out of the processed and input channels
+type ChannelRouting struct {
+  Encode [][]float64 // processed channels x input channels
+  Decode [][]float64 // output channels x processed channels
+  Pass [][]float64 // output channels x input channels, written unprocessed
+}
+
+// matrixReader reads channels mixed from the channels of another reader
+type matrixReader struct {
+  Reader
+  matrix [][]float64
+}
+
+// ParseChannels parses a list of one indexed channels and ranges, such as
+// 1,3-4, into zero indexed channels
+func ParseChannels(text string) ([]int, error) {
+  channels := []int{}
+  seen := map[int]bool{}
+
+  for _, part := range strings.Split(text, ",") {
+    bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+    first, err := strconv.Atoi(bounds[0])
+    last := first
+
+    if err == nil && len(bounds) == 2 {
+      last, err = strconv.Atoi(bounds[1])
+    }
+
+    if err != nil || first < 1 || last < first {
+      return nil, fmt.Errorf("Channels must be a list of channels from 1 and ranges, such as 1,3-4, got %s", text)
+    }
+
+    for channel := first - 1; channel < last; channel++ {
+      if seen[channel] {
+        return nil, fmt.Errorf("Channel %d is listed more than once in %s", channel + 1, text)
+      }
+
+      seen[channel] = true
+      channels = append(channels, channel)
+    }
+  }
+
+  return channels, nil
+}
+
+// ParseMix parses mono (all the channels summed into one), stereo (the
+// channels alternately summed into two) or a matrix of gains with a row for
+// each mixed channel, such as 0.5,0.5;1,0;0,1
+func ParseMix(text string) (Mix, error) {
+  if text == "mono" || text == "stereo" {
+    return Mix{Name: text}, nil
+  }
+
+  mix := Mix{}
+
+  for _, row := range strings.Split(text, ";") {
+    gains := []float64{}
+
+    for _, gain := range strings.Split(row, ",") {
+      value, err := strconv.ParseFloat(strings.TrimSpace(gain), 64)
+
+      if err != nil {
+        return Mix{}, fmt.Errorf("Mix must be mono, stereo or rows of gains for each input channel such as 0.5,0.5;1,0, got %s", text)
+      }
+
+      gains = append(gains, value)
+    }
+
+    if len(mix.Rows) > 0 && len(gains) != len(mix.Rows[0]) {
+      return Mix{}, fmt.Errorf("Every row of the mix %s must have a gain for each input channel", text)
+    }
+
+    mix.Rows = append(mix.Rows, gains)
+  }
+
+  return mix, nil
+}
+
+// the gains of the mix for an input of numChans channels
+func (m Mix) matrix(numChans int) ([][]float64, error) {
+  switch m.Name {
+  case "mono":
+    row := make([]float64, numChans, numChans)
+    for i := range row {
+      row[i] = 1 / float64(numChans)
+    }
+
+    return [][]float64{row}, nil
+  case "stereo":
+    // a mono input goes to both sides
+    if numChans == 1 {
+      return [][]float64{{1}, {1}}, nil
+    }
+
+    matrix := [][]float64{make([]float64, numChans, numChans), make([]float64, numChans, numChans)}
+    for i := 0; i < numChans; i++ {
+      matrix[i % 2][i] = 1 / float64((numChans + 1 - i % 2) / 2)
+    }
+
+    return matrix, nil
+  }
+
+  if len(m.Rows[0]) != numChans {
+    return nil, fmt.Errorf("The mix has gains for %d input channels, the input has %d", len(m.Rows[0]), numChans)
+  }
+
+  return m.Rows, nil
+}
+
+// NewChannelRouting routes an input of numChans channels: mixed by mix (nil
+// keeps the channels as they are), then the mixed channels listed in
+// channels (nil for all of them) are processed, as mid and side with
+// midSide. With pass the channels that aren't processed are written
+// unprocessed in their place, otherwise only the processed ones are written
+func NewChannelRouting(numChans int, mix *Mix, channels []int, midSide, pass bool) (*ChannelRouting, error) {
+  mixed := make([][]float64, numChans, numChans)
+  for i := range mixed {
+    mixed[i] = make([]float64, numChans, numChans)
+    mixed[i][i] = 1
+  }
+
+  if mix != nil {
+    var err error
+    if mixed, err = mix.matrix(numChans); err != nil {
+      return nil, err
+    }
+  }
+
+  if channels == nil {
+    for i := range mixed {
+      channels = append(channels, i)
+    }
+  }
+
+  processed := map[int]int{}
+
+  for i, channel := range channels {
+    if channel >= len(mixed) {
+      return nil, fmt.Errorf("Channel %d can't be processed, there are %d", channel + 1, len(mixed))
+    }
+
+    processed[channel] = i
+  }
+
+  if midSide && len(channels) != 2 {
+    return nil, fmt.Errorf("Mid/side processing needs 2 channels, got %d", len(channels))
+  }
+
+  routing := &ChannelRouting{}
+
+  for _, channel := range channels {
+    routing.Encode = append(routing.Encode, mixed[channel])
+  }
+
+  // mid is the sum of the two channels and side their difference, halved so
+  // that decoding them is their sum and difference again
+  if midSide {
+    mid := make([]float64, numChans, numChans)
+    side := make([]float64, numChans, numChans)
+
+    for i := 0; i < numChans; i++ {
+      mid[i] = (routing.Encode[0][i] + routing.Encode[1][i]) / 2
+      side[i] = (routing.Encode[0][i] - routing.Encode[1][i]) / 2
+    }
+
+    routing.Encode = [][]float64{mid, side}
+  }
+
+  for channel := range mixed {
+    decodeRow := make([]float64, len(channels), len(channels))
+    passRow := make([]float64, numChans, numChans)
+    i, ok := processed[channel]
+
+    switch {
+    case ok && midSide:
+      decodeRow[0] = 1
+      decodeRow[1] = 1 - 2 * float64(i)
+    case ok:
+      decodeRow[i] = 1
+    case pass:
+      copy(passRow, mixed[channel])
+    default:
+      continue
+    }
+
+    routing.Decode = append(routing.Decode, decodeRow)
+    routing.Pass = append(routing.Pass, passRow)
+  }
+
+  return routing, nil
+}
+
+// whether any output channel is written unprocessed
+func (cr *ChannelRouting) Passes() bool {
+  for _, row := range cr.Pass {
+    for _, gain := range row {
+      if gain != 0 {
+        return true
+      }
+    }
+  }
+
+  return false
+}
+
+// MixSignals mixes signals by a matrix of output rows and signal columns
+func MixSignals(matrix [][]float64, signals [][]float64) [][]float64 {
+  length := 0
+  if len(signals) > 0 {
+    length = len(signals[0])
+  }
+
+  mixed := make([][]float64, len(matrix), len(matrix))
+
+  for r, row := range matrix {
+    mixed[r] = make([]float64, length, length)
+
+    for c, gain := range row {
+      if gain == 0 {
+        continue
+      }
+
+      for i, sample := range signals[c] {
+        mixed[r][i] += gain * sample
+      }
+    }
+  }
+
+  return mixed
+}
+
+// SetChannels reads the channels mixed by matrix, a row of gains for each
+// channel read and a column for each channel of the file. Call it after Open
+func (ar *AudioReader) SetChannels(matrix [][]float64) error {
+  for _, row := range matrix {
+    if len(row) != ar.GetNumChans() {
+      return fmt.Errorf("Channel matrix has %d columns for %d channels", len(row), ar.GetNumChans())
+    }
+  }
+
+  if len(matrix) == 0 {
+    return errors.New("Channel matrix has no rows")
+  }
+
+  ar.Reader = &matrixReader{Reader: ar.Reader, matrix: matrix}
+  return nil
+}
+
+func (mr *matrixReader) GetNumChans() int {
+  return len(mr.matrix)
+}
+
+// channel is zero indexed, a row of the matrix
+func (mr *matrixReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
+  if channel < 0 || channel >= len(mr.matrix) {
+    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, len(mr.matrix) - 1)
+  }
+
+  var buffer *audio.IntBuffer
+  mixed := []float64{}
+
+  for c, gain := range mr.matrix[channel] {
+    input, err := mr.Reader.ExtractChannel(c)
+
+    if err != nil {
+      return nil, err
+    }
+
+    if buffer == nil {
+      buffer = input
+      mixed = make([]float64, len(input.Data), len(input.Data))
+    }
+
+    for i, sample := range input.Data {
+      mixed[i] += gain * float64(sample)
+    }
+  }
+
+  for i, sample := range mixed {
+    buffer.Data[i] = int(math.Round(sample))
+  }
+
+  return buffer, nil
+}
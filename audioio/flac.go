@@ -0,0 +1,483 @@
+package audioio
+
+import(
+  "fmt"
+  "errors"
+  "io"
+  "math"
+  "os"
+  "github.com/go-audio/audio"
+  "github.com/mewkiz/flac"
+  "github.com/mewkiz/flac/frame"
+  "github.com/mewkiz/flac/meta"
+)
+
+// sample frames per FLAC frame written, the reference encoder's default
+const flacBlockSize = 4096
+
+// highest fixed predictor order tried for each subframe
+const flacMaxFixedOrder = 4
+
+// written as the vendor of the Vorbis comments
+const flacVendor = "gopvoc"
+
+type FlacReader struct {
+  AudioFile
+  ReadBuffer *audio.IntBuffer
+  NumSampleFrames int
+  Duration float64
+  Tags [][2]string // Vorbis comments, name and value
+  stream *flac.Stream
+  pending [][]int32 // decoded samples of the current frame not read yet
+  atEnd bool // seeked to the end, there are no more frames to read
+  fileIo *os.File
+}
+
+type FlacWriter struct {
+  AudioFile
+  WriteBuffer *audio.IntBuffer
+  Tags [][2]string // Vorbis comments, name and value
+  encoder *flac.Encoder
+  pending [][]int32 // samples waiting for a full frame
+  maxSampleValue int
+  fileIo *os.File
+}
+
+// Getters
+func (fr *FlacReader) GetBitDepth() int {
+  return fr.BitDepth
+}
+
+func (fr *FlacReader) GetSampleRate() int {
+  return fr.SampleRate
+}
+
+func (fr *FlacReader) GetNumChans() int {
+  return fr.NumChans
+}
+
+func (fr *FlacReader) GetNumSampleFrames() int {
+  return fr.NumSampleFrames
+}
+
+func (fr *FlacReader) GetDuration() float64 {
+  return fr.Duration
+}
+
+// reads the Vorbis comments, the seekable stream skips them
+func readFlacTags(filePath string) ([][2]string, error) {
+  stream, err := flac.ParseFile(filePath)
+
+  if err != nil {
+    return nil, err
+  }
+
+  defer stream.Close()
+
+  tags := [][2]string{}
+
+  for _, block := range stream.Blocks {
+    if comment, ok := block.Body.(*meta.VorbisComment); ok {
+      tags = append(tags, comment.Tags...)
+    }
+  }
+
+  return tags, nil
+}
+
+// bufferLength: how many frames to read at one time
+func (fr *FlacReader) Open(bufferLength int) (err error) {
+  fr.Tags, err = readFlacTags(fr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  fr.fileIo, err = os.Open(fr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  // the file isn't left open when it can't be decoded
+  defer func() {
+    if err != nil {
+      fr.fileIo.Close()
+    }
+  }()
+
+  fr.stream, err = flac.NewSeek(fr.fileIo)
+
+  if err != nil {
+    return err
+  }
+
+  if fr.stream.Info.NChannels == 0 {
+    return errors.New("FlacReader.stream.Info.NChannels is 0")
+  }
+
+  if fr.stream.Info.SampleRate == 0 {
+    return errors.New("FlacReader.stream.Info.SampleRate is 0")
+  }
+
+  if fr.stream.Info.BitsPerSample == 0 {
+    return errors.New("FlacReader.stream.Info.BitsPerSample is 0")
+  }
+
+  fr.NumChans = int(fr.stream.Info.NChannels)
+  fr.BitDepth = int(fr.stream.Info.BitsPerSample)
+  fr.SampleRate = int(fr.stream.Info.SampleRate)
+  fr.NumSampleFrames = int(fr.stream.Info.NSamples)
+  fr.Duration = float64(fr.NumSampleFrames) / float64(fr.SampleRate)
+  fr.pending = make([][]int32, fr.NumChans, fr.NumChans)
+
+  format := &audio.Format{
+    NumChannels: fr.NumChans,
+    SampleRate: fr.SampleRate,
+  }
+
+  fr.ReadBuffer = &audio.IntBuffer{
+    Format: format,
+    Data: make([]int, bufferLength * fr.NumChans, bufferLength * fr.NumChans),
+    SourceBitDepth: fr.BitDepth,
+  }
+
+  return nil
+}
+
+// channel is zero indexed
+func (fr *FlacReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
+  if fr.NumChans == 0 {
+    return nil, errors.New("FlacReader.has no channels to extract")
+  }
+
+  if channel > fr.NumChans - 1 {
+    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, fr.NumChans - 1)
+  }
+
+  buffer := &audio.IntBuffer{
+    Format: fr.ReadBuffer.Format,
+    Data: make([]int, fr.ReadBuffer.NumFrames(), fr.ReadBuffer.NumFrames()),
+    SourceBitDepth: fr.ReadBuffer.SourceBitDepth,
+  }
+
+  x := 0
+  for i := channel; i < len(fr.ReadBuffer.Data); i += fr.NumChans {
+    buffer.Data[x] = fr.ReadBuffer.Data[i]
+    x++
+  }
+
+  return buffer, nil
+}
+
+func (fr *FlacReader) Close() {
+  fr.fileIo.Close()
+}
+
+// numSamples is the number of samples read across all channels
+// numFrames is the number of samples per channel
+func (fr *FlacReader) ReadNext() (numSamples, numFrames int, err error) {
+  bufferLength := fr.ReadBuffer.NumFrames()
+
+  for numFrames < bufferLength && !fr.atEnd {
+    if len(fr.pending[0]) == 0 {
+      decoded, err := fr.stream.ParseNext()
+
+      if err == io.EOF {
+        break
+      }
+
+      if err != nil {
+        return numSamples, numFrames, err
+      }
+
+      for c := range fr.pending {
+        fr.pending[c] = decoded.Subframes[c].Samples
+      }
+
+      continue
+    }
+
+    count := len(fr.pending[0])
+    if count > bufferLength - numFrames {
+      count = bufferLength - numFrames
+    }
+
+    for c, samples := range fr.pending {
+      for i, sample := range samples[:count] {
+        fr.ReadBuffer.Data[(numFrames + i) * fr.NumChans + c] = int(sample)
+      }
+
+      fr.pending[c] = samples[count:]
+    }
+
+    numFrames += count
+  }
+
+  // the rest of a short read is silence
+  for i := numFrames * fr.NumChans; i < len(fr.ReadBuffer.Data); i++ {
+    fr.ReadBuffer.Data[i] = 0
+  }
+
+  numSamples = numFrames * fr.NumChans
+  return
+}
+
+// the next ReadNext starts at sampleFrame
+func (fr *FlacReader) Seek(sampleFrame int) error {
+  if sampleFrame < 0 || sampleFrame > fr.NumSampleFrames {
+    return fmt.Errorf("Cannot seek to sample frame %d of %d", sampleFrame, fr.NumSampleFrames)
+  }
+
+  for c := range fr.pending {
+    fr.pending[c] = nil
+  }
+
+  // nothing left to read
+  fr.atEnd = sampleFrame == fr.NumSampleFrames
+
+  if fr.atEnd {
+    return nil
+  }
+
+  // the stream seeks to the start of the frame holding sampleFrame
+  frameStart, err := fr.stream.Seek(uint64(sampleFrame))
+
+  if err != nil {
+    return err
+  }
+
+  decoded, err := fr.stream.ParseNext()
+
+  if err != nil {
+    return err
+  }
+
+  for c := range fr.pending {
+    fr.pending[c] = decoded.Subframes[c].Samples[sampleFrame - int(frameStart):]
+  }
+
+  return nil
+}
+
+// FlacWriter
+func (fw *FlacWriter) Create(bufferLength int) error {
+  var err error
+
+  fw.maxSampleValue = IntMaxSignedValue[fw.BitDepth]
+
+  if fw.maxSampleValue == 0 || fw.BitDepth > 24 {
+    return fmt.Errorf("FLAC files can be 8, 16 or 24 bit, got %d", fw.BitDepth)
+  }
+
+  if fw.NumChans < 1 || fw.NumChans > 8 {
+    return fmt.Errorf("FLAC files can have 1 to 8 channels, got %d", fw.NumChans)
+  }
+
+  fw.fileIo, err = os.Create(fw.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  info := &meta.StreamInfo{
+    BlockSizeMin: flacBlockSize,
+    BlockSizeMax: flacBlockSize,
+    SampleRate: uint32(fw.SampleRate),
+    NChannels: uint8(fw.NumChans),
+    BitsPerSample: uint8(fw.BitDepth),
+  }
+
+  blocks := []*meta.Block{}
+
+  if len(fw.Tags) > 0 {
+    // the length only has to be set, the encoder computes it
+    blocks = append(blocks, &meta.Block{
+      Header: meta.Header{Type: meta.TypeVorbisComment, Length: 1},
+      Body: &meta.VorbisComment{Vendor: flacVendor, Tags: fw.Tags},
+    })
+  }
+
+  fw.encoder, err = flac.NewEncoder(fw.fileIo, info, blocks...)
+
+  if err != nil {
+    return err
+  }
+
+  format := &audio.Format{
+    NumChannels: fw.NumChans,
+    SampleRate: fw.SampleRate,
+  }
+
+  fw.WriteBuffer = &audio.IntBuffer{
+    Format: format,
+    Data: make([]int, bufferLength * fw.NumChans, bufferLength * fw.NumChans),
+    SourceBitDepth: fw.BitDepth,
+  }
+
+  fw.pending = make([][]int32, fw.NumChans, fw.NumChans)
+
+  return nil
+}
+
+// writes what is left as a last, shorter frame and finishes the stream info
+func (fw *FlacWriter) Close() {
+  if len(fw.pending[0]) > 0 {
+    fw.writeFrame(len(fw.pending[0]))
+  }
+
+  // also closes the file
+  fw.encoder.Close()
+}
+
+func (fw *FlacWriter) Write(buffer *audio.IntBuffer) error {
+  // clip gaurd: if any sample in the int buffer exceeds maximum allowed for the
+  // buffer's BitDepth, clip the sample instead of letting the encoder have it
+  for i := 0; i < len(buffer.Data); i++ {
+    if buffer.Data[i] > fw.maxSampleValue {
+      buffer.Data[i] = fw.maxSampleValue
+    } else if buffer.Data[i] < -fw.maxSampleValue {
+      buffer.Data[i] = -fw.maxSampleValue
+    }
+  }
+
+  for i, sample := range buffer.Data {
+    c := i % fw.NumChans
+    fw.pending[c] = append(fw.pending[c], int32(sample))
+  }
+
+  for len(fw.pending[0]) >= flacBlockSize {
+    if err := fw.writeFrame(flacBlockSize); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// encodes the first length pending samples of every channel as one frame
+func (fw *FlacWriter) writeFrame(length int) error {
+  subframes := make([]*frame.Subframe, fw.NumChans, fw.NumChans)
+
+  for c := range subframes {
+    subframes[c] = flacSubframe(fw.pending[c][:length])
+  }
+
+  err := fw.encoder.WriteFrame(&frame.Frame{
+    Header: frame.Header{
+      HasFixedBlockSize: true,
+      BlockSize: uint16(length),
+      SampleRate: uint32(fw.SampleRate),
+      Channels: frame.Channels(fw.NumChans - 1), // independent channels
+      BitsPerSample: uint8(fw.BitDepth),
+    },
+    Subframes: subframes,
+  })
+
+  for c := range fw.pending {
+    fw.pending[c] = fw.pending[c][length:]
+  }
+
+  return err
+}
+
+// a subframe of the samples with the fixed predictor leaving the smallest
+// residuals, or a constant one for a constant signal
+func flacSubframe(samples []int32) *frame.Subframe {
+  constant := true
+  for _, sample := range samples {
+    if sample != samples[0] {
+      constant = false
+      break
+    }
+  }
+
+  if constant {
+    return &frame.Subframe{
+      SubHeader: frame.SubHeader{Pred: frame.PredConstant},
+      Samples: samples,
+      NSamples: len(samples),
+    }
+  }
+
+  bestOrder := 0
+  bestSum := math.Inf(1)
+
+  for order := 0; order <= flacMaxFixedOrder && order < len(samples); order++ {
+    sum := 0.0
+
+    for i := order; i < len(samples); i++ {
+      sum += math.Abs(float64(flacResidual(samples, order, i)))
+    }
+
+    if sum < bestSum {
+      bestOrder = order
+      bestSum = sum
+    }
+  }
+
+  // the Rice parameter that suits the mean residual best
+  param := uint(0)
+  mean := bestSum / float64(len(samples) - bestOrder)
+
+  if mean > 1.0 {
+    param = uint(math.Floor(math.Log2(mean)))
+  }
+
+  if param > 30 {
+    param = 30
+  }
+
+  return &frame.Subframe{
+    SubHeader: frame.SubHeader{
+      Pred: frame.PredFixed,
+      Order: bestOrder,
+      ResidualCodingMethod: frame.ResidualCodingMethodRice2,
+      RiceSubframe: &frame.RiceSubframe{
+        PartOrder: 0,
+        Partitions: []frame.RicePartition{{Param: param}},
+      },
+    },
+    Samples: samples,
+    NSamples: len(samples),
+  }
+}
+
+// the error of the fixed predictor of order at sample i
+func flacResidual(samples []int32, order, i int) int64 {
+  switch order {
+  case 1:
+    return int64(samples[i]) - int64(samples[i - 1])
+  case 2:
+    return int64(samples[i]) - 2 * int64(samples[i - 1]) + int64(samples[i - 2])
+  case 3:
+    return int64(samples[i]) - 3 * int64(samples[i - 1]) + 3 * int64(samples[i - 2]) - int64(samples[i - 3])
+  case 4:
+    return int64(samples[i]) - 4 * int64(samples[i - 1]) + 6 * int64(samples[i - 2]) - 4 * int64(samples[i - 3]) + int64(samples[i - 4])
+  }
+
+  return int64(samples[i])
+}
+
+func (fw *FlacWriter) ZeroWriteBuffer() {
+  for i := 0; i < len(fw.WriteBuffer.Data); i++ {
+    fw.WriteBuffer.Data[i] = 0
+  }
+}
+
+func (fw *FlacWriter) WriteNext() error {
+  return fw.Write(fw.WriteBuffer)
+}
+
+func (fw *FlacWriter) InterleaveChannel(channel int, data []int) error {
+  if len(data) * fw.NumChans != len(fw.WriteBuffer.Data) {
+    return errors.New("Data to interleave will not fit exactly into WriteBuffer")
+  }
+
+  for frameNumber :=0; frameNumber < len(data); frameNumber++ {
+    i := frameNumber * fw.NumChans
+    fw.WriteBuffer.Data[i + channel] = data[frameNumber]
+  }
+
+  return nil
+}
@@ -0,0 +1,107 @@
+package audioio
+
+import(
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+// the sample rates gopvoc reads, outside them FFT bands are too narrow or too
+// wide to mean much for sound
+const MinSampleRate = 1000
+const MaxSampleRate = 768000
+
+// the sample rates a FLAC frame header holds directly
+const flacMaxPlainSampleRate = 65535
+const flacMaxSampleRate = 655350
+
+// FormatCapabilities are the samples an output format stores
+type FormatCapabilities struct {
+  Name string
+  BitDepths []int // in increasing order
+  MaxSampleRate int // 0 for any
+  SampleRateStep int // sample rates above 65535 Hz must be a multiple of it, 0 for any
+}
+
+// the capabilities of the formats gopvoc writes, .npy arrays store floats
+// scaled by the bit depth
+var formatCapabilities = map[int]FormatCapabilities{
+  TYPE_AIFF: {"AIFF", []int{8, 16, 24, 32}, 0, 0},
+  TYPE_WAVE: {"WAV", []int{8, 16, 24, 32}, 0, 0},
+  TYPE_W64: {"W64", []int{8, 16, 24, 32}, 0, 0},
+  TYPE_CAF: {"CAF", []int{8, 16, 24, 32}, 0, 0},
+  TYPE_RAW: {"raw PCM", []int{8, 16, 24, 32}, 0, 0},
+  TYPE_NPY: {"NPY", []int{8, 16, 24, 32}, 0, 0},
+  TYPE_FLAC: {"FLAC", []int{8, 16, 24}, flacMaxSampleRate, 10},
+}
+
+// Capabilities of an output file type, ok is false for the formats gopvoc
+// only reads
+func Capabilities(fileType int) (fc FormatCapabilities, ok bool) {
+  fc, ok = formatCapabilities[fileType]
+  return
+}
+
+// SupportsBitDepth is true if samples of bitDepth are stored as they are
+func (fc FormatCapabilities) SupportsBitDepth(bitDepth int) bool {
+  for _, supported := range fc.BitDepths {
+    if supported == bitDepth {
+      return true
+    }
+  }
+
+  return false
+}
+
+// WriteBitDepth is the bit depth samples of bitDepth are stored at, the
+// smallest of the format's that holds them, or its largest
+func (fc FormatCapabilities) WriteBitDepth(bitDepth int) int {
+  for _, supported := range fc.BitDepths {
+    if supported >= bitDepth {
+      return supported
+    }
+  }
+
+  return fc.BitDepths[len(fc.BitDepths) - 1]
+}
+
+// CheckSampleRate errors if the format can't store the sample rate
+func (fc FormatCapabilities) CheckSampleRate(sampleRate int) error {
+  if sampleRate < 1 {
+    return fmt.Errorf("Cannot write a sample rate of %d Hz", sampleRate)
+  }
+
+  if fc.MaxSampleRate > 0 && sampleRate > fc.MaxSampleRate {
+    return fmt.Errorf("%s files can have sample rates up to %d Hz, got %d", fc.Name, fc.MaxSampleRate, sampleRate)
+  }
+
+  if fc.SampleRateStep > 0 && sampleRate > flacMaxPlainSampleRate && sampleRate % fc.SampleRateStep != 0 {
+    return fmt.Errorf("%s sample rates above %d Hz must be a multiple of %d Hz, got %d", fc.Name, flacMaxPlainSampleRate, fc.SampleRateStep, sampleRate)
+  }
+
+  return nil
+}
+
+// BitDepthsString lists the bit depths, such as 8, 16 or 24
+func (fc FormatCapabilities) BitDepthsString() string {
+  depths := []string{}
+  for _, bitDepth := range fc.BitDepths {
+    depths = append(depths, strconv.Itoa(bitDepth))
+  }
+
+  last := len(depths) - 1
+  if last < 1 {
+    return strings.Join(depths, "")
+  }
+
+  return strings.Join(depths[:last], ", ") + " or " + depths[last]
+}
+
+// CheckInputSampleRate errors for sample rates gopvoc doesn't process
+func CheckInputSampleRate(sampleRate int) error {
+  if sampleRate < MinSampleRate || sampleRate > MaxSampleRate {
+    return fmt.Errorf("Sample rate of %d Hz is not supported, only %d to %d Hz", sampleRate, MinSampleRate, MaxSampleRate)
+  }
+
+  return nil
+}
@@ -0,0 +1,395 @@
+package audioio
+
+import(
+  "fmt"
+  "errors"
+  "io"
+  "os"
+  "github.com/go-audio/audio"
+  "github.com/hajimehoshi/go-mp3"
+)
+
+// decoded samples are 16 bit, reported as 24 bit so they sit in the same
+// range as the other compressed formats
+const mp3BitDepth = 24
+
+// sample frames a layer III decoder outputs before the first encoded sample,
+// LAME's encoder delay does not include it
+const mp3DecoderDelay = 529
+
+// enough of the first frame for the Xing/Info and LAME tags
+const mp3HeaderLength = 256
+
+// frames decoded and thrown away before a seek target, the bit reservoir and
+// the filterbanks need the frames before it
+const mp3SeekPreroll = 16
+
+type Mp3Reader struct {
+  AudioFile
+  ReadBuffer *audio.IntBuffer
+  NumSampleFrames int
+  Duration float64
+  decoder *mp3.Decoder
+  startSkip int // decoded sample frames before the first sample of the file
+  samplesPerFrame int
+  position int // sample frames read so far
+  pcmBuffer []byte
+  fileIo *os.File
+}
+
+// what the first frame says about the stream
+type mp3StreamInfo struct {
+  mono bool
+  samplesPerFrame int
+  infoFrame bool // the first frame is a Xing/Info frame, decoded as silence
+  numFrames int // audio frames from the Info frame, 0 when unknown
+  lameTag bool // encoder delay and padding are known
+  encoderDelay int
+  encoderPadding int
+}
+
+// Getters
+func (mr *Mp3Reader) GetBitDepth() int {
+  return mr.BitDepth
+}
+
+func (mr *Mp3Reader) GetSampleRate() int {
+  return mr.SampleRate
+}
+
+func (mr *Mp3Reader) GetNumChans() int {
+  return mr.NumChans
+}
+
+func (mr *Mp3Reader) GetNumSampleFrames() int {
+  return mr.NumSampleFrames
+}
+
+func (mr *Mp3Reader) GetDuration() float64 {
+  return mr.Duration
+}
+
+// skips an ID3v2 tag, returns the offset of the first byte after it
+func skipId3v2(header []byte) int {
+  if len(header) < 10 || string(header[:3]) != "ID3" {
+    return 0
+  }
+
+  size := int(header[6]) << 21 | int(header[7]) << 14 | int(header[8]) << 7 | int(header[9])
+  size += 10
+
+  // footer present
+  if header[5] & 0x10 != 0 {
+    size += 10
+  }
+
+  return size
+}
+
+// true for the sync word of an MPEG layer III frame header
+func isMp3FrameSync(header []byte) bool {
+  return len(header) >= 4 &&
+    header[0] == 0xff &&
+    header[1] & 0xe0 == 0xe0 &&
+    header[1] & 0x18 != 0x08 && // reserved version
+    header[1] & 0x06 == 0x02 // layer III
+}
+
+// parses the header of the first frame and, when it is a Xing/Info frame,
+// the frame count and the LAME encoder delay and padding
+func parseMp3StreamInfo(frame []byte) (mp3StreamInfo, error) {
+  info := mp3StreamInfo{}
+
+  if !isMp3FrameSync(frame) {
+    return info, errors.New("Could not find the first MP3 frame")
+  }
+
+  mpeg1 := frame[1] & 0x18 == 0x18
+  crc := frame[1] & 0x01 == 0
+  info.mono = frame[3] >> 6 == 3
+
+  var sideInfoLength int
+  if mpeg1 {
+    info.samplesPerFrame = 1152
+    sideInfoLength = 32
+    if info.mono {
+      sideInfoLength = 17
+    }
+  } else {
+    info.samplesPerFrame = 576
+    sideInfoLength = 17
+    if info.mono {
+      sideInfoLength = 9
+    }
+  }
+
+  offset := 4 + sideInfoLength
+  if crc {
+    offset += 2
+  }
+
+  if len(frame) < offset + 8 {
+    return info, nil
+  }
+
+  tag := string(frame[offset:offset + 4])
+  if tag != "Xing" && tag != "Info" {
+    return info, nil
+  }
+
+  info.infoFrame = true
+  flags := int(frame[offset + 7])
+  offset += 8
+
+  // frame count, byte count, table of contents and quality, when present
+  if flags & 0x1 != 0 && len(frame) >= offset + 4 {
+    info.numFrames = int(frame[offset]) << 24 | int(frame[offset + 1]) << 16 | int(frame[offset + 2]) << 8 | int(frame[offset + 3])
+    offset += 4
+  }
+
+  if flags & 0x2 != 0 {
+    offset += 4
+  }
+
+  if flags & 0x4 != 0 {
+    offset += 100
+  }
+
+  if flags & 0x8 != 0 {
+    offset += 4
+  }
+
+  // the encoder version (9 bytes) is followed by 12 bytes of settings, then
+  // 12 bits of delay and 12 bits of padding
+  if len(frame) < offset + 24 {
+    return info, nil
+  }
+
+  encoder := string(frame[offset:offset + 4])
+  if encoder != "LAME" && encoder != "Lavf" && encoder != "Lavc" {
+    return info, nil
+  }
+
+  delayPadding := frame[offset + 21:offset + 24]
+  info.lameTag = true
+  info.encoderDelay = int(delayPadding[0]) << 4 | int(delayPadding[1]) >> 4
+  info.encoderPadding = int(delayPadding[1] & 0x0f) << 8 | int(delayPadding[2])
+
+  return info, nil
+}
+
+// reads the start of the file up to and including the first frame
+func readMp3StreamInfo(file *os.File) (mp3StreamInfo, error) {
+  header := make([]byte, 10)
+
+  if _, err := io.ReadFull(file, header); err != nil {
+    return mp3StreamInfo{}, err
+  }
+
+  offset := skipId3v2(header)
+
+  frame := make([]byte, mp3HeaderLength)
+  n, err := file.ReadAt(frame, int64(offset))
+
+  if err != nil && err != io.EOF {
+    return mp3StreamInfo{}, err
+  }
+
+  // padding can sit between the tag and the first frame
+  for start := 0; start + 4 <= n; start++ {
+    if isMp3FrameSync(frame[start:n]) {
+      return parseMp3StreamInfo(frame[start:n])
+    }
+  }
+
+  return mp3StreamInfo{}, errors.New("Could not find the first MP3 frame")
+}
+
+// bufferLength: how many frames to read at one time
+func (mr *Mp3Reader) Open(bufferLength int) (err error) {
+  mr.fileIo, err = os.Open(mr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  // the file isn't left open when it can't be decoded
+  defer func() {
+    if err != nil {
+      mr.fileIo.Close()
+    }
+  }()
+
+  info, err := readMp3StreamInfo(mr.fileIo)
+
+  if err != nil {
+    return err
+  }
+
+  if _, err = mr.fileIo.Seek(0, io.SeekStart); err != nil {
+    return err
+  }
+
+  mr.decoder, err = mp3.NewDecoder(mr.fileIo)
+
+  if err != nil {
+    return err
+  }
+
+  if mr.decoder.SampleRate() == 0 {
+    return errors.New("Mp3Reader.decoder.SampleRate is 0")
+  }
+
+  // the decoder always outputs 16 bit stereo
+  decodedFrames := int(mr.decoder.Length() / 4)
+  mr.NumSampleFrames = decodedFrames
+  mr.startSkip = 0
+
+  if info.infoFrame {
+    mr.startSkip = info.samplesPerFrame
+    mr.NumSampleFrames -= info.samplesPerFrame
+  }
+
+  if info.lameTag {
+    mr.startSkip += info.encoderDelay + mp3DecoderDelay
+    numFrames := info.numFrames
+
+    if numFrames == 0 {
+      numFrames = mr.NumSampleFrames / info.samplesPerFrame
+    }
+
+    mr.NumSampleFrames = numFrames * info.samplesPerFrame - info.encoderDelay - info.encoderPadding
+  }
+
+  // never more than was decoded
+  if mr.NumSampleFrames > decodedFrames - mr.startSkip {
+    mr.NumSampleFrames = decodedFrames - mr.startSkip
+  }
+
+  if mr.NumSampleFrames < 0 {
+    mr.NumSampleFrames = 0
+  }
+
+  mr.samplesPerFrame = info.samplesPerFrame
+  mr.NumChans = 2
+  if info.mono {
+    mr.NumChans = 1
+  }
+
+  mr.BitDepth = mp3BitDepth
+  mr.SampleRate = mr.decoder.SampleRate()
+  mr.Duration = float64(mr.NumSampleFrames) / float64(mr.SampleRate)
+  mr.pcmBuffer = make([]byte, bufferLength * 4, bufferLength * 4)
+
+  format := &audio.Format{
+    NumChannels: mr.NumChans,
+    SampleRate: mr.SampleRate,
+  }
+
+  mr.ReadBuffer = &audio.IntBuffer{
+    Format: format,
+    Data: make([]int, bufferLength * mr.NumChans, bufferLength * mr.NumChans),
+    SourceBitDepth: mr.BitDepth,
+  }
+
+  return mr.Seek(0)
+}
+
+// channel is zero indexed
+func (mr *Mp3Reader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
+  if mr.NumChans == 0 {
+    return nil, errors.New("Mp3Reader.has no channels to extract")
+  }
+
+  if channel > mr.NumChans - 1 {
+    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, mr.NumChans - 1)
+  }
+
+  buffer := &audio.IntBuffer{
+    Format: mr.ReadBuffer.Format,
+    Data: make([]int, mr.ReadBuffer.NumFrames(), mr.ReadBuffer.NumFrames()),
+    SourceBitDepth: mr.ReadBuffer.SourceBitDepth,
+  }
+
+  x := 0
+  for i := channel; i < len(mr.ReadBuffer.Data); i += mr.NumChans {
+    buffer.Data[x] = mr.ReadBuffer.Data[i]
+    x++
+  }
+
+  return buffer, nil
+}
+
+func (mr *Mp3Reader) Close() {
+  mr.fileIo.Close()
+}
+
+// numSamples is the number of samples read across all channels
+// numFrames is the number of samples per channel
+func (mr *Mp3Reader) ReadNext() (numSamples, numFrames int, err error) {
+  bufferLength := mr.ReadBuffer.NumFrames()
+
+  // stop at the encoder padding
+  if remaining := mr.NumSampleFrames - mr.position; bufferLength > remaining {
+    bufferLength = remaining
+  }
+
+  n, err := io.ReadFull(mr.decoder, mr.pcmBuffer[:bufferLength * 4])
+
+  if err == io.EOF || err == io.ErrUnexpectedEOF {
+    err = nil
+  }
+
+  if err != nil {
+    return 0, 0, err
+  }
+
+  numFrames = n / 4
+
+  for i := 0; i < numFrames; i++ {
+    for c := 0; c < mr.NumChans; c++ {
+      offset := i * 4 + c * 2
+      sample := int(int16(uint16(mr.pcmBuffer[offset]) | uint16(mr.pcmBuffer[offset + 1]) << 8))
+      mr.ReadBuffer.Data[i * mr.NumChans + c] = sample << (mp3BitDepth - 16)
+    }
+  }
+
+  // the rest of a short read is silence
+  for i := numFrames * mr.NumChans; i < len(mr.ReadBuffer.Data); i++ {
+    mr.ReadBuffer.Data[i] = 0
+  }
+
+  mr.position += numFrames
+  numSamples = numFrames * mr.NumChans
+  return
+}
+
+// the next ReadNext starts at sampleFrame
+func (mr *Mp3Reader) Seek(sampleFrame int) error {
+  if sampleFrame < 0 || sampleFrame > mr.NumSampleFrames {
+    return fmt.Errorf("Cannot seek to sample frame %d of %d", sampleFrame, mr.NumSampleFrames)
+  }
+
+  mr.position = sampleFrame
+
+  // nothing left to read, the decoder can't seek past its last frame
+  if sampleFrame == mr.NumSampleFrames {
+    return nil
+  }
+
+  // the decoder only decodes the frame before the target again, which isn't
+  // enough to refill the bit reservoir, so start earlier and read up to it
+  target := mr.startSkip + sampleFrame
+  start := target - mp3SeekPreroll * mr.samplesPerFrame
+
+  if start < 0 {
+    start = 0
+  }
+
+  if _, err := mr.decoder.Seek(int64(start) * 4, io.SeekStart); err != nil {
+    return err
+  }
+
+  _, err := io.CopyN(io.Discard, mr.decoder, int64(target - start) * 4)
+  return err
+}
@@ -0,0 +1,187 @@
+package audioio
+
+import(
+  "bytes"
+  "fmt"
+  "encoding/binary"
+  "errors"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+)
+
+const npyMagic = "\x93NUMPY"
+
+// the header written by NpyWriter, long enough for any shape so it can be
+// rewritten in place on Close
+const npyHeaderLength = 128
+
+// NumPy .npy arrays of float32 samples, one row per frame and one column
+// per channel. The samples are scaled to and from the bit depth
+type NpyReader struct {
+  pcmReader
+}
+
+type NpyWriter struct {
+  pcmWriter
+}
+
+// bufferLength: how many frames to read at one time
+func (nr *NpyReader) Open(bufferLength int) (err error) {
+  nr.fileIo, err = os.Open(nr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  // the file isn't left open when its header can't be read
+  defer func() {
+    if err != nil {
+      nr.fileIo.Close()
+    }
+  }()
+
+  preamble := make([]byte, 12)
+
+  if _, err = io.ReadFull(nr.fileIo, preamble); err != nil {
+    return err
+  }
+
+  if string(preamble[:6]) != npyMagic {
+    return errors.New("Not a NumPy .npy file")
+  }
+
+  // version 1 has a 16 bit header length, later versions 32 bit
+  headerOffset := int64(10)
+  headerLength := int64(binary.LittleEndian.Uint16(preamble[8:]))
+
+  if preamble[6] > 1 {
+    headerOffset = 12
+    headerLength = int64(binary.LittleEndian.Uint32(preamble[8:]))
+  }
+
+  header := make([]byte, headerLength)
+
+  if _, err = nr.fileIo.ReadAt(header, headerOffset); err != nil {
+    return err
+  }
+
+  dict := string(header)
+  descr := npyHeaderValue(dict, "descr")
+
+  switch descr {
+  case "<f4":
+    nr.format = pcmFormat{floatScale: float64(IntMaxSignedValue[floatBitDepth])}
+  case ">f4":
+    nr.format = pcmFormat{bigEndian: true, floatScale: float64(IntMaxSignedValue[floatBitDepth])}
+  default:
+    return fmt.Errorf("NumPy arrays of %s are not supported, only float32", descr)
+  }
+
+  if npyHeaderValue(dict, "fortran_order") != "False" {
+    return errors.New("NumPy arrays in Fortran order are not supported")
+  }
+
+  shape, err := parseNpyShape(npyHeaderValue(dict, "shape"))
+
+  if err != nil {
+    return err
+  }
+
+  // a one dimensional array is mono
+  nr.NumChans = 1
+  if len(shape) == 2 {
+    nr.NumChans = shape[1]
+  }
+
+  nr.BitDepth = floatBitDepth
+
+  if nr.SampleRate == 0 {
+    nr.SampleRate = defaultNpySampleRate
+  }
+
+  dataSize := int64(shape[0]) * int64(nr.NumChans) * 4
+  return nr.openData(bufferLength, headerOffset + headerLength, dataSize)
+}
+
+// the text of a value in the Python dict literal of a header, quotes removed
+func npyHeaderValue(dict, key string) string {
+  start := strings.Index(dict, "'" + key + "':")
+
+  if start < 0 {
+    return ""
+  }
+
+  value := strings.TrimSpace(dict[start + len(key) + 3:])
+
+  switch {
+  case strings.HasPrefix(value, "'"):
+    if end := strings.Index(value[1:], "'"); end >= 0 {
+      return value[1:end + 1]
+    }
+  case strings.HasPrefix(value, "("):
+    if end := strings.Index(value, ")"); end >= 0 {
+      return value[:end + 1]
+    }
+  default:
+    if end := strings.IndexAny(value, ",}"); end >= 0 {
+      return strings.TrimSpace(value[:end])
+    }
+  }
+
+  return value
+}
+
+// the dimensions of a shape tuple, (frames,) or (frames, channels)
+func parseNpyShape(tuple string) ([]int, error) {
+  shape := []int{}
+
+  for _, dimension := range strings.Split(strings.Trim(tuple, "()"), ",") {
+    dimension = strings.TrimSpace(dimension)
+
+    if dimension == "" {
+      continue
+    }
+
+    size, err := strconv.Atoi(dimension)
+
+    if err != nil {
+      return nil, fmt.Errorf("NumPy array has an invalid shape %s", tuple)
+    }
+
+    shape = append(shape, size)
+  }
+
+  if len(shape) < 1 || len(shape) > 2 {
+    return nil, fmt.Errorf("NumPy array must be frames or frames x channels, got shape %s", tuple)
+  }
+
+  return shape, nil
+}
+
+// a version 1 header for the shape, padded to npyHeaderLength
+func npyHeader(numFrames, numChans int) []byte {
+  header := &bytes.Buffer{}
+  header.WriteString(npyMagic + "\x01\x00")
+  binary.Write(header, binary.LittleEndian, uint16(npyHeaderLength - 10))
+  fmt.Fprintf(header, "{'descr': '<f4', 'fortran_order': False, 'shape': (%d, %d), }", numFrames, numChans)
+  header.WriteString(strings.Repeat(" ", npyHeaderLength - 1 - header.Len()))
+  header.WriteString("\n")
+
+  return header.Bytes()
+}
+
+// NpyWriter
+func (nw *NpyWriter) Create(bufferLength int) error {
+  nw.format = pcmFormat{floatScale: float64(IntMaxSignedValue[nw.BitDepth])}
+
+  return nw.createData(bufferLength, npyHeader(0, nw.NumChans))
+}
+
+// writes the number of frames into the shape
+func (nw *NpyWriter) Close() {
+  nw.closeData(
+    pcmPatch{0, npyHeader(int(nw.dataSize / int64(4 * nw.NumChans)), nw.NumChans)},
+  )
+}
@@ -0,0 +1,444 @@
+package audioio
+
+import(
+  "bufio"
+  "bytes"
+  "encoding/binary"
+  "fmt"
+  "errors"
+  "io"
+  "math"
+  "os"
+  "github.com/go-audio/audio"
+)
+
+// bytes buffered between the file and the sample buffers
+const pcmIoBufferSize = 1 << 16
+
+// the layout of the interleaved samples in the data chunk of an uncompressed
+// file
+type pcmFormat struct {
+  bigEndian bool
+  unsigned8 bool // samples stored in 1 byte are offset by 128
+  floatScale float64 // samples are 32 bit floats, 1.0 is this integer sample
+  sampleSize int // bytes of a stored sample, 0 for the fewest that hold the bit depth
+  padBits uint // the low bits of a stored sample below the bit depth, set by openData
+}
+
+// bytes of one stored sample of a file with the bit depth
+func (f pcmFormat) sampleBytes(bitDepth int) int {
+  if f.floatScale != 0 {
+    return 4
+  }
+
+  if f.sampleSize != 0 {
+    return f.sampleSize
+  }
+
+  return pcmSampleBytes(bitDepth)
+}
+
+// pcmReader reads the data chunk of the uncompressed formats gopvoc parses
+// itself, the reader of each format parses its header and calls openData
+type pcmReader struct {
+  AudioFile
+  ReadBuffer *audio.IntBuffer
+  NumSampleFrames int
+  Duration float64
+  format pcmFormat
+  dataOffset int64
+  blockAlign int
+  position int
+  bytes []byte
+  reader *bufio.Reader
+  fileIo *os.File
+}
+
+// pcmWriter writes the data chunk of the uncompressed formats gopvoc writes
+// itself, the writer of each format writes its header with createData and
+// patches the sizes on Close
+type pcmWriter struct {
+  AudioFile
+  WriteBuffer *audio.IntBuffer
+  format pcmFormat
+  maxSampleValue int
+  dataOffset int64
+  dataSize int64 // bytes of samples written
+  bytes []byte
+  writer *bufio.Writer
+  fileIo *os.File
+}
+
+// Getters
+func (pr *pcmReader) GetBitDepth() int {
+  return pr.BitDepth
+}
+
+func (pr *pcmReader) GetSampleRate() int {
+  return pr.SampleRate
+}
+
+func (pr *pcmReader) GetNumChans() int {
+  return pr.NumChans
+}
+
+func (pr *pcmReader) GetNumSampleFrames() int {
+  return pr.NumSampleFrames
+}
+
+func (pr *pcmReader) GetDuration() float64 {
+  return pr.Duration
+}
+
+// the fewest bytes that hold a sample at the bit depth, 0 if it isn't one
+// gopvoc handles. Samples narrower than their bytes, such as 12 bit samples
+// in 2 bytes, are stored in the high bits
+func pcmSampleBytes(bitDepth int) int {
+  if bitDepth < 1 || bitDepth > 32 {
+    return 0
+  }
+
+  return (bitDepth + 7) / 8
+}
+
+// the header has been parsed into AudioFile, dataSize is the length of the
+// data chunk in bytes, -1 when it runs to the end of the file
+func (pr *pcmReader) openData(bufferLength int, dataOffset, dataSize int64) error {
+  if pr.NumChans == 0 {
+    return errors.New("pcmReader.NumChans is 0")
+  }
+
+  if pr.SampleRate == 0 {
+    return errors.New("pcmReader.SampleRate is 0")
+  }
+
+  sampleBytes := pr.format.sampleBytes(pr.BitDepth)
+
+  if sampleBytes == 0 || sampleBytes > 4 {
+    return fmt.Errorf("Unsupported bit depth %d", pr.BitDepth)
+  }
+
+  // read at their own bit depth, 20 bit samples in 3 bytes are shifted down
+  if pr.format.floatScale == 0 {
+    if pr.BitDepth < 1 || pr.BitDepth > sampleBytes * 8 {
+      return fmt.Errorf("%d bit samples in %d bytes are not supported", pr.BitDepth, sampleBytes)
+    }
+
+    pr.format.padBits = uint(sampleBytes * 8 - pr.BitDepth)
+  }
+
+  fileInfo, err := pr.fileIo.Stat()
+
+  if err != nil {
+    return err
+  }
+
+  // a truncated file or an unknown size reads to the end of the file
+  available := fileInfo.Size() - dataOffset
+  if dataSize < 0 || dataSize > available {
+    dataSize = available
+  }
+
+  pr.dataOffset = dataOffset
+  pr.blockAlign = sampleBytes * pr.NumChans
+  pr.NumSampleFrames = int(dataSize / int64(pr.blockAlign))
+  pr.Duration = float64(pr.NumSampleFrames) / float64(pr.SampleRate)
+  pr.bytes = make([]byte, bufferLength * pr.blockAlign, bufferLength * pr.blockAlign)
+
+  format := &audio.Format{
+    NumChannels: pr.NumChans,
+    SampleRate: pr.SampleRate,
+  }
+
+  pr.ReadBuffer = &audio.IntBuffer{
+    Format: format,
+    Data: make([]int, bufferLength * pr.NumChans, bufferLength * pr.NumChans),
+    SourceBitDepth: pr.BitDepth,
+  }
+
+  return pr.Seek(0)
+}
+
+// channel is zero indexed
+func (pr *pcmReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
+  if pr.NumChans == 0 {
+    return nil, errors.New("pcmReader.has no channels to extract")
+  }
+
+  if channel > pr.NumChans - 1 {
+    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, pr.NumChans - 1)
+  }
+
+  buffer := &audio.IntBuffer{
+    Format: pr.ReadBuffer.Format,
+    Data: make([]int, pr.ReadBuffer.NumFrames(), pr.ReadBuffer.NumFrames()),
+    SourceBitDepth: pr.ReadBuffer.SourceBitDepth,
+  }
+
+  x := 0
+  for i := channel; i < len(pr.ReadBuffer.Data); i += pr.NumChans {
+    buffer.Data[x] = pr.ReadBuffer.Data[i]
+    x++
+  }
+
+  return buffer, nil
+}
+
+func (pr *pcmReader) Close() {
+  pr.fileIo.Close()
+}
+
+// numSamples is the number of samples read across all channels
+// numFrames is the number of samples per channel
+func (pr *pcmReader) ReadNext() (numSamples, numFrames int, err error) {
+  numFrames = pr.ReadBuffer.NumFrames()
+
+  if remaining := pr.NumSampleFrames - pr.position; numFrames > remaining {
+    numFrames = remaining
+  }
+
+  n, err := io.ReadFull(pr.reader, pr.bytes[:numFrames * pr.blockAlign])
+
+  if err == io.EOF || err == io.ErrUnexpectedEOF {
+    err = nil
+  }
+
+  if err != nil {
+    return 0, 0, err
+  }
+
+  numFrames = n / pr.blockAlign
+  numSamples = numFrames * pr.NumChans
+  sampleBytes := pr.blockAlign / pr.NumChans
+
+  for i := 0; i < numSamples; i++ {
+    pr.ReadBuffer.Data[i] = pr.format.decode(pr.bytes[i * sampleBytes:(i + 1) * sampleBytes])
+  }
+
+  // the rest of a short read is silence
+  for i := numSamples; i < len(pr.ReadBuffer.Data); i++ {
+    pr.ReadBuffer.Data[i] = 0
+  }
+
+  pr.position += numFrames
+  return
+}
+
+// the next ReadNext starts at sampleFrame
+func (pr *pcmReader) Seek(sampleFrame int) error {
+  if sampleFrame < 0 || sampleFrame > pr.NumSampleFrames {
+    return fmt.Errorf("Cannot seek to sample frame %d of %d", sampleFrame, pr.NumSampleFrames)
+  }
+
+  _, err := pr.fileIo.Seek(pr.dataOffset + int64(sampleFrame) * int64(pr.blockAlign), io.SeekStart)
+
+  if err != nil {
+    return err
+  }
+
+  if pr.reader == nil {
+    pr.reader = bufio.NewReaderSize(pr.fileIo, pcmIoBufferSize)
+  } else {
+    pr.reader.Reset(pr.fileIo)
+  }
+
+  pr.position = sampleFrame
+  return nil
+}
+
+// one sample from its bytes
+func (f pcmFormat) decode(sample []byte) int {
+  return f.decodeStored(sample) >> f.padBits
+}
+
+// the sample as it is stored, at the bit depth of its bytes
+func (f pcmFormat) decodeStored(sample []byte) int {
+  if f.floatScale != 0 {
+    bits := binary.LittleEndian.Uint32(sample)
+    if f.bigEndian {
+      bits = binary.BigEndian.Uint32(sample)
+    }
+    return int(math.Round(float64(math.Float32frombits(bits)) * f.floatScale))
+  }
+
+  switch len(sample) {
+  case 1:
+    if f.unsigned8 {
+      return int(sample[0]) - 128
+    }
+    return int(int8(sample[0]))
+  case 2:
+    if f.bigEndian {
+      return int(int16(uint16(sample[0]) << 8 | uint16(sample[1])))
+    }
+    return int(int16(uint16(sample[1]) << 8 | uint16(sample[0])))
+  case 3:
+    if f.bigEndian {
+      return int(int32(uint32(sample[0]) << 24 | uint32(sample[1]) << 16 | uint32(sample[2]) << 8) >> 8)
+    }
+    return int(int32(uint32(sample[2]) << 24 | uint32(sample[1]) << 16 | uint32(sample[0]) << 8) >> 8)
+  }
+
+  if f.bigEndian {
+    return int(int32(uint32(sample[0]) << 24 | uint32(sample[1]) << 16 | uint32(sample[2]) << 8 | uint32(sample[3])))
+  }
+  return int(int32(uint32(sample[3]) << 24 | uint32(sample[2]) << 16 | uint32(sample[1]) << 8 | uint32(sample[0])))
+}
+
+// one sample into its bytes
+func (f pcmFormat) encode(value int, sample []byte) {
+  if f.floatScale != 0 {
+    bits := math.Float32bits(float32(float64(value) / f.floatScale))
+    if f.bigEndian {
+      binary.BigEndian.PutUint32(sample, bits)
+    } else {
+      binary.LittleEndian.PutUint32(sample, bits)
+    }
+    return
+  }
+
+  value <<= f.padBits
+
+  if len(sample) == 1 {
+    if f.unsigned8 {
+      value += 128
+    }
+    sample[0] = byte(value)
+    return
+  }
+
+  for i := range sample {
+    shift := uint(i * 8)
+    if f.bigEndian {
+      shift = uint((len(sample) - 1 - i) * 8)
+    }
+    sample[i] = byte(value >> shift)
+  }
+}
+
+// creates the file and writes the header, the samples follow it
+func (pw *pcmWriter) createData(bufferLength int, header []byte) error {
+  var err error
+
+  pw.maxSampleValue = IntMaxSignedValue[pw.BitDepth]
+
+  if pw.maxSampleValue == 0 {
+    return fmt.Errorf("Cannot write %d bit samples, only 8, 16, 24 or 32", pw.BitDepth)
+  }
+
+  if pw.NumChans < 1 {
+    return fmt.Errorf("Cannot write %d channels", pw.NumChans)
+  }
+
+  pw.fileIo, err = os.Create(pw.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  pw.writer = bufio.NewWriterSize(pw.fileIo, pcmIoBufferSize)
+
+  if _, err = pw.writer.Write(header); err != nil {
+    return err
+  }
+
+  pw.dataOffset = int64(len(header))
+  pw.dataSize = 0
+
+  blockAlign := pw.format.sampleBytes(pw.BitDepth) * pw.NumChans
+  pw.bytes = make([]byte, bufferLength * blockAlign, bufferLength * blockAlign)
+
+  format := &audio.Format{
+    NumChannels: pw.NumChans,
+    SampleRate: pw.SampleRate,
+  }
+
+  pw.WriteBuffer = &audio.IntBuffer{
+    Format: format,
+    Data: make([]int, bufferLength * pw.NumChans, bufferLength * pw.NumChans),
+    SourceBitDepth: pw.BitDepth,
+  }
+
+  return nil
+}
+
+func (pw *pcmWriter) Write(buffer *audio.IntBuffer) error {
+  sampleBytes := pw.format.sampleBytes(pw.BitDepth)
+  size := len(buffer.Data) * sampleBytes
+
+  if size > len(pw.bytes) {
+    pw.bytes = make([]byte, size, size)
+  }
+
+  // clip gaurd: if any sample in the int buffer exceeds maximum allowed for the
+  // buffer's BitDepth, clip the sample instead of letting the encoder have it
+  for i, sample := range buffer.Data {
+    if sample > pw.maxSampleValue {
+      sample = pw.maxSampleValue
+    } else if sample < -pw.maxSampleValue {
+      sample = -pw.maxSampleValue
+    }
+
+    buffer.Data[i] = sample
+    pw.format.encode(sample, pw.bytes[i * sampleBytes:(i + 1) * sampleBytes])
+  }
+
+  n, err := pw.writer.Write(pw.bytes[:size])
+  pw.dataSize += int64(n)
+
+  return err
+}
+
+func (pw *pcmWriter) ZeroWriteBuffer() {
+  for i := 0; i < len(pw.WriteBuffer.Data); i++ {
+    pw.WriteBuffer.Data[i] = 0
+  }
+}
+
+func (pw *pcmWriter) WriteNext() error {
+  return pw.Write(pw.WriteBuffer)
+}
+
+func (pw *pcmWriter) InterleaveChannel(channel int, data []int) error {
+  if len(data) * pw.NumChans != len(pw.WriteBuffer.Data) {
+    return errors.New("Data to interleave will not fit exactly into WriteBuffer")
+  }
+
+  for frameNumber :=0; frameNumber < len(data); frameNumber++ {
+    i := frameNumber * pw.NumChans
+    pw.WriteBuffer.Data[i + channel] = data[frameNumber]
+  }
+
+  return nil
+}
+
+// flushes the samples, then writes the header fields at their offsets and
+// closes the file
+func (pw *pcmWriter) closeData(patches ...pcmPatch) {
+  pw.writer.Flush()
+
+  for _, patch := range patches {
+    pw.fileIo.WriteAt(patch.data, patch.offset)
+  }
+
+  pw.fileIo.Close()
+}
+
+// the bytes of a header field
+func littleEndian(value interface{}) []byte {
+  field := &bytes.Buffer{}
+  binary.Write(field, binary.LittleEndian, value)
+  return field.Bytes()
+}
+
+func bigEndian(value interface{}) []byte {
+  field := &bytes.Buffer{}
+  binary.Write(field, binary.BigEndian, value)
+  return field.Bytes()
+}
+
+// bytes to write over the header once the sizes are known
+type pcmPatch struct {
+  offset int64
+  data []byte
+}
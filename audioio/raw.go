@@ -0,0 +1,177 @@
+package audioio
+
+import(
+  "fmt"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// the encodings of headerless PCM, named as ffmpeg names them
+var rawEncodings = map[string]struct {
+  bitDepth int
+  format pcmFormat
+}{
+  "u8": {8, pcmFormat{unsigned8: true}},
+  "s8": {8, pcmFormat{}},
+  "s16le": {16, pcmFormat{}},
+  "s16be": {16, pcmFormat{bigEndian: true}},
+  "s24le": {24, pcmFormat{}},
+  "s24be": {24, pcmFormat{bigEndian: true}},
+  "s32le": {32, pcmFormat{}},
+  "s32be": {32, pcmFormat{bigEndian: true}},
+  "f32le": {floatBitDepth, pcmFormat{floatScale: float64(IntMaxSignedValue[floatBitDepth])}},
+  "f32be": {floatBitDepth, pcmFormat{bigEndian: true, floatScale: float64(IntMaxSignedValue[floatBitDepth])}},
+}
+
+// the keys of rawEncodings in order, for messages
+const rawEncodingNames = "u8, s8, s16le, s16be, s24le, s24be, s32le, s32be, f32le, f32be"
+
+// float samples are scaled to 24 bit integers
+const floatBitDepth = 24
+
+// the sample rate of .npy arrays that have no input format
+const defaultNpySampleRate = 44100
+
+// describes an input file the magic bytes can't, raw PCM has no header and a
+// .npy array has no sample rate, a split input is a set of mono files. The
+// zero InputFormat reads everything from the file
+type InputFormat struct {
+  FileType int // TYPE_RAW or TYPE_NPY
+  Encoding string // raw only
+  SampleRate int
+  NumChans int // raw only
+  SplitNames []string // read from a mono file per channel name, nil if it isn't split
+}
+
+// Headerless PCM, the format comes from an InputFormat. Files are written as
+// signed little endian samples
+type RawReader struct {
+  pcmReader
+  Encoding string
+}
+
+type RawWriter struct {
+  pcmWriter
+}
+
+// ParseInputFormat parses raw:<encoding>:<sample rate>:<channels>, such as
+// raw:s16le:48000:2, or npy:<sample rate>
+func ParseInputFormat(spec string) (InputFormat, error) {
+  parts := strings.Split(spec, ":")
+
+  switch parts[0] {
+  case "raw":
+    if len(parts) != 4 {
+      return InputFormat{}, fmt.Errorf("Raw input format must be raw:<encoding>:<sample rate>:<channels>, got %s", spec)
+    }
+
+    if _, ok := rawEncodings[parts[1]]; !ok {
+      return InputFormat{}, fmt.Errorf("Raw encoding must be one of: %s, got %s", rawEncodingNames, parts[1])
+    }
+
+    sampleRate, err := strconv.Atoi(parts[2])
+
+    if err != nil || sampleRate <= 0 {
+      return InputFormat{}, fmt.Errorf("Raw sample rate must be a positive integer, got %s", parts[2])
+    }
+
+    numChans, err := strconv.Atoi(parts[3])
+
+    if err != nil || numChans <= 0 {
+      return InputFormat{}, fmt.Errorf("Raw channels must be a positive integer, got %s", parts[3])
+    }
+
+    return InputFormat{FileType: TYPE_RAW, Encoding: parts[1], SampleRate: sampleRate, NumChans: numChans}, nil
+  case "npy":
+    if len(parts) != 2 {
+      return InputFormat{}, fmt.Errorf("NumPy input format must be npy:<sample rate>, got %s", spec)
+    }
+
+    sampleRate, err := strconv.Atoi(parts[1])
+
+    if err != nil || sampleRate <= 0 {
+      return InputFormat{}, fmt.Errorf("NumPy sample rate must be a positive integer, got %s", parts[1])
+    }
+
+    return InputFormat{FileType: TYPE_NPY, SampleRate: sampleRate}, nil
+  }
+
+  return InputFormat{}, fmt.Errorf("Input format must start with raw: or npy:, got %s", spec)
+}
+
+// InputFormat is what a file written as format reads back with, audioFile
+// is what was written. Headered files need none, raw PCM and .npy arrays
+// need what their writers leave out, and split outputs the names of their
+// files
+func (format OutputFormat) InputFormat(audioFile AudioFile) (InputFormat, error) {
+  fileType := format.FileType
+
+  if fileType == 0 {
+    var err error
+    if fileType, err = OutputFileType(audioFile.Filepath); err != nil {
+      return InputFormat{}, err
+    }
+  }
+
+  var inputFormat InputFormat
+
+  switch fileType {
+  case TYPE_RAW:
+    capabilities, _ := Capabilities(TYPE_RAW)
+    bitDepth := capabilities.WriteBitDepth(audioFile.BitDepth)
+    encoding := fmt.Sprintf("s%dle", bitDepth)
+
+    if bitDepth == 8 {
+      encoding = "s8"
+    }
+
+    inputFormat = InputFormat{FileType: TYPE_RAW, Encoding: encoding, SampleRate: audioFile.SampleRate, NumChans: audioFile.NumChans}
+  case TYPE_NPY:
+    inputFormat = InputFormat{FileType: TYPE_NPY, SampleRate: audioFile.SampleRate}
+  }
+
+  if format.Split {
+    inputFormat.SplitNames = writtenSplitNames(format.SplitNames, audioFile.NumChans)
+  }
+
+  return inputFormat, nil
+}
+
+// bufferLength: how many frames to read at one time
+func (rr *RawReader) Open(bufferLength int) (err error) {
+  encoding, ok := rawEncodings[rr.Encoding]
+
+  if !ok {
+    return fmt.Errorf("Unknown raw encoding %s", rr.Encoding)
+  }
+
+  rr.fileIo, err = os.Open(rr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  // the file isn't left open when it can't be read
+  defer func() {
+    if err != nil {
+      rr.fileIo.Close()
+    }
+  }()
+
+  rr.BitDepth = encoding.bitDepth
+  rr.format = encoding.format
+
+  return rr.openData(bufferLength, 0, -1)
+}
+
+// RawWriter
+func (rw *RawWriter) Create(bufferLength int) error {
+  rw.format = pcmFormat{}
+
+  return rw.createData(bufferLength, nil)
+}
+
+func (rw *RawWriter) Close() {
+  rw.closeData()
+}
@@ -0,0 +1,126 @@
+package audioio
+
+import(
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+  "github.com/go-audio/audio"
+)
+
+// a position in a file, given in seconds or in sample frames
+type Position struct {
+  Seconds float64
+  Frames int
+  InFrames bool
+}
+
+// rangeReader reads the sample frames from start up to end of another
+// reader, as if they were the whole file
+type rangeReader struct {
+  Reader
+  start int
+  end int
+  position int
+  lastFrames int // read by the last ReadNext
+}
+
+// ParsePosition parses seconds (1.5), sample frames (72000smp) or a
+// timecode ([hh:]mm:ss.fff)
+func ParsePosition(text string) (Position, error) {
+  if strings.HasSuffix(text, "smp") {
+    frames, err := strconv.Atoi(strings.TrimSuffix(text, "smp"))
+
+    if err != nil || frames < 0 {
+      return Position{}, fmt.Errorf("Position in sample frames must be a whole number of at least 0, got %s", text)
+    }
+
+    return Position{Frames: frames, InFrames: true}, nil
+  }
+
+  // the parts of a timecode are sixty of the next
+  seconds := 0.0
+  parts := strings.Split(text, ":")
+
+  if len(parts) > 3 {
+    return Position{}, fmt.Errorf("Timecode must be [hh:]mm:ss.fff, got %s", text)
+  }
+
+  for i, part := range parts {
+    value, err := strconv.ParseFloat(part, 64)
+
+    if err != nil || value < 0 || math.IsInf(value, 0) || (i > 0 && value >= 60) {
+      return Position{}, fmt.Errorf("Position must be seconds, sample frames (such as 72000smp) or a timecode ([hh:]mm:ss.fff), got %s", text)
+    }
+
+    seconds = seconds * 60 + value
+  }
+
+  return Position{Seconds: seconds}, nil
+}
+
+// the sample frame of the position at the sample rate
+func (p Position) Frame(sampleRate int) int {
+  if p.InFrames {
+    return p.Frames
+  }
+
+  return int(math.Round(p.Seconds * float64(sampleRate)))
+}
+
+// SetRange limits reading to the sample frames from start up to end, call it
+// after Open. Seek and the number of sample frames are relative to start
+func (ar *AudioReader) SetRange(start, end int) error {
+  if start < 0 || end > ar.GetNumSampleFrames() || start >= end {
+    return fmt.Errorf("Range of sample frames %d to %d is not within the %d of the file", start, end, ar.GetNumSampleFrames())
+  }
+
+  ar.Reader = &rangeReader{Reader: ar.Reader, start: start, end: end}
+  return ar.Reader.Seek(0)
+}
+
+func (rr *rangeReader) GetNumSampleFrames() int {
+  return rr.end - rr.start
+}
+
+func (rr *rangeReader) GetDuration() float64 {
+  return float64(rr.end - rr.start) / float64(rr.GetSampleRate())
+}
+
+// reads up to end, the numbers read are cut there
+func (rr *rangeReader) ReadNext() (numSamples, numFrames int, err error) {
+  numSamples, numFrames, err = rr.Reader.ReadNext()
+
+  if remaining := rr.end - rr.start - rr.position; numFrames > remaining {
+    numFrames = remaining
+    numSamples = remaining * rr.GetNumChans()
+  }
+
+  rr.position += numFrames
+  rr.lastFrames = numFrames
+  return
+}
+
+// channel is zero indexed, the samples after end are silence
+func (rr *rangeReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
+  buffer, err := rr.Reader.ExtractChannel(channel)
+
+  if err != nil {
+    return nil, err
+  }
+
+  for i := rr.lastFrames; i < len(buffer.Data); i++ {
+    buffer.Data[i] = 0
+  }
+
+  return buffer, nil
+}
+
+func (rr *rangeReader) Seek(sampleFrame int) error {
+  if sampleFrame < 0 || sampleFrame > rr.end - rr.start {
+    return fmt.Errorf("Cannot seek to sample frame %d of %d", sampleFrame, rr.end - rr.start)
+  }
+
+  rr.position = sampleFrame
+  return rr.Reader.Seek(rr.start + sampleFrame)
+}
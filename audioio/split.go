@@ -0,0 +1,288 @@
+package audioio
+
+import(
+  "errors"
+  "fmt"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "github.com/go-audio/audio"
+)
+
+// A set of mono files read as the channels of one file, such as name.L.wav,
+// name.R.wav and name.C.wav for name.wav split into L, R and C. The files
+// must have the same sample rate, bit depth and length
+type SplitReader struct {
+  AudioFile
+  Paths []string // one mono file per channel
+  Format InputFormat // of every file
+  readers []*AudioReader
+}
+
+// Writes each channel to its own mono file, named after the channel
+type SplitWriter struct {
+  AudioFile
+  Names []string // of the channels, numbered from 1 if there are none for every channel
+  fileType int // of every file
+  writers []*AudioWriter
+}
+
+// SplitPaths are the files of the channels of filePath, the channel name
+// goes before the extension
+func SplitPaths(filePath string, names []string) []string {
+  extension := filepath.Ext(filePath)
+  paths := []string{}
+
+  for _, name := range names {
+    paths = append(paths, strings.TrimSuffix(filePath, extension) + "." + name + extension)
+  }
+
+  return paths
+}
+
+// the names a split output of numChans channels is written with, numbered
+// from 1 if there aren't names for every channel
+func writtenSplitNames(names []string, numChans int) []string {
+  if len(names) == numChans {
+    return names
+  }
+
+  names = []string{}
+  for c := 1; c <= numChans; c++ {
+    names = append(names, strconv.Itoa(c))
+  }
+
+  return names
+}
+
+// ParseSplitNames parses a list of channel names such as L,R,C
+func ParseSplitNames(text string) ([]string, error) {
+  names := strings.Split(text, ",")
+  seen := map[string]bool{}
+
+  for _, name := range names {
+    if name == "" || strings.ContainsAny(name, "/\\") {
+      return nil, fmt.Errorf("Split channel names must be a list of names such as L,R,C, got %s", text)
+    }
+
+    if seen[name] {
+      return nil, fmt.Errorf("Split channel name %s is listed more than once", name)
+    }
+
+    seen[name] = true
+  }
+
+  return names, nil
+}
+
+// InputPaths are the files read for filePath, the split files if format is
+// split
+func InputPaths(filePath string, format InputFormat) []string {
+  if format.SplitNames != nil {
+    return SplitPaths(filePath, format.SplitNames)
+  }
+
+  return []string{filePath}
+}
+
+func (sr *SplitReader) GetBitDepth() int {
+  return sr.BitDepth
+}
+
+func (sr *SplitReader) GetSampleRate() int {
+  return sr.SampleRate
+}
+
+func (sr *SplitReader) GetNumChans() int {
+  return sr.NumChans
+}
+
+func (sr *SplitReader) GetNumSampleFrames() int {
+  if len(sr.readers) == 0 {
+    return 0
+  }
+
+  return sr.readers[0].GetNumSampleFrames()
+}
+
+func (sr *SplitReader) GetDuration() float64 {
+  if len(sr.readers) == 0 {
+    return 0
+  }
+
+  return sr.readers[0].GetDuration()
+}
+
+// bufferLength: how many frames to read at one time
+func (sr *SplitReader) Open(bufferLength int) error {
+  sr.readers = []*AudioReader{}
+
+  for _, path := range sr.Paths {
+    reader, err := NewAudioReader(path, sr.Format)
+
+    if err != nil {
+      sr.Close()
+      return fmt.Errorf("%s: %v", filepath.Base(path), err)
+    }
+
+    if err = reader.Open(bufferLength); err != nil {
+      sr.Close()
+      return fmt.Errorf("%s: %v", filepath.Base(path), err)
+    }
+
+    sr.readers = append(sr.readers, reader)
+    first := sr.readers[0]
+
+    switch {
+    case reader.GetNumChans() != 1:
+      err = fmt.Errorf("%s has %d channels, split files must be mono", filepath.Base(path), reader.GetNumChans())
+    case reader.GetSampleRate() != first.GetSampleRate():
+      err = fmt.Errorf("%s has a sample rate of %d, %s has %d", filepath.Base(path), reader.GetSampleRate(), filepath.Base(sr.Paths[0]), first.GetSampleRate())
+    case reader.GetBitDepth() != first.GetBitDepth():
+      err = fmt.Errorf("%s has a bit depth of %d, %s has %d", filepath.Base(path), reader.GetBitDepth(), filepath.Base(sr.Paths[0]), first.GetBitDepth())
+    case reader.GetNumSampleFrames() != first.GetNumSampleFrames():
+      err = fmt.Errorf("%s has %d sample frames, %s has %d", filepath.Base(path), reader.GetNumSampleFrames(), filepath.Base(sr.Paths[0]), first.GetNumSampleFrames())
+    }
+
+    if err != nil {
+      sr.Close()
+      return err
+    }
+  }
+
+  if len(sr.readers) == 0 {
+    return errors.New("Split input has no files")
+  }
+
+  sr.NumChans = len(sr.readers)
+  sr.SampleRate = sr.readers[0].GetSampleRate()
+  sr.BitDepth = sr.readers[0].GetBitDepth()
+
+  return nil
+}
+
+func (sr *SplitReader) Close() {
+  for _, reader := range sr.readers {
+    reader.Close()
+  }
+}
+
+// the files are the same length, so they all read as many frames
+func (sr *SplitReader) ReadNext() (numSamples, numFrames int, err error) {
+  for i, reader := range sr.readers {
+    _, frames, err := reader.ReadNext()
+
+    if err != nil {
+      return 0, 0, err
+    }
+
+    if i == 0 {
+      numFrames = frames
+    }
+  }
+
+  return numFrames * sr.NumChans, numFrames, nil
+}
+
+func (sr *SplitReader) Seek(sampleFrame int) error {
+  for _, reader := range sr.readers {
+    if err := reader.Seek(sampleFrame); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// channel is zero indexed, the only channel of its file
+func (sr *SplitReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
+  if channel < 0 || channel >= len(sr.readers) {
+    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, len(sr.readers) - 1)
+  }
+
+  return sr.readers[channel].ExtractChannel(0)
+}
+
+// SplitWriter
+func (sw *SplitWriter) Create(bufferLength int) error {
+  names := writtenSplitNames(sw.Names, sw.NumChans)
+
+  sw.writers = []*AudioWriter{}
+
+  for _, path := range SplitPaths(sw.Filepath, names) {
+    writer, err := NewAudioWriter(AudioFile{
+      Filepath: path,
+      NumChans: 1,
+      SampleRate: sw.SampleRate,
+      BitDepth: sw.BitDepth,
+    }, OutputFormat{FileType: sw.fileType})
+
+    if err == nil {
+      err = writer.Create(bufferLength)
+    }
+
+    if err != nil {
+      sw.Close()
+      return fmt.Errorf("%s: %v", filepath.Base(path), err)
+    }
+
+    sw.writers = append(sw.writers, writer)
+  }
+
+  return nil
+}
+
+func (sw *SplitWriter) Close() {
+  for _, writer := range sw.writers {
+    writer.Close()
+  }
+}
+
+// buffer is interleaved, each channel is written to its file
+func (sw *SplitWriter) Write(buffer *audio.IntBuffer) error {
+  numFrames := len(buffer.Data) / sw.NumChans
+
+  for c, writer := range sw.writers {
+    data := make([]int, numFrames, numFrames)
+
+    for i := range data {
+      data[i] = buffer.Data[i * sw.NumChans + c]
+    }
+
+    err := writer.Write(&audio.IntBuffer{
+      Format: &audio.Format{NumChannels: 1, SampleRate: sw.SampleRate},
+      Data: data,
+      SourceBitDepth: sw.BitDepth,
+    })
+
+    if err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+func (sw *SplitWriter) WriteNext() error {
+  for _, writer := range sw.writers {
+    if err := writer.WriteNext(); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+func (sw *SplitWriter) InterleaveChannel(channel int, data []int) error {
+  if channel < 0 || channel >= len(sw.writers) {
+    return fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, len(sw.writers) - 1)
+  }
+
+  return sw.writers[channel].InterleaveChannel(0, data)
+}
+
+func (sw *SplitWriter) ZeroWriteBuffer() {
+  for _, writer := range sw.writers {
+    writer.ZeroWriteBuffer()
+  }
+}
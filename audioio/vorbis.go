@@ -0,0 +1,197 @@
+package audioio
+
+import(
+  "fmt"
+  "errors"
+  "io"
+  "math"
+  "os"
+  "strings"
+  "github.com/go-audio/audio"
+  "github.com/jfreymuth/oggvorbis"
+)
+
+// decoded samples are floats, scaled to 24 bit integers
+const vorbisBitDepth = 24
+
+type VorbisReader struct {
+  AudioFile
+  ReadBuffer *audio.IntBuffer
+  NumSampleFrames int
+  Duration float64
+  Tags [][2]string // Vorbis comments, name and value
+  stream *oggvorbis.Reader
+  startPosition int64 // granule position of the first sample
+  floatBuffer []float32
+  fileIo *os.File
+}
+
+// the codec of the first logical stream of an Ogg file, from the first
+// packet on its first page
+func oggCodec(header []byte) string {
+  if len(header) < 27 || string(header[:4]) != "OggS" {
+    return ""
+  }
+
+  packet := header[27 + int(header[26]):]
+
+  if len(packet) >= 7 && string(packet[:7]) == "\x01vorbis" {
+    return "vorbis"
+  }
+
+  return ""
+}
+
+// Getters
+func (vr *VorbisReader) GetBitDepth() int {
+  return vr.BitDepth
+}
+
+func (vr *VorbisReader) GetSampleRate() int {
+  return vr.SampleRate
+}
+
+func (vr *VorbisReader) GetNumChans() int {
+  return vr.NumChans
+}
+
+func (vr *VorbisReader) GetNumSampleFrames() int {
+  return vr.NumSampleFrames
+}
+
+func (vr *VorbisReader) GetDuration() float64 {
+  return vr.Duration
+}
+
+// bufferLength: how many frames to read at one time
+func (vr *VorbisReader) Open(bufferLength int) (err error) {
+  vr.fileIo, err = os.Open(vr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  // the file isn't left open when it can't be decoded
+  defer func() {
+    if err != nil {
+      vr.fileIo.Close()
+    }
+  }()
+
+  // the length comes from the granule position of the last page, which
+  // already leaves out the encoder padding
+  vr.stream, err = oggvorbis.NewReader(vr.fileIo)
+
+  if err != nil {
+    return err
+  }
+
+  if vr.stream.Channels() == 0 {
+    return errors.New("VorbisReader.stream.Channels is 0")
+  }
+
+  if vr.stream.SampleRate() == 0 {
+    return errors.New("VorbisReader.stream.SampleRate is 0")
+  }
+
+  vr.Tags = [][2]string{}
+  for _, comment := range vr.stream.CommentHeader().Comments {
+    parts := strings.SplitN(comment, "=", 2)
+
+    if len(parts) == 2 {
+      vr.Tags = append(vr.Tags, [2]string{parts[0], parts[1]})
+    }
+  }
+
+  vr.NumChans = vr.stream.Channels()
+  vr.BitDepth = vorbisBitDepth
+  vr.SampleRate = vr.stream.SampleRate()
+  vr.startPosition = vr.stream.Position()
+  vr.NumSampleFrames = int(vr.stream.Length() - vr.startPosition)
+  vr.Duration = float64(vr.NumSampleFrames) / float64(vr.SampleRate)
+  vr.floatBuffer = make([]float32, bufferLength * vr.NumChans, bufferLength * vr.NumChans)
+
+  format := &audio.Format{
+    NumChannels: vr.NumChans,
+    SampleRate: vr.SampleRate,
+  }
+
+  vr.ReadBuffer = &audio.IntBuffer{
+    Format: format,
+    Data: make([]int, bufferLength * vr.NumChans, bufferLength * vr.NumChans),
+    SourceBitDepth: vr.BitDepth,
+  }
+
+  return nil
+}
+
+// channel is zero indexed
+func (vr *VorbisReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
+  if vr.NumChans == 0 {
+    return nil, errors.New("VorbisReader.has no channels to extract")
+  }
+
+  if channel > vr.NumChans - 1 {
+    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, vr.NumChans - 1)
+  }
+
+  buffer := &audio.IntBuffer{
+    Format: vr.ReadBuffer.Format,
+    Data: make([]int, vr.ReadBuffer.NumFrames(), vr.ReadBuffer.NumFrames()),
+    SourceBitDepth: vr.ReadBuffer.SourceBitDepth,
+  }
+
+  x := 0
+  for i := channel; i < len(vr.ReadBuffer.Data); i += vr.NumChans {
+    buffer.Data[x] = vr.ReadBuffer.Data[i]
+    x++
+  }
+
+  return buffer, nil
+}
+
+func (vr *VorbisReader) Close() {
+  vr.fileIo.Close()
+}
+
+// numSamples is the number of samples read across all channels
+// numFrames is the number of samples per channel
+func (vr *VorbisReader) ReadNext() (numSamples, numFrames int, err error) {
+  maxSampleValue := float64(IntMaxSignedValue[vr.BitDepth])
+
+  // the stream returns at most one packet per read
+  for numSamples < len(vr.floatBuffer) {
+    n, err := vr.stream.Read(vr.floatBuffer[numSamples:])
+
+    for i, sample := range vr.floatBuffer[numSamples:numSamples + n] {
+      vr.ReadBuffer.Data[numSamples + i] = int(math.Round(float64(sample) * maxSampleValue))
+    }
+
+    numSamples += n
+
+    if err == io.EOF {
+      break
+    }
+
+    if err != nil {
+      return numSamples, numSamples / vr.NumChans, err
+    }
+  }
+
+  // the rest of a short read is silence
+  for i := numSamples; i < len(vr.ReadBuffer.Data); i++ {
+    vr.ReadBuffer.Data[i] = 0
+  }
+
+  numFrames = numSamples / vr.NumChans
+  return
+}
+
+// the next ReadNext starts at sampleFrame
+func (vr *VorbisReader) Seek(sampleFrame int) error {
+  if sampleFrame < 0 || sampleFrame > vr.NumSampleFrames {
+    return fmt.Errorf("Cannot seek to sample frame %d of %d", sampleFrame, vr.NumSampleFrames)
+  }
+
+  return vr.stream.SetPosition(vr.startPosition + int64(sampleFrame))
+}
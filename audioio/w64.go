@@ -0,0 +1,121 @@
+package audioio
+
+import(
+  "bytes"
+  "fmt"
+  "encoding/binary"
+  "errors"
+  "io"
+  "os"
+)
+
+// Sony Wave64 replaces the RIFF chunk ids with GUIDs and the sizes with 64 bit
+// sizes that include the chunk header, chunks start on 8 byte boundaries
+var w64RiffGUID = []byte{0x72, 0x69, 0x66, 0x66, 0x2e, 0x91, 0xcf, 0x11, 0xa5, 0xd6, 0x28, 0xdb, 0x04, 0xc1, 0x00, 0x00}
+var w64WaveGUID = []byte{0x77, 0x61, 0x76, 0x65, 0xf3, 0xac, 0xd3, 0x11, 0x8c, 0xd1, 0x00, 0xc0, 0x4f, 0x8e, 0xdb, 0x8a}
+var w64FmtGUID = []byte{0x66, 0x6d, 0x74, 0x20, 0xf3, 0xac, 0xd3, 0x11, 0x8c, 0xd1, 0x00, 0xc0, 0x4f, 0x8e, 0xdb, 0x8a}
+var w64DataGUID = []byte{0x64, 0x61, 0x74, 0x61, 0xf3, 0xac, 0xd3, 0x11, 0x8c, 0xd1, 0x00, 0xc0, 0x4f, 0x8e, 0xdb, 0x8a}
+
+// GUID and size
+const w64ChunkHeaderSize = 24
+
+// Sony Wave64 files hold the same samples as WAV files, with no size limit
+type W64Reader struct {
+  pcmReader
+}
+
+type W64Writer struct {
+  pcmWriter
+}
+
+// bufferLength: how many frames to read at one time
+func (wr *W64Reader) Open(bufferLength int) (err error) {
+  wr.fileIo, err = os.Open(wr.Filepath)
+
+  if err != nil {
+    return err
+  }
+
+  // the file isn't left open when its chunks can't be read
+  defer func() {
+    if err != nil {
+      wr.fileIo.Close()
+    }
+  }()
+
+  wr.format = pcmFormat{unsigned8: true}
+
+  header := make([]byte, 40)
+
+  if _, err = io.ReadFull(wr.fileIo, header); err != nil {
+    return err
+  }
+
+  if !bytes.Equal(header[:16], w64RiffGUID) || !bytes.Equal(header[24:], w64WaveGUID) {
+    return errors.New("Not a Wave64 file")
+  }
+
+  offset := int64(40)
+  foundFmt := false
+
+  // the chunks up to the samples
+  for {
+    chunkHeader := make([]byte, w64ChunkHeaderSize)
+
+    if _, err = wr.fileIo.ReadAt(chunkHeader, offset); err != nil {
+      return fmt.Errorf("Wave64 file has no data chunk: %v", err)
+    }
+
+    chunkSize := int64(binary.LittleEndian.Uint64(chunkHeader[16:])) - w64ChunkHeaderSize
+
+    if chunkSize < 0 {
+      return fmt.Errorf("Wave64 chunk at %d has an invalid size", offset)
+    }
+
+    offset += w64ChunkHeaderSize
+
+    if bytes.Equal(chunkHeader[:16], w64FmtGUID) {
+      if err = wr.readFmt(offset, chunkSize); err != nil {
+        return err
+      }
+
+      foundFmt = true
+    } else if bytes.Equal(chunkHeader[:16], w64DataGUID) {
+      if !foundFmt {
+        return errors.New("Wave64 data chunk comes before the fmt chunk")
+      }
+
+      return wr.openData(bufferLength, offset, chunkSize)
+    }
+
+    offset += (chunkSize + 7) / 8 * 8
+  }
+}
+
+// W64Writer
+func (ww *W64Writer) Create(bufferLength int) error {
+  ww.format = pcmFormat{unsigned8: true}
+
+  fmtChunk := ww.fmtChunk()
+
+  header := &bytes.Buffer{}
+  header.Write(w64RiffGUID)
+  binary.Write(header, binary.LittleEndian, uint64(0))
+  header.Write(w64WaveGUID)
+
+  header.Write(w64FmtGUID)
+  binary.Write(header, binary.LittleEndian, uint64(w64ChunkHeaderSize + len(fmtChunk)))
+  header.Write(fmtChunk)
+
+  header.Write(w64DataGUID)
+  binary.Write(header, binary.LittleEndian, uint64(0))
+
+  return ww.createData(bufferLength, header.Bytes())
+}
+
+func (ww *W64Writer) Close() {
+  ww.closeData(
+    pcmPatch{16, littleEndian(uint64(ww.dataOffset + ww.dataSize))},
+    pcmPatch{ww.dataOffset - 8, littleEndian(uint64(w64ChunkHeaderSize + ww.dataSize))},
+  )
+}
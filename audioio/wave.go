@@ -1,216 +1,217 @@
 package audioio
 
 import(
+  "bytes"
   "fmt"
+  "encoding/binary"
   "errors"
+  "io"
   "os"
-  "github.com/go-audio/wav"
-  "github.com/go-audio/audio"
 )
 
-type WaveReader struct {
-  AudioFile
-  ReadBuffer *audio.IntBuffer
-  NumSampleFrames int
-  Duration float64
-  decoder *wav.Decoder
-  fileIo *os.File
-}
-
-type WaveWriter struct {
-  AudioFile
-  WriteBuffer *audio.IntBuffer
-  encoder *wav.Encoder
-  maxSampleValue int
-  fileIo *os.File
-}
-
-// Getters
-func (wr *WaveReader) GetBitDepth() int {
-  return wr.BitDepth
-}
+// the largest size a RIFF header can hold, longer files are written as RF64
+const riffMaxSize = 0xffffffff
 
-func (wr *WaveReader) GetSampleRate() int {
-  return wr.SampleRate
-}
+// bytes reserved after the RIFF header for the ds64 chunk of RF64
+const ds64Size = 28
 
-func (wr *WaveReader) GetNumChans() int {
-  return wr.NumChans
-}
+const waveFormatPCM = 1
+const waveFormatExtensible = 0xfffe
 
-func (wr *WaveReader) GetNumSampleFrames() int {
-  return wr.NumSampleFrames
+// WAV files are RIFF files, or RF64/BW64 files when they are longer than the
+// RIFF sizes can hold. 8 bit samples are unsigned, the others are signed and
+// little endian
+type WaveReader struct {
+  pcmReader
 }
 
-func (wr *WaveReader) GetDuration() float64 {
-  return wr.Duration
+type WaveWriter struct {
+  pcmWriter
 }
 
 // bufferLength: how many frames to read at one time
-func (wr *WaveReader) Open(bufferLength int) error {
-  var err error
-
+func (wr *WaveReader) Open(bufferLength int) (err error) {
   wr.fileIo, err = os.Open(wr.Filepath)
 
   if err != nil {
     return err
   }
 
-  wr.decoder = wav.NewDecoder(wr.fileIo)
-
-  wr.decoder.ReadInfo()
+  // the file isn't left open when its chunks can't be read
+  defer func() {
+    if err != nil {
+      wr.fileIo.Close()
+    }
+  }()
 
-  if wr.decoder.NumChans == 0 {
-    return errors.New("WaveReader.decoder.NumChans is 0")
-  }
+  wr.format = pcmFormat{unsigned8: true}
 
-  if wr.decoder.SampleRate == 0 {
-    return errors.New("WaveReader.decoder.SampleRate is 0")
-  }
+  header := make([]byte, 12)
 
-  if wr.decoder.BitDepth == 0 {
-    return errors.New("WaveReader.decoder.BitDepth is 0")
+  if _, err = io.ReadFull(wr.fileIo, header); err != nil {
+    return err
   }
 
-  wr.NumChans = int(wr.decoder.NumChans)
-  wr.BitDepth = int(wr.decoder.BitDepth)
-  wr.SampleRate = int(wr.decoder.SampleRate)
-  duration, err := wr.decoder.Duration()
+  form := string(header[:4])
 
-  if err != nil {
-    return err
+  if (form != "RIFF" && form != "RF64" && form != "BW64") || string(header[8:]) != "WAVE" {
+    return errors.New("Not a WAV file")
   }
 
-  wr.Duration = duration.Seconds()
-  wr.NumSampleFrames = int(wr.Duration * float64(wr.SampleRate))
+  offset := int64(12)
+  var dataSize64 int64 = -1
+  foundFmt := false
 
-  format := &audio.Format{
-    NumChannels: wr.NumChans,
-    SampleRate: wr.SampleRate,
-  }
+  // the chunks up to the samples
+  for {
+    chunkHeader := make([]byte, 8)
 
-  wr.ReadBuffer = &audio.IntBuffer{
-    Format: format,
-    Data: make([]int, bufferLength * wr.NumChans, bufferLength * wr.NumChans),
-    SourceBitDepth: wr.BitDepth,
-  }
+    if _, err = wr.fileIo.ReadAt(chunkHeader, offset); err != nil {
+      return fmt.Errorf("WAV file has no data chunk: %v", err)
+    }
 
-  return nil
-}
+    chunkID := string(chunkHeader[:4])
+    chunkSize := int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+    offset += 8
 
-// channel is zero indexed
-func (wr *WaveReader) ExtractChannel(channel int) (*audio.IntBuffer, error) {
-  if wr.NumChans == 0 {
-    return nil, errors.New("WaveReader.has no channels to extract")
-  }
+    switch chunkID {
+    case "ds64":
+      ds64 := make([]byte, 16)
 
-  if channel > wr.NumChans - 1 {
-    return nil, fmt.Errorf("Requested channel (%d) is out of bounds 0-%d", channel, wr.NumChans - 1)
-  }
+      if _, err = wr.fileIo.ReadAt(ds64, offset); err != nil {
+        return err
+      }
 
-  buffer := &audio.IntBuffer{
-    Format: wr.ReadBuffer.Format,
-    Data: make([]int, wr.ReadBuffer.NumFrames(), wr.ReadBuffer.NumFrames()),
-    SourceBitDepth: wr.ReadBuffer.SourceBitDepth,
-  }
+      dataSize64 = int64(binary.LittleEndian.Uint64(ds64[8:]))
+    case "fmt ":
+      if err = wr.readFmt(offset, chunkSize); err != nil {
+        return err
+      }
 
-  x := 0
-  for i := channel; i < len(wr.ReadBuffer.Data); i += wr.NumChans {
-    buffer.Data[x] = wr.ReadBuffer.Data[i]
-    x++
-  }
+      foundFmt = true
+    case "data":
+      if !foundFmt {
+        return errors.New("WAV data chunk comes before the fmt chunk")
+      }
 
-  return buffer, nil
-}
+      if chunkSize == riffMaxSize && dataSize64 >= 0 {
+        chunkSize = dataSize64
+      }
 
-func (wr *WaveReader) Close() {
-  wr.fileIo.Close()
-}
+      return wr.openData(bufferLength, offset, chunkSize)
+    }
 
-// numSamples is the number of samples read across all channels
-// numFrames is the number of samples per channel
-func (wr *WaveReader) ReadNext() (numSamples, numFrames int, err error) {
-  numSamples, err = wr.decoder.PCMBuffer(wr.ReadBuffer)
-  numFrames = numSamples / wr.NumChans
-  return
+    // chunks are padded to an even size
+    offset += chunkSize + chunkSize % 2
+  }
 }
 
-// WaveWriter
-func (wr *WaveWriter) Create(bufferLength int) error {
-  var err error
+// reads the format of the samples from a fmt chunk, shared with W64
+func (pr *pcmReader) readFmt(offset, chunkSize int64) error {
+  if chunkSize < 16 {
+    return fmt.Errorf("fmt chunk is %d bytes", chunkSize)
+  }
 
-  wr.fileIo, err = os.Create(wr.Filepath)
+  fmtChunk := make([]byte, chunkSize)
 
-  if err != nil {
+  if _, err := pr.fileIo.ReadAt(fmtChunk, offset); err != nil {
     return err
   }
 
-  wr.encoder = wav.NewEncoder(
-    wr.fileIo,
-    wr.SampleRate,
-    wr.BitDepth,
-    wr.NumChans,
-    1, // Linear PCM
-  )
+  formatTag := binary.LittleEndian.Uint16(fmtChunk)
+  extensible := formatTag == waveFormatExtensible && chunkSize >= 26
 
-  format := &audio.Format{
-    NumChannels: wr.NumChans,
-    SampleRate: wr.SampleRate,
+  // the sub format of an extensible format starts with the format tag
+  if extensible {
+    formatTag = binary.LittleEndian.Uint16(fmtChunk[24:])
   }
 
-  wr.WriteBuffer = &audio.IntBuffer{
-    Format: format,
-    Data: make([]int, bufferLength * wr.NumChans, bufferLength * wr.NumChans),
-    SourceBitDepth: wr.BitDepth,
+  if formatTag != waveFormatPCM {
+    return fmt.Errorf("Format %d is not supported, only integer PCM", formatTag)
   }
 
-  wr.maxSampleValue = IntMaxSignedValue[wr.BitDepth]
+  pr.NumChans = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+  pr.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+  pr.BitDepth = int(binary.LittleEndian.Uint16(fmtChunk[14:]))
+
+  // the block align gives the bytes of each sample, 12 bit samples are in 2
+  // bytes. An extensible format gives the bits of them that are used
+  if pr.NumChans > 0 {
+    pr.format.sampleSize = int(binary.LittleEndian.Uint16(fmtChunk[12:])) / pr.NumChans
+  }
 
-  if wr.maxSampleValue == 0 {
-    return fmt.Errorf("BitDepth %d returned invalid integer max signed value of 0", wr.BitDepth)
+  if extensible {
+    if validBits := int(binary.LittleEndian.Uint16(fmtChunk[18:])); validBits > 0 && validBits < pr.BitDepth {
+      pr.BitDepth = validBits
+    }
   }
 
   return nil
 }
 
-func (wr *WaveWriter) Close() {
-  wr.encoder.Close()
-  wr.fileIo.Close()
-}
+// the fmt chunk contents written by WaveWriter and W64Writer
+func (pw *pcmWriter) fmtChunk() []byte {
+  blockAlign := pw.BitDepth / 8 * pw.NumChans
 
-func (wr *WaveWriter) Write(buffer *audio.IntBuffer) error {
-  // clip gaurd: if any sample in the int buffer exceeds maximum allowed for the
-  // buffer's BitDepth, clip the sample instead of letting the encoder have it
-  for i := 0; i < len(buffer.Data); i++ {
-    if buffer.Data[i] > wr.maxSampleValue {
-      buffer.Data[i] = wr.maxSampleValue
-    } else if buffer.Data[i] < -wr.maxSampleValue {
-      buffer.Data[i] = -wr.maxSampleValue
-    }
-  }
+  chunk := &bytes.Buffer{}
+  binary.Write(chunk, binary.LittleEndian, []uint16{waveFormatPCM, uint16(pw.NumChans)})
+  binary.Write(chunk, binary.LittleEndian, []uint32{uint32(pw.SampleRate), uint32(pw.SampleRate * blockAlign)})
+  binary.Write(chunk, binary.LittleEndian, []uint16{uint16(blockAlign), uint16(pw.BitDepth)})
 
-  return wr.encoder.Write(buffer)
+  return chunk.Bytes()
 }
 
-func (wr *WaveWriter) ZeroWriteBuffer() {
-  for i := 0; i < len(wr.WriteBuffer.Data); i++ {
-    wr.WriteBuffer.Data[i] = 0
-  }
-}
+// WaveWriter
+func (ww *WaveWriter) Create(bufferLength int) error {
+  ww.format = pcmFormat{unsigned8: true}
+
+  header := &bytes.Buffer{}
+  header.WriteString("RIFF\x00\x00\x00\x00WAVE")
+
+  // room for a ds64 chunk if the file outgrows RIFF
+  header.WriteString("JUNK")
+  binary.Write(header, binary.LittleEndian, uint32(ds64Size))
+  header.Write(make([]byte, ds64Size))
+
+  fmtChunk := ww.fmtChunk()
+  header.WriteString("fmt ")
+  binary.Write(header, binary.LittleEndian, uint32(len(fmtChunk)))
+  header.Write(fmtChunk)
+
+  header.WriteString("data\x00\x00\x00\x00")
 
-func (wr *WaveWriter) WriteNext() error {
-  return wr.Write(wr.WriteBuffer)
+  return ww.createData(bufferLength, header.Bytes())
 }
 
-func (wr *WaveWriter) InterleaveChannel(channel int, data []int) error {
-  if len(data) * wr.NumChans != len(wr.WriteBuffer.Data) {
-    return errors.New("Data to interleave will not fit exactly into WriteBuffer")
+// writes the sizes, as RF64 if they don't fit RIFF
+func (ww *WaveWriter) Close() {
+  pad := ww.dataSize % 2
+
+  if pad == 1 {
+    ww.writer.WriteByte(0)
   }
 
-  for frameNumber :=0; frameNumber < len(data); frameNumber++ {
-    i := frameNumber * wr.NumChans
-    wr.WriteBuffer.Data[i + channel] = data[frameNumber]
+  riffSize := ww.dataOffset - 8 + ww.dataSize + pad
+
+  if riffSize <= riffMaxSize {
+    ww.closeData(
+      pcmPatch{4, littleEndian(uint32(riffSize))},
+      pcmPatch{ww.dataOffset - 4, littleEndian(uint32(ww.dataSize))},
+    )
+    return
   }
 
-  return nil
+  blockAlign := int64(ww.BitDepth / 8 * ww.NumChans)
+
+  ds64 := &bytes.Buffer{}
+  ds64.WriteString("ds64")
+  binary.Write(ds64, binary.LittleEndian, uint32(ds64Size))
+  binary.Write(ds64, binary.LittleEndian, []uint64{uint64(riffSize), uint64(ww.dataSize), uint64(ww.dataSize / blockAlign)})
+  binary.Write(ds64, binary.LittleEndian, uint32(0)) // no table
+
+  ww.closeData(
+    pcmPatch{0, []byte("RF64\xff\xff\xff\xff")},
+    pcmPatch{12, ds64.Bytes()},
+    pcmPatch{ww.dataOffset - 4, littleEndian(uint32(riffMaxSize))},
+  )
 }
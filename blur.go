@@ -0,0 +1,59 @@
+package main
+
+import (
+  "fmt"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// writes the input, smeared in time by the spectral blur
+func runBlur(parsedArgs *cli.Arguments) error {
+  width := pvoc.ConstantEnvelope(parsedArgs.BlurFrames)
+
+  if len(parsedArgs.BlurCurvePath) > 0 {
+    var err error
+
+    if width, err = pvoc.ReadEnvelope(parsedArgs.BlurCurvePath); err != nil {
+      return fmt.Errorf("Could not read width curve: %s", err)
+    }
+  }
+
+  blur, err := pvoc.NewSpectralBlur(width, parsedArgs.BlurPhases)
+
+  if err != nil {
+    return err
+  }
+
+  blur.GriffinLimIterations = parsedArgs.Iterations
+
+  spectrogram, err := analyzeFile(parsedArgs, parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err != nil {
+    return err
+  }
+
+  audioFile := audioio.AudioFile{
+    Filepath: parsedArgs.OutputPath,
+    NumChans: spectrogram.NumChans,
+    SampleRate: spectrogram.SampleRate,
+    BitDepth: spectrogram.BitDepth,
+  }
+
+  signals, err := blur.BlurSignals(spectrogram)
+
+  if err != nil {
+    return err
+  }
+
+  if err = audioio.WriteSignals(audioFile, parsedArgs.OutputFormat(), signals); err != nil {
+    return fmt.Errorf("Could not write output audio file: %s", err)
+  }
+
+  if !parsedArgs.Quiet {
+    fmt.Printf("%24s   %s\n", "Output File:", filepath.Base(parsedArgs.OutputPath))
+  }
+
+  return nil
+}
@@ -20,7 +20,7 @@ build () {
   zip=$7
   target_name="gopvoc_${version}_${platform}_${arch}${target_suffix}"
 
-  GOOS=$platform GOARCH=$arch go build -ldflags="-X 'main.Version=${version}'" -o "${builds_dir}/${target_name}/gopvoc${6}" main.go
+  GOOS=$platform GOARCH=$arch go build -ldflags="-X 'main.Version=${version}'" -o "${builds_dir}/${target_name}/gopvoc${6}" .
 
   cd $builds_dir
   if [ "$zip" != "" ]; then
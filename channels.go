@@ -0,0 +1,98 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+)
+
+// how -ch, -mix and -ms route the channels of the input. The reader is set
+// to the processed channels, the output is made of them and the input
+// channels passed through once processing is done
+type channels struct {
+  *audioio.ChannelRouting
+  inputPath string
+  inputFormat audioio.InputFormat
+  offset int // the input frame the first output frame is in time with
+  tempDir string // holds the processed channels
+  processedPath string
+}
+
+// sets the opened audioReader to the processed channels, latency is how far
+// the processed output lags the input
+func prepareChannels(parsedArgs *cli.Arguments, audioReader *audioio.AudioReader, latency int) (*channels, error) {
+  routing, err := audioio.NewChannelRouting(
+    audioReader.GetNumChans(),
+    parsedArgs.Mix,
+    parsedArgs.Channels,
+    parsedArgs.MidSide,
+    parsedArgs.PassUnprocessed,
+  )
+
+  if err != nil {
+    return nil, err
+  }
+
+  if err = audioReader.SetChannels(routing.Encode); err != nil {
+    return nil, err
+  }
+
+  ch := &channels{
+    ChannelRouting: routing,
+    inputPath: parsedArgs.InputPath,
+    inputFormat: parsedArgs.InputFormat,
+    offset: -latency,
+  }
+
+  ch.tempDir, err = os.MkdirTemp("", "gopvoc-channels")
+  ch.processedPath = filepath.Join(ch.tempDir, "processed.wav")
+
+  return ch, err
+}
+
+// the output starts at the region instead of the start of the input, unless
+// it is spliced back into the whole input. The region is cut without the
+// latency, so the passed channels aren't delayed
+func (ch *channels) setRegion(r *region) {
+  ch.offset = 0
+
+  if !r.splice {
+    ch.offset = r.start
+  }
+}
+
+// decodes the processed channels and adds the passed through input channels
+// to them, written to outputPath
+func (ch *channels) finish(outputPath string, outputFormat audioio.OutputFormat) error {
+  processed, audioFile, err := audioio.ReadSignals(ch.processedPath, audioio.InputFormat{})
+
+  if err != nil {
+    return err
+  }
+
+  signals := audioio.MixSignals(ch.Decode, processed)
+
+  if ch.Passes() {
+    input, _, err := audioio.ReadSignals(ch.inputPath, ch.inputFormat)
+
+    if err != nil {
+      return err
+    }
+
+    passed := audioio.MixSignals(ch.Pass, input)
+
+    for c := range signals {
+      for i := range signals[c] {
+        if from := ch.offset + i; from >= 0 && from < len(passed[c]) {
+          signals[c][i] += passed[c][from]
+        }
+      }
+    }
+  }
+
+  audioFile.Filepath = outputPath
+  audioFile.NumChans = len(signals)
+
+  return audioio.WriteSignals(audioFile, outputFormat, signals)
+}
@@ -2,43 +2,165 @@ package charter
 
 import (
   "fmt"
+  "html/template"
   "os"
+  "path/filepath"
   "github.com/go-echarts/go-echarts/v2/charts"
   "github.com/go-echarts/go-echarts/v2/opts"
   "github.com/go-echarts/go-echarts/v2/types"
 )
 
-func MakeChart(seriesName string, seriesIndex int, data []float64) {
-  items := make([]opts.LineData, len(data), len(data))
+// one line of a chart
+type Series struct {
+  Name string
+  Data []float64
+}
+
+// a chart written by the Charter, for the index page
+type page struct {
+  Title string
+  Subtitle string
+  File string
+}
+
+// Charter writes interactive HTML line charts into a directory, plus an
+// index page linking all of them
+type Charter struct {
+  Dir string
+  pages []page
+}
+
+// creates the directory if it doesn't exist
+func NewCharter(dir string) (*Charter, error) {
+  if len(dir) == 0 {
+    return nil, fmt.Errorf("The chart directory cannot be empty")
+  }
+
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return nil, err
+  }
 
+  return &Charter{
+    Dir: dir,
+    pages: []page{},
+  }, nil
+}
+
+// charts data against its indexes, written to <seriesName>_<seriesIndex>.html
+func (c *Charter) MakeChart(seriesName string, seriesIndex int, data []float64) error {
   xLabels := make([]string, len(data), len(data))
 
-  for i := 0; i < len(data); i++ {
-    items[i] = opts.LineData{
-      Value: data[i],
-    }
+  for i := range data {
     xLabels[i] = fmt.Sprint(i)
   }
 
+  return c.MakeLines(seriesName, seriesIndex, fmt.Sprint(seriesIndex), "", xLabels, Series{Name: "Data", Data: data})
+}
+
+// charts one or more series sharing the x axis labels, written to
+// <seriesName>_<seriesIndex>.html
+func (c *Charter) MakeLines(
+  seriesName string,
+  seriesIndex int,
+  subtitle string,
+  yName string,
+  xLabels []string,
+  series ...Series,
+) error {
   line := charts.NewLine()
   line.SetGlobalOptions(
-    charts.WithInitializationOpts(opts.Initialization{Theme: types.ThemeWesteros}),
+    charts.WithInitializationOpts(opts.Initialization{
+      PageTitle: seriesName,
+      Theme: types.ThemeWesteros,
+      Width: "1200px",
+      Height: "600px",
+    }),
     charts.WithTitleOpts(opts.Title{
-      Title:    seriesName,
-      Subtitle: string(seriesIndex),
+      Title: seriesName,
+      Subtitle: subtitle,
     }),
+    charts.WithTooltipOpts(opts.Tooltip{Show: true, Trigger: "axis"}),
+    charts.WithLegendOpts(opts.Legend{Show: len(series) > 1, Right: "10%"}),
+    charts.WithYAxisOpts(opts.YAxis{Name: yName, Scale: true}),
+    charts.WithDataZoomOpts(opts.DataZoom{Type: "inside"}, opts.DataZoom{Type: "slider"}),
+  )
+
+  line.SetXAxis(xLabels)
+
+  for _, s := range series {
+    items := make([]opts.LineData, len(s.Data), len(s.Data))
+
+    for i, value := range s.Data {
+      items[i] = opts.LineData{
+        Value: value,
+        Symbol: "none",
+      }
+    }
+
+    line.AddSeries(s.Name, items)
+  }
+
+  line.SetSeriesOptions(
+    charts.WithLineChartOpts(opts.LineChart{Smooth: false}),
   )
 
-  line.SetXAxis(xLabels).
-    AddSeries("Data", items).
-    SetSeriesOptions(charts.WithLineChartOpts(opts.LineChart{Smooth: false}))
+  fileName := fmt.Sprintf("%s_%d.html", seriesName, seriesIndex)
+  f, err := os.Create(filepath.Join(c.Dir, fileName))
 
-  f, err := os.Create(fmt.Sprintf("/tmp/charter/" + seriesName + "_%d.html", seriesIndex))
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+
+  if err = line.Render(f); err != nil {
+    return err
+  }
+
+  c.pages = append(c.pages, page{
+    Title: seriesName,
+    Subtitle: subtitle,
+    File: fileName,
+  })
+
+  return nil
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+td { padding: 0.2em 1em 0.2em 0; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+{{range .Pages}}<tr><td><a href="{{.File}}">{{.Title}}</a></td><td>{{.Subtitle}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// writes index.html, linking every chart made so far in the order they were
+// made
+func (c *Charter) WriteIndex(title string) error {
+  f, err := os.Create(filepath.Join(c.Dir, "index.html"))
 
   if err != nil {
-    panic(err)
+    return err
   }
   defer f.Close()
 
-  line.Render(f)
+  err = indexTemplate.Execute(f, struct {
+    Title string
+    Pages []page
+  }{
+    Title: title,
+    Pages: c.pages,
+  })
+
+  return err
 }
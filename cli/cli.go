@@ -5,23 +5,122 @@ import(
   "fmt"
   "os"
   "path/filepath"
+  "gopvoc/audioio"
   "gopvoc/pvoc"
   "strings"
   "math"
 )
 
+// Commands
+const CommandTime = "time"
+const CommandPitch = "pitch"
+const CommandPartials = "partials"
+const CommandDecompose = "decompose"
+const CommandHPSS = "hpss"
+const CommandBlur = "blur"
+const CommandMorph = "morph"
+const CommandSpectral = "spectral"
+const CommandPitchTrack = "pitchtrack"
+const CommandSpectrogram = "spectrogram"
+const CommandImageSynth = "imagesynth"
+
 type Arguments struct {
+  Command string
   Bands int
   Overlap float64
   Scale float64
   Operation int
   Quiet bool
   InputPath string
+  InputFormat audioio.InputFormat // of a headerless or split InputPath, zero if it has a header
   OutputPath string
+  OutputType int // forced by -of for every output, 0 takes it from the extension
+  SplitOutput bool // write every output as a mono file per channel
+  RangeStart *audioio.Position // nil processes from the start of the input
+  RangeEnd *audioio.Position // nil processes to the end of the input
+  Splice bool // write the processed range back into the whole input
+  Crossfade float64 // seconds
+  Channels []int // zero indexed channels to process, nil processes all of them
+  Mix *audioio.Mix // of the input channels before processing, nil keeps them
+  MidSide bool // process two channels as mid and side
+  PassUnprocessed bool // write the channels that aren't processed unprocessed
   PhaseLock bool
+  PhaseLockMode string
+  PhaseReconstruction string
+  Iterations int
+  LinkChannels bool // advance the phases of every channel together
+  LinkReference int // pvoc.LinkSum or the channel the others follow
   WindowName string
   GatingAmplitude float64
   GatingThreshold float64
+  TransientSensitivity float64
+  TransientKeep bool
+  OnsetsPath string
+  PartialsInputPath string // read partials instead of analyzing InputPath
+  PartialsOutputPath string
+  PartialThreshold float64
+  PartialDeviation float64
+  PartialMinLength float64
+  PartialMaxPeaks int
+  PitchScale float64
+  SampleRate int
+  BitDepth int
+  DeterministicPath string
+  ResidualPath string
+  MixPath string
+  DeterministicScale float64
+  DeterministicPitch float64
+  ResidualScale float64
+  ResidualPitch float64
+  HarmonicPath string
+  PercussivePath string
+  HarmonicFrames int
+  PercussiveBands int
+  HPSSMask string
+  HPSSPower float64
+  HarmonicOnly bool // time stretch the harmonic layer only
+  BlurFrames float64
+  BlurCurvePath string // blur width envelope, overrides BlurFrames
+  BlurPhases bool
+  MorphInputPath string // B, morphed into InputPath (A)
+  MorphInputFormat audioio.InputFormat
+  MorphAmount float64
+  MorphCurvePath string // morph envelope, overrides MorphAmount
+  MorphMode string
+  MorphNormalize bool // time normalize B to the length of A
+  SpectralOperation string
+  SpectralLow float64
+  SpectralHigh float64
+  SpectralPivot float64
+  SpectralTo float64
+  SpectralSeed int64
+  SpectralWidth int
+  TuneScale string // pitch correction scale, empty disables it
+  TuneKey int // semitones above C
+  TuneReference float64
+  TuneRetune float64
+  PitchMin float64
+  PitchMax float64
+  PitchConfidence float64
+  TuneCSVPath string
+  ScaleCurvePath string // pitch scale envelope, overrides Scale
+  PitchMethod string
+  PitchPath string
+  PitchReference float64
+  PitchFlatten bool
+  SpectrogramPath string // PNG of the input (and output) spectrograms
+  ComparePath string // drawn next to InputPath
+  CompareFormat audioio.InputFormat // of a headerless ComparePath, zero if it has a header
+  ImageWidth int
+  ImageHeight int
+  ImageScale string
+  ImageMinFrequency float64
+  ImageMaxFrequency float64
+  ImageRange float64
+  ImagePath string // read by imagesynth
+  ImageDuration float64
+  ImagePeak float64
+  DebugDir string // diagnostic charts of the processing
 }
 
 func parseOutputFilePath(outputFile string, parsedArgs *Arguments) (string, error) {
@@ -93,13 +192,55 @@ func parseOutputFilePath(outputFile string, parsedArgs *Arguments) (string, erro
   }
 
   phaseLock := ""
-  if parsedArgs.PhaseLock {
+  if parsedArgs.PhaseLock || parsedArgs.PhaseLockMode == pvoc.PhaseLockNeighbor {
     phaseLock = "-p"
+  } else if parsedArgs.PhaseLockMode != "" && parsedArgs.PhaseLockMode != pvoc.PhaseLockNone {
+    phaseLock = fmt.Sprintf("-l%s", parsedArgs.PhaseLockMode)
+  }
+
+  phase := ""
+  if parsedArgs.PhaseReconstruction != "" && parsedArgs.PhaseReconstruction != pvoc.PhaseClassic {
+    phase = fmt.Sprintf("-%s", parsedArgs.PhaseReconstruction)
+  }
+
+  link := ""
+  if parsedArgs.LinkChannels && parsedArgs.LinkReference == pvoc.LinkSum {
+    link = "-linksum"
+  } else if parsedArgs.LinkChannels {
+    link = fmt.Sprintf("-link%d", parsedArgs.LinkReference + 1)
+  }
+
+  transients := ""
+  if parsedArgs.TransientSensitivity != 0 {
+    transients = fmt.Sprintf("-tr%g", parsedArgs.TransientSensitivity)
+
+    if parsedArgs.TransientKeep {
+      transients += "k"
+    }
+  }
+
+  harmonicOnly := ""
+  if parsedArgs.HarmonicOnly {
+    harmonicOnly = "-ho"
+  }
+
+  spectral := ""
+  if parsedArgs.SpectralOperation != "" {
+    spectral = fmt.Sprintf("-%s", parsedArgs.SpectralOperation)
+
+    if parsedArgs.SpectralOperation == pvoc.SpectralShuffle {
+      spectral += fmt.Sprintf("%d", parsedArgs.SpectralSeed)
+    }
+  }
+
+  tune := ""
+  if parsedArgs.TuneScale != "" {
+    tune = fmt.Sprintf("-%s", parsedArgs.TuneScale)
   }
 
   builtName := strings.Replace(
     fmt.Sprintf(
-      "%s-%ss%g%s%s%s%s%s%s",
+      "%s-%ss%g%s%s%s%s%s%s%s%s%s%s%s%s",
       strings.TrimSuffix(fileName, ext),
       operation,
       parsedArgs.Scale,
@@ -109,17 +250,240 @@ func parseOutputFilePath(outputFile string, parsedArgs *Arguments) (string, erro
       gatingA,
       gatingT,
       phaseLock,
+      phase,
+      link,
+      transients,
+      harmonicOnly,
+      spectral,
+      tune,
     ),
     ".",
     "",
     -1,
   )
 
-  builtName = fmt.Sprintf("%s%s", builtName, ext)
+  builtName = fmt.Sprintf("%s%s", builtName, autoOutputExtension(fileName, parsedArgs))
 
   return filepath.Join(fullPath, builtName), nil
 }
 
+// the extension of an automatically named output: the -of format, or the
+// input's extension when gopvoc writes that type. Otherwise the type of the
+// input's contents, and inputs that can be decoded but not written are
+// named as FLAC files, which keep their tags
+func autoOutputExtension(inputFileName string, parsedArgs *Arguments) string {
+  if parsedArgs.OutputType != 0 {
+    return audioio.OutputExtension(parsedArgs.OutputType)
+  }
+
+  if _, err := audioio.OutputFileType(inputFileName); err == nil {
+    return filepath.Ext(inputFileName)
+  }
+
+  inputType, err := audioio.InputFileType(parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err == nil && audioio.OutputExtension(inputType) != "" {
+    return audioio.OutputExtension(inputType)
+  }
+
+  return ".flac"
+}
+
+// the image settings of -spectrogram on the processing commands, which only
+// take the path
+func setSpectrogramDefaults(parsedArgs *Arguments, path string) {
+  parsedArgs.SpectrogramPath, _ = filepath.Abs(path)
+  parsedArgs.ImageScale = pvoc.FrequencyLog
+  parsedArgs.ImageMinFrequency = pvoc.DefaultImageMinFrequency
+  parsedArgs.ImageRange = pvoc.DefaultImageRange
+  parsedArgs.ImageWidth = pvoc.DefaultImageWidth
+  parsedArgs.ImageHeight = pvoc.DefaultImageHeight
+}
+
+// -i-format, empty when the input has a header to read the format from
+func parseInputFormat(spec string) (audioio.InputFormat, error) {
+  if spec == "" {
+    return audioio.InputFormat{}, nil
+  }
+
+  return audioio.ParseInputFormat(spec)
+}
+
+// AudioOutputPaths are the audio files the command writes
+func (parsedArgs *Arguments) AudioOutputPaths() []string {
+  paths := []string{}
+
+  for _, path := range []string{
+    parsedArgs.OutputPath,
+    parsedArgs.DeterministicPath,
+    parsedArgs.ResidualPath,
+    parsedArgs.MixPath,
+    parsedArgs.HarmonicPath,
+    parsedArgs.PercussivePath,
+  } {
+    if path != "" {
+      paths = append(paths, path)
+    }
+  }
+
+  return paths
+}
+
+// OutputFormat is the format the command's audio outputs are written in,
+// temporary files are written as their extension says. Split outputs are
+// named like the split input
+func (parsedArgs *Arguments) OutputFormat() audioio.OutputFormat {
+  return audioio.OutputFormat{
+    FileType: parsedArgs.OutputType,
+    Split: parsedArgs.SplitOutput,
+    SplitNames: parsedArgs.InputFormat.SplitNames,
+  }
+}
+
+// -split, nil when the input isn't split
+func parseSplitNames(text string) ([]string, error) {
+  if text == "" {
+    return nil, nil
+  }
+
+  return audioio.ParseSplitNames(text)
+}
+
+// -of, 0 when the output type is taken from the extension
+func parseOutputType(name string) (int, error) {
+  if name == "" {
+    return 0, nil
+  }
+
+  return audioio.ParseOutputFormat(name)
+}
+
+// without -of, every output path must have an extension of a type gopvoc
+// writes, checked before any processing
+func checkOutputTypes(parsedArgs *Arguments) error {
+  if parsedArgs.OutputType != 0 {
+    return nil
+  }
+
+  for _, path := range parsedArgs.AudioOutputPaths() {
+    if _, err := audioio.OutputFileType(path); err != nil {
+      return fmt.Errorf("%v, or set the format with -of", err)
+    }
+  }
+
+  return nil
+}
+
+// -start, -end, -splice and -crossfade
+func parseRange(parsedArgs *Arguments, start, end string, splice bool, crossfade float64) error {
+  if len(start) > 0 {
+    position, err := audioio.ParsePosition(start)
+
+    if err != nil {
+      return fmt.Errorf("-start: %v", err)
+    }
+
+    parsedArgs.RangeStart = &position
+  }
+
+  if len(end) > 0 {
+    position, err := audioio.ParsePosition(end)
+
+    if err != nil {
+      return fmt.Errorf("-end: %v", err)
+    }
+
+    parsedArgs.RangeEnd = &position
+  }
+
+  // positions in different units are compared once the sample rate is known
+  if startPos, endPos := parsedArgs.RangeStart, parsedArgs.RangeEnd; startPos != nil && endPos != nil && startPos.InFrames == endPos.InFrames {
+    if (startPos.InFrames && startPos.Frames >= endPos.Frames) || (!startPos.InFrames && startPos.Seconds >= endPos.Seconds) {
+      return fmt.Errorf("-start must be before -end")
+    }
+  }
+
+  if splice && parsedArgs.RangeStart == nil && parsedArgs.RangeEnd == nil {
+    return fmt.Errorf("-splice needs a region, set with -start and/or -end")
+  }
+
+  if crossfade < 0 {
+    return fmt.Errorf("-crossfade must be at least 0, got %g", crossfade)
+  }
+
+  if parsedArgs.HarmonicOnly && (parsedArgs.RangeStart != nil || parsedArgs.RangeEnd != nil) {
+    return fmt.Errorf("-start and -end can't be combined with -harmonic-only")
+  }
+
+  parsedArgs.Splice = splice
+  parsedArgs.Crossfade = crossfade / 1000
+  return nil
+}
+
+// -ch, -mix, -ms and -pass, after the operation and scale are set
+func parseChannelRouting(parsedArgs *Arguments, channels, mix string, midSide, pass bool) error {
+  if len(channels) > 0 {
+    list, err := audioio.ParseChannels(channels)
+
+    if err != nil {
+      return fmt.Errorf("-ch: %v", err)
+    }
+
+    parsedArgs.Channels = list
+  }
+
+  if len(mix) > 0 {
+    parsedMix, err := audioio.ParseMix(mix)
+
+    if err != nil {
+      return fmt.Errorf("-mix: %v", err)
+    }
+
+    parsedArgs.Mix = &parsedMix
+  }
+
+  if pass && parsedArgs.Channels == nil {
+    return fmt.Errorf("-pass keeps the channels -ch doesn't select, set them with -ch")
+  }
+
+  // unprocessed channels are only in time with a processed output as long
+  if pass && parsedArgs.Operation == pvoc.TimeStretch && parsedArgs.Scale != 1 {
+    return fmt.Errorf("-pass can't keep unprocessed channels in time with a stretched output, drop them or use -s 1")
+  }
+
+  if parsedArgs.HarmonicOnly && (parsedArgs.Channels != nil || parsedArgs.Mix != nil || midSide) {
+    return fmt.Errorf("-ch, -mix and -ms can't be combined with -harmonic-only")
+  }
+
+  parsedArgs.MidSide = midSide
+  parsedArgs.PassUnprocessed = pass
+  return nil
+}
+
+// -p is shorthand for -lock neighbor, which was the only phase locking
+// available before -lock
+func parsePhaseLock(phaseLock bool, lockMode string) (string, error) {
+  if phaseLock {
+    if lockMode != "" && lockMode != pvoc.PhaseLockNeighbor {
+      return "", fmt.Errorf("-p is the same as -lock %s and can't be combined with -lock %s", pvoc.PhaseLockNeighbor, lockMode)
+    }
+
+    return pvoc.PhaseLockNeighbor, nil
+  }
+
+  if lockMode == "" {
+    return pvoc.PhaseLockNone, nil
+  }
+
+  for _, mode := range pvoc.PhaseLockModes {
+    if mode == lockMode {
+      return lockMode, nil
+    }
+  }
+
+  return "", fmt.Errorf("-lock must be one of: %s, got %s", pvoc.PhaseLockModesString(), lockMode)
+}
+
 func ParseFlags(args []string, version string) (*Arguments, error) {
   var flgVersion bool
   flag.BoolVar(&flgVersion, "version", false, "print version and exit")
@@ -131,7 +495,7 @@ func ParseFlags(args []string, version string) (*Arguments, error) {
     os.Exit(0)
   }
 
-  cmdError := fmt.Errorf("usage: gopvoc [--version] <command> <args>\n\nAvailable Commands:\n\n    time    time stretch input AIFF/WAV file\n    pitch   pitch shift input AIFF/WAV file\n\nFor specific command options:\n\ngopvoc <command> -h\n\n")
+  cmdError := fmt.Errorf("usage: gopvoc [--version] <command> <args>\n\nAvailable Commands:\n\n    time       time stretch input AIFF/WAV file\n    pitch      pitch shift input AIFF/WAV file\n    partials   track sinusoidal partials of input AIFF/WAV file, export and resynthesize them\n    decompose  split input AIFF/WAV file into sinusoidal and residual (noise) files\n    hpss       split input AIFF/WAV file into harmonic and percussive files\n    blur       smear input AIFF/WAV file in time by averaging its analysis frames\n    morph      morph between two AIFF/WAV files over time\n    spectral   rearrange the spectrum of input AIFF/WAV file (mirror, shuffle, swap, invert)\n    spectrogram  draw the spectrogram of input AIFF/WAV file (and another one next to it) as a PNG image\n    imagesynth   turn an image into an AIFF/WAV file, as if it was a spectrogram\n    pitchtrack detect the pitch of input AIFF/WAV file over time, export it as CSV/JSON or a pitch curve\n\nFor specific command options:\n\ngopvoc <command> -h\n\n")
 
   if len(args) < 2 {
     return nil, cmdError
@@ -140,33 +504,283 @@ func ParseFlags(args []string, version string) (*Arguments, error) {
   // time stretch flags
   timeCmd := flag.NewFlagSet("time", flag.ExitOnError)
   timeInput := timeCmd.String("i", "", "input file: path to input AIFF/WAV")
+  timeInputFormat := timeCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  timeSplit := timeCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
   timeScale := timeCmd.Float64("s", 1.0, "scale factor: time scale multiplier")
   timeBands := timeCmd.Int("b", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
   timeOverlap := timeCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
-  timePhaseLock := timeCmd.Bool("p", false, "phase lock flag: enable phase locking during resynthesis")
+  timePhaseLock := timeCmd.Bool("p", false, "phase lock flag: enable neighbor phase locking during resynthesis, same as -lock neighbor")
+  timeLockMode := timeCmd.String("lock", "", "phase lock mode: phase locking during resynthesis, one of: " + pvoc.PhaseLockModesString() + " (default none)")
   timeWindowName := timeCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
   timeGatingAmplitude := timeCmd.Float64("ga", 0.0, "resynthesis gating amplitude (db): amplitude below 0db under which an FFT frequency is removed from the spectrum.")
   timeGatingThreshold := timeCmd.Float64("gt", 0.0, "resynthesis gating threshold (db) below maximum: any FFT frequency bin with an amplitude this far below the maximum amplitude of all bins in that FFT window will get removed.")
+  timePhase := timeCmd.String("phase", pvoc.PhaseClassic, "phase reconstruction: how output phases are computed during resynthesis, one of: " + pvoc.PhaseReconstructionsString())
+  timeLink := timeCmd.String("link", "", "link channels: advance the phases of every channel with the phases of a reference, sum (of the channels) or a channel counted from 1, and keep the phase differences between the channels, which keeps the stereo image stable over large stretches (default each channel on its own)")
+  timeIterations := timeCmd.Int("iterations", pvoc.DefaultGriffinLimIterations, "iterations: number of Griffin-Lim iterations for -phase " + pvoc.PhaseGriffinLim)
+  timeTransients := timeCmd.Float64("transients", 0.0, "transient sensitivity (0-1): detect onsets and reset phases at transients during resynthesis, higher values detect more onsets. 0 disables transient detection")
+  timeTransientKeep := timeCmd.Bool("transient-keep", false, "keep transients flag: resynthesize detected transients un-stretched and stretch the steady-state more to compensate, requires -transients")
+  timeOnsets := timeCmd.String("onsets", "", "onsets file: write the detected onset times (in seconds of the input) to this text file, requires -transients")
+  timeHarmonicOnly := timeCmd.Bool("harmonic-only", false, "harmonic only flag: separate the harmonic and percussive layers, stretch the harmonic layer and add the percussive layer back unstretched at its stretched onset times")
+  timeStart := timeCmd.String("start", "", "region start: process the input from this position, in seconds (1.5), sample frames (72000smp) or a timecode ([hh:]mm:ss.fff) (default the start of the file)")
+  timeEnd := timeCmd.String("end", "", "region end: process the input up to this position, as -start (default the end of the file)")
+  timeSplice := timeCmd.Bool("splice", false, "splice flag: write the processed region back into the whole input, crossfading at both ends")
+  timeCrossfade := timeCmd.Float64("crossfade", 10, "crossfade: length of the -splice crossfades in milliseconds")
+  timeChannels := timeCmd.String("ch", "", "channels: process only these channels, counted from 1, as a list of channels and ranges such as 1,3-4 (default all of them)")
+  timeMix := timeCmd.String("mix", "", "mix: mix the input channels before processing, mono sums them into one, stereo into two, or rows of gains for each input channel such as 0.5,0.5;1,0;0,1")
+  timeMidSide := timeCmd.Bool("ms", false, "mid/side flag: process two channels as their sum and difference, which keeps the stereo image steady")
+  timePass := timeCmd.Bool("pass", false, "pass flag: write the channels -ch doesn't select unprocessed, in time with the processed ones, instead of dropping them")
   timeQuiet := timeCmd.Bool("q", false, "quiet flag: suppress informational output")
+  timeSpectrogram := timeCmd.String("spectrogram", "", "spectrogram image: draw the spectrograms of the input and output files side by side to this PNG file")
+  timeDebugDir := timeCmd.String("debug-dir", "", "debug directory: chart the windows, a selection of frames, gate decisions and output peaks as HTML pages in this directory, open index.html to browse them")
   timeOutput := timeCmd.String("f", "", "output file or directory: Provide a path to an AIFF/WAV file. If only a directory is specified, the output file will be automatically named. In both cases, file will be overwritten if it exists.")
+  timeOutputFormat := timeCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  timeSplitOut := timeCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
 
   // pitch flags
   pitchCmd := flag.NewFlagSet("pitch", flag.ExitOnError)
   pitchInput := pitchCmd.String("i", "", "input file: path to input AIFF/WAV")
+  pitchInputFormat := pitchCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  pitchSplit := pitchCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
   pitchScale := pitchCmd.Float64("s", 1.0, "scale factor: time scale multiplier")
   pitchBands := pitchCmd.Int("b", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
   pitchOverlap := pitchCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  pitchPhaseLock := pitchCmd.Bool("p", false, "phase lock flag: enable neighbor phase locking during resynthesis, same as -lock neighbor")
+  pitchLockMode := pitchCmd.String("lock", "", "phase lock mode: phase locking of the oscillator bank during resynthesis, one of: " + pvoc.PhaseLockModesString() + " (default none)")
   pitchWindowName := pitchCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
   pitchGatingAmplitude := pitchCmd.Float64("ga", 0.0, "resynthesis gating amplitude (db): amplitude below 0db under which an FFT frequency is removed from the spectrum.")
   pitchGatingThreshold := pitchCmd.Float64("gt", 0.0, "resynthesis gating threshold (db) below maximum: any FFT frequency bin with an amplitude this far below the maximum amplitude of all bins in that FFT window will get removed.")
+  pitchStart := pitchCmd.String("start", "", "region start: process the input from this position, in seconds (1.5), sample frames (72000smp) or a timecode ([hh:]mm:ss.fff) (default the start of the file)")
+  pitchEnd := pitchCmd.String("end", "", "region end: process the input up to this position, as -start (default the end of the file)")
+  pitchSplice := pitchCmd.Bool("splice", false, "splice flag: write the processed region back into the whole input, crossfading at both ends")
+  pitchCrossfade := pitchCmd.Float64("crossfade", 10, "crossfade: length of the -splice crossfades in milliseconds")
+  pitchChannels := pitchCmd.String("ch", "", "channels: process only these channels, counted from 1, as a list of channels and ranges such as 1,3-4 (default all of them)")
+  pitchMix := pitchCmd.String("mix", "", "mix: mix the input channels before processing, mono sums them into one, stereo into two, or rows of gains for each input channel such as 0.5,0.5;1,0;0,1")
+  pitchMidSide := pitchCmd.Bool("ms", false, "mid/side flag: process two channels as their sum and difference, which keeps the stereo image steady")
+  pitchPass := pitchCmd.Bool("pass", false, "pass flag: write the channels -ch doesn't select unprocessed, in time with the processed ones, instead of dropping them")
   pitchQuiet := pitchCmd.Bool("q", false, "quiet flag: suppress informational output")
+  pitchCurve := pitchCmd.String("curve", "", "scale curve: breakpoint file (.bpf) of \"time scale\" lines giving the pitch shift multiplier over time, like the ones pitchtrack writes, overrides -s")
+  pitchTune := pitchCmd.String("tune", "", "pitch correction scale: snap the pitch of every frame to the nearest note of this scale after shifting (monophonic sounds), one of: " + pvoc.ScaleNamesString() + ". Empty disables pitch correction")
+  pitchKey := pitchCmd.String("key", "C", "key of the pitch correction scale: a note name like C, F# or Bb")
+  pitchReference := pitchCmd.Float64("reference", pvoc.DefaultTuningReference, "tuning reference (Hz) of A4 for pitch correction")
+  pitchRetune := pitchCmd.Float64("retune", pvoc.DefaultRetuneTime, "retune time (seconds): how fast pitch correction reaches the target note, 0 snaps instantly")
+  pitchMin := pitchCmd.Float64("min-pitch", pvoc.DefaultMinPitch, "lowest pitch (Hz) detected for pitch correction")
+  pitchMax := pitchCmd.Float64("max-pitch", pvoc.DefaultMaxPitch, "highest pitch (Hz) detected for pitch correction")
+  pitchConfidence := pitchCmd.Float64("confidence", pvoc.DefaultPitchConfidence, "pitch confidence threshold (0-1): frames detected with a lower confidence are left uncorrected")
+  pitchTuneCSV := pitchCmd.String("tune-csv", "", "pitch correction file: write the detected and corrected pitch of every frame to this CSV file, requires -tune")
+  pitchSpectrogram := pitchCmd.String("spectrogram", "", "spectrogram image: draw the spectrograms of the input and output files side by side to this PNG file")
+  pitchDebugDir := pitchCmd.String("debug-dir", "", "debug directory: chart the windows, a selection of frames, gate decisions and output peaks as HTML pages in this directory, open index.html to browse them")
   pitchOutput := pitchCmd.String("f", "", "output file or directory: Provide a path to an AIFF/WAV file. If only a directory is specified, the output file will be automatically named. In both cases, file will be overwritten if it exists.")
+  pitchOutputFormat := pitchCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  pitchSplitOut := pitchCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+
+  // partials flags
+  partialsCmd := flag.NewFlagSet("partials", flag.ExitOnError)
+  partialsInput := partialsCmd.String("i", "", "input file: path to input AIFF/WAV to analyze")
+  partialsInputFormat := partialsCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  partialsSplit := partialsCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
+  partialsRead := partialsCmd.String("r", "", "read partials: path to a partial file (" + pvoc.PartialFormatsString() + ") to resynthesize instead of analyzing an input file")
+  partialsTracks := partialsCmd.String("t", "", "partials output file: write the partials to this file, the format is chosen by the extension: " + pvoc.PartialFormatsString())
+  partialsBands := partialsCmd.Int("b", 4096, "bands: number of FFT bands to use during analysis. Must be a power of two between 2 to 8192 inclusive")
+  partialsOverlap := partialsCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  partialsWindowName := partialsCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  partialsThreshold := partialsCmd.Float64("threshold", -70.0, "peak threshold (db): spectral peaks below this amplitude (below 0dBFS) are not tracked")
+  partialsDeviation := partialsCmd.Float64("deviation", 50.0, "frequency deviation (cents): how far a partial may move from one analysis frame to the next")
+  partialsMinLength := partialsCmd.Float64("min-length", 0.02, "minimum length (seconds): shorter partials are dropped")
+  partialsMaxPeaks := partialsCmd.Int("max-peaks", 0, "maximum peaks: only track the loudest peaks of each frame, 0 tracks all of them")
+  partialsScale := partialsCmd.Float64("s", 1.0, "time scale factor: time scale multiplier applied on resynthesis")
+  partialsPitch := partialsCmd.Float64("pitch", 1.0, "pitch scale factor: frequency multiplier applied on resynthesis")
+  partialsRate := partialsCmd.Int("rate", 0, "sample rate of the resynthesized file, defaults to the rate of the analysis")
+  partialsBits := partialsCmd.Int("bits", 24, "bit depth of the resynthesized file")
+  partialsQuiet := partialsCmd.Bool("q", false, "quiet flag: suppress informational output")
+  partialsOutput := partialsCmd.String("f", "", "output file: resynthesize the partials into this AIFF/WAV file, file will be overwritten if it exists")
+  partialsOutputFormat := partialsCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  partialsSplitOut := partialsCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+
+  // decompose flags
+  decomposeCmd := flag.NewFlagSet("decompose", flag.ExitOnError)
+  decomposeInput := decomposeCmd.String("i", "", "input file: path to input AIFF/WAV")
+  decomposeInputFormat := decomposeCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  decomposeSplit := decomposeCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
+  decomposeBands := decomposeCmd.Int("b", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
+  decomposeOverlap := decomposeCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  decomposeWindowName := decomposeCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  decomposeLockMode := decomposeCmd.String("lock", "", "phase lock mode: phase locking when time stretching or pitch shifting a component, one of: " + pvoc.PhaseLockModesString() + " (default none)")
+  decomposeThreshold := decomposeCmd.Float64("threshold", -70.0, "peak threshold (db): spectral peaks below this amplitude (below 0dBFS) are left in the residual")
+  decomposeDeviation := decomposeCmd.Float64("deviation", 50.0, "frequency deviation (cents): how far a partial may move from one analysis frame to the next")
+  decomposeMinLength := decomposeCmd.Float64("min-length", 0.02, "minimum length (seconds): shorter partials are left in the residual")
+  decomposeMaxPeaks := decomposeCmd.Int("max-peaks", 0, "maximum peaks: only track the loudest peaks of each frame, 0 tracks all of them")
+  decomposeDeterministic := decomposeCmd.String("d", "", "deterministic output file: write the sinusoidal component to this AIFF/WAV file")
+  decomposeResidual := decomposeCmd.String("n", "", "residual output file: write the noise/transient component to this AIFF/WAV file")
+  decomposeMix := decomposeCmd.String("m", "", "remix output file: write the sum of both (processed) components to this AIFF/WAV file")
+  decomposeOutputFormat := decomposeCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  decomposeSplitOut := decomposeCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+  decomposeDeterministicScale := decomposeCmd.Float64("ds", 1.0, "deterministic time scale factor: time scale multiplier for the sinusoidal component")
+  decomposeDeterministicPitch := decomposeCmd.Float64("dp", 1.0, "deterministic pitch scale factor: pitch shift multiplier for the sinusoidal component")
+  decomposeResidualScale := decomposeCmd.Float64("ns", 1.0, "residual time scale factor: time scale multiplier for the residual component")
+  decomposeResidualPitch := decomposeCmd.Float64("np", 1.0, "residual pitch scale factor: pitch shift multiplier for the residual component")
+  decomposeQuiet := decomposeCmd.Bool("q", false, "quiet flag: suppress informational output")
+
+  // hpss flags
+  hpssCmd := flag.NewFlagSet("hpss", flag.ExitOnError)
+  hpssInput := hpssCmd.String("i", "", "input file: path to input AIFF/WAV")
+  hpssInputFormat := hpssCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  hpssSplit := hpssCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
+  hpssBands := hpssCmd.Int("b", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
+  hpssOverlap := hpssCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  hpssWindowName := hpssCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  hpssHarmonicFrames := hpssCmd.Int("hl", pvoc.DefaultHarmonicFrames, "harmonic filter length (frames): length of the median filter across analysis frames")
+  hpssPercussiveBands := hpssCmd.Int("pl", pvoc.DefaultPercussiveBands, "percussive filter length (bands): length of the median filter across FFT bands")
+  hpssMask := hpssCmd.String("mask", pvoc.HPSSMaskSoft, "mask: how bands are split between the layers, one of: " + pvoc.HPSSMasksString())
+  hpssPower := hpssCmd.Float64("power", pvoc.DefaultHPSSPower, "mask power: exponent of the soft masks, higher values separate more")
+  hpssHarmonic := hpssCmd.String("harmonic", "", "harmonic output file: write the harmonic layer to this AIFF/WAV file")
+  hpssPercussive := hpssCmd.String("percussive", "", "percussive output file: write the percussive layer to this AIFF/WAV file")
+  hpssOutputFormat := hpssCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  hpssSplitOut := hpssCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+  hpssQuiet := hpssCmd.Bool("q", false, "quiet flag: suppress informational output")
+
+  // blur flags
+  blurCmd := flag.NewFlagSet("blur", flag.ExitOnError)
+  blurInput := blurCmd.String("i", "", "input file: path to input AIFF/WAV")
+  blurInputFormat := blurCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  blurSplit := blurCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
+  blurOutput := blurCmd.String("f", "", "output file: path to the blurred AIFF/WAV file, file will be overwritten if it exists")
+  blurOutputFormat := blurCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  blurSplitOut := blurCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+  blurBands := blurCmd.Int("b", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
+  blurOverlap := blurCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  blurWindowName := blurCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  blurFrames := blurCmd.Float64("n", pvoc.DefaultBlurFrames, "frames: number of analysis frames averaged, at least 1, fractional values are allowed")
+  blurCurve := blurCmd.String("curve", "", "width curve: breakpoint file (.bpf) of \"time frames\" lines giving the number of frames averaged over time, overrides -n")
+  blurPhases := blurCmd.Bool("phases", false, "phases flag: average the phases as well as the magnitudes")
+  blurIterations := blurCmd.Int("gl", 0, "Griffin-Lim iterations: reconstruct the output phases from the blurred magnitudes with this many iterations, 0 keeps the frames' own phases")
+  blurQuiet := blurCmd.Bool("q", false, "quiet flag: suppress informational output")
+
+  // morph flags, -b is the second input so bands are -bands
+  morphCmd := flag.NewFlagSet("morph", flag.ExitOnError)
+  morphInputA := morphCmd.String("a", "", "input file A: path to the AIFF/WAV file the morph starts from")
+  morphInputB := morphCmd.String("b", "", "input file B: path to the AIFF/WAV file the morph goes to")
+  morphFormatA := morphCmd.String("a-format", "", "input format of A: raw:<encoding>:<sample rate>:<channels> for headerless PCM, npy:<sample rate> for a .npy array")
+  morphFormatB := morphCmd.String("b-format", "", "input format of B, as -a-format")
+  morphSplitA := morphCmd.String("a-split", "", "split input of A: read A from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -a name.wav")
+  morphSplitB := morphCmd.String("b-split", "", "split input of B, as -a-split")
+  morphOutput := morphCmd.String("f", "", "output file: path to the morphed AIFF/WAV file, file will be overwritten if it exists")
+  morphOutputFormat := morphCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  morphSplitOut := morphCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+  morphBands := morphCmd.Int("bands", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
+  morphOverlap := morphCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  morphWindowName := morphCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  morphAmount := morphCmd.Float64("x", 0.5, "morph amount: position between A (0) and B (1)")
+  morphCurve := morphCmd.String("curve", "", "morph curve: breakpoint file (.bpf) of \"time amount\" lines giving the position between A (0) and B (1) over time, overrides -x")
+  morphMode := morphCmd.String("mode", pvoc.MorphBins, "mode: what is interpolated, one of: " + pvoc.MorphModesString())
+  morphNormalize := morphCmd.Bool("normalize", false, "normalize flag: stretch or squeeze B to the length of A")
+  morphThreshold := morphCmd.Float64("threshold", -70.0, "peak threshold (db): in partials mode, spectral peaks below this amplitude (below 0dBFS) are not tracked")
+  morphDeviation := morphCmd.Float64("deviation", 50.0, "frequency deviation (cents): in partials mode, how far a partial may move from one analysis frame to the next")
+  morphMinLength := morphCmd.Float64("min-length", 0.02, "minimum length (seconds): in partials mode, shorter partials are dropped")
+  morphMaxPeaks := morphCmd.Int("max-peaks", 0, "maximum peaks: in partials mode, only track the loudest peaks of each frame, 0 tracks all of them")
+  morphIterations := morphCmd.Int("gl", 0, "Griffin-Lim iterations: in bins mode, reconstruct the output phases from the morphed magnitudes with this many iterations, 0 keeps the locked phases")
+  morphQuiet := morphCmd.Bool("q", false, "quiet flag: suppress informational output")
+
+  // spectral flags
+  spectralCmd := flag.NewFlagSet("spectral", flag.ExitOnError)
+  spectralInput := spectralCmd.String("i", "", "input file: path to input AIFF/WAV")
+  spectralInputFormat := spectralCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  spectralSplit := spectralCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
+  spectralOutput := spectralCmd.String("f", "", "output file or directory: Provide a path to an AIFF/WAV file. If only a directory is specified, the output file will be automatically named. In both cases, file will be overwritten if it exists.")
+  spectralOutputFormat := spectralCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  spectralSplitOut := spectralCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+  spectralScale := spectralCmd.Float64("s", 1.0, "scale factor: time scale multiplier")
+  spectralBands := spectralCmd.Int("b", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
+  spectralOverlap := spectralCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  spectralWindowName := spectralCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  spectralOperation := spectralCmd.String("op", "", "operation: spectral rearrangement applied to every frame, one of: " + pvoc.SpectralOperationsString())
+  spectralLow := spectralCmd.Float64("low", 0.0, "low frequency (Hz): start of the range of bands operated on")
+  spectralHigh := spectralCmd.Float64("high", 0.0, "high frequency (Hz): end of the range of bands operated on, 0 is the Nyquist frequency")
+  spectralPivot := spectralCmd.Float64("pivot", 0.0, "pivot frequency (Hz): mirror the range around this frequency, 0 is the middle of the range")
+  spectralTo := spectralCmd.Float64("to", 0.0, "swap frequency (Hz): swap the range with the range of the same width starting here")
+  spectralSeed := spectralCmd.Int64("seed", 1, "seed: random seed of the shuffle, the same seed always shuffles the same way")
+  spectralWidth := spectralCmd.Int("width", 1, "width (bands): number of adjacent bands shuffled together")
+  spectralSpectrogram := spectralCmd.String("spectrogram", "", "spectrogram image: draw the spectrograms of the input and output files side by side to this PNG file")
+  spectralDebugDir := spectralCmd.String("debug-dir", "", "debug directory: chart the windows, a selection of frames, gate decisions and output peaks as HTML pages in this directory, open index.html to browse them")
+  spectralStart := spectralCmd.String("start", "", "region start: process the input from this position, in seconds (1.5), sample frames (72000smp) or a timecode ([hh:]mm:ss.fff) (default the start of the file)")
+  spectralEnd := spectralCmd.String("end", "", "region end: process the input up to this position, as -start (default the end of the file)")
+  spectralSplice := spectralCmd.Bool("splice", false, "splice flag: write the processed region back into the whole input, crossfading at both ends")
+  spectralCrossfade := spectralCmd.Float64("crossfade", 10, "crossfade: length of the -splice crossfades in milliseconds")
+  spectralChannels := spectralCmd.String("ch", "", "channels: process only these channels, counted from 1, as a list of channels and ranges such as 1,3-4 (default all of them)")
+  spectralMix := spectralCmd.String("mix", "", "mix: mix the input channels before processing, mono sums them into one, stereo into two, or rows of gains for each input channel such as 0.5,0.5;1,0;0,1")
+  spectralMidSide := spectralCmd.Bool("ms", false, "mid/side flag: process two channels as their sum and difference, which keeps the stereo image steady")
+  spectralPass := spectralCmd.Bool("pass", false, "pass flag: write the channels -ch doesn't select unprocessed, in time with the processed ones, instead of dropping them")
+  spectralQuiet := spectralCmd.Bool("q", false, "quiet flag: suppress informational output")
+
+  // pitchtrack flags
+  pitchTrackCmd := flag.NewFlagSet("pitchtrack", flag.ExitOnError)
+  pitchTrackInput := pitchTrackCmd.String("i", "", "input file: path to input AIFF/WAV")
+  pitchTrackInputFormat := pitchTrackCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  pitchTrackSplit := pitchTrackCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
+  pitchTrackOutput := pitchTrackCmd.String("t", "", "pitch file: write the pitch of every frame to this file, the format is taken from the extension, one of: " + pvoc.PitchFormatsString())
+  pitchTrackMethod := pitchTrackCmd.String("method", pvoc.PitchYIN, "method: pitch estimator, one of: " + pvoc.PitchMethodsString())
+  pitchTrackBands := pitchTrackCmd.Int("b", 1024, "bands: number of FFT bands, the frames are twice as many samples times the overlap. Must be a power of two between 2 to 8192 inclusive")
+  pitchTrackOverlap := pitchTrackCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  pitchTrackWindowName := pitchTrackCmd.String("w", "hamming", "window: windowing function of the harmonic method, one of: " + pvoc.WindowNamesString())
+  pitchTrackMin := pitchTrackCmd.Float64("min-pitch", pvoc.DefaultMinPitch, "lowest pitch (Hz) detected")
+  pitchTrackMax := pitchTrackCmd.Float64("max-pitch", pvoc.DefaultMaxPitch, "highest pitch (Hz) detected")
+  pitchTrackConfidence := pitchTrackCmd.Float64("confidence", pvoc.DefaultPitchConfidence, "pitch confidence threshold (0-1): frames detected with a lower confidence are unvoiced (0 Hz)")
+  pitchTrackReference := pitchTrackCmd.Float64("reference", pvoc.DefaultTuningReference, "reference pitch (Hz) of bpf files: the curve is the detected pitch divided by the reference")
+  pitchTrackFlatten := pitchTrackCmd.Bool("flatten", false, "flatten flag: bpf files get the reference divided by the detected pitch, a curve that shifts the input to the reference")
+  pitchTrackQuiet := pitchTrackCmd.Bool("q", false, "quiet flag: suppress informational output")
+
+  // spectrogram flags, -o is the image so overlap is -overlap
+  spectrogramCmd := flag.NewFlagSet("spectrogram", flag.ExitOnError)
+  spectrogramInput := spectrogramCmd.String("i", "", "input file: path to input AIFF/WAV")
+  spectrogramInputFormat := spectrogramCmd.String("i-format", "", "input format: raw:<encoding>:<sample rate>:<channels> for headerless PCM (such as raw:s16le:48000:2), npy:<sample rate> for a .npy array (default 44100)")
+  spectrogramSplit := spectrogramCmd.String("split", "", "split input: read the input from a mono file for each of these channel names, such as L,R,C for name.L.wav, name.R.wav and name.C.wav with -i name.wav")
+  spectrogramCompare := spectrogramCmd.String("c", "", "compare file: path to an AIFF/WAV file drawn to the right of the input, on the same scales")
+  spectrogramOutput := spectrogramCmd.String("o", "", "image file: path to the PNG file, file will be overwritten if it exists")
+  spectrogramBands := spectrogramCmd.Int("b", 4096, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
+  spectrogramOverlap := spectrogramCmd.Float64("overlap", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  spectrogramWindowName := spectrogramCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  spectrogramScale := spectrogramCmd.String("scale", pvoc.FrequencyLog, "frequency scale, one of: " + pvoc.FrequencyScalesString())
+  spectrogramMin := spectrogramCmd.Float64("min", pvoc.DefaultImageMinFrequency, "lowest frequency (Hz) drawn")
+  spectrogramMax := spectrogramCmd.Float64("max", 0.0, "highest frequency (Hz) drawn, 0 is the Nyquist frequency")
+  spectrogramRange := spectrogramCmd.Float64("range", pvoc.DefaultImageRange, "range (dB): magnitudes from full scale down to this many dB below it are drawn")
+  spectrogramWidth := spectrogramCmd.Int("width", pvoc.DefaultImageWidth, "width (pixels) of each spectrogram, 0 draws one column per analysis frame")
+  spectrogramHeight := spectrogramCmd.Int("height", pvoc.DefaultImageHeight, "height (pixels) of the spectrograms")
+  spectrogramQuiet := spectrogramCmd.Bool("q", false, "quiet flag: suppress informational output")
+
+  // imagesynth flags
+  imageSynthCmd := flag.NewFlagSet("imagesynth", flag.ExitOnError)
+  imageSynthImage := imageSynthCmd.String("img", "", "image file: path to the PNG, JPEG or GIF image, rows are frequencies (high at the top) and columns are time")
+  imageSynthOutput := imageSynthCmd.String("f", "", "output file: path to the AIFF/WAV file, file will be overwritten if it exists")
+  imageSynthOutputFormat := imageSynthCmd.String("of", "", "output format: write the output as one of: " + audioio.OutputFormatsString() + ", whatever its extension (default: taken from the extension)")
+  imageSynthSplitOut := imageSynthCmd.Bool("split-out", false, "split output flag: write each channel of the output to a mono file, named after the -split channel names or numbered from 1, such as name.1.wav")
+  imageSynthDuration := imageSynthCmd.Float64("d", 0.0, "duration (seconds) of the output, 0 gives every column of pixels one analysis frame")
+  imageSynthScale := imageSynthCmd.String("scale", pvoc.FrequencyLog, "frequency scale of the rows, one of: " + pvoc.FrequencyScalesString())
+  imageSynthMin := imageSynthCmd.Float64("min", pvoc.DefaultImageSynthMinFrequency, "lowest frequency (Hz), at the bottom row")
+  imageSynthMax := imageSynthCmd.Float64("max", pvoc.DefaultImageSynthMaxFrequency, "highest frequency (Hz), at the top row, limited to the Nyquist frequency")
+  imageSynthRange := imageSynthCmd.Float64("range", pvoc.DefaultImageSynthRange, "range (dB): white pixels are this much louder than the darkest grey, black is silent")
+  imageSynthPeak := imageSynthCmd.Float64("peak", pvoc.DefaultImageSynthPeak, "peak (dB): the output is normalized to this level below full scale")
+  imageSynthBands := imageSynthCmd.Int("b", 2048, "bands: number of FFT bands to use during processing. Must be a power of two between 2 to 8192 inclusive")
+  imageSynthOverlap := imageSynthCmd.Float64("o", 1.0, "overlap: overlap factor, allowed values: 0.5, 1, 2, 4")
+  imageSynthWindowName := imageSynthCmd.String("w", "hamming", "window: windowing function to use, one of: " + pvoc.WindowNamesString())
+  imageSynthRate := imageSynthCmd.Int("rate", 44100, "sample rate of the output file")
+  imageSynthBits := imageSynthCmd.Int("bits", 24, "bit depth of the output file")
+  imageSynthIterations := imageSynthCmd.Int("gl", 0, "Griffin-Lim iterations: reconstruct the phases from the image's magnitudes with this many iterations, 0 keeps the phases following each row's frequency")
+  imageSynthQuiet := imageSynthCmd.Bool("q", false, "quiet flag: suppress informational output")
 
   parsedArgs := &Arguments{ }
+  var err error
 
   switch args[1] {
   case "time":
     timeCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandTime
+    parsedArgs.OutputType, err = parseOutputType(*timeOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *timeSplitOut
+
 
     if len(*timeInput) == 0 {
       return nil, fmt.Errorf("Required argument missing:\n\n-i <path to input file> is required, for help:\n\ngopvoc time -h\n\n")
@@ -174,15 +788,84 @@ func ParseFlags(args []string, version string) (*Arguments, error) {
 
     parsedArgs.Operation = pvoc.TimeStretch
     parsedArgs.InputPath, _ = filepath.Abs(*timeInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*timeInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*timeSplit)
+
+    if err != nil {
+      return nil, err
+    }
     parsedArgs.Scale = *timeScale
     parsedArgs.Bands = *timeBands
     parsedArgs.Overlap = *timeOverlap
     parsedArgs.PhaseLock = *timePhaseLock
+    parsedArgs.PhaseLockMode, err = parsePhaseLock(*timePhaseLock, *timeLockMode)
+
+    if err != nil {
+      return nil, err
+    }
     parsedArgs.WindowName = *timeWindowName
     parsedArgs.GatingAmplitude = *timeGatingAmplitude
     parsedArgs.GatingThreshold = *timeGatingThreshold
+    parsedArgs.PhaseReconstruction = *timePhase
+    parsedArgs.Iterations = *timeIterations
+
+    if len(*timeLink) > 0 {
+      if *timePhase == pvoc.PhaseGriffinLim {
+        return nil, fmt.Errorf("-link can't be combined with -phase %s, Griffin-Lim finds the phases of each channel on its own, for help:\n\ngopvoc time -h\n\n", pvoc.PhaseGriffinLim)
+      }
+
+      parsedArgs.LinkChannels = true
+      parsedArgs.LinkReference, err = pvoc.ParseLinkReference(*timeLink)
+
+      if err != nil {
+        return nil, err
+      }
+    }
+    parsedArgs.TransientSensitivity = *timeTransients
+    parsedArgs.TransientKeep = *timeTransientKeep
+    parsedArgs.HarmonicOnly = *timeHarmonicOnly
     parsedArgs.Quiet = *timeQuiet
 
+    if err = parseRange(parsedArgs, *timeStart, *timeEnd, *timeSplice, *timeCrossfade); err != nil {
+      return nil, err
+    }
+
+    if err = parseChannelRouting(parsedArgs, *timeChannels, *timeMix, *timeMidSide, *timePass); err != nil {
+      return nil, err
+    }
+
+    if *timeHarmonicOnly {
+      if *timeTransientKeep {
+        return nil, fmt.Errorf("-harmonic-only places the percussive layer at uniformly stretched times and can't be combined with -transient-keep, for help:\n\ngopvoc time -h\n\n")
+      }
+
+      parsedArgs.HarmonicFrames = pvoc.DefaultHarmonicFrames
+      parsedArgs.PercussiveBands = pvoc.DefaultPercussiveBands
+      parsedArgs.HPSSMask = pvoc.HPSSMaskSoft
+      parsedArgs.HPSSPower = pvoc.DefaultHPSSPower
+    }
+
+    if len(*timeOnsets) > 0 {
+      if *timeTransients == 0 {
+        return nil, fmt.Errorf("-onsets requires -transients <sensitivity>, for help:\n\ngopvoc time -h\n\n")
+      }
+
+      parsedArgs.OnsetsPath, _ = filepath.Abs(*timeOnsets)
+    }
+
+    if len(*timeDebugDir) > 0 {
+      parsedArgs.DebugDir, _ = filepath.Abs(*timeDebugDir)
+    }
+
+    if len(*timeSpectrogram) > 0 {
+      setSpectrogramDefaults(parsedArgs, *timeSpectrogram)
+    }
+
     if len(*timeOutput) == 0 {
       return nil, fmt.Errorf("Required argument missing:\n\n-f <path to output file or directory> is required, for help:\n\ngopvoc time -h\n\n")
     }
@@ -194,6 +877,15 @@ func ParseFlags(args []string, version string) (*Arguments, error) {
     parsedArgs.OutputPath = parsedFilePath
   case "pitch":
     pitchCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandPitch
+    parsedArgs.OutputType, err = parseOutputType(*pitchOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *pitchSplitOut
+
     parsedArgs.Operation = pvoc.PitchShift
 
     if len(*pitchInput) == 0 {
@@ -201,14 +893,74 @@ func ParseFlags(args []string, version string) (*Arguments, error) {
     }
 
     parsedArgs.InputPath, _ = filepath.Abs(*pitchInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*pitchInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*pitchSplit)
+
+    if err != nil {
+      return nil, err
+    }
     parsedArgs.Scale = *pitchScale
     parsedArgs.Bands = *pitchBands
     parsedArgs.Overlap = *pitchOverlap
+    parsedArgs.PhaseLock = *pitchPhaseLock
+    parsedArgs.PhaseLockMode, err = parsePhaseLock(*pitchPhaseLock, *pitchLockMode)
+
+    if err != nil {
+      return nil, err
+    }
     parsedArgs.WindowName = *pitchWindowName
     parsedArgs.GatingAmplitude = *pitchGatingAmplitude
     parsedArgs.GatingThreshold = *pitchGatingThreshold
     parsedArgs.Quiet = *pitchQuiet
 
+    if err = parseRange(parsedArgs, *pitchStart, *pitchEnd, *pitchSplice, *pitchCrossfade); err != nil {
+      return nil, err
+    }
+
+    if err = parseChannelRouting(parsedArgs, *pitchChannels, *pitchMix, *pitchMidSide, *pitchPass); err != nil {
+      return nil, err
+    }
+
+    if len(*pitchCurve) > 0 {
+      parsedArgs.ScaleCurvePath, _ = filepath.Abs(*pitchCurve)
+    }
+
+    if len(*pitchTune) > 0 {
+      parsedArgs.TuneScale = *pitchTune
+      parsedArgs.TuneKey, err = pvoc.ParseKey(*pitchKey)
+
+      if err != nil {
+        return nil, err
+      }
+
+      parsedArgs.TuneReference = *pitchReference
+      parsedArgs.TuneRetune = *pitchRetune
+      parsedArgs.PitchMin = *pitchMin
+      parsedArgs.PitchMax = *pitchMax
+      parsedArgs.PitchConfidence = *pitchConfidence
+    }
+
+    if len(*pitchTuneCSV) > 0 {
+      if len(*pitchTune) == 0 {
+        return nil, fmt.Errorf("-tune-csv requires -tune <scale>, for help:\n\ngopvoc pitch -h\n\n")
+      }
+
+      parsedArgs.TuneCSVPath, _ = filepath.Abs(*pitchTuneCSV)
+    }
+
+    if len(*pitchDebugDir) > 0 {
+      parsedArgs.DebugDir, _ = filepath.Abs(*pitchDebugDir)
+    }
+
+    if len(*pitchSpectrogram) > 0 {
+      setSpectrogramDefaults(parsedArgs, *pitchSpectrogram)
+    }
+
     if len(*pitchOutput) == 0 {
       return nil, fmt.Errorf("Required argument missing:\n\n-f <path to output file> is required, for help:\n\ngopvoc time -h\n\n")
     }
@@ -218,9 +970,503 @@ func ParseFlags(args []string, version string) (*Arguments, error) {
       return nil, err
     }
     parsedArgs.OutputPath = parsedFilePath
+  case "partials":
+    partialsCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandPartials
+    parsedArgs.OutputType, err = parseOutputType(*partialsOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *partialsSplitOut
+
+
+    if (len(*partialsInput) == 0) == (len(*partialsRead) == 0) {
+      return nil, fmt.Errorf("Either -i <path to input file> or -r <path to partial file> is required, for help:\n\ngopvoc partials -h\n\n")
+    }
+
+    if len(*partialsTracks) == 0 && len(*partialsOutput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-t <path to partial file> and/or -f <path to output file> is required, for help:\n\ngopvoc partials -h\n\n")
+    }
+
+    if len(*partialsInput) > 0 {
+      parsedArgs.InputPath, _ = filepath.Abs(*partialsInput)
+      parsedArgs.InputFormat, err = parseInputFormat(*partialsInputFormat)
+
+      if err != nil {
+        return nil, err
+      }
+
+      parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*partialsSplit)
+
+      if err != nil {
+        return nil, err
+      }
+    }
+
+    if len(*partialsRead) > 0 {
+      parsedArgs.PartialsInputPath, _ = filepath.Abs(*partialsRead)
+    }
+
+    if len(*partialsTracks) > 0 {
+      parsedArgs.PartialsOutputPath, _ = filepath.Abs(*partialsTracks)
+
+      if _, err = pvoc.PartialFormat(parsedArgs.PartialsOutputPath); err != nil {
+        return nil, err
+      }
+    }
+
+    if len(*partialsOutput) > 0 {
+      parsedArgs.OutputPath, _ = filepath.Abs(*partialsOutput)
+    }
+
+    parsedArgs.Bands = *partialsBands
+    parsedArgs.Overlap = *partialsOverlap
+    parsedArgs.WindowName = *partialsWindowName
+    parsedArgs.PartialThreshold = *partialsThreshold
+    parsedArgs.PartialDeviation = *partialsDeviation
+    parsedArgs.PartialMinLength = *partialsMinLength
+    parsedArgs.PartialMaxPeaks = *partialsMaxPeaks
+    parsedArgs.Scale = *partialsScale
+    parsedArgs.PitchScale = *partialsPitch
+    parsedArgs.SampleRate = *partialsRate
+    parsedArgs.BitDepth = *partialsBits
+    parsedArgs.Quiet = *partialsQuiet
+  case "decompose":
+    decomposeCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandDecompose
+    parsedArgs.OutputType, err = parseOutputType(*decomposeOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *decomposeSplitOut
+
+
+    if len(*decomposeInput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-i <path to input file> is required, for help:\n\ngopvoc decompose -h\n\n")
+    }
+
+    if len(*decomposeDeterministic) == 0 && len(*decomposeResidual) == 0 && len(*decomposeMix) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\nat least one of -d, -n or -m <path to output file> is required, for help:\n\ngopvoc decompose -h\n\n")
+    }
+
+    parsedArgs.InputPath, _ = filepath.Abs(*decomposeInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*decomposeInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*decomposeSplit)
+
+    if err != nil {
+      return nil, err
+    }
+
+    if len(*decomposeDeterministic) > 0 {
+      parsedArgs.DeterministicPath, _ = filepath.Abs(*decomposeDeterministic)
+    }
+
+    if len(*decomposeResidual) > 0 {
+      parsedArgs.ResidualPath, _ = filepath.Abs(*decomposeResidual)
+    }
+
+    if len(*decomposeMix) > 0 {
+      parsedArgs.MixPath, _ = filepath.Abs(*decomposeMix)
+    }
+
+    parsedArgs.PhaseLockMode, err = parsePhaseLock(false, *decomposeLockMode)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.Bands = *decomposeBands
+    parsedArgs.Overlap = *decomposeOverlap
+    parsedArgs.WindowName = *decomposeWindowName
+    parsedArgs.PartialThreshold = *decomposeThreshold
+    parsedArgs.PartialDeviation = *decomposeDeviation
+    parsedArgs.PartialMinLength = *decomposeMinLength
+    parsedArgs.PartialMaxPeaks = *decomposeMaxPeaks
+    parsedArgs.DeterministicScale = *decomposeDeterministicScale
+    parsedArgs.DeterministicPitch = *decomposeDeterministicPitch
+    parsedArgs.ResidualScale = *decomposeResidualScale
+    parsedArgs.ResidualPitch = *decomposeResidualPitch
+    parsedArgs.Quiet = *decomposeQuiet
+  case "hpss":
+    hpssCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandHPSS
+    parsedArgs.OutputType, err = parseOutputType(*hpssOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *hpssSplitOut
+
+
+    if len(*hpssInput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-i <path to input file> is required, for help:\n\ngopvoc hpss -h\n\n")
+    }
+
+    if len(*hpssHarmonic) == 0 && len(*hpssPercussive) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-harmonic and/or -percussive <path to output file> is required, for help:\n\ngopvoc hpss -h\n\n")
+    }
+
+    parsedArgs.InputPath, _ = filepath.Abs(*hpssInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*hpssInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*hpssSplit)
+
+    if err != nil {
+      return nil, err
+    }
+
+    if len(*hpssHarmonic) > 0 {
+      parsedArgs.HarmonicPath, _ = filepath.Abs(*hpssHarmonic)
+    }
+
+    if len(*hpssPercussive) > 0 {
+      parsedArgs.PercussivePath, _ = filepath.Abs(*hpssPercussive)
+    }
+
+    parsedArgs.Bands = *hpssBands
+    parsedArgs.Overlap = *hpssOverlap
+    parsedArgs.WindowName = *hpssWindowName
+    parsedArgs.HarmonicFrames = *hpssHarmonicFrames
+    parsedArgs.PercussiveBands = *hpssPercussiveBands
+    parsedArgs.HPSSMask = *hpssMask
+    parsedArgs.HPSSPower = *hpssPower
+    parsedArgs.Quiet = *hpssQuiet
+  case "spectrogram":
+    spectrogramCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandSpectrogram
+
+    if len(*spectrogramInput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-i <path to input file> is required, for help:\n\ngopvoc spectrogram -h\n\n")
+    }
+
+    if len(*spectrogramOutput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-o <path to PNG file> is required, for help:\n\ngopvoc spectrogram -h\n\n")
+    }
+
+    parsedArgs.InputPath, _ = filepath.Abs(*spectrogramInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*spectrogramInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*spectrogramSplit)
+
+    if err != nil {
+      return nil, err
+    }
+    parsedArgs.SpectrogramPath, _ = filepath.Abs(*spectrogramOutput)
+
+    if len(*spectrogramCompare) > 0 {
+      parsedArgs.ComparePath, _ = filepath.Abs(*spectrogramCompare)
+    }
+
+    parsedArgs.Bands = *spectrogramBands
+    parsedArgs.Overlap = *spectrogramOverlap
+    parsedArgs.WindowName = *spectrogramWindowName
+    parsedArgs.ImageScale = *spectrogramScale
+    parsedArgs.ImageMinFrequency = *spectrogramMin
+    parsedArgs.ImageMaxFrequency = *spectrogramMax
+    parsedArgs.ImageRange = *spectrogramRange
+    parsedArgs.ImageWidth = *spectrogramWidth
+    parsedArgs.ImageHeight = *spectrogramHeight
+    parsedArgs.Quiet = *spectrogramQuiet
+  case "imagesynth":
+    imageSynthCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandImageSynth
+    parsedArgs.OutputType, err = parseOutputType(*imageSynthOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *imageSynthSplitOut
+
+
+    if len(*imageSynthImage) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-img <path to image file> is required, for help:\n\ngopvoc imagesynth -h\n\n")
+    }
+
+    if len(*imageSynthOutput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-f <path to output file> is required, for help:\n\ngopvoc imagesynth -h\n\n")
+    }
+
+    parsedArgs.ImagePath, _ = filepath.Abs(*imageSynthImage)
+    parsedArgs.OutputPath, _ = filepath.Abs(*imageSynthOutput)
+    parsedArgs.ImageDuration = *imageSynthDuration
+    parsedArgs.ImageScale = *imageSynthScale
+    parsedArgs.ImageMinFrequency = *imageSynthMin
+    parsedArgs.ImageMaxFrequency = *imageSynthMax
+    parsedArgs.ImageRange = *imageSynthRange
+    parsedArgs.ImagePeak = *imageSynthPeak
+    parsedArgs.Bands = *imageSynthBands
+    parsedArgs.Overlap = *imageSynthOverlap
+    parsedArgs.WindowName = *imageSynthWindowName
+    parsedArgs.SampleRate = *imageSynthRate
+    parsedArgs.BitDepth = *imageSynthBits
+    parsedArgs.Iterations = *imageSynthIterations
+
+    if parsedArgs.Iterations < 0 {
+      return nil, fmt.Errorf("-gl must be at least 0, got %d", parsedArgs.Iterations)
+    }
+
+    parsedArgs.Quiet = *imageSynthQuiet
+  case "pitchtrack":
+    pitchTrackCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandPitchTrack
+
+    if len(*pitchTrackInput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-i <path to input file> is required, for help:\n\ngopvoc pitchtrack -h\n\n")
+    }
+
+    if len(*pitchTrackOutput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-t <path to pitch file> is required, for help:\n\ngopvoc pitchtrack -h\n\n")
+    }
+
+    if _, err = pvoc.PitchFormat(*pitchTrackOutput); err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputPath, _ = filepath.Abs(*pitchTrackInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*pitchTrackInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*pitchTrackSplit)
+
+    if err != nil {
+      return nil, err
+    }
+    parsedArgs.PitchPath, _ = filepath.Abs(*pitchTrackOutput)
+    parsedArgs.PitchMethod = *pitchTrackMethod
+    parsedArgs.Bands = *pitchTrackBands
+    parsedArgs.Overlap = *pitchTrackOverlap
+    parsedArgs.WindowName = *pitchTrackWindowName
+    parsedArgs.PitchMin = *pitchTrackMin
+    parsedArgs.PitchMax = *pitchTrackMax
+    parsedArgs.PitchConfidence = *pitchTrackConfidence
+    parsedArgs.PitchReference = *pitchTrackReference
+    parsedArgs.PitchFlatten = *pitchTrackFlatten
+    parsedArgs.Quiet = *pitchTrackQuiet
+  case "blur":
+    blurCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandBlur
+    parsedArgs.OutputType, err = parseOutputType(*blurOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *blurSplitOut
+
+
+    if len(*blurInput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-i <path to input file> is required, for help:\n\ngopvoc blur -h\n\n")
+    }
+
+    if len(*blurOutput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-f <path to output file> is required, for help:\n\ngopvoc blur -h\n\n")
+    }
+
+    parsedArgs.InputPath, _ = filepath.Abs(*blurInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*blurInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*blurSplit)
+
+    if err != nil {
+      return nil, err
+    }
+    parsedArgs.OutputPath, _ = filepath.Abs(*blurOutput)
+
+    if len(*blurCurve) > 0 {
+      parsedArgs.BlurCurvePath, _ = filepath.Abs(*blurCurve)
+    }
+
+    parsedArgs.Bands = *blurBands
+    parsedArgs.Overlap = *blurOverlap
+    parsedArgs.WindowName = *blurWindowName
+    parsedArgs.BlurFrames = *blurFrames
+    parsedArgs.BlurPhases = *blurPhases
+    parsedArgs.Iterations = *blurIterations
+
+    if parsedArgs.Iterations < 0 {
+      return nil, fmt.Errorf("-gl must be at least 0, got %d", parsedArgs.Iterations)
+    }
+
+    parsedArgs.Quiet = *blurQuiet
+  case "morph":
+    morphCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandMorph
+    parsedArgs.OutputType, err = parseOutputType(*morphOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *morphSplitOut
+
+
+    if len(*morphInputA) == 0 || len(*morphInputB) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-a and -b <path to input file> are required, for help:\n\ngopvoc morph -h\n\n")
+    }
+
+    if len(*morphOutput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-f <path to output file> is required, for help:\n\ngopvoc morph -h\n\n")
+    }
+
+    parsedArgs.InputPath, _ = filepath.Abs(*morphInputA)
+    parsedArgs.MorphInputPath, _ = filepath.Abs(*morphInputB)
+    parsedArgs.InputFormat, err = parseInputFormat(*morphFormatA)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*morphSplitA)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.MorphInputFormat, err = parseInputFormat(*morphFormatB)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.MorphInputFormat.SplitNames, err = parseSplitNames(*morphSplitB)
+
+    if err != nil {
+      return nil, err
+    }
+    parsedArgs.OutputPath, _ = filepath.Abs(*morphOutput)
+
+    if len(*morphCurve) > 0 {
+      parsedArgs.MorphCurvePath, _ = filepath.Abs(*morphCurve)
+    }
+
+    parsedArgs.Bands = *morphBands
+    parsedArgs.Overlap = *morphOverlap
+    parsedArgs.WindowName = *morphWindowName
+    parsedArgs.MorphAmount = *morphAmount
+    parsedArgs.MorphMode = *morphMode
+    parsedArgs.MorphNormalize = *morphNormalize
+    parsedArgs.PartialThreshold = *morphThreshold
+    parsedArgs.PartialDeviation = *morphDeviation
+    parsedArgs.PartialMinLength = *morphMinLength
+    parsedArgs.PartialMaxPeaks = *morphMaxPeaks
+    parsedArgs.Iterations = *morphIterations
+
+    if parsedArgs.Iterations < 0 {
+      return nil, fmt.Errorf("-gl must be at least 0, got %d", parsedArgs.Iterations)
+    }
+
+    if parsedArgs.Iterations > 0 && parsedArgs.MorphMode == pvoc.MorphPartials {
+      return nil, fmt.Errorf("-gl can't be combined with -mode %s, partials are synthesized from their own phases, for help:\n\ngopvoc morph -h\n\n", pvoc.MorphPartials)
+    }
+
+    parsedArgs.Quiet = *morphQuiet
+  case "spectral":
+    spectralCmd.Parse(os.Args[2:])
+    parsedArgs.Command = CommandSpectral
+    parsedArgs.OutputType, err = parseOutputType(*spectralOutputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.SplitOutput = *spectralSplitOut
+
+    parsedArgs.Operation = pvoc.TimeStretch
+
+    if len(*spectralInput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-i <path to input file> is required, for help:\n\ngopvoc spectral -h\n\n")
+    }
+
+    if len(*spectralOperation) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-op <operation> is required, one of: %s, for help:\n\ngopvoc spectral -h\n\n", pvoc.SpectralOperationsString())
+    }
+
+    if len(*spectralOutput) == 0 {
+      return nil, fmt.Errorf("Required argument missing:\n\n-f <path to output file or directory> is required, for help:\n\ngopvoc spectral -h\n\n")
+    }
+
+    parsedArgs.InputPath, _ = filepath.Abs(*spectralInput)
+    parsedArgs.InputFormat, err = parseInputFormat(*spectralInputFormat)
+
+    if err != nil {
+      return nil, err
+    }
+
+    parsedArgs.InputFormat.SplitNames, err = parseSplitNames(*spectralSplit)
+
+    if err != nil {
+      return nil, err
+    }
+    parsedArgs.Scale = *spectralScale
+    parsedArgs.Bands = *spectralBands
+    parsedArgs.Overlap = *spectralOverlap
+    parsedArgs.WindowName = *spectralWindowName
+    parsedArgs.PhaseLockMode = pvoc.PhaseLockNone
+    parsedArgs.PhaseReconstruction = pvoc.PhaseClassic
+    parsedArgs.Iterations = pvoc.DefaultGriffinLimIterations
+    parsedArgs.SpectralOperation = *spectralOperation
+    parsedArgs.SpectralLow = *spectralLow
+    parsedArgs.SpectralHigh = *spectralHigh
+    parsedArgs.SpectralPivot = *spectralPivot
+    parsedArgs.SpectralTo = *spectralTo
+    parsedArgs.SpectralSeed = *spectralSeed
+    parsedArgs.SpectralWidth = *spectralWidth
+    parsedArgs.Quiet = *spectralQuiet
+
+    if err = parseRange(parsedArgs, *spectralStart, *spectralEnd, *spectralSplice, *spectralCrossfade); err != nil {
+      return nil, err
+    }
+
+    if err = parseChannelRouting(parsedArgs, *spectralChannels, *spectralMix, *spectralMidSide, *spectralPass); err != nil {
+      return nil, err
+    }
+
+    if len(*spectralDebugDir) > 0 {
+      parsedArgs.DebugDir, _ = filepath.Abs(*spectralDebugDir)
+    }
+
+    if len(*spectralSpectrogram) > 0 {
+      setSpectrogramDefaults(parsedArgs, *spectralSpectrogram)
+    }
+
+    parsedFilePath, err := parseOutputFilePath(*spectralOutput, parsedArgs)
+    if err != nil {
+      return nil, err
+    }
+    parsedArgs.OutputPath = parsedFilePath
   default:
     return nil, cmdError
   }
 
+  if err = checkOutputTypes(parsedArgs); err != nil {
+    return nil, err
+  }
+
   return parsedArgs, nil
 }
@@ -2,8 +2,10 @@ package cli
 
 import (
 	"fmt"
+	"gopvoc/audioio"
 	"gopvoc/pvoc"
 	. "gopvoc/testing_utilities"
+	"os"
 	"path/filepath"
 	"testing"
 )
@@ -82,6 +84,97 @@ func TestParseOutputFilePath(t *testing.T) {
       },
       hasError: false,
     },
+    "directory only, base path exists, time with transients": {
+      outputPath: "../fixtures/tmp",
+      expected: fmt.Sprintf("%s/%s", fixturesPath, "tmp/out-ts4-tr05k.aif"),
+      parsedArgs: &Arguments{
+        Bands: 4096,
+        Overlap: 1,
+        Scale: 4,
+        Operation: pvoc.TimeStretch,
+        InputPath: "../fixtures/out.aif",
+        OutputPath: "../fixtures/",
+        WindowName: "hamming",
+        TransientSensitivity: 0.5,
+        TransientKeep: true,
+      },
+      hasError: false,
+    },
+    "directory only, base path exists, time with pghi": {
+      outputPath: "../fixtures/tmp",
+      expected: fmt.Sprintf("%s/%s", fixturesPath, "tmp/out-ts2-pghi.aif"),
+      parsedArgs: &Arguments{
+        Bands: 4096,
+        Overlap: 1,
+        Scale: 2,
+        Operation: pvoc.TimeStretch,
+        InputPath: "../fixtures/out.aif",
+        OutputPath: "../fixtures/",
+        WindowName: "hamming",
+        PhaseReconstruction: pvoc.PhasePGHI,
+      },
+      hasError: false,
+    },
+    "directory only, base path exists, pitch with identity phase locking": {
+      outputPath: "../fixtures/tmp",
+      expected: fmt.Sprintf("%s/%s", fixturesPath, "tmp/out-ps05-lidentity.aif"),
+      parsedArgs: &Arguments{
+        Bands: 4096,
+        Overlap: 1,
+        Scale: 0.5,
+        Operation: pvoc.PitchShift,
+        InputPath: "../fixtures/out.aif",
+        OutputPath: "../fixtures/",
+        WindowName: "hamming",
+        PhaseLockMode: pvoc.PhaseLockIdentity,
+      },
+      hasError: false,
+    },
+    "directory only, base path exists, spectral shuffle": {
+      outputPath: "../fixtures/tmp",
+      expected: fmt.Sprintf("%s/%s", fixturesPath, "tmp/out-ts1-shuffle7.aif"),
+      parsedArgs: &Arguments{
+        Bands: 4096,
+        Overlap: 1,
+        Scale: 1,
+        Operation: pvoc.TimeStretch,
+        InputPath: "../fixtures/out.aif",
+        OutputPath: "../fixtures/",
+        WindowName: "hamming",
+        SpectralOperation: pvoc.SpectralShuffle,
+        SpectralSeed: 7,
+      },
+      hasError: false,
+    },
+    "directory only, base path exists, mp3 input is written as flac": {
+      outputPath: "../fixtures/tmp",
+      expected: fmt.Sprintf("%s/%s", fixturesPath, "tmp/speech-ts2.flac"),
+      parsedArgs: &Arguments{
+        Bands: 4096,
+        Overlap: 1,
+        Scale: 2,
+        Operation: pvoc.TimeStretch,
+        InputPath: "../fixtures/speech.MP3",
+        OutputPath: "../fixtures/",
+        WindowName: "hamming",
+      },
+      hasError: false,
+    },
+    "directory only, base path exists, -of names the output": {
+      outputPath: "../fixtures/tmp",
+      expected: fmt.Sprintf("%s/%s", fixturesPath, "tmp/sine_1_chan-ts2.caf"),
+      parsedArgs: &Arguments{
+        Bands: 4096,
+        Overlap: 1,
+        Scale: 2,
+        Operation: pvoc.TimeStretch,
+        InputPath: "../fixtures/sine_1_chan.aif",
+        OutputPath: "../fixtures/",
+        OutputType: audioio.TYPE_CAF,
+        WindowName: "hamming",
+      },
+      hasError: false,
+    },
   }
 
   for name, test := range tests {
@@ -107,3 +200,95 @@ func TestParseOutputFilePath(t *testing.T) {
     })
   }
 }
+
+func TestParsePhaseLock(t *testing.T) {
+  mode, err := parsePhaseLock(false, "")
+  Ok(t, err)
+  Equals(t, pvoc.PhaseLockNone, mode)
+
+  mode, err = parsePhaseLock(true, "")
+  Ok(t, err)
+  Equals(t, pvoc.PhaseLockNeighbor, mode)
+
+  mode, err = parsePhaseLock(false, "scaled")
+  Ok(t, err)
+  Equals(t, pvoc.PhaseLockScaled, mode)
+
+  _, err = parsePhaseLock(true, "identity")
+  Assert(t, err != nil, "-p with -lock identity should error")
+
+  _, err = parsePhaseLock(false, "sideways")
+  Assert(t, err != nil, "unknown lock mode should error")
+}
+
+func TestOutputType(t *testing.T) {
+  outputType, err := parseOutputType("")
+  Ok(t, err)
+  Equals(t, 0, outputType)
+
+  outputType, err = parseOutputType("WAV")
+  Ok(t, err)
+  Equals(t, audioio.TYPE_WAVE, outputType)
+
+  _, err = parseOutputType("mp3")
+  Assert(t, err != nil, "mp3 output should error")
+
+  // without -of every output needs a known extension
+  parsedArgs := &Arguments{OutputPath: "out.wav", HarmonicPath: "harmonic.xyz"}
+  Assert(t, checkOutputTypes(parsedArgs) != nil, "unknown extension should error")
+
+  parsedArgs.OutputType = audioio.TYPE_FLAC
+  Ok(t, checkOutputTypes(parsedArgs))
+
+  // an input with an extension gopvoc doesn't write is named after its
+  // contents
+  wave, err := os.ReadFile("../fixtures/sine_1_chan.wav")
+  Ok(t, err)
+  inputPath := filepath.Join(t.TempDir(), "sine.bin")
+  Ok(t, os.WriteFile(inputPath, wave, 0644))
+
+  parsedArgs = &Arguments{InputPath: inputPath}
+  Equals(t, ".wav", autoOutputExtension("sine.bin", parsedArgs))
+  Equals(t, ".aiff", autoOutputExtension("sine.aiff", parsedArgs))
+
+  // -split-out names the outputs like the -split input
+  parsedArgs = &Arguments{InputFormat: audioio.InputFormat{SplitNames: []string{"L", "R"}}, SplitOutput: true}
+  Equals(t, audioio.OutputFormat{Split: true, SplitNames: []string{"L", "R"}}, parsedArgs.OutputFormat())
+}
+
+func TestParseRange(t *testing.T) {
+  parsedArgs := &Arguments{}
+  Ok(t, parseRange(parsedArgs, "1.5", "00:03", true, 20))
+  Equals(t, audioio.Position{Seconds: 1.5}, *parsedArgs.RangeStart)
+  Equals(t, audioio.Position{Seconds: 3}, *parsedArgs.RangeEnd)
+  Equals(t, true, parsedArgs.Splice)
+  Equals(t, 0.02, parsedArgs.Crossfade)
+
+  parsedArgs = &Arguments{}
+  Ok(t, parseRange(parsedArgs, "", "", false, 10))
+  Assert(t, parsedArgs.RangeStart == nil && parsedArgs.RangeEnd == nil, "no range should be set")
+
+  Assert(t, parseRange(&Arguments{}, "3", "1.5", false, 10) != nil, "start after end should error")
+  Assert(t, parseRange(&Arguments{}, "200smp", "100smp", false, 10) != nil, "start after end should error")
+  Assert(t, parseRange(&Arguments{}, "", "", true, 10) != nil, "-splice without a region should error")
+  Assert(t, parseRange(&Arguments{HarmonicOnly: true}, "1", "", false, 10) != nil, "-harmonic-only with a region should error")
+}
+
+func TestParseChannelRouting(t *testing.T) {
+  parsedArgs := &Arguments{Operation: pvoc.PitchShift, Scale: 2}
+  Ok(t, parseChannelRouting(parsedArgs, "1,3-4", "mono", false, true))
+  Equals(t, []int{0, 2, 3}, parsedArgs.Channels)
+  Equals(t, "mono", parsedArgs.Mix.Name)
+  Equals(t, true, parsedArgs.PassUnprocessed)
+
+  parsedArgs = &Arguments{Operation: pvoc.TimeStretch, Scale: 2}
+  Ok(t, parseChannelRouting(parsedArgs, "", "", true, false))
+  Assert(t, parsedArgs.Channels == nil && parsedArgs.Mix == nil, "no channels or mix should be set")
+  Equals(t, true, parsedArgs.MidSide)
+
+  Assert(t, parseChannelRouting(&Arguments{}, "1-", "", false, false) != nil, "an open range should error")
+  Assert(t, parseChannelRouting(&Arguments{}, "", "1,x", false, false) != nil, "a gain that isn't a number should error")
+  Assert(t, parseChannelRouting(&Arguments{}, "", "", false, true) != nil, "-pass without -ch should error")
+  Assert(t, parseChannelRouting(&Arguments{Operation: pvoc.TimeStretch, Scale: 2}, "1", "", false, true) != nil, "-pass with a stretch should error")
+  Assert(t, parseChannelRouting(&Arguments{HarmonicOnly: true}, "", "", true, false) != nil, "-harmonic-only with -ms should error")
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+  "fmt"
+  "os"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// a time stretch or pitch shift applied to a component
+type processingStep struct {
+  operation int
+  scale float64
+}
+
+// splits the input into its sinusoidal and residual components, time
+// stretches and/or pitch shifts each of them and optionally mixes them back
+// together
+func runDecompose(parsedArgs *cli.Arguments) error {
+  input, inputFile, err := audioio.ReadSignals(parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err != nil {
+    return fmt.Errorf("Could not read input file: %s", err)
+  }
+
+  audioReader, err := audioio.NewAudioReader(parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err != nil {
+    return err
+  }
+
+  tracker, err := pvoc.NewPartialTracker(
+    parsedArgs.PartialThreshold,
+    parsedArgs.PartialDeviation,
+    parsedArgs.PartialMinLength,
+    parsedArgs.PartialMaxPeaks,
+  )
+
+  if err != nil {
+    return err
+  }
+
+  // the same hop as partial tracking
+  decimation := int(float64(parsedArgs.Bands) * parsedArgs.Overlap / 4.0)
+
+  if decimation < 1 {
+    decimation = 1
+  }
+
+  if err = audioReader.Open(decimation); err != nil {
+    return fmt.Errorf("Could not open input file: %s", parsedArgs.InputPath)
+  }
+
+  defer audioReader.Close()
+
+  spectrogram, err := pvoc.Analyze(
+    audioReader,
+    parsedArgs.Bands,
+    parsedArgs.Overlap,
+    parsedArgs.WindowName,
+    decimation,
+    nil,
+  )
+
+  if err != nil {
+    return err
+  }
+
+  partials := tracker.Track(spectrogram)
+
+  deterministic, residual, err := pvoc.Decompose(spectrogram, partials, input)
+
+  if err != nil {
+    return err
+  }
+
+  if !parsedArgs.Quiet {
+    fmt.Printf("%24s   %d\n", "Partials:", len(partials))
+  }
+
+  tempDir, err := os.MkdirTemp("", "gopvoc-decompose")
+
+  if err != nil {
+    return err
+  }
+
+  defer os.RemoveAll(tempDir)
+
+  components := []struct {
+    name string
+    signals [][]float64
+    outputPath string
+    timeScale float64
+    pitchScale float64
+  }{
+    {"deterministic", deterministic, parsedArgs.DeterministicPath, parsedArgs.DeterministicScale, parsedArgs.DeterministicPitch},
+    {"residual", residual, parsedArgs.ResidualPath, parsedArgs.ResidualScale, parsedArgs.ResidualPitch},
+  }
+
+  mixPaths := []string{}
+
+  for _, component := range components {
+    outputPath := component.outputPath
+
+    if len(outputPath) == 0 {
+      if len(parsedArgs.MixPath) == 0 {
+        continue
+      }
+
+      outputPath = filepath.Join(tempDir, component.name + ".aif")
+    }
+
+    // each processing step reads the file the previous one wrote
+    steps := []processingStep{}
+
+    if component.timeScale != 1.0 {
+      steps = append(steps, processingStep{pvoc.TimeStretch, component.timeScale})
+    }
+
+    if component.pitchScale != 1.0 {
+      steps = append(steps, processingStep{pvoc.PitchShift, component.pitchScale})
+    }
+
+    stepPath := outputPath
+    if len(steps) > 0 {
+      stepPath = filepath.Join(tempDir, component.name + "-0.aif")
+    }
+
+    // only the component's output file is written as -of says
+    stepFormat := audioio.OutputFormat{}
+    if stepPath == component.outputPath {
+      stepFormat = parsedArgs.OutputFormat()
+    }
+
+    componentFile := inputFile
+    componentFile.Filepath = stepPath
+
+    if err = audioio.WriteSignals(componentFile, stepFormat, component.signals); err != nil {
+      return fmt.Errorf("Could not write %s file: %s", component.name, err)
+    }
+
+    for i, step := range steps {
+      nextPath := outputPath
+      if i < len(steps) - 1 {
+        nextPath = filepath.Join(tempDir, fmt.Sprintf("%s-%d.aif", component.name, i + 1))
+      }
+
+      nextFormat := audioio.OutputFormat{}
+      if nextPath == component.outputPath {
+        nextFormat = parsedArgs.OutputFormat()
+      }
+
+      if err = processFile(parsedArgs, stepPath, nextPath, nextFormat, step.operation, step.scale); err != nil {
+        return fmt.Errorf("Could not process %s: %s", component.name, err)
+      }
+
+      stepPath = nextPath
+    }
+
+    mixPaths = append(mixPaths, outputPath)
+
+    if !parsedArgs.Quiet && len(component.outputPath) > 0 {
+      fmt.Printf("%24s   %s\n", "Output File:", filepath.Base(component.outputPath))
+    }
+  }
+
+  if len(parsedArgs.MixPath) == 0 {
+    return nil
+  }
+
+  // the components can have different lengths after time stretching
+  mix := make([][]float64, inputFile.NumChans, inputFile.NumChans)
+
+  for _, mixPath := range mixPaths {
+    signals, _, err := audioio.ReadSignals(mixPath, audioio.InputFormat{})
+
+    if err != nil {
+      return fmt.Errorf("Could not read component file: %s", err)
+    }
+
+    for c := range mix {
+      for len(mix[c]) < len(signals[c]) {
+        mix[c] = append(mix[c], 0.0)
+      }
+
+      for i, sample := range signals[c] {
+        mix[c][i] += sample
+      }
+    }
+  }
+
+  for c := range mix {
+    for len(mix[c]) < len(mix[0]) {
+      mix[c] = append(mix[c], 0.0)
+    }
+  }
+
+  mixFile := inputFile
+  mixFile.Filepath = parsedArgs.MixPath
+
+  if err = audioio.WriteSignals(mixFile, parsedArgs.OutputFormat(), mix); err != nil {
+    return fmt.Errorf("Could not write remix file: %s", err)
+  }
+
+  if !parsedArgs.Quiet {
+    fmt.Printf("%24s   %s\n", "Remix File:", filepath.Base(parsedArgs.MixPath))
+  }
+
+  return nil
+}
+
+// time stretches or pitch shifts a whole file with the analysis settings of
+// parsedArgs, without reporting progress
+func processFile(parsedArgs *cli.Arguments, inputPath, outputPath string, outputFormat audioio.OutputFormat, operation int, scale float64) error {
+  audioReader, err := audioio.NewAudioReader(inputPath, audioio.InputFormat{})
+
+  if err != nil {
+    return err
+  }
+
+  processor, err := pvoc.NewPvoc(
+    parsedArgs.Bands,
+    parsedArgs.Overlap,
+    scale,
+    operation,
+    parsedArgs.PhaseLockMode,
+    parsedArgs.WindowName,
+    0.0,
+    0.0,
+  )
+
+  if err != nil {
+    return err
+  }
+
+  if err = audioReader.Open(processor.Decimation); err != nil {
+    return err
+  }
+
+  defer audioReader.Close()
+
+  audioWriter, err := audioio.NewAudioWriter(audioio.AudioFile{
+    Filepath: outputPath,
+    NumChans: audioReader.GetNumChans(),
+    SampleRate: audioReader.GetSampleRate(),
+    BitDepth: audioReader.GetBitDepth(),
+  }, outputFormat)
+
+  if err != nil {
+    return err
+  }
+
+  if err = audioWriter.Create(processor.Interpolation); err != nil {
+    return err
+  }
+
+  defer audioWriter.Close()
+
+  progress := make(chan int)
+  errors := make(chan error)
+  done := make(chan bool)
+
+  go processor.Run(audioReader, audioWriter, progress, errors, done)
+
+  for {
+    select {
+    case err := <- errors:
+      return err
+    case <- progress:
+    case <- done:
+      return nil
+    }
+  }
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "os"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// onset sensitivity for placing the percussive layer when -transients isn't
+// given
+const percussiveOnsetSensitivity = 0.5
+
+// percussive segments start this long (in seconds) before their onset, and
+// fade in and out over percussiveFade seconds
+const percussivePreRoll = 0.01
+const percussiveFade = 0.005
+
+// the harmonic and percussive layers of a file
+type hpssLayers struct {
+  inputFile audioio.AudioFile
+  harmonic [][]float64
+  percussive [][]float64
+  onsets []int // of the percussive layer, in samples
+}
+
+// analyzes the input file and separates it with the hpss settings of
+// parsedArgs
+func separateLayers(parsedArgs *cli.Arguments, onsetSensitivity float64) (*hpssLayers, error) {
+  separator, err := pvoc.NewHarmonicPercussive(
+    parsedArgs.HarmonicFrames,
+    parsedArgs.PercussiveBands,
+    parsedArgs.HPSSMask,
+    parsedArgs.HPSSPower,
+  )
+
+  if err != nil {
+    return nil, err
+  }
+
+  audioReader, err := audioio.NewAudioReader(parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err != nil {
+    return nil, err
+  }
+
+  // the same hop as partial tracking
+  decimation := int(float64(parsedArgs.Bands) * parsedArgs.Overlap / 4.0)
+
+  if decimation < 1 {
+    decimation = 1
+  }
+
+  if err = audioReader.Open(decimation); err != nil {
+    return nil, fmt.Errorf("Could not open input file: %s", parsedArgs.InputPath)
+  }
+
+  defer audioReader.Close()
+
+  spectrogram, err := pvoc.Analyze(
+    audioReader,
+    parsedArgs.Bands,
+    parsedArgs.Overlap,
+    parsedArgs.WindowName,
+    decimation,
+    nil,
+  )
+
+  if err != nil {
+    return nil, err
+  }
+
+  harmonicFrames, percussiveFrames := separator.Separate(spectrogram)
+
+  layers := &hpssLayers{
+    inputFile: audioio.AudioFile{
+      Filepath: parsedArgs.InputPath,
+      NumChans: spectrogram.NumChans,
+      SampleRate: spectrogram.SampleRate,
+      BitDepth: spectrogram.BitDepth,
+    },
+    harmonic: spectrogram.Synthesize(harmonicFrames),
+    percussive: spectrogram.Synthesize(percussiveFrames),
+  }
+
+  if onsetSensitivity == 0 {
+    return layers, nil
+  }
+
+  detector, err := pvoc.NewOnsetDetector(
+    onsetSensitivity,
+    spectrogram.NumChans,
+    spectrogram.Points,
+    float64(spectrogram.SampleRate) / float64(decimation),
+    spectrogram.MaxSampleValue(),
+  )
+
+  if err != nil {
+    return nil, err
+  }
+
+  polarSpectra := make([][]float64, spectrogram.NumChans, spectrogram.NumChans)
+
+  for f := 0; f < spectrogram.NumFrames(); f++ {
+    for c := range polarSpectra {
+      polarSpectra[c] = percussiveFrames[c][f]
+    }
+
+    detector.Detect(polarSpectra, spectrogram.FrameTime(f))
+  }
+
+  // the detector only knows which frame an onset is in, move each onset to
+  // the loudest sample of the percussive layer within half a window
+  radius := spectrogram.WindowSize / 2
+
+  for _, onset := range detector.Onsets {
+    center := int(math.Round(onset * float64(spectrogram.SampleRate)))
+    peak := center
+    peakAmplitude := -1.0
+
+    for n := center - radius; n <= center + radius; n++ {
+      if n < 0 || n >= spectrogram.NumSampleFrames {
+        continue
+      }
+
+      amplitude := 0.0
+      for c := range layers.percussive {
+        amplitude += math.Abs(layers.percussive[c][n])
+      }
+
+      if amplitude > peakAmplitude {
+        peak = n
+        peakAmplitude = amplitude
+      }
+    }
+
+    layers.onsets = append(layers.onsets, peak)
+  }
+
+  return layers, nil
+}
+
+// writes the harmonic and/or percussive layers of the input
+func runHPSS(parsedArgs *cli.Arguments) error {
+  layers, err := separateLayers(parsedArgs, 0)
+
+  if err != nil {
+    return err
+  }
+
+  outputs := []struct {
+    path string
+    signals [][]float64
+  }{
+    {parsedArgs.HarmonicPath, layers.harmonic},
+    {parsedArgs.PercussivePath, layers.percussive},
+  }
+
+  for _, output := range outputs {
+    if len(output.path) == 0 {
+      continue
+    }
+
+    audioFile := layers.inputFile
+    audioFile.Filepath = output.path
+
+    if err = audioio.WriteSignals(audioFile, parsedArgs.OutputFormat(), output.signals); err != nil {
+      return fmt.Errorf("Could not write output audio file: %s", err)
+    }
+
+    if !parsedArgs.Quiet {
+      fmt.Printf("%24s   %s\n", "Output File:", filepath.Base(output.path))
+    }
+  }
+
+  return nil
+}
+
+// writes the harmonic layer of the input to a file in tempDir, for time
+// stretching it on its own
+func (layers *hpssLayers) writeHarmonic(tempDir string) (string, error) {
+  audioFile := layers.inputFile
+  audioFile.Filepath = filepath.Join(tempDir, "harmonic.aif")
+
+  return audioFile.Filepath, audioio.WriteSignals(audioFile, audioio.OutputFormat{}, layers.harmonic)
+}
+
+// adds the percussive layer, unstretched but moved to the stretched onset
+// times, to the stretched harmonic layer and writes the result to outputPath
+func (layers *hpssLayers) addPercussive(stretchedPath, outputPath string, outputFormat audioio.OutputFormat, scale float64) error {
+  stretched, _, err := audioio.ReadSignals(stretchedPath, audioio.InputFormat{})
+
+  if err != nil {
+    return err
+  }
+
+  sampleRate := float64(layers.inputFile.SampleRate)
+  for c := range stretched {
+    percussive := pvoc.RealignSegments(
+      layers.percussive[c],
+      layers.onsets,
+      scale,
+      int(percussivePreRoll * sampleRate),
+      int(percussiveFade * sampleRate),
+    )
+
+    for len(stretched[c]) < len(percussive) {
+      stretched[c] = append(stretched[c], 0.0)
+    }
+
+    for i, sample := range percussive {
+      stretched[c][i] += sample
+    }
+  }
+
+  for c := range stretched {
+    for len(stretched[c]) < len(stretched[0]) {
+      stretched[c] = append(stretched[c], 0.0)
+    }
+  }
+
+  audioFile := layers.inputFile
+  audioFile.Filepath = outputPath
+
+  return audioio.WriteSignals(audioFile, outputFormat, stretched)
+}
+
+// separates the input for time -harmonic-only, returning the path of the
+// harmonic layer to stretch and a temporary directory to remove afterwards
+func prepareHarmonicOnly(parsedArgs *cli.Arguments) (*hpssLayers, string, string, error) {
+  sensitivity := parsedArgs.TransientSensitivity
+
+  if sensitivity == 0 {
+    sensitivity = percussiveOnsetSensitivity
+  }
+
+  layers, err := separateLayers(parsedArgs, sensitivity)
+
+  if err != nil {
+    return nil, "", "", err
+  }
+
+  tempDir, err := os.MkdirTemp("", "gopvoc-hpss")
+
+  if err != nil {
+    return nil, "", "", err
+  }
+
+  harmonicPath, err := layers.writeHarmonic(tempDir)
+
+  if err != nil {
+    os.RemoveAll(tempDir)
+    return nil, "", "", err
+  }
+
+  return layers, harmonicPath, tempDir, nil
+}
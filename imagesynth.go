@@ -0,0 +1,78 @@
+package main
+
+import (
+  "fmt"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// turns the image into sound, reading it as a spectrogram
+func runImageSynth(parsedArgs *cli.Arguments) error {
+  if audioio.IntMaxSignedValue[parsedArgs.BitDepth] == 0 {
+    return fmt.Errorf("Bit depth must be 8, 16, 24 or 32, got %d", parsedArgs.BitDepth)
+  }
+
+  // the same hop as partial tracking
+  decimation := int(float64(parsedArgs.Bands) * parsedArgs.Overlap / 4.0)
+
+  if decimation < 1 {
+    decimation = 1
+  }
+
+  imageSynth, err := pvoc.NewImageSynth(
+    parsedArgs.ImageDuration,
+    parsedArgs.ImageScale,
+    parsedArgs.ImageMinFrequency,
+    parsedArgs.ImageMaxFrequency,
+    parsedArgs.ImageRange,
+    parsedArgs.ImagePeak,
+    parsedArgs.Bands,
+    parsedArgs.Overlap,
+    parsedArgs.WindowName,
+    decimation,
+    parsedArgs.SampleRate,
+    parsedArgs.BitDepth,
+  )
+
+  if err != nil {
+    return err
+  }
+
+  imageSynth.GriffinLimIterations = parsedArgs.Iterations
+
+  img, err := pvoc.ReadImage(parsedArgs.ImagePath)
+
+  if err != nil {
+    return fmt.Errorf("Could not read image: %s", err)
+  }
+
+  signal, err := imageSynth.Synthesize(img)
+
+  if err != nil {
+    return err
+  }
+
+  audioFile := audioio.AudioFile{
+    Filepath: parsedArgs.OutputPath,
+    NumChans: 1,
+    SampleRate: parsedArgs.SampleRate,
+    BitDepth: parsedArgs.BitDepth,
+  }
+
+  if err = audioio.WriteSignals(audioFile, parsedArgs.OutputFormat(), [][]float64{signal}); err != nil {
+    return fmt.Errorf("Could not write output audio file: %s", err)
+  }
+
+  if !parsedArgs.Quiet {
+    bounds := img.Bounds()
+
+    fmt.Printf("%24s   %d x %d\n", "Image Size:", bounds.Dx(), bounds.Dy())
+    fmt.Printf("%24s   %.2f to %.2f Hz (%s)\n", "Frequency Range:", imageSynth.MinFrequency, imageSynth.MaxFrequency, imageSynth.Scale)
+    fmt.Printf("%24s   %.2f s\n", "Output Duration:", float64(len(signal)) / float64(parsedArgs.SampleRate))
+    fmt.Printf("%24s   %s\n", "Output File:", filepath.Base(parsedArgs.OutputPath))
+  }
+
+  return nil
+}
@@ -5,6 +5,7 @@ import (
   "os"
   "path/filepath"
   "gopvoc/audioio"
+  "gopvoc/charter"
   "gopvoc/pvoc"
   "gopvoc/cli"
   "github.com/schollz/progressbar/v3"
@@ -12,6 +13,11 @@ import (
 
 var Version = ""
 
+// past these the FFT bands are too far apart to keep the harmonics of low
+// notes apart, or the window too long to keep transients sharp
+const maxBandWidth = 20.0
+const maxWindowDuration = 0.5
+
 func main() {
   // parse cli flags/arguments
   parsedArgs, err := cli.ParseFlags(os.Args, Version)
@@ -21,14 +27,110 @@ func main() {
     os.Exit(1)
   }
 
-  // check if input file exists
-  if _, err := os.Stat(parsedArgs.InputPath); err != nil {
-    fmt.Fprintln(os.Stderr, "File does not exist:", parsedArgs.InputPath)
-    os.Exit(1)
+  if parsedArgs.Command == cli.CommandPartials {
+    if err = runPartials(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  if parsedArgs.Command == cli.CommandDecompose {
+    if err = runDecompose(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  if parsedArgs.Command == cli.CommandHPSS {
+    if err = runHPSS(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  if parsedArgs.Command == cli.CommandBlur {
+    if err = runBlur(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  if parsedArgs.Command == cli.CommandMorph {
+    if err = runMorph(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  if parsedArgs.Command == cli.CommandSpectrogram {
+    if err = runSpectrogram(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  if parsedArgs.Command == cli.CommandImageSynth {
+    if err = runImageSynth(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  if parsedArgs.Command == cli.CommandPitchTrack {
+    if err = runPitchTrack(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    return
+  }
+
+  // check if input file exists, or each of its split files
+  for _, path := range audioio.InputPaths(parsedArgs.InputPath, parsedArgs.InputFormat) {
+    if _, err := os.Stat(path); err != nil {
+      fmt.Fprintln(os.Stderr, "File does not exist:", path)
+      os.Exit(1)
+    }
+  }
+
+  // with -harmonic-only, the harmonic layer is stretched into a temporary
+  // file and the percussive layer is added to it afterwards
+  inputPath := parsedArgs.InputPath
+  inputFormat := parsedArgs.InputFormat
+  outputPath := parsedArgs.OutputPath
+
+  var layers *hpssLayers
+
+  if parsedArgs.HarmonicOnly {
+    var tempDir string
+    layers, inputPath, tempDir, err = prepareHarmonicOnly(parsedArgs)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Could not separate harmonic and percussive layers:", err)
+      os.Exit(1)
+    }
+
+    defer os.RemoveAll(tempDir)
+    inputFormat = audioio.InputFormat{}
+    outputPath = filepath.Join(tempDir, "stretched.aif")
   }
 
   // setup the audioReader
-  audioReader, err := audioio.NewAudioReader(parsedArgs.InputPath)
+  audioReader, err := audioio.NewAudioReader(inputPath, inputFormat)
 
   if err != nil {
     fmt.Fprintln(os.Stderr, err)
@@ -41,7 +143,7 @@ func main() {
     parsedArgs.Overlap,
     parsedArgs.Scale,
     parsedArgs.Operation,
-    parsedArgs.PhaseLock,
+    parsedArgs.PhaseLockMode,
     parsedArgs.WindowName,
     parsedArgs.GatingAmplitude,
     parsedArgs.GatingThreshold,
@@ -52,49 +154,228 @@ func main() {
     os.Exit(1)
   }
 
+  if parsedArgs.Operation == pvoc.TimeStretch {
+    if err = processor.SetPhaseReconstruction(parsedArgs.PhaseReconstruction); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    if err = processor.SetGriffinLimIterations(parsedArgs.Iterations); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    if parsedArgs.LinkChannels {
+      if err = processor.SetChannelLink(parsedArgs.LinkReference); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+        os.Exit(1)
+      }
+    }
+  }
+
+  if err = processor.SetTransients(parsedArgs.TransientSensitivity, parsedArgs.TransientKeep); err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+
+  if len(parsedArgs.ScaleCurvePath) > 0 {
+    curve, err := pvoc.ReadEnvelope(parsedArgs.ScaleCurvePath)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Could not read scale curve:", err)
+      os.Exit(1)
+    }
+
+    if err = processor.SetScaleCurve(curve); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+  }
+
+  if len(parsedArgs.SpectralOperation) > 0 {
+    spectralOperation, err := pvoc.NewSpectralOperation(
+      parsedArgs.SpectralOperation,
+      parsedArgs.SpectralLow,
+      parsedArgs.SpectralHigh,
+      parsedArgs.SpectralPivot,
+      parsedArgs.SpectralTo,
+      parsedArgs.SpectralSeed,
+      parsedArgs.SpectralWidth,
+    )
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    processor.SetSpectralOperation(spectralOperation)
+  }
+
+  if len(parsedArgs.DebugDir) > 0 {
+    chartWriter, err := charter.NewCharter(parsedArgs.DebugDir)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Could not create debug directory:", err)
+      os.Exit(1)
+    }
+
+    processor.SetCharter(chartWriter)
+  }
+
   if err = audioReader.Open(processor.Decimation); err != nil {
-    fmt.Fprintln(os.Stderr, "Could not open input file:", parsedArgs.InputPath)
+    fmt.Fprintf(os.Stderr, "Could not open input file %s: %v\n", parsedArgs.InputPath, err)
     os.Exit(1)
   }
 
   defer audioReader.Close()
+  numChans := audioReader.GetNumChans()
+
+  // -ch, -mix and -ms process the routed input channels into a temporary
+  // file, that the output channels are made of afterwards
+  var routedChannels *channels
+
+  if parsedArgs.Channels != nil || parsedArgs.Mix != nil || parsedArgs.MidSide {
+    routedChannels, err = prepareChannels(parsedArgs, audioReader, processor.Latency())
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    defer os.RemoveAll(routedChannels.tempDir)
+    outputPath = routedChannels.processedPath
+  }
+
+  // -start and -end process a region of the input, into a temporary file
+  // that the region is cut from afterwards
+  var inputRegion *region
+
+  if parsedArgs.RangeStart != nil || parsedArgs.RangeEnd != nil {
+    scale := 1.0
+    if processor.Operation == pvoc.TimeStretch {
+      scale = processor.ScaleFactor
+    }
+
+    inputRegion, err = prepareRegion(parsedArgs, audioReader, processor.WindowSize, processor.Latency(), scale)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    // a spliced region goes into the routed input channels
+    if routedChannels != nil {
+      inputRegion.encode = routedChannels.Encode
+      routedChannels.setRegion(inputRegion)
+    }
+
+    defer os.RemoveAll(inputRegion.tempDir)
+    outputPath = filepath.Join(inputRegion.tempDir, "region.wav")
+  }
+
+  // pitch correction needs the sample rate of the input
+  if len(parsedArgs.TuneScale) > 0 {
+    detector, err := pvoc.NewPitchDetector(
+      parsedArgs.PitchMin,
+      parsedArgs.PitchMax,
+      parsedArgs.PitchConfidence,
+      processor.Points,
+      processor.WindowSize,
+      audioReader.GetSampleRate(),
+      processor.Decimation,
+    )
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    autotune, err := pvoc.NewAutotune(
+      parsedArgs.TuneScale,
+      parsedArgs.TuneKey,
+      parsedArgs.TuneReference,
+      parsedArgs.TuneRetune,
+      detector,
+    )
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    if err = processor.SetAutotune(autotune); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+  }
+
+  bandWidth := float64(audioReader.GetSampleRate()) / float64(processor.Bands) / 2.0
+  windowDuration := float64(processor.WindowSize) / float64(audioReader.GetSampleRate())
 
   if !parsedArgs.Quiet {
+    if bandWidth > maxBandWidth {
+      fmt.Fprintf(os.Stderr, "Warning: FFT bands are %.2f Hz apart at a sample rate of %d Hz, more bands (-b) resolve low notes better\n", bandWidth, audioReader.GetSampleRate())
+    }
+
+    if windowDuration > maxWindowDuration {
+      fmt.Fprintf(os.Stderr, "Warning: the FFT window is %.2f s long at a sample rate of %d Hz, fewer bands (-b) keep transients sharper\n", windowDuration, audioReader.GetSampleRate())
+    }
+
     fmt.Print(processor.String())
 
-    fmt.Printf("%24s   %d\n", "Number of Channels:", audioReader.GetNumChans())
+    fmt.Printf("%24s   %d\n", "Number of Channels:", numChans)
+    if routedChannels != nil {
+      fmt.Printf("%24s   %d\n", "Processed Channels:", audioReader.GetNumChans())
+      fmt.Printf("%24s   %d\n", "Output Channels:", len(routedChannels.Decode))
+    }
     fmt.Printf("%24s   %d\n", "Bit Depth:", audioReader.GetBitDepth())
     fmt.Printf("%24s   %d\n", "Sample Rate:", audioReader.GetSampleRate())
-    fmt.Printf("%24s   %.2f\n", "Hz/FFT Band:", float64(audioReader.GetSampleRate()) / float64(processor.Bands) / 2.0)
-    fmt.Printf("%24s   %.2f s\n", "Input Duration:", audioReader.GetDuration())
+    fmt.Printf("%24s   %.2f\n", "Hz/FFT Band:", bandWidth)
+    if inputRegion != nil {
+      inputDuration, outputDuration := inputRegion.durations(audioReader.GetSampleRate())
+      fmt.Printf("%24s   %.2f s from %.2f s\n", "Input Region:", inputDuration, float64(inputRegion.start) / float64(audioReader.GetSampleRate()))
 
-    if processor.Operation == pvoc.TimeStretch {
-      fmt.Printf("%24s   %.2f s\n", "Output Duration:", audioReader.GetDuration() * processor.ScaleFactor)
+      if processor.Operation == pvoc.TimeStretch {
+        fmt.Printf("%24s   %.2f s\n", "Output Duration:", outputDuration)
+      }
+    } else {
+      fmt.Printf("%24s   %.2f s\n", "Input Duration:", audioReader.GetDuration())
+
+      if processor.Operation == pvoc.TimeStretch {
+        fmt.Printf("%24s   %.2f s\n", "Output Duration:", audioReader.GetDuration() * processor.ScaleFactor)
+      }
     }
     fmt.Printf("%24s   %s\n", "Output File:", filepath.Base(parsedArgs.OutputPath))
   }
 
   audioFile := audioio.AudioFile{
-    Filepath: parsedArgs.OutputPath,
+    Filepath: outputPath,
     NumChans: audioReader.GetNumChans(),
     SampleRate: audioReader.GetSampleRate(),
     BitDepth: audioReader.GetBitDepth(),
   }
 
-  audioWriter, err := audioio.NewAudioWriter(audioFile)
+  // the output is only written as -of says when it isn't a temporary file
+  outputFormat := audioio.OutputFormat{}
+  if outputPath == parsedArgs.OutputPath {
+    outputFormat = parsedArgs.OutputFormat()
+  }
+
+  audioWriter, err := audioio.NewAudioWriter(audioFile, outputFormat)
 
   if err != nil {
     fmt.Fprintln(os.Stderr, "Could not create output audio file:", err)
     os.Exit(1)
   }
 
+  // keep the input's metadata tags, for formats that have them
+  audioWriter.SetTags(audioReader.GetTags())
+
   if err = audioWriter.Create(processor.Interpolation); err != nil {
-    fmt.Fprintln(os.Stderr, "Could not open audio file for writing:", parsedArgs.OutputPath)
+    fmt.Fprintf(os.Stderr, "Could not open audio file for writing %s: %v\n", outputPath, err)
     os.Exit(1)
   }
 
-  defer audioWriter.Close()
-
   // progress will be a number 0-100
   progress := make(chan int)
   errors := make(chan error)
@@ -127,7 +408,7 @@ func main() {
   for wait {
     select {
     case err := <- errors:
-      fmt.Fprintln(os.Stderr, "\n >>> Processing error:", err, " <<<\n")
+      fmt.Fprint(os.Stderr, "\n >>> Processing error: ", err, " <<<\n\n")
       os.Exit(1)
     case curProgress := <-progress:
       if !parsedArgs.Quiet {
@@ -140,4 +421,111 @@ func main() {
       wait = false
     }
   }
+
+  // the output file is complete, with -harmonic-only the percussive layer
+  // is added to it
+  audioWriter.Close()
+
+  if inputRegion != nil {
+    regionPath := parsedArgs.OutputPath
+    regionFormat := parsedArgs.OutputFormat()
+    if routedChannels != nil {
+      regionPath = routedChannels.processedPath
+      regionFormat = audioio.OutputFormat{}
+    }
+
+    if err = inputRegion.finish(outputPath, regionPath, regionFormat); err != nil {
+      fmt.Fprintln(os.Stderr, "Could not write the processed region:", err)
+      os.Exit(1)
+    }
+  }
+
+  if routedChannels != nil {
+    if err = routedChannels.finish(parsedArgs.OutputPath, parsedArgs.OutputFormat()); err != nil {
+      fmt.Fprintln(os.Stderr, "Could not write the output channels:", err)
+      os.Exit(1)
+    }
+  }
+
+  if layers != nil {
+    if err = layers.addPercussive(outputPath, parsedArgs.OutputPath, parsedArgs.OutputFormat(), processor.ScaleFactor); err != nil {
+      fmt.Fprintln(os.Stderr, "Could not add the percussive layer:", err)
+      os.Exit(1)
+    }
+
+    if !parsedArgs.Quiet {
+      fmt.Printf("%d percussive onsets realigned\n", len(layers.onsets))
+    }
+  }
+
+  if len(parsedArgs.SpectrogramPath) > 0 {
+    // the output is read back as it was written, routed channels change
+    // how many there are
+    outputFile := audioFile
+    outputFile.Filepath = parsedArgs.OutputPath
+    if routedChannels != nil {
+      outputFile.NumChans = len(routedChannels.Decode)
+    }
+
+    parsedArgs.ComparePath = parsedArgs.OutputPath
+    parsedArgs.CompareFormat, err = parsedArgs.OutputFormat().InputFormat(outputFile)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Could not draw the spectrograms:", err)
+      os.Exit(1)
+    }
+
+    if err = runSpectrogram(parsedArgs); err != nil {
+      fmt.Fprintln(os.Stderr, "Could not draw the spectrograms:", err)
+      os.Exit(1)
+    }
+  }
+
+  if convergence := processor.GriffinLimConvergence(); len(convergence) > 0 && !parsedArgs.Quiet {
+    fmt.Printf("%24s   %.4f (first iteration %.4f)\n", "Spectral Convergence:", convergence[len(convergence) - 1], convergence[0])
+  }
+
+  if len(parsedArgs.DebugDir) > 0 && !parsedArgs.Quiet {
+    fmt.Printf("%24s   %s\n", "Debug Charts:", filepath.Join(parsedArgs.DebugDir, "index.html"))
+  }
+
+  if len(parsedArgs.OnsetsPath) > 0 {
+    onsetsFile, err := os.Create(parsedArgs.OnsetsPath)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Could not create onsets file:", err)
+      os.Exit(1)
+    }
+
+    defer onsetsFile.Close()
+
+    if err = processor.WriteOnsets(onsetsFile); err != nil {
+      fmt.Fprintln(os.Stderr, "Could not write onsets file:", err)
+      os.Exit(1)
+    }
+
+    if !parsedArgs.Quiet {
+      fmt.Printf("%d onsets written to %s\n", len(processor.Onsets()), filepath.Base(parsedArgs.OnsetsPath))
+    }
+  }
+
+  if len(parsedArgs.TuneCSVPath) > 0 {
+    csvFile, err := os.Create(parsedArgs.TuneCSVPath)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, "Could not create pitch correction file:", err)
+      os.Exit(1)
+    }
+
+    defer csvFile.Close()
+
+    if err = processor.Autotune().WriteCSV(csvFile); err != nil {
+      fmt.Fprintln(os.Stderr, "Could not write pitch correction file:", err)
+      os.Exit(1)
+    }
+
+    if !parsedArgs.Quiet {
+      fmt.Printf("%d frames of pitch correction written to %s\n", len(processor.Autotune().Frames), filepath.Base(parsedArgs.TuneCSVPath))
+    }
+  }
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+  "fmt"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// analyzes a whole file with the FFT settings of parsedArgs
+func analyzeFile(parsedArgs *cli.Arguments, inputPath string, inputFormat audioio.InputFormat) (*pvoc.Spectrogram, error) {
+  audioReader, err := audioio.NewAudioReader(inputPath, inputFormat)
+
+  if err != nil {
+    return nil, err
+  }
+
+  // the same hop as partial tracking
+  decimation := int(float64(parsedArgs.Bands) * parsedArgs.Overlap / 4.0)
+
+  if decimation < 1 {
+    decimation = 1
+  }
+
+  if err = audioReader.Open(decimation); err != nil {
+    return nil, fmt.Errorf("Could not open input file: %s", inputPath)
+  }
+
+  defer audioReader.Close()
+
+  return pvoc.Analyze(
+    audioReader,
+    parsedArgs.Bands,
+    parsedArgs.Overlap,
+    parsedArgs.WindowName,
+    decimation,
+    nil,
+  )
+}
+
+// morphs input A into input B following the morph curve
+func runMorph(parsedArgs *cli.Arguments) error {
+  curve := pvoc.ConstantEnvelope(parsedArgs.MorphAmount)
+
+  if len(parsedArgs.MorphCurvePath) > 0 {
+    var err error
+
+    if curve, err = pvoc.ReadEnvelope(parsedArgs.MorphCurvePath); err != nil {
+      return fmt.Errorf("Could not read morph curve: %s", err)
+    }
+  }
+
+  morph, err := pvoc.NewMorph(curve, parsedArgs.MorphMode, parsedArgs.MorphNormalize)
+
+  if err != nil {
+    return err
+  }
+
+  a, err := analyzeFile(parsedArgs, parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err != nil {
+    return err
+  }
+
+  b, err := analyzeFile(parsedArgs, parsedArgs.MorphInputPath, parsedArgs.MorphInputFormat)
+
+  if err != nil {
+    return err
+  }
+
+  if a.SampleRate != b.SampleRate {
+    return fmt.Errorf("Both files must have the same sample rate, got %d and %d", a.SampleRate, b.SampleRate)
+  }
+
+  output := morph.OutputSpectrogram(a, b)
+
+  numChans := a.NumChans
+  if b.NumChans > numChans {
+    numChans = b.NumChans
+  }
+
+  var signals [][]float64
+
+  if parsedArgs.MorphMode == pvoc.MorphPartials {
+    tracker, err := pvoc.NewPartialTracker(
+      parsedArgs.PartialThreshold,
+      parsedArgs.PartialDeviation,
+      parsedArgs.PartialMinLength,
+      parsedArgs.PartialMaxPeaks,
+    )
+
+    if err != nil {
+      return err
+    }
+
+    aDuration := float64(a.NumSampleFrames) / float64(a.SampleRate)
+    bDuration := float64(b.NumSampleFrames) / float64(b.SampleRate)
+
+    partials := morph.MorphPartials(tracker.Track(a), tracker.Track(b), aDuration, bDuration)
+
+    if !parsedArgs.Quiet {
+      fmt.Printf("%24s   %d\n", "Partials:", len(partials))
+    }
+
+    signals, err = pvoc.SynthesizePartials(partials, numChans, a.SampleRate, 1.0, 1.0, a.MaxSampleValue())
+
+    if err != nil {
+      return err
+    }
+
+    // as long as the bands morph would be
+    for c := range signals {
+      for len(signals[c]) < output.NumSampleFrames {
+        signals[c] = append(signals[c], 0.0)
+      }
+
+      signals[c] = signals[c][:output.NumSampleFrames]
+    }
+  } else {
+    frames, err := morph.MorphFrames(a, b)
+
+    if err != nil {
+      return err
+    }
+
+    if parsedArgs.Iterations > 0 {
+      if signals, err = output.SynthesizeGriffinLim(frames, parsedArgs.Iterations); err != nil {
+        return err
+      }
+    } else {
+      signals = output.Synthesize(frames)
+    }
+  }
+
+  audioFile := audioio.AudioFile{
+    Filepath: parsedArgs.OutputPath,
+    NumChans: numChans,
+    SampleRate: a.SampleRate,
+    BitDepth: a.BitDepth,
+  }
+
+  if err = audioio.WriteSignals(audioFile, parsedArgs.OutputFormat(), signals); err != nil {
+    return fmt.Errorf("Could not write output audio file: %s", err)
+  }
+
+  if !parsedArgs.Quiet {
+    fmt.Printf("%24s   %s\n", "Output File:", filepath.Base(parsedArgs.OutputPath))
+  }
+
+  return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+  "fmt"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// sample rate for partial files that don't have one
+const defaultPartialsSampleRate = 44100
+
+// analyzes the input (or reads a partial file), then writes the partials
+// and/or resynthesizes them
+func runPartials(parsedArgs *cli.Arguments) error {
+  var partials []*pvoc.Partial
+  sampleRate := 0
+  numChans := 1
+
+  if len(parsedArgs.InputPath) > 0 {
+    audioReader, err := audioio.NewAudioReader(parsedArgs.InputPath, parsedArgs.InputFormat)
+
+    if err != nil {
+      return err
+    }
+
+    tracker, err := pvoc.NewPartialTracker(
+      parsedArgs.PartialThreshold,
+      parsedArgs.PartialDeviation,
+      parsedArgs.PartialMinLength,
+      parsedArgs.PartialMaxPeaks,
+    )
+
+    if err != nil {
+      return err
+    }
+
+    // the same hop as pitch shifting, small enough to measure instantaneous
+    // frequencies across the whole band
+    decimation := int(float64(parsedArgs.Bands) * parsedArgs.Overlap / 4.0)
+
+    if decimation < 1 {
+      decimation = 1
+    }
+
+    if err = audioReader.Open(decimation); err != nil {
+      return fmt.Errorf("Could not open input file %s: %v", parsedArgs.InputPath, err)
+    }
+
+    defer audioReader.Close()
+
+    spectrogram, err := pvoc.Analyze(
+      audioReader,
+      parsedArgs.Bands,
+      parsedArgs.Overlap,
+      parsedArgs.WindowName,
+      decimation,
+      nil,
+    )
+
+    if err != nil {
+      return err
+    }
+
+    partials = tracker.Track(spectrogram)
+    sampleRate = spectrogram.SampleRate
+    numChans = spectrogram.NumChans
+  } else {
+    var err error
+    partials, sampleRate, err = pvoc.ReadPartials(parsedArgs.PartialsInputPath)
+
+    if err != nil {
+      return err
+    }
+
+    for _, partial := range partials {
+      if partial.Channel + 1 > numChans {
+        numChans = partial.Channel + 1
+      }
+    }
+  }
+
+  if parsedArgs.SampleRate != 0 {
+    sampleRate = parsedArgs.SampleRate
+  }
+
+  if sampleRate == 0 {
+    sampleRate = defaultPartialsSampleRate
+  }
+
+  if !parsedArgs.Quiet {
+    fmt.Printf("%24s   %d\n", "Partials:", len(partials))
+  }
+
+  if len(parsedArgs.PartialsOutputPath) > 0 {
+    if err := pvoc.WritePartials(parsedArgs.PartialsOutputPath, partials, sampleRate); err != nil {
+      return fmt.Errorf("Could not write partial file: %s", err)
+    }
+
+    if !parsedArgs.Quiet {
+      fmt.Printf("%24s   %s\n", "Partial File:", filepath.Base(parsedArgs.PartialsOutputPath))
+    }
+  }
+
+  if len(parsedArgs.OutputPath) == 0 {
+    return nil
+  }
+
+  maxSampleValue := audioio.IntMaxSignedValue[parsedArgs.BitDepth]
+
+  if maxSampleValue == 0 {
+    return fmt.Errorf("Bit depth must be 8, 16, 24 or 32, got %d", parsedArgs.BitDepth)
+  }
+
+  signals, err := pvoc.SynthesizePartials(
+    partials,
+    numChans,
+    sampleRate,
+    parsedArgs.Scale,
+    parsedArgs.PitchScale,
+    float64(maxSampleValue),
+  )
+
+  if err != nil {
+    return err
+  }
+
+  audioFile := audioio.AudioFile{
+    Filepath: parsedArgs.OutputPath,
+    NumChans: numChans,
+    SampleRate: sampleRate,
+    BitDepth: parsedArgs.BitDepth,
+  }
+
+  if err = audioio.WriteSignals(audioFile, parsedArgs.OutputFormat(), signals); err != nil {
+    return fmt.Errorf("Could not write output audio file: %s", err)
+  }
+
+  if !parsedArgs.Quiet {
+    fmt.Printf("%24s   %s\n", "Output File:", filepath.Base(parsedArgs.OutputPath))
+  }
+
+  return nil
+}
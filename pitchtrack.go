@@ -0,0 +1,72 @@
+package main
+
+import (
+  "fmt"
+  "path/filepath"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// detects the pitch of the input over time and writes it to the pitch file
+func runPitchTrack(parsedArgs *cli.Arguments) error {
+  // the same hop as partial tracking
+  decimation := int(float64(parsedArgs.Bands) * parsedArgs.Overlap / 4.0)
+
+  if decimation < 1 {
+    decimation = 1
+  }
+
+  tracker, err := pvoc.NewPitchTracker(
+    parsedArgs.PitchMethod,
+    parsedArgs.PitchMin,
+    parsedArgs.PitchMax,
+    parsedArgs.PitchConfidence,
+    parsedArgs.Bands,
+    parsedArgs.Overlap,
+    parsedArgs.WindowName,
+    decimation,
+  )
+
+  if err != nil {
+    return err
+  }
+
+  audioReader, err := audioio.NewAudioReader(parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err != nil {
+    return err
+  }
+
+  if err = audioReader.Open(decimation); err != nil {
+    return fmt.Errorf("Could not open input file: %s", parsedArgs.InputPath)
+  }
+
+  defer audioReader.Close()
+
+  pitchPoints, err := tracker.Track(audioReader, nil)
+
+  if err != nil {
+    return err
+  }
+
+  if err = pvoc.WritePitch(parsedArgs.PitchPath, pitchPoints, parsedArgs.PitchReference, parsedArgs.PitchFlatten); err != nil {
+    return fmt.Errorf("Could not write pitch file: %s", err)
+  }
+
+  if !parsedArgs.Quiet {
+    voiced := 0
+
+    for _, point := range pitchPoints {
+      if point.Frequency > 0.0 {
+        voiced++
+      }
+    }
+
+    fmt.Printf("%24s   %s\n", "Method:", tracker.Method)
+    fmt.Printf("%24s   %d (%d voiced)\n", "Frames:", len(pitchPoints), voiced)
+    fmt.Printf("%24s   %s\n", "Pitch File:", filepath.Base(parsedArgs.PitchPath))
+  }
+
+  return nil
+}
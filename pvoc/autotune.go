@@ -0,0 +1,217 @@
+package pvoc
+
+import(
+  "fmt"
+  "io"
+  "math"
+  "sort"
+  "strings"
+)
+
+// Scales for pitch correction, as semitones above the key
+var Scales = map[string][]int{
+  "chromatic": {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+  "major": {0, 2, 4, 5, 7, 9, 11},
+  "minor": {0, 2, 3, 5, 7, 8, 10},
+  "harmonic-minor": {0, 2, 3, 5, 7, 8, 11},
+  "dorian": {0, 2, 3, 5, 7, 9, 10},
+  "mixolydian": {0, 2, 4, 5, 7, 9, 10},
+  "pentatonic": {0, 2, 4, 7, 9},
+  "minor-pentatonic": {0, 3, 5, 7, 10},
+  "blues": {0, 3, 5, 6, 7, 10},
+}
+
+func ScaleNamesString() string {
+  names := []string{}
+
+  for name := range Scales {
+    names = append(names, name)
+  }
+
+  sort.Strings(names)
+
+  return strings.Join(names, ", ")
+}
+
+// semitones above C of the note names
+var noteNames = map[string]int{
+  "C": 0,
+  "D": 2,
+  "E": 4,
+  "F": 5,
+  "G": 7,
+  "A": 9,
+  "B": 11,
+}
+
+// the name of the key at each semitone above C, for printing
+var keyNames = []string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "Ab", "A", "Bb", "B"}
+
+// ParseKey returns the semitones above C of a note name like C, F# or Bb
+func ParseKey(key string) (int, error) {
+  if len(key) == 0 {
+    return 0, fmt.Errorf("Key can't be empty")
+  }
+
+  semitones, ok := noteNames[strings.ToUpper(key[:1])]
+
+  if !ok {
+    return 0, fmt.Errorf("Key must be a note name like C, F# or Bb, got %s", key)
+  }
+
+  switch key[1:] {
+  case "":
+  case "#":
+    semitones++
+  case "b":
+    semitones--
+  default:
+    return 0, fmt.Errorf("Key must be a note name like C, F# or Bb, got %s", key)
+  }
+
+  return (semitones + 12) % 12, nil
+}
+
+// default tuning reference (A4) and retune time of the pitch correction
+const DefaultTuningReference = 440.0
+const DefaultRetuneTime = 0.05
+
+// a frame of pitch correction, frequencies in Hz (0 when unvoiced)
+type AutotuneFrame struct {
+  Time float64 // seconds, center of the analysis window
+  Detected float64
+  Confidence float64
+  Target float64 // nearest note of the scale
+  Corrected float64 // detected frequency after the smoothed correction
+}
+
+// Autotune snaps the pitch of a monophonic sound to the nearest note of a
+// scale: the fundamental of every frame is estimated by a PitchDetector and
+// the frame is shifted by the ratio to the nearest note. The ratio moves
+// towards the target exponentially, taking RetuneTime seconds for about
+// two thirds of the way (0 snaps instantly), which also makes note changes
+// glide. On unvoiced frames it moves back to no correction.
+type Autotune struct {
+  Scale string
+  Key int // semitones above C
+  Reference float64 // Hz of A4
+  RetuneTime float64 // seconds
+  Detector *PitchDetector
+  Frames []AutotuneFrame
+  cents float64 // current correction
+}
+
+func NewAutotune(scale string, key int, reference, retuneTime float64, detector *PitchDetector) (*Autotune, error) {
+  if _, ok := Scales[scale]; !ok {
+    return nil, fmt.Errorf("Scale must be one of: %s, got %s", ScaleNamesString(), scale)
+  }
+
+  if key < 0 || key > 11 {
+    return nil, fmt.Errorf("Key must be between 0 and 11 semitones above C, got %d", key)
+  }
+
+  if reference <= 0 {
+    return nil, fmt.Errorf("Tuning reference must be above 0 Hz, got %f", reference)
+  }
+
+  if retuneTime < 0 {
+    return nil, fmt.Errorf("Retune time cannot be negative, got %f", retuneTime)
+  }
+
+  return &Autotune{
+    Scale: scale,
+    Key: key,
+    Reference: reference,
+    RetuneTime: retuneTime,
+    Detector: detector,
+    Frames: []AutotuneFrame{},
+  }, nil
+}
+
+// Nearest returns the note of the scale nearest to a frequency
+func (at *Autotune) Nearest(frequency float64) float64 {
+  // semitones above the C below the reference A
+  semitones := 12.0 * math.Log2(frequency / at.Reference) + 9.0
+  octave := math.Floor(semitones / 12.0)
+
+  nearest, nearestDistance := 0.0, math.Inf(1)
+
+  // the notes of this octave and its neighbors' closest notes
+  for o := octave - 1.0; o <= octave + 1.0; o++ {
+    for _, degree := range Scales[at.Scale] {
+      note := o * 12.0 + float64(degree + at.Key)
+
+      if distance := math.Abs(note - semitones); distance < nearestDistance {
+        nearest, nearestDistance = note, distance
+      }
+    }
+  }
+
+  return at.Reference * math.Pow(2.0, (nearest - 9.0) / 12.0)
+}
+
+// Correct detects the pitch of a frame and returns the pitch ratio to apply
+// to it, time is the center of the frame's window in seconds and
+// frameDuration the time between frames. scaleFactor is the transposition
+// applied to the whole file, the transposed pitch is what gets snapped.
+func (at *Autotune) Correct(polarSpectra [][]float64, time, frameDuration, scaleFactor float64) float64 {
+  detected, confidence := at.Detector.Detect(polarSpectra)
+
+  frame := AutotuneFrame{
+    Time: time,
+    Detected: detected,
+    Confidence: confidence,
+  }
+
+  targetCents := 0.0
+
+  if detected > 0.0 {
+    frame.Target = at.Nearest(detected * scaleFactor)
+    targetCents = 1200.0 * math.Log2(frame.Target / (detected * scaleFactor))
+  }
+
+  if at.RetuneTime == 0 {
+    at.cents = targetCents
+  } else {
+    at.cents += (targetCents - at.cents) * (1.0 - math.Exp(-frameDuration / at.RetuneTime))
+  }
+
+  ratio := math.Pow(2.0, at.cents / 1200.0)
+
+  if detected > 0.0 {
+    frame.Corrected = detected * scaleFactor * ratio
+  }
+
+  // frames centered before the start of the file still correct the pitch,
+  // they aren't kept like the pitch track's
+  if time >= 0.0 {
+    at.Frames = append(at.Frames, frame)
+  }
+
+  return scaleFactor * ratio
+}
+
+// writes the detected and corrected pitches as CSV, one line per frame
+func (at *Autotune) WriteCSV(writer io.Writer) error {
+  if _, err := fmt.Fprintln(writer, "time,detected,confidence,target,corrected"); err != nil {
+    return err
+  }
+
+  for _, frame := range at.Frames {
+    _, err := fmt.Fprintf(
+      writer,
+      "%.6f,%.3f,%.3f,%.3f,%.3f\n",
+      frame.Time,
+      frame.Detected,
+      frame.Confidence,
+      frame.Target,
+      frame.Corrected,
+    )
+
+    if err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
@@ -0,0 +1,176 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+)
+
+// default number of frames averaged by the spectral blur
+const DefaultBlurFrames = 8
+
+// the blurred output fades in and out over this long (in seconds) at the
+// start and end of the file, blurring smears sound up to the file's edges
+// where it would otherwise be cut off
+const blurEdgeFade = 0.01
+
+// SpectralBlur averages every frame of a Spectrogram with the frames around
+// it, smearing the sound in time like SoundHack's spectral blurring. Width
+// gives the number of frames averaged (centered on each frame) at every
+// time of the input, fractional widths weight the two outermost frames
+// partially. Near the start and end of the file only the frames that exist
+// are averaged. The magnitudes are always averaged, with Phases the phases
+// are too (as the magnitude weighted mean direction), otherwise every frame
+// keeps its own. The blurred magnitudes no longer match either, with
+// GriffinLimIterations the output phases are reconstructed from them.
+type SpectralBlur struct {
+  Width *Envelope // frames
+  Phases bool
+  GriffinLimIterations int // 0 resynthesizes the blurred frames as they are
+}
+
+func NewSpectralBlur(width *Envelope, phases bool) (*SpectralBlur, error) {
+  if width.Min() < 1.0 {
+    return nil, fmt.Errorf("Blur width must be at least 1 frame, got %f", width.Min())
+  }
+
+  return &SpectralBlur{
+    Width: width,
+    Phases: phases,
+  }, nil
+}
+
+// Blur returns blurred frames shaped like the spectrogram's Frames
+func (sb *SpectralBlur) Blur(spectrogram *Spectrogram) [][][]float64 {
+  numFrames := spectrogram.NumFrames()
+  halfPoints := spectrogram.Points / 2
+
+  blurred := make([][][]float64, spectrogram.NumChans, spectrogram.NumChans)
+
+  // running sums of the magnitudes (and of the spectra, for the phases)
+  // over the frames, so any width costs the same
+  ampSums := make([][]float64, numFrames + 1, numFrames + 1)
+  realSums := make([][]float64, numFrames + 1, numFrames + 1)
+  imagSums := make([][]float64, numFrames + 1, numFrames + 1)
+
+  for f := 0; f <= numFrames; f++ {
+    ampSums[f] = make([]float64, halfPoints + 1, halfPoints + 1)
+    realSums[f] = make([]float64, halfPoints + 1, halfPoints + 1)
+    imagSums[f] = make([]float64, halfPoints + 1, halfPoints + 1)
+  }
+
+  for c := 0; c < spectrogram.NumChans; c++ {
+    frames := spectrogram.Frames[c]
+
+    for f := 0; f < numFrames; f++ {
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        amp := frames[f][bandNumber * 2]
+        phase := frames[f][bandNumber * 2 + 1]
+
+        ampSums[f + 1][bandNumber] = ampSums[f][bandNumber] + amp
+        realSums[f + 1][bandNumber] = realSums[f][bandNumber] + amp * math.Cos(phase)
+        imagSums[f + 1][bandNumber] = imagSums[f][bandNumber] + amp * math.Sin(phase)
+      }
+    }
+
+    blurred[c] = make([][]float64, numFrames, numFrames)
+
+    for f := 0; f < numFrames; f++ {
+      blurred[c][f] = make([]float64, spectrogram.Points + 2, spectrogram.Points + 2)
+
+      // a width between two odd numbers of frames averages the smaller
+      // number fully and the two frames beyond it partially
+      width := sb.Width.Value(spectrogram.FrameTime(f))
+      reach := int(math.Ceil((width - 1.0) / 2.0))
+      edgeWeight := 1.0
+
+      // a single frame is kept as it is
+      if reach == 0 {
+        copy(blurred[c][f], frames[f])
+        continue
+      }
+
+      edgeWeight = (width - 1.0) / 2.0 - float64(reach - 1)
+
+      // frames beyond the start and end of the file don't count
+      first := f - reach
+      last := f + reach
+      partialEdges := []int{}
+
+      if first < 0 {
+        first = 0
+      } else {
+        partialEdges = append(partialEdges, first)
+      }
+
+      if last > numFrames - 1 {
+        last = numFrames - 1
+      } else {
+        partialEdges = append(partialEdges, last)
+      }
+
+      count := float64(last - first + 1) - (1.0 - edgeWeight) * float64(len(partialEdges))
+
+      // the weighted sum over the frames
+      sum := func(sums [][]float64, bandNumber int) float64 {
+        total := sums[last + 1][bandNumber] - sums[first][bandNumber]
+
+        for _, edge := range partialEdges {
+          total -= (1.0 - edgeWeight) * (sums[edge + 1][bandNumber] - sums[edge][bandNumber])
+        }
+
+        return total
+      }
+
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        ampIndex := bandNumber * 2
+        phaseIndex := ampIndex + 1
+
+        blurred[c][f][ampIndex] = sum(ampSums, bandNumber) / count
+        blurred[c][f][phaseIndex] = frames[f][phaseIndex]
+
+        if sb.Phases {
+          real := sum(realSums, bandNumber)
+          imag := sum(imagSums, bandNumber)
+
+          if real != 0.0 || imag != 0.0 {
+            blurred[c][f][phaseIndex] = math.Atan2(imag, real)
+          }
+        }
+      }
+    }
+  }
+
+  return blurred
+}
+
+// BlurSignals blurs the spectrogram and resynthesizes it, fading the result
+// in and out at the edges of the file
+func (sb *SpectralBlur) BlurSignals(spectrogram *Spectrogram) ([][]float64, error) {
+  frames := sb.Blur(spectrogram)
+  signals := [][]float64{}
+
+  if sb.GriffinLimIterations > 0 {
+    var err error
+
+    if signals, err = spectrogram.SynthesizeGriffinLim(frames, sb.GriffinLimIterations); err != nil {
+      return nil, err
+    }
+  } else {
+    signals = spectrogram.Synthesize(frames)
+  }
+
+  fade := int(blurEdgeFade * float64(spectrogram.SampleRate))
+
+  for _, signal := range signals {
+    length := len(signal)
+
+    for i := 0; i < fade && i < length / 2; i++ {
+      gain := 0.5 - 0.5 * math.Cos(pi * (float64(i) + 0.5) / float64(fade))
+
+      signal[i] *= gain
+      signal[length - 1 - i] *= gain
+    }
+  }
+
+  return signals, nil
+}
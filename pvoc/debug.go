@@ -0,0 +1,205 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+  "gopvoc/charter"
+)
+
+// the number of frames whose spectra are charted, spread over the input
+const debugFrameCount = 8
+
+// levels below this are charted at this level (dB below full scale)
+const debugFloorDb = -150.0
+
+// runDebug collects what Run charts when a Charter is set: the windows,
+// the magnitudes and phases of a few frames as they enter phase processing,
+// how many bands the gate zeroed in every frame and the peak of every
+// block written
+type runDebug struct {
+  charter *charter.Charter
+  numChans int
+  sampleRate int
+  blockLength int
+  maxSampleValue float64
+  frameInterval int
+  bandLabels []string
+  frameTimes []string
+  gatedBands [][]float64 // [channel][frame]
+  blockPeaks [][]float64 // [channel][block] dB below full scale
+}
+
+func newRunDebug(
+  chartWriter *charter.Charter,
+  numChans,
+  sampleRate,
+  numSampleFrames,
+  points,
+  windowSize,
+  decimation,
+  blockLength int,
+  maxSampleValue float64,
+) *runDebug {
+  frameInterval := (numSampleFrames + windowSize) / decimation / debugFrameCount
+
+  if frameInterval < 1 {
+    frameInterval = 1
+  }
+
+  halfPoints := points / 2
+  bandLabels := make([]string, halfPoints + 1, halfPoints + 1)
+
+  for bandNumber := range bandLabels {
+    bandLabels[bandNumber] = fmt.Sprintf("%.1f", float64(bandNumber * sampleRate) / float64(points))
+  }
+
+  return &runDebug{
+    charter: chartWriter,
+    numChans: numChans,
+    sampleRate: sampleRate,
+    blockLength: blockLength,
+    maxSampleValue: maxSampleValue,
+    frameInterval: frameInterval,
+    bandLabels: bandLabels,
+    frameTimes: []string{},
+    gatedBands: make([][]float64, numChans, numChans),
+    blockPeaks: make([][]float64, numChans, numChans),
+  }
+}
+
+// dB below full scale, no lower than debugFloorDb
+func (d *runDebug) decibels(amplitude float64) float64 {
+  if amplitude <= 0.0 {
+    return debugFloorDb
+  }
+
+  return math.Max(20.0 * math.Log10(amplitude / d.maxSampleValue), debugFloorDb)
+}
+
+// the windows after scaling, as they are applied
+func (d *runDebug) windows(analysisWindow, synthesisWindow []float64) error {
+  xLabels := make([]string, len(analysisWindow), len(analysisWindow))
+
+  for i := range xLabels {
+    xLabels[i] = fmt.Sprint(i)
+  }
+
+  return d.charter.MakeLines(
+    "windows",
+    0,
+    "scaled analysis and synthesis windows",
+    "",
+    xLabels,
+    charter.Series{Name: "Analysis", Data: analysisWindow},
+    charter.Series{Name: "Synthesis", Data: synthesisWindow},
+  )
+}
+
+// records the time of the frame, and charts its spectra if it is one of the
+// selected frames
+func (d *runDebug) frame(frameNumber int, frameTime float64, polarBuffers [][]float64) error {
+  d.frameTimes = append(d.frameTimes, fmt.Sprintf("%.3f", frameTime))
+
+  if frameNumber % d.frameInterval != 0 {
+    return nil
+  }
+
+  subtitle := fmt.Sprintf("frame %d at %.3f s", frameNumber, frameTime)
+
+  for c, polarBuffer := range polarBuffers {
+    magnitudes := make([]float64, len(d.bandLabels), len(d.bandLabels))
+    phases := make([]float64, len(d.bandLabels), len(d.bandLabels))
+
+    for bandNumber := range d.bandLabels {
+      magnitudes[bandNumber] = d.decibels(polarBuffer[bandNumber * 2])
+      phases[bandNumber] = polarBuffer[bandNumber * 2 + 1]
+    }
+
+    err := d.charter.MakeLines(
+      fmt.Sprintf("magnitude_chan-%d", c),
+      frameNumber,
+      subtitle,
+      "dB",
+      d.bandLabels,
+      charter.Series{Name: "Magnitude", Data: magnitudes},
+    )
+
+    if err != nil {
+      return err
+    }
+
+    err = d.charter.MakeLines(
+      fmt.Sprintf("phase_chan-%d", c),
+      frameNumber,
+      subtitle,
+      "radians",
+      d.bandLabels,
+      charter.Series{Name: "Phase", Data: phases},
+    )
+
+    if err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// the number of bands the gate zeroed in the current frame of a channel
+func (d *runDebug) gate(channel, gated int) {
+  d.gatedBands[channel] = append(d.gatedBands[channel], float64(gated))
+}
+
+// the peak of a block of a channel about to be written
+func (d *runDebug) blockPeak(channel int, block []int) {
+  peak := 0
+  for _, sample := range block {
+    if sample < 0 {
+      sample = -sample
+    }
+
+    if sample > peak {
+      peak = sample
+    }
+  }
+
+  d.blockPeaks[channel] = append(d.blockPeaks[channel], d.decibels(float64(peak)))
+}
+
+// charts the gate decisions and block peaks, then writes the index page
+func (d *runDebug) write(title string) error {
+  if len(d.gatedBands[0]) > 0 {
+    series := make([]charter.Series, d.numChans, d.numChans)
+
+    for c := range series {
+      series[c] = charter.Series{Name: fmt.Sprintf("Channel %d", c), Data: d.gatedBands[c]}
+    }
+
+    err := d.charter.MakeLines("gate", 0, "bands zeroed by the gate in every frame, by input time (s)", "bands", d.frameTimes, series...)
+
+    if err != nil {
+      return err
+    }
+  }
+
+  if len(d.blockPeaks[0]) > 0 {
+    series := make([]charter.Series, d.numChans, d.numChans)
+    blockTimes := make([]string, len(d.blockPeaks[0]), len(d.blockPeaks[0]))
+
+    for c := range series {
+      series[c] = charter.Series{Name: fmt.Sprintf("Channel %d", c), Data: d.blockPeaks[c]}
+    }
+
+    for block := range blockTimes {
+      blockTimes[block] = fmt.Sprintf("%.3f", float64(block * d.blockLength) / float64(d.sampleRate))
+    }
+
+    err := d.charter.MakeLines("peaks", 0, "peak of every block written, by output time (s)", "dB", blockTimes, series...)
+
+    if err != nil {
+      return err
+    }
+  }
+
+  return d.charter.WriteIndex(title)
+}
@@ -0,0 +1,117 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+)
+
+// Decompose splits the analyzed input into a deterministic part (the
+// sinusoids followed by the partials) and a residual part (noise and
+// transients), in the manner of Serra's Spectral Modeling Synthesis. The
+// deterministic part is resynthesized from the bands under each partial's
+// spectral peak, out to the troughs on either side, and the residual is the
+// input minus the deterministic part, so the two always sum back to the
+// input. input must hold the analyzed file's samples, one signal per channel.
+func Decompose(
+  spectrogram *Spectrogram,
+  partials []*Partial,
+  input [][]float64,
+) (deterministic, residual [][]float64, err error) {
+  if len(input) != spectrogram.NumChans {
+    return nil, nil, fmt.Errorf("Got %d input signals for %d channels", len(input), spectrogram.NumChans)
+  }
+
+  for c, signal := range input {
+    if len(signal) != spectrogram.NumSampleFrames {
+      return nil, nil, fmt.Errorf("Input signal for channel %d has %d samples, expected %d", c, len(signal), spectrogram.NumSampleFrames)
+    }
+  }
+
+  halfPoints := spectrogram.Points / 2
+  frames := make([][][]float64, spectrogram.NumChans, spectrogram.NumChans)
+
+  for c := 0; c < spectrogram.NumChans; c++ {
+    frames[c] = make([][]float64, spectrogram.NumFrames(), spectrogram.NumFrames())
+
+    for f := range frames[c] {
+      frames[c][f] = make([]float64, spectrogram.Points + 2, spectrogram.Points + 2)
+    }
+  }
+
+  for _, partial := range partials {
+    if partial.Channel < 0 || partial.Channel >= spectrogram.NumChans {
+      return nil, nil, fmt.Errorf("Partial %d is on channel %d, only %d channels", partial.ID, partial.Channel, spectrogram.NumChans)
+    }
+
+    for _, breakpoint := range partial.Frames {
+      f := spectrogram.frameAt(breakpoint.Time)
+
+      if f < 0 {
+        continue
+      }
+
+      polarSpectrum := spectrogram.Frames[partial.Channel][f]
+      amp := func(bandNumber int) float64 {
+        return polarSpectrum[bandNumber * 2]
+      }
+
+      // the instantaneous frequency can be off the peak band by a little,
+      // climb to the peak first
+      peak := int(math.Round(breakpoint.Frequency * float64(spectrogram.Points) / float64(spectrogram.SampleRate)))
+
+      if peak < 0 || peak > halfPoints {
+        continue
+      }
+
+      for peak < halfPoints && amp(peak + 1) > amp(peak) {
+        peak++
+      }
+
+      for peak > 0 && amp(peak - 1) > amp(peak) {
+        peak--
+      }
+
+      low := peak
+      for low > 0 && amp(low - 1) < amp(low) {
+        low--
+      }
+
+      high := peak
+      for high < halfPoints && amp(high + 1) < amp(high) {
+        high++
+      }
+
+      copy(frames[partial.Channel][f][low * 2:high * 2 + 2], polarSpectrum[low * 2:high * 2 + 2])
+    }
+  }
+
+  deterministic = spectrogram.Synthesize(frames)
+  residual = make([][]float64, spectrogram.NumChans, spectrogram.NumChans)
+
+  for c := 0; c < spectrogram.NumChans; c++ {
+    residual[c] = make([]float64, spectrogram.NumSampleFrames, spectrogram.NumSampleFrames)
+
+    for i := range residual[c] {
+      residual[c][i] = input[c][i] - deterministic[c][i]
+    }
+  }
+
+  return deterministic, residual, nil
+}
+
+// the frame whose window is centered at time (in seconds), -1 if there is
+// no such frame
+func (s *Spectrogram) frameAt(time float64) int {
+  if s.NumFrames() == 0 {
+    return -1
+  }
+
+  center := math.Round(time * float64(s.SampleRate)) - float64(s.WindowSize / 2)
+  f := int(math.Round((center - float64(s.Positions[0])) / float64(s.Decimation)))
+
+  if f < 0 || f >= s.NumFrames() {
+    return -1
+  }
+
+  return f
+}
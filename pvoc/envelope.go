@@ -0,0 +1,173 @@
+package pvoc
+
+import(
+  "bufio"
+  "fmt"
+  "io"
+  "os"
+  "strconv"
+  "strings"
+)
+
+// Envelope is a breakpoint function of time (in seconds), used wherever a
+// setting can change over the course of a file. Values are interpolated
+// linearly between breakpoints and held before the first and after the last
+// one. Two breakpoints at the same time make a step.
+type Envelope struct {
+  Times []float64
+  Values []float64
+}
+
+func NewEnvelope(times, values []float64) (*Envelope, error) {
+  if len(times) == 0 {
+    return nil, fmt.Errorf("Envelope needs at least one breakpoint")
+  }
+
+  if len(times) != len(values) {
+    return nil, fmt.Errorf("Envelope has %d times and %d values", len(times), len(values))
+  }
+
+  for i := 1; i < len(times); i++ {
+    if times[i] < times[i - 1] {
+      return nil, fmt.Errorf("Envelope times must not decrease, %f comes after %f", times[i], times[i - 1])
+    }
+  }
+
+  return &Envelope{
+    Times: times,
+    Values: values,
+  }, nil
+}
+
+// an envelope that is value at all times
+func ConstantEnvelope(value float64) *Envelope {
+  return &Envelope{
+    Times: []float64{0.0},
+    Values: []float64{value},
+  }
+}
+
+func (e *Envelope) Value(time float64) float64 {
+  last := len(e.Times) - 1
+
+  if time < e.Times[0] {
+    return e.Values[0]
+  }
+
+  if time >= e.Times[last] {
+    return e.Values[last]
+  }
+
+  // the last breakpoint at or before time
+  i := 0
+  for i < last && e.Times[i + 1] <= time {
+    i++
+  }
+
+  span := e.Times[i + 1] - e.Times[i]
+  position := (time - e.Times[i]) / span
+
+  return e.Values[i] + (e.Values[i + 1] - e.Values[i]) * position
+}
+
+func (e *Envelope) Min() float64 {
+  min := e.Values[0]
+
+  for _, value := range e.Values {
+    if value < min {
+      min = value
+    }
+  }
+
+  return min
+}
+
+func (e *Envelope) Max() float64 {
+  max := e.Values[0]
+
+  for _, value := range e.Values {
+    if value > max {
+      max = value
+    }
+  }
+
+  return max
+}
+
+// ReadEnvelope reads a breakpoint file (.bpf): one "time value" pair per
+// line, separated by spaces, tabs or a comma. Blank lines and lines starting
+// with # are skipped.
+func ReadEnvelope(path string) (*Envelope, error) {
+  file, err := os.Open(path)
+
+  if err != nil {
+    return nil, err
+  }
+
+  defer file.Close()
+
+  envelope, err := ParseEnvelope(file)
+
+  if err != nil {
+    return nil, fmt.Errorf("%s: %s", path, err)
+  }
+
+  return envelope, nil
+}
+
+func ParseEnvelope(reader io.Reader) (*Envelope, error) {
+  times := []float64{}
+  values := []float64{}
+
+  scanner := bufio.NewScanner(reader)
+  lineNumber := 0
+
+  for scanner.Scan() {
+    lineNumber++
+    line := strings.TrimSpace(scanner.Text())
+
+    if len(line) == 0 || strings.HasPrefix(line, "#") {
+      continue
+    }
+
+    fields := strings.FieldsFunc(line, func(r rune) bool {
+      return r == ' ' || r == '\t' || r == ','
+    })
+
+    if len(fields) != 2 {
+      return nil, fmt.Errorf("line %d: expected a time and a value, got %q", lineNumber, line)
+    }
+
+    time, err := strconv.ParseFloat(fields[0], 64)
+
+    if err != nil {
+      return nil, fmt.Errorf("line %d: invalid time %q", lineNumber, fields[0])
+    }
+
+    value, err := strconv.ParseFloat(fields[1], 64)
+
+    if err != nil {
+      return nil, fmt.Errorf("line %d: invalid value %q", lineNumber, fields[1])
+    }
+
+    times = append(times, time)
+    values = append(values, value)
+  }
+
+  if err := scanner.Err(); err != nil {
+    return nil, err
+  }
+
+  return NewEnvelope(times, values)
+}
+
+// writes the envelope in the breakpoint file format ReadEnvelope reads
+func (e *Envelope) Write(writer io.Writer) error {
+  for i := range e.Times {
+    if _, err := fmt.Fprintf(writer, "%.6f %g\n", e.Times[i], e.Values[i]); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
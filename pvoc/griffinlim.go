@@ -0,0 +1,268 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+)
+
+// default momentum of the fast Griffin-Lim algorithm (Perraudin, Balazs and
+// Sondergaard, "A Fast Griffin-Lim Algorithm", 2013), 0 is the original
+// Griffin-Lim algorithm
+const griffinLimMomentum = 0.99
+
+// output samples where the summed window overlap is below this fraction of
+// its maximum are not normalized, they are too close to the silent edges
+const griffinLimNormFloor = 1e-6
+
+// GriffinLim iteratively reconstructs signals whose short-time Fourier
+// transform magnitudes are as close as possible to the given ones (Griffin
+// and Lim, "Signal Estimation from Modified Short-Time Fourier Transform",
+// 1984). It is used wherever the phases of the spectra are discarded or
+// can't be trusted: each iteration resynthesizes the spectra with
+// OverlapAdd, re-analyzes the result with WindowFold and keeps the new
+// phases with the original magnitudes. Resynthesis followed by analysis is
+// an exact projection when the window is not longer than the FFT (overlaps of
+// 0.5 and 1), longer windows are folded and the reconstruction converges to
+// an approximation.
+type GriffinLim struct {
+  Iterations int
+  Momentum float64
+  Points int
+  WindowSize int
+  Convergence []float64 // spectral convergence after each iteration
+  analysisWindow []float64
+  synthesisWindow []float64
+}
+
+// the windows are scaled the same way Run scales them for the given
+// interpolation, so the magnitudes of spectra analyzed by Run can be used
+// as they are
+func NewGriffinLim(
+  points,
+  windowSize,
+  interpolation int,
+  windowName string,
+  iterations int,
+) (*GriffinLim, error) {
+  if iterations < 1 {
+    return nil, fmt.Errorf("Griffin-Lim iterations must be at least 1, got %d", iterations)
+  }
+
+  windowFunction := WindowFunctions[windowName]
+
+  if windowFunction == nil {
+    return nil, fmt.Errorf("Invalid window function (%s), valid options are: %s", windowName, WindowNamesString())
+  }
+
+  analysisWindow := windowFunction(windowSize)
+  synthesisWindow := windowFunction(windowSize)
+
+  ScaleWindowsInPlace(
+    analysisWindow,
+    synthesisWindow,
+    points,
+    interpolation,
+  )
+
+  return &GriffinLim{
+    Iterations: iterations,
+    Momentum: griffinLimMomentum,
+    Points: points,
+    WindowSize: windowSize,
+    Convergence: []float64{},
+    analysisWindow: analysisWindow,
+    synthesisWindow: synthesisWindow,
+  }, nil
+}
+
+// Reconstruct takes polar spectra (Points + 2 values per frame) for every
+// channel, and the output time (in samples) each frame is overlap-added at.
+// The positions must be increasing but don't need to be evenly spaced. The
+// phases of the spectra are used as the initial estimate and are replaced by
+// the reconstructed phases. The returned signals start at positions[0] and
+// are WindowSize samples longer than the last position. report, if not nil,
+// is called after every iteration with the spectral convergence
+// (|| |X| - |Y| || / || |Y| ||) of all channels.
+func (gl *GriffinLim) Reconstruct(
+  polarSpectra [][][]float64,
+  positions []int,
+  report func(iteration int, convergence float64),
+) ([][]float64, error) {
+  numChans := len(polarSpectra)
+  numFrames := len(positions)
+
+  for c := 0; c < numChans; c++ {
+    if len(polarSpectra[c]) != numFrames {
+      return nil, fmt.Errorf("Channel %d has %d frames, expected %d", c, len(polarSpectra[c]), numFrames)
+    }
+  }
+
+  gl.Convergence = []float64{}
+
+  if numFrames == 0 {
+    return make([][]float64, numChans, numChans), nil
+  }
+
+  for f := 1; f < numFrames; f++ {
+    if positions[f] < positions[f - 1] {
+      return nil, fmt.Errorf("Frame positions must be increasing, frame %d is at %d after %d", f, positions[f], positions[f - 1])
+    }
+  }
+
+  origin := positions[0]
+  signalLength := positions[numFrames - 1] - origin + gl.WindowSize
+  norm := gl.windowNorm(positions, signalLength)
+
+  // estimate (with momentum) and previous projection, in RealFFT format
+  estimates := make([][][]float64, numChans, numChans)
+  projections := make([][][]float64, numChans, numChans)
+  signals := make([][]float64, numChans, numChans)
+
+  for c := 0; c < numChans; c++ {
+    estimates[c] = make([][]float64, numFrames, numFrames)
+    projections[c] = make([][]float64, numFrames, numFrames)
+    signals[c] = make([]float64, signalLength, signalLength)
+
+    for f := 0; f < numFrames; f++ {
+      estimates[c][f] = make([]float64, gl.Points, gl.Points)
+      projections[c][f] = make([]float64, gl.Points, gl.Points)
+      PolarToCart(polarSpectra[c][f], estimates[c][f])
+    }
+  }
+
+  polarBuffer := make([]float64, gl.Points + 2, gl.Points + 2)
+  spectrumBuffer := make([]float64, gl.Points, gl.Points)
+
+  for iteration := 1; iteration <= gl.Iterations; iteration++ {
+    errorSum := 0.0
+    magnitudeSum := 0.0
+
+    for c := 0; c < numChans; c++ {
+      gl.synthesize(polarSpectra[c], estimates[c], positions, norm, signals[c], polarBuffer, spectrumBuffer)
+
+      for f := 0; f < numFrames; f++ {
+        WindowFold(
+          signals[c][positions[f] - origin:positions[f] - origin + gl.WindowSize],
+          gl.analysisWindow,
+          spectrumBuffer,
+          positions[f],
+        )
+        RealFFT(spectrumBuffer, Time2Freq)
+
+        CartToPolar(spectrumBuffer, polarBuffer)
+
+        for bandNumber := 0; bandNumber <= gl.Points / 2; bandNumber++ {
+          difference := polarBuffer[bandNumber * 2] - polarSpectra[c][f][bandNumber * 2]
+          errorSum += difference * difference
+          magnitudeSum += polarSpectra[c][f][bandNumber * 2] * polarSpectra[c][f][bandNumber * 2]
+        }
+
+        // accelerate towards the new projection
+        for i := 0; i < gl.Points; i++ {
+          estimates[c][f][i] = spectrumBuffer[i] + gl.Momentum * (spectrumBuffer[i] - projections[c][f][i])
+        }
+
+        copy(projections[c][f], spectrumBuffer)
+      }
+    }
+
+    convergence := 0.0
+
+    if magnitudeSum > 0.0 {
+      convergence = math.Sqrt(errorSum / magnitudeSum)
+    }
+
+    gl.Convergence = append(gl.Convergence, convergence)
+
+    if report != nil {
+      report(iteration, convergence)
+    }
+  }
+
+  // the final signal comes from the last projection, not the extrapolated
+  // estimate, and the spectra get its phases
+  for c := 0; c < numChans; c++ {
+    gl.synthesize(polarSpectra[c], projections[c], positions, norm, signals[c], polarBuffer, spectrumBuffer)
+
+    for f := 0; f < numFrames; f++ {
+      CartToPolar(projections[c][f], polarBuffer)
+
+      for bandNumber := 0; bandNumber <= gl.Points / 2; bandNumber++ {
+        polarSpectra[c][f][bandNumber * 2 + 1] = polarBuffer[bandNumber * 2 + 1]
+      }
+    }
+  }
+
+  return signals, nil
+}
+
+// the sum of the analysis and synthesis window products at every output
+// sample, dividing the overlap-added frames by it makes resynthesis followed
+// by analysis a projection, whatever the hop sizes are
+func (gl *GriffinLim) windowNorm(positions []int, signalLength int) []float64 {
+  norm := make([]float64, signalLength, signalLength)
+  maxNorm := 0.0
+
+  for f := 0; f < len(positions); f++ {
+    start := positions[f] - positions[0]
+
+    for i := 0; i < gl.WindowSize; i++ {
+      norm[start + i] += gl.analysisWindow[i] * gl.synthesisWindow[i]
+    }
+  }
+
+  for i := 0; i < signalLength; i++ {
+    maxNorm = math.Max(maxNorm, norm[i])
+  }
+
+  for i := 0; i < signalLength; i++ {
+    if norm[i] < maxNorm * griffinLimNormFloor {
+      norm[i] = 0.0
+    } else {
+      norm[i] = 1.0 / norm[i]
+    }
+  }
+
+  return norm
+}
+
+// overlap-adds the spectra with the target magnitudes and the phases of the
+// estimates into signal
+func (gl *GriffinLim) synthesize(
+  polarSpectra,
+  estimates [][]float64,
+  positions []int,
+  norm,
+  signal,
+  polarBuffer,
+  spectrumBuffer []float64,
+) {
+  origin := positions[0]
+
+  for i := 0; i < len(signal); i++ {
+    signal[i] = 0.0
+  }
+
+  for f := 0; f < len(positions); f++ {
+    copy(spectrumBuffer, estimates[f])
+    CartToPolar(spectrumBuffer, polarBuffer)
+
+    for bandNumber := 0; bandNumber <= gl.Points / 2; bandNumber++ {
+      polarBuffer[bandNumber * 2] = polarSpectra[f][bandNumber * 2]
+    }
+
+    PolarToCart(polarBuffer, spectrumBuffer)
+    RealFFT(spectrumBuffer, Freq2Time)
+
+    OverlapAdd(
+      spectrumBuffer,
+      gl.synthesisWindow,
+      signal[positions[f] - origin:positions[f] - origin + gl.WindowSize],
+      positions[f],
+    )
+  }
+
+  for i := 0; i < len(signal); i++ {
+    signal[i] *= norm[i]
+  }
+}
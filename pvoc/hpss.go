@@ -0,0 +1,225 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+  "sort"
+  "strings"
+)
+
+// Harmonic/percussive separation masks
+const HPSSMaskSoft = "soft"
+const HPSSMaskHard = "hard"
+
+var HPSSMasks = []string{
+  HPSSMaskSoft,
+  HPSSMaskHard,
+}
+
+func HPSSMasksString() string {
+  return strings.Join(HPSSMasks, ", ")
+}
+
+// default median filter lengths, in frames and bands
+const DefaultHarmonicFrames = 17
+const DefaultPercussiveBands = 17
+
+// default exponent of the soft (Wiener) masks
+const DefaultHPSSPower = 2.0
+
+// HarmonicPercussive separates a Spectrogram into harmonic and percussive
+// layers by median filtering its magnitudes (Fitzgerald, "Harmonic/Percussive
+// Separation Using Median Filtering", 2010). Harmonic sounds are steady
+// across frames, so a median across HarmonicFrames frames keeps them and
+// removes the short percussive ones, percussive sounds are spread across
+// the bands, so a median across PercussiveBands bands keeps them and
+// removes the narrow harmonic ones. The two filtered spectrograms are turned
+// into masks that split every band between the layers, with the masks
+// summing to 1.
+type HarmonicPercussive struct {
+  HarmonicFrames int
+  PercussiveBands int
+  Mask string
+  Power float64 // soft mask exponent
+}
+
+func NewHarmonicPercussive(harmonicFrames, percussiveBands int, mask string, power float64) (*HarmonicPercussive, error) {
+  if harmonicFrames < 1 {
+    return nil, fmt.Errorf("Harmonic filter length must be at least 1 frame, got %d", harmonicFrames)
+  }
+
+  if percussiveBands < 1 {
+    return nil, fmt.Errorf("Percussive filter length must be at least 1 band, got %d", percussiveBands)
+  }
+
+  if mask != HPSSMaskSoft && mask != HPSSMaskHard {
+    return nil, fmt.Errorf("Mask must be one of: %s, got %s", HPSSMasksString(), mask)
+  }
+
+  if power <= 0 {
+    return nil, fmt.Errorf("Mask power must be greater than 0, got %f", power)
+  }
+
+  return &HarmonicPercussive{
+    HarmonicFrames: harmonicFrames,
+    PercussiveBands: percussiveBands,
+    Mask: mask,
+    Power: power,
+  }, nil
+}
+
+// the median of values, which is reordered
+func median(values []float64) float64 {
+  sort.Float64s(values)
+
+  middle := len(values) / 2
+
+  if len(values) % 2 == 0 {
+    return (values[middle - 1] + values[middle]) / 2.0
+  }
+
+  return values[middle]
+}
+
+// Separate returns the harmonic and percussive frames of the spectrogram,
+// shaped like its Frames. Both keep the analysis phases. The filters are
+// centered on each frame and band and shortened at the edges.
+func (hp *HarmonicPercussive) Separate(spectrogram *Spectrogram) (harmonic, percussive [][][]float64) {
+  numFrames := spectrogram.NumFrames()
+  halfPoints := spectrogram.Points / 2
+
+  harmonic = make([][][]float64, spectrogram.NumChans, spectrogram.NumChans)
+  percussive = make([][][]float64, spectrogram.NumChans, spectrogram.NumChans)
+
+  window := make([]float64, 0, hp.HarmonicFrames + hp.PercussiveBands)
+
+  for c := 0; c < spectrogram.NumChans; c++ {
+    frames := spectrogram.Frames[c]
+    harmonic[c] = make([][]float64, numFrames, numFrames)
+    percussive[c] = make([][]float64, numFrames, numFrames)
+
+    for f := 0; f < numFrames; f++ {
+      harmonic[c][f] = make([]float64, spectrogram.Points + 2, spectrogram.Points + 2)
+      percussive[c][f] = make([]float64, spectrogram.Points + 2, spectrogram.Points + 2)
+
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        ampIndex := bandNumber * 2
+        phaseIndex := ampIndex + 1
+
+        // across frames
+        window = window[:0]
+        for i := f - hp.HarmonicFrames / 2; i <= f + (hp.HarmonicFrames - 1) / 2; i++ {
+          if i >= 0 && i < numFrames {
+            window = append(window, frames[i][ampIndex])
+          }
+        }
+        harmonicAmp := median(window)
+
+        // across bands
+        window = window[:0]
+        for i := bandNumber - hp.PercussiveBands / 2; i <= bandNumber + (hp.PercussiveBands - 1) / 2; i++ {
+          if i >= 0 && i <= halfPoints {
+            window = append(window, frames[f][i * 2])
+          }
+        }
+        percussiveAmp := median(window)
+
+        harmonicMask := hp.harmonicMask(harmonicAmp, percussiveAmp)
+
+        harmonic[c][f][ampIndex] = frames[f][ampIndex] * harmonicMask
+        harmonic[c][f][phaseIndex] = frames[f][phaseIndex]
+        percussive[c][f][ampIndex] = frames[f][ampIndex] * (1.0 - harmonicMask)
+        percussive[c][f][phaseIndex] = frames[f][phaseIndex]
+      }
+    }
+  }
+
+  return harmonic, percussive
+}
+
+// the share of a band that goes to the harmonic layer, ties and silence go
+// to the harmonic layer
+func (hp *HarmonicPercussive) harmonicMask(harmonicAmp, percussiveAmp float64) float64 {
+  if hp.Mask == HPSSMaskHard {
+    if harmonicAmp >= percussiveAmp {
+      return 1.0
+    }
+
+    return 0.0
+  }
+
+  harmonicPower := math.Pow(harmonicAmp, hp.Power)
+  percussivePower := math.Pow(percussiveAmp, hp.Power)
+
+  if harmonicPower + percussivePower == 0.0 {
+    return 1.0
+  }
+
+  return harmonicPower / (harmonicPower + percussivePower)
+}
+
+// RealignSegments cuts signal into segments starting preRoll samples before
+// each onset (in samples, increasing) and places every segment, unstretched,
+// so that its onset lands at onset * scale. The segments are faded in and
+// out over fade samples; a segment that runs into the next one's placement
+// (when scale is below 1) is cut there, crossfading into it. The result is
+// the input length times scale.
+func RealignSegments(signal []float64, onsets []int, scale float64, preRoll, fade int) []float64 {
+  length := int(math.Round(float64(len(signal)) * scale))
+  output := make([]float64, length, length)
+
+  starts := []int{0}
+  positions := []int{0}
+
+  for _, onset := range onsets {
+    start := onset - preRoll
+    position := int(math.Round(float64(onset) * scale)) - preRoll
+
+    if start <= starts[len(starts) - 1] || start >= len(signal) || position <= positions[len(positions) - 1] {
+      continue
+    }
+
+    starts = append(starts, start)
+    positions = append(positions, position)
+  }
+
+  fadeIn := func(i int) float64 {
+    return 0.5 - 0.5 * math.Cos(pi * (float64(i) + 0.5) / float64(fade))
+  }
+
+  for s := range starts {
+    segmentEnd := len(signal)
+    if s < len(starts) - 1 {
+      segmentEnd = starts[s + 1]
+    }
+
+    segmentLength := segmentEnd - starts[s]
+
+    // cut where the next segment has faded in
+    if s < len(starts) - 1 && positions[s] + segmentLength > positions[s + 1] + fade {
+      segmentLength = positions[s + 1] + fade - positions[s]
+    }
+
+    for i := 0; i < segmentLength; i++ {
+      n := positions[s] + i
+
+      if n < 0 || n >= length {
+        continue
+      }
+
+      gain := 1.0
+
+      if s > 0 && i < fade {
+        gain *= fadeIn(i)
+      }
+
+      if s < len(starts) - 1 && segmentLength - i <= fade {
+        gain *= 1.0 - fadeIn(fade - (segmentLength - i))
+      }
+
+      output[n] += signal[starts[s] + i] * gain
+    }
+  }
+
+  return output
+}
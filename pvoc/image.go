@@ -0,0 +1,507 @@
+package pvoc
+
+import(
+  "fmt"
+  "image"
+  "image/color"
+  "image/png"
+  "math"
+  "os"
+  "strings"
+)
+
+// Frequency axis scales of spectrogram images
+const FrequencyLog = "log"
+const FrequencyLinear = "linear"
+
+var FrequencyScales = []string{
+  FrequencyLog,
+  FrequencyLinear,
+}
+
+func FrequencyScalesString() string {
+  return strings.Join(FrequencyScales, ", ")
+}
+
+// default size (pixels of one spectrogram), lowest frequency and dynamic
+// range of spectrogram images
+const DefaultImageWidth = 1024
+const DefaultImageHeight = 512
+const DefaultImageMinFrequency = 20.0
+const DefaultImageRange = 90.0
+
+// layout of the image around the spectrograms, in pixels
+const imageMargin = 10
+const imageTitle = 12 // above the spectrograms, for the units
+const imageFrequencyAxis = 44
+const imageTimeAxis = 22
+const imagePanelGap = 20
+const imageColorbarWidth = 14
+const imageColorbarAxis = 36
+const imageTickLength = 4
+
+var imageBackground = color.RGBA{255, 255, 255, 255}
+var imageForeground = color.RGBA{0, 0, 0, 255}
+
+// the colormap, from the bottom of the range to full scale
+var imageColormap = []color.RGBA{
+  {0, 0, 4, 255},
+  {60, 15, 110, 255},
+  {150, 40, 120, 255},
+  {225, 80, 75, 255},
+  {250, 165, 60, 255},
+  {252, 250, 190, 255},
+}
+
+// SpectrogramImage renders spectrograms as images: time from left to right,
+// frequency from bottom to top on a log or linear scale, and the magnitudes
+// in dB below full scale through a colormap. Channels are averaged. Several
+// spectrograms are drawn side by side on the same frequency and dB scales,
+// for before and after comparisons.
+type SpectrogramImage struct {
+  Width int // pixels of each spectrogram, 0 is one column per frame
+  Height int // pixels
+  Scale string
+  MinFrequency float64 // Hz
+  MaxFrequency float64 // Hz, 0 is the Nyquist frequency
+  Range float64 // dB below full scale shown
+}
+
+func NewSpectrogramImage(width, height int, scale string, minFrequency, maxFrequency, dbRange float64) (*SpectrogramImage, error) {
+  if width < 0 {
+    return nil, fmt.Errorf("Image width cannot be negative, got %d", width)
+  }
+
+  if height < 16 {
+    return nil, fmt.Errorf("Image height must be at least 16 pixels, got %d", height)
+  }
+
+  switch scale {
+  case FrequencyLog:
+    if minFrequency <= 0 {
+      return nil, fmt.Errorf("The lowest frequency of a log scale must be above 0 Hz, got %f", minFrequency)
+    }
+  case FrequencyLinear:
+    if minFrequency < 0 {
+      return nil, fmt.Errorf("The lowest frequency cannot be negative, got %f", minFrequency)
+    }
+  default:
+    return nil, fmt.Errorf("Frequency scale must be one of: %s, got %s", FrequencyScalesString(), scale)
+  }
+
+  if maxFrequency != 0 && maxFrequency <= minFrequency {
+    return nil, fmt.Errorf("The highest frequency must be above the lowest, got %f to %f", minFrequency, maxFrequency)
+  }
+
+  if dbRange <= 0 {
+    return nil, fmt.Errorf("Image range must be above 0 dB, got %f", dbRange)
+  }
+
+  return &SpectrogramImage{
+    Width: width,
+    Height: height,
+    Scale: scale,
+    MinFrequency: minFrequency,
+    MaxFrequency: maxFrequency,
+    Range: dbRange,
+  }, nil
+}
+
+// the frequency at a fraction of the way from min to max on a scale
+func scaleFrequency(scale string, minFrequency, maxFrequency, fraction float64) float64 {
+  if scale == FrequencyLog {
+    return minFrequency * math.Pow(maxFrequency / minFrequency, fraction)
+  }
+
+  return minFrequency + (maxFrequency - minFrequency) * fraction
+}
+
+// the frequency at a fraction of the height of the image, from the bottom
+func (si *SpectrogramImage) frequencyAt(fraction, maxFrequency float64) float64 {
+  return scaleFrequency(si.Scale, si.MinFrequency, maxFrequency, fraction)
+}
+
+// the inverse of frequencyAt
+func (si *SpectrogramImage) fractionAt(frequency, maxFrequency float64) float64 {
+  if si.Scale == FrequencyLog {
+    return math.Log(frequency / si.MinFrequency) / math.Log(maxFrequency / si.MinFrequency)
+  }
+
+  return (frequency - si.MinFrequency) / (maxFrequency - si.MinFrequency)
+}
+
+// the color of a level between 0 (the bottom of the range) and 1 (full scale)
+func colormap(level float64) color.RGBA {
+  level = math.Max(0.0, math.Min(1.0, level))
+  position := level * float64(len(imageColormap) - 1)
+  i := int(position)
+
+  if i >= len(imageColormap) - 1 {
+    return imageColormap[len(imageColormap) - 1]
+  }
+
+  fraction := position - float64(i)
+  from, to := imageColormap[i], imageColormap[i + 1]
+  mix := func(a, b uint8) uint8 {
+    return uint8(math.Round(float64(a) + (float64(b) - float64(a)) * fraction))
+  }
+
+  return color.RGBA{mix(from.R, to.R), mix(from.G, to.G), mix(from.B, to.B), 255}
+}
+
+// the frame whose center is nearest to a time, within the spectrogram
+func nearestFrame(spectrogram *Spectrogram, time float64) int {
+  first := float64(spectrogram.Positions[0] + spectrogram.WindowSize / 2)
+  frame := int(math.Round((time * float64(spectrogram.SampleRate) - first) / float64(spectrogram.Decimation)))
+
+  if frame < 0 {
+    return 0
+  }
+
+  if frame >= spectrogram.NumFrames() {
+    return spectrogram.NumFrames() - 1
+  }
+
+  return frame
+}
+
+func (si *SpectrogramImage) panelWidth(spectrogram *Spectrogram) int {
+  if si.Width > 0 {
+    return si.Width
+  }
+
+  // the frames centered within the file
+  width := 0
+
+  for f := 0; f < spectrogram.NumFrames(); f++ {
+    if time := spectrogram.FrameTime(f); time >= 0 && time * float64(spectrogram.SampleRate) <= float64(spectrogram.NumSampleFrames) {
+      width++
+    }
+  }
+
+  if width < 1 {
+    return 1
+  }
+
+  return width
+}
+
+// Render draws the spectrograms side by side with their axes and a colorbar
+func (si *SpectrogramImage) Render(spectrograms ...*Spectrogram) (*image.RGBA, error) {
+  if len(spectrograms) == 0 {
+    return nil, fmt.Errorf("Nothing to render")
+  }
+
+  // the highest frequency all the spectrograms have
+  maxFrequency := si.MaxFrequency
+
+  for _, spectrogram := range spectrograms {
+    if spectrogram.NumFrames() == 0 {
+      return nil, fmt.Errorf("Cannot render a spectrogram without frames")
+    }
+
+    nyquist := float64(spectrogram.SampleRate) / 2.0
+
+    if maxFrequency == 0 || maxFrequency > nyquist {
+      maxFrequency = nyquist
+    }
+  }
+
+  if maxFrequency <= si.MinFrequency {
+    return nil, fmt.Errorf("The lowest frequency (%f Hz) must be below the Nyquist frequency (%f Hz)", si.MinFrequency, maxFrequency)
+  }
+
+  width := imageMargin + imageFrequencyAxis
+  for i, spectrogram := range spectrograms {
+    if i > 0 {
+      width += imagePanelGap
+    }
+
+    width += si.panelWidth(spectrogram)
+  }
+  width += imagePanelGap + imageColorbarWidth + imageColorbarAxis + imageMargin
+
+  height := imageMargin * 2 + imageTitle + si.Height + imageTimeAxis
+
+  img := image.NewRGBA(image.Rect(0, 0, width, height))
+  fillRect(img, 0, 0, width, height, imageBackground)
+
+  top := imageMargin + imageTitle
+  left := imageMargin + imageFrequencyAxis
+
+  si.drawFrequencyAxis(img, left, top, maxFrequency)
+
+  for _, spectrogram := range spectrograms {
+    panelWidth := si.panelWidth(spectrogram)
+
+    si.drawPanel(img, spectrogram, left, top, panelWidth, maxFrequency)
+    si.drawTimeAxis(img, spectrogram, left, top + si.Height, panelWidth)
+
+    left += panelWidth + imagePanelGap
+  }
+
+  si.drawColorbar(img, left, top)
+
+  return img, nil
+}
+
+func (si *SpectrogramImage) drawPanel(img *image.RGBA, spectrogram *Spectrogram, left, top, width int, maxFrequency float64) {
+  halfPoints := spectrogram.Points / 2
+  duration := float64(spectrogram.NumSampleFrames) / float64(spectrogram.SampleRate)
+  maxSampleValue := spectrogram.MaxSampleValue()
+  magnitudes := make([]float64, halfPoints + 1, halfPoints + 1)
+
+  // the bands under every row, from the bottom edge to the top edge
+  lowBands := make([]int, si.Height, si.Height)
+  highBands := make([]int, si.Height, si.Height)
+
+  for y := 0; y < si.Height; y++ {
+    row := si.Height - 1 - y
+    low := si.frequencyAt(float64(row) / float64(si.Height), maxFrequency) * float64(spectrogram.Points) / float64(spectrogram.SampleRate)
+    high := si.frequencyAt(float64(row + 1) / float64(si.Height), maxFrequency) * float64(spectrogram.Points) / float64(spectrogram.SampleRate)
+
+    lowBands[y] = int(math.Round(low))
+    highBands[y] = int(math.Round(high))
+
+    if highBands[y] > halfPoints {
+      highBands[y] = halfPoints
+    }
+
+    if lowBands[y] > highBands[y] {
+      lowBands[y] = highBands[y]
+    }
+  }
+
+  for x := 0; x < width; x++ {
+    first := nearestFrame(spectrogram, duration * float64(x) / float64(width))
+    last := nearestFrame(spectrogram, duration * float64(x + 1) / float64(width))
+
+    if last <= first {
+      last = first + 1
+    }
+
+    if last > spectrogram.NumFrames() {
+      last = spectrogram.NumFrames()
+    }
+
+    // the loudest of the frames in the column, channels averaged
+    for bandNumber := range magnitudes {
+      magnitudes[bandNumber] = 0.0
+    }
+
+    for f := first; f < last; f++ {
+      for bandNumber := range magnitudes {
+        magnitude := 0.0
+
+        for c := 0; c < spectrogram.NumChans; c++ {
+          magnitude += spectrogram.Frames[c][f][bandNumber * 2]
+        }
+
+        magnitudes[bandNumber] = math.Max(magnitudes[bandNumber], magnitude / float64(spectrogram.NumChans))
+      }
+    }
+
+    for y := 0; y < si.Height; y++ {
+      magnitude := 0.0
+
+      for bandNumber := lowBands[y]; bandNumber <= highBands[y]; bandNumber++ {
+        magnitude = math.Max(magnitude, magnitudes[bandNumber])
+      }
+
+      level := 0.0
+      if magnitude > 0.0 {
+        level = (20.0 * math.Log10(magnitude / maxSampleValue) + si.Range) / si.Range
+      }
+
+      img.SetRGBA(left + x, top + y, colormap(level))
+    }
+  }
+
+  strokeRect(img, left - 1, top - 1, width + 2, si.Height + 2, imageForeground)
+}
+
+func (si *SpectrogramImage) drawFrequencyAxis(img *image.RGBA, left, top int, maxFrequency float64) {
+  ticks := []float64{}
+
+  if si.Scale == FrequencyLog {
+    for decade := math.Pow(10.0, math.Floor(math.Log10(si.MinFrequency))); decade <= maxFrequency; decade *= 10.0 {
+      for _, multiple := range []float64{1.0, 2.0, 5.0} {
+        ticks = append(ticks, decade * multiple)
+      }
+    }
+  } else {
+    step := niceStep((maxFrequency - si.MinFrequency) / 8.0)
+
+    for tick := math.Ceil(si.MinFrequency / step) * step; tick <= maxFrequency; tick += step {
+      ticks = append(ticks, tick)
+    }
+  }
+
+  for _, tick := range ticks {
+    if tick < si.MinFrequency || tick > maxFrequency {
+      continue
+    }
+
+    y := top + si.Height - 1 - int(math.Round(si.fractionAt(tick, maxFrequency) * float64(si.Height - 1)))
+    label := formatFrequency(tick)
+
+    fillRect(img, left - 1 - imageTickLength, y, imageTickLength, 1, imageForeground)
+    drawText(img, left - 3 - imageTickLength - textWidth(label), y - glyphHeight / 2, label, imageForeground)
+  }
+
+  drawText(img, left - 3 - imageTickLength - textWidth("Hz"), top - imageTitle - glyphHeight / 2, "Hz", imageForeground)
+}
+
+func (si *SpectrogramImage) drawTimeAxis(img *image.RGBA, spectrogram *Spectrogram, left, bottom, width int) {
+  duration := float64(spectrogram.NumSampleFrames) / float64(spectrogram.SampleRate)
+
+  if duration <= 0 {
+    return
+  }
+
+  // labels need some room
+  step := niceStep(duration * 50.0 / float64(width))
+
+  // counted in steps so the last tick doesn't get lost to rounding
+  numTicks := int(math.Floor(duration / step + 1e-9))
+
+  for i := 0; i <= numTicks; i++ {
+    tick := float64(i) * step
+    x := left + int(math.Round(tick / duration * float64(width - 1)))
+    label := fmt.Sprintf("%g", math.Round(tick * 1000.0) / 1000.0)
+
+    fillRect(img, x, bottom + 1, 1, imageTickLength, imageForeground)
+
+    // the last label is the unit
+    if i == numTicks {
+      label += "s"
+    }
+
+    drawText(img, x - textWidth(label) / 2, bottom + imageTickLength + 4, label, imageForeground)
+  }
+}
+
+func (si *SpectrogramImage) drawColorbar(img *image.RGBA, left, top int) {
+  for y := 0; y < si.Height; y++ {
+    fillRect(img, left, top + y, imageColorbarWidth, 1, colormap(float64(si.Height - 1 - y) / float64(si.Height - 1)))
+  }
+
+  strokeRect(img, left - 1, top - 1, imageColorbarWidth + 2, si.Height + 2, imageForeground)
+
+  step := niceStep(si.Range / 6.0)
+  right := left + imageColorbarWidth + 1
+
+  for i := 0; float64(i) * step <= si.Range + 1e-9; i++ {
+    tick := float64(i) * step
+    y := top + int(math.Round(tick / si.Range * float64(si.Height - 1)))
+    label := fmt.Sprintf("%g", 0.0 - tick)
+
+    fillRect(img, right, y, imageTickLength, 1, imageForeground)
+    drawText(img, right + imageTickLength + 2, y - glyphHeight / 2, label, imageForeground)
+  }
+
+  drawText(img, left, top - imageTitle - glyphHeight / 2, "dB", imageForeground)
+}
+
+// a step of 1, 2 or 5 times a power of ten, at least minimum
+func niceStep(minimum float64) float64 {
+  magnitude := math.Pow(10.0, math.Floor(math.Log10(minimum)))
+
+  for _, multiple := range []float64{1.0, 2.0, 5.0, 10.0} {
+    if magnitude * multiple >= minimum {
+      return magnitude * multiple
+    }
+  }
+
+  return magnitude * 10.0
+}
+
+func formatFrequency(frequency float64) string {
+  if frequency >= 1000.0 {
+    return fmt.Sprintf("%gk", frequency / 1000.0)
+  }
+
+  return fmt.Sprintf("%g", frequency)
+}
+
+func fillRect(img *image.RGBA, x, y, width, height int, color color.RGBA) {
+  for j := y; j < y + height; j++ {
+    for i := x; i < x + width; i++ {
+      img.SetRGBA(i, j, color)
+    }
+  }
+}
+
+func strokeRect(img *image.RGBA, x, y, width, height int, color color.RGBA) {
+  fillRect(img, x, y, width, 1, color)
+  fillRect(img, x, y + height - 1, width, 1, color)
+  fillRect(img, x, y, 1, height, color)
+  fillRect(img, x + width - 1, y, 1, height, color)
+}
+
+// 5x7 glyphs of the characters axis labels use, a row per byte from the top
+// with the leftmost pixel in the fifth bit
+const glyphWidth = 5
+const glyphHeight = 7
+
+var glyphs = map[rune][glyphHeight]uint8{
+  '0': {0x0E, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0E},
+  '1': {0x04, 0x0C, 0x04, 0x04, 0x04, 0x04, 0x0E},
+  '2': {0x0E, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1F},
+  '3': {0x1F, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0E},
+  '4': {0x02, 0x06, 0x0A, 0x12, 0x1F, 0x02, 0x02},
+  '5': {0x1F, 0x10, 0x1E, 0x01, 0x01, 0x11, 0x0E},
+  '6': {0x06, 0x08, 0x10, 0x1E, 0x11, 0x11, 0x0E},
+  '7': {0x1F, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+  '8': {0x0E, 0x11, 0x11, 0x0E, 0x11, 0x11, 0x0E},
+  '9': {0x0E, 0x11, 0x11, 0x0F, 0x01, 0x02, 0x0C},
+  '.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0C, 0x0C},
+  '-': {0x00, 0x00, 0x00, 0x0E, 0x00, 0x00, 0x00},
+  'k': {0x10, 0x10, 0x12, 0x14, 0x18, 0x14, 0x12},
+  'H': {0x11, 0x11, 0x11, 0x1F, 0x11, 0x11, 0x11},
+  'z': {0x00, 0x00, 0x1F, 0x02, 0x04, 0x08, 0x1F},
+  's': {0x00, 0x00, 0x0E, 0x10, 0x0E, 0x01, 0x1E},
+  'd': {0x01, 0x01, 0x0D, 0x13, 0x11, 0x11, 0x0F},
+  'B': {0x1E, 0x11, 0x11, 0x1E, 0x11, 0x11, 0x1E},
+}
+
+func textWidth(text string) int {
+  if len(text) == 0 {
+    return 0
+  }
+
+  return len(text) * (glyphWidth + 1) - 1
+}
+
+// draws text with its top left corner at x, y, characters without a glyph
+// are left blank
+func drawText(img *image.RGBA, x, y int, text string, color color.RGBA) {
+  for _, character := range text {
+    glyph := glyphs[character]
+
+    for row := 0; row < glyphHeight; row++ {
+      for column := 0; column < glyphWidth; column++ {
+        if glyph[row] & (1 << (glyphWidth - 1 - column)) != 0 {
+          img.SetRGBA(x + column, y + row, color)
+        }
+      }
+    }
+
+    x += glyphWidth + 1
+  }
+}
+
+func WritePNG(path string, img image.Image) error {
+  file, err := os.Create(path)
+
+  if err != nil {
+    return err
+  }
+
+  if err = png.Encode(file, img); err != nil {
+    file.Close()
+    return err
+  }
+
+  return file.Close()
+}
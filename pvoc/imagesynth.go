@@ -0,0 +1,342 @@
+package pvoc
+
+import(
+  "fmt"
+  "image"
+  _ "image/gif"
+  _ "image/jpeg"
+  _ "image/png"
+  "math"
+  "math/rand"
+  "os"
+)
+
+// default frequency range, dynamic range and output peak of image synthesis
+const DefaultImageSynthMinFrequency = 20.0
+const DefaultImageSynthMaxFrequency = 20000.0
+const DefaultImageSynthRange = 60.0
+const DefaultImageSynthPeak = -1.0
+
+// the main lobe of the window is tabulated this finely, in bands
+const imageSynthKernelStep = 1.0 / 32.0
+
+// ImageSynth turns an image into sound, the other way around from
+// SpectrogramImage: every row of pixels is a sinusoid, from MaxFrequency at
+// the top to MinFrequency at the bottom on a log or linear scale, and every
+// column is a stretch of time whose brightness sets the sinusoids' levels,
+// white at full scale and black silent with Range dB in between. The
+// magnitude frames are built with the spectrum a windowed sinusoid has and
+// phases that advance at each row's frequency, then overlap-added. Colors are
+// taken by their luminance and transparent pixels are black. With
+// GriffinLimIterations the phases are reconstructed from the magnitudes
+// instead, starting from the advancing ones.
+type ImageSynth struct {
+  Duration float64 // seconds, 0 is one column per analysis frame
+  Scale string
+  MinFrequency float64 // Hz
+  MaxFrequency float64 // Hz, above the Nyquist frequency is the Nyquist frequency
+  Range float64 // dB
+  Peak float64 // dB below full scale the output is normalized to
+  Bands int
+  Overlap float64
+  WindowName string
+  Decimation int
+  SampleRate int
+  BitDepth int
+  GriffinLimIterations int // 0 keeps the advancing phases
+}
+
+func NewImageSynth(
+  duration float64,
+  scale string,
+  minFrequency,
+  maxFrequency,
+  dbRange,
+  peak float64,
+  bands int,
+  overlap float64,
+  windowName string,
+  decimation,
+  sampleRate,
+  bitDepth int,
+) (*ImageSynth, error) {
+  if duration < 0 {
+    return nil, fmt.Errorf("Duration cannot be negative, got %f", duration)
+  }
+
+  switch scale {
+  case FrequencyLog:
+    if minFrequency <= 0 {
+      return nil, fmt.Errorf("The lowest frequency of a log scale must be above 0 Hz, got %f", minFrequency)
+    }
+  case FrequencyLinear:
+    if minFrequency < 0 {
+      return nil, fmt.Errorf("The lowest frequency cannot be negative, got %f", minFrequency)
+    }
+  default:
+    return nil, fmt.Errorf("Frequency scale must be one of: %s, got %s", FrequencyScalesString(), scale)
+  }
+
+  if maxFrequency <= minFrequency || minFrequency >= float64(sampleRate) / 2.0 {
+    return nil, fmt.Errorf("The frequency range must end above its start and start below the Nyquist frequency, got %f to %f", minFrequency, maxFrequency)
+  }
+
+  if dbRange <= 0 {
+    return nil, fmt.Errorf("Range must be above 0 dB, got %f", dbRange)
+  }
+
+  if peak > 0 {
+    return nil, fmt.Errorf("Peak must be at or below 0 dB, got %f", peak)
+  }
+
+  if bands > 8192 || bands < 1 || (bands & (bands - 1)) != 0 {
+    return nil, fmt.Errorf("bands must be a power of 2 less than or equal to 8192, got %d", bands)
+  }
+
+  if !allowedOverlaps[overlap] {
+    return nil, fmt.Errorf("overlap must be 0.5, 1.0, 2.0 or 4.0, got %f", overlap)
+  }
+
+  if WindowFunctions[windowName] == nil {
+    return nil, fmt.Errorf("Invalid window function (%s), valid options are: %s", windowName, WindowNamesString())
+  }
+
+  if decimation < 1 {
+    return nil, fmt.Errorf("Decimation must be at least 1, got %d", decimation)
+  }
+
+  if sampleRate < 1 {
+    return nil, fmt.Errorf("Sample rate must be above 0, got %d", sampleRate)
+  }
+
+  return &ImageSynth{
+    Duration: duration,
+    Scale: scale,
+    MinFrequency: minFrequency,
+    MaxFrequency: math.Min(maxFrequency, float64(sampleRate) / 2.0),
+    Range: dbRange,
+    Peak: peak,
+    Bands: bands,
+    Overlap: overlap,
+    WindowName: windowName,
+    Decimation: decimation,
+    SampleRate: sampleRate,
+    BitDepth: bitDepth,
+  }, nil
+}
+
+// reads a PNG, JPEG or GIF image
+func ReadImage(path string) (image.Image, error) {
+  file, err := os.Open(path)
+
+  if err != nil {
+    return nil, err
+  }
+
+  defer file.Close()
+
+  img, _, err := image.Decode(file)
+
+  return img, err
+}
+
+// the luminance of every pixel between 0 and 1, [row][column]
+func imageLevels(img image.Image) [][]float64 {
+  bounds := img.Bounds()
+  levels := make([][]float64, bounds.Dy(), bounds.Dy())
+
+  for y := range levels {
+    levels[y] = make([]float64, bounds.Dx(), bounds.Dx())
+
+    for x := range levels[y] {
+      // premultiplied by alpha, so transparent is black
+      r, g, b, _ := img.At(bounds.Min.X + x, bounds.Min.Y + y).RGBA()
+      levels[y][x] = (0.299 * float64(r) + 0.587 * float64(g) + 0.114 * float64(b)) / 65535.0
+    }
+  }
+
+  return levels
+}
+
+// the magnitude of the analysis window's spectrum relative to its peak, every
+// imageSynthKernelStep bands from the center to the end of the main lobe
+func windowKernel(window []float64, points int) []float64 {
+  center := float64(len(window) - 1) / 2.0
+  kernel := []float64{}
+
+  for offset := 0.0; ; offset += imageSynthKernelStep {
+    sum := 0.0
+
+    for n, value := range window {
+      sum += value * math.Cos(twoPi * offset * (float64(n) - center) / float64(points))
+    }
+
+    if len(kernel) > 0 {
+      sum /= kernel[0]
+
+      if sum <= 0.0 {
+        break
+      }
+    }
+
+    kernel = append(kernel, sum)
+  }
+
+  kernel[0] = 1.0
+
+  return kernel
+}
+
+// Spectrogram builds the frames of an image, ready for Synthesize
+func (is *ImageSynth) Spectrogram(img image.Image) (*Spectrogram, error) {
+  levels := imageLevels(img)
+
+  if len(levels) == 0 || len(levels[0]) == 0 {
+    return nil, fmt.Errorf("The image is empty")
+  }
+
+  numRows, numColumns := len(levels), len(levels[0])
+
+  spectrogram := &Spectrogram{
+    Points: is.Bands * 2,
+    WindowSize: int(float64(is.Bands) * 2.0 * is.Overlap),
+    Decimation: is.Decimation,
+    WindowName: is.WindowName,
+    NumChans: 1,
+    SampleRate: is.SampleRate,
+    BitDepth: is.BitDepth,
+    Positions: []int{},
+    Frames: [][][]float64{{}},
+  }
+
+  duration := is.Duration
+  if duration == 0 {
+    duration = float64(numColumns * is.Decimation) / float64(is.SampleRate)
+  }
+
+  spectrogram.NumSampleFrames = int(math.Round(duration * float64(is.SampleRate)))
+
+  // positioned like Analyze positions them, the first window ends at the
+  // first sample and the last one starts after the last sample
+  for position := is.Decimation - spectrogram.WindowSize; ; position += is.Decimation {
+    spectrogram.Positions = append(spectrogram.Positions, position)
+
+    if position >= spectrogram.NumSampleFrames {
+      break
+    }
+  }
+
+  points := spectrogram.Points
+  halfPoints := points / 2
+  maxSampleValue := spectrogram.MaxSampleValue()
+  kernel := windowKernel(spectrogram.AnalysisWindow(), points)
+  reach := float64(len(kernel) - 1) * imageSynthKernelStep
+
+  // the rows' frequencies (in bands) and starting phases, the
+  // same for every run
+  random := rand.New(rand.NewSource(1))
+  frequencies := make([]float64, numRows, numRows)
+  startPhases := make([]float64, numRows, numRows)
+
+  for y := range frequencies {
+    fraction := (float64(numRows - 1 - y) + 0.5) / float64(numRows)
+    frequencies[y] = scaleFrequency(is.Scale, is.MinFrequency, is.MaxFrequency, fraction) * float64(points) / float64(is.SampleRate)
+    startPhases[y] = random.Float64() * twoPi
+  }
+
+  realParts := make([]float64, halfPoints + 1, halfPoints + 1)
+  imagParts := make([]float64, halfPoints + 1, halfPoints + 1)
+
+  for _, position := range spectrogram.Positions {
+    center := position + spectrogram.WindowSize / 2
+    column := int(math.Floor(float64(center) / float64(spectrogram.NumSampleFrames) * float64(numColumns)))
+
+    if column < 0 {
+      column = 0
+    }
+
+    if column >= numColumns {
+      column = numColumns - 1
+    }
+
+    // the window center within the FFT buffer, for the heterodyned phases
+    rotationCenter := center % points
+    if rotationCenter < 0 {
+      rotationCenter += points
+    }
+
+    for bandNumber := range realParts {
+      realParts[bandNumber] = 0.0
+      imagParts[bandNumber] = 0.0
+    }
+
+    for y, frequency := range frequencies {
+      if levels[y][column] == 0.0 {
+        continue
+      }
+
+      amplitude := math.Pow(10.0, (levels[y][column] - 1.0) * is.Range / 20.0) * maxSampleValue
+      centerPhase := startPhases[y] + twoPi * frequency * float64(center) / float64(points)
+
+      for bandNumber := int(math.Ceil(frequency - reach)); float64(bandNumber) <= frequency + reach; bandNumber++ {
+        if bandNumber < 0 || bandNumber > halfPoints {
+          continue
+        }
+
+        magnitude := amplitude * kernel[int(math.Round(math.Abs(frequency - float64(bandNumber)) / imageSynthKernelStep))]
+        rotation := twoPi * float64((bandNumber * rotationCenter) % points) / float64(points)
+
+        realParts[bandNumber] += magnitude * math.Cos(centerPhase - rotation)
+        imagParts[bandNumber] += magnitude * math.Sin(centerPhase - rotation)
+      }
+    }
+
+    polarSpectrum := make([]float64, points + 2, points + 2)
+
+    for bandNumber := range realParts {
+      polarSpectrum[bandNumber * 2] = math.Hypot(realParts[bandNumber], imagParts[bandNumber])
+      polarSpectrum[bandNumber * 2 + 1] = math.Atan2(imagParts[bandNumber], realParts[bandNumber])
+    }
+
+    spectrogram.Frames[0] = append(spectrogram.Frames[0], polarSpectrum)
+  }
+
+  return spectrogram, nil
+}
+
+// Synthesize returns the sound of an image, its peak normalized to Peak dB
+// below full scale
+func (is *ImageSynth) Synthesize(img image.Image) ([]float64, error) {
+  spectrogram, err := is.Spectrogram(img)
+
+  if err != nil {
+    return nil, err
+  }
+
+  signals := [][]float64{}
+
+  if is.GriffinLimIterations > 0 {
+    if signals, err = spectrogram.SynthesizeGriffinLim(spectrogram.Frames, is.GriffinLimIterations); err != nil {
+      return nil, err
+    }
+  } else {
+    signals = spectrogram.Synthesize(spectrogram.Frames)
+  }
+
+  signal := signals[0]
+
+  peak := 0.0
+  for _, sample := range signal {
+    peak = math.Max(peak, math.Abs(sample))
+  }
+
+  if peak > 0.0 {
+    gain := math.Pow(10.0, is.Peak / 20.0) * spectrogram.MaxSampleValue() / peak
+
+    for i := range signal {
+      signal[i] *= gain
+    }
+  }
+
+  return signal, nil
+}
@@ -0,0 +1,117 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+  "strconv"
+)
+
+// the reference of linked channels that is the sum of all of them
+const LinkSum = -1
+
+// where the reference band is more than this far below the channel's
+// (relative amplitude) its phase says nothing about the channel, the channel
+// keeps its own advanced phase there
+const linkTolerance = 1e-2
+
+// ChannelLinker keeps the channels of a TimeStretch coherent: the phases of
+// a reference (the sum of the channels or one of them) advance as any
+// channel's would, and every channel keeps the phase difference to the
+// reference it had in the analysis. Where the reference is too quiet to
+// follow the channels advance on their own
+type ChannelLinker struct {
+  Reference int // zero indexed channel, or LinkSum
+  Polar []float64 // the reference spectrum of the current frame
+  LastPhaseIn []float64
+  LastPhaseOut []float64
+  PhaseLocker *PhaseLocker // nil unless the phase lock mode needs one
+  PhaseHeap *PhaseGradientHeap // nil unless reconstructing with PGHI
+  analysisPhases []float64
+  channelPhases [][]float64 // the analysis phases of every channel
+}
+
+// ParseLinkReference parses sum or a channel counted from 1
+func ParseLinkReference(text string) (int, error) {
+  if text == "sum" {
+    return LinkSum, nil
+  }
+
+  channel, err := strconv.Atoi(text)
+
+  if err != nil || channel < 1 {
+    return 0, fmt.Errorf("Link reference must be sum or a channel from 1, got %s", text)
+  }
+
+  return channel - 1, nil
+}
+
+func NewChannelLinker(reference, numChans, points int) (*ChannelLinker, error) {
+  if reference != LinkSum && (reference < 0 || reference >= numChans) {
+    return nil, fmt.Errorf("Link reference channel %d is not one of the %d channels", reference + 1, numChans)
+  }
+
+  halfPoints := points / 2
+  channelPhases := make([][]float64, numChans, numChans)
+
+  for c := range channelPhases {
+    channelPhases[c] = make([]float64, halfPoints + 1, halfPoints + 1)
+  }
+
+  return &ChannelLinker{
+    Reference: reference,
+    Polar: make([]float64, points + 2, points + 2),
+    LastPhaseIn: make([]float64, halfPoints + 1, halfPoints + 1),
+    LastPhaseOut: make([]float64, halfPoints + 1, halfPoints + 1),
+    analysisPhases: make([]float64, halfPoints + 1, halfPoints + 1),
+    channelPhases: channelPhases,
+  }, nil
+}
+
+// sets Polar to the reference of the analyzed channels, before its phases
+// (and the channels' own) are advanced
+func (cl *ChannelLinker) Analyze(polarBuffers [][]float64) {
+  for bandNumber := range cl.analysisPhases {
+    ampIndex := bandNumber * 2
+    phaseIndex := ampIndex + 1
+
+    if cl.Reference != LinkSum {
+      cl.Polar[ampIndex] = polarBuffers[cl.Reference][ampIndex]
+      cl.Polar[phaseIndex] = polarBuffers[cl.Reference][phaseIndex]
+    } else {
+      real := 0.0
+      imaginary := 0.0
+
+      for _, polar := range polarBuffers {
+        real += polar[ampIndex] * math.Cos(polar[phaseIndex])
+        imaginary += polar[ampIndex] * math.Sin(polar[phaseIndex])
+      }
+
+      cl.Polar[ampIndex] = math.Hypot(real, imaginary)
+      cl.Polar[phaseIndex] = math.Atan2(imaginary, real)
+    }
+
+    cl.analysisPhases[bandNumber] = cl.Polar[phaseIndex]
+
+    for c, polar := range polarBuffers {
+      cl.channelPhases[c][bandNumber] = polar[phaseIndex]
+    }
+  }
+}
+
+// gives a channel, already advanced on its own, the advanced phases of the
+// reference offset by the channel's analysis phase difference to it,
+// wherever the reference is loud enough next to it. lastPhaseOut is kept in
+// step so the channel continues from there when it is on its own again
+func (cl *ChannelLinker) Resynthesize(channel int, polar, lastPhaseOut []float64) {
+  for bandNumber, analysisPhase := range cl.analysisPhases {
+    ampIndex := bandNumber * 2
+    phaseIndex := ampIndex + 1
+
+    if cl.Polar[ampIndex] <= polar[ampIndex] * linkTolerance {
+      continue
+    }
+
+    polar[phaseIndex] = princarg(cl.Polar[phaseIndex] + cl.channelPhases[channel][bandNumber] - analysisPhase)
+    lastPhaseOut[bandNumber] = polar[phaseIndex]
+  }
+}
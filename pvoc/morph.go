@@ -0,0 +1,474 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+  "sort"
+  "strings"
+)
+
+// Morph modes
+const MorphBins = "bins"
+const MorphPartials = "partials"
+
+var MorphModes = []string{
+  MorphBins,
+  MorphPartials,
+}
+
+func MorphModesString() string {
+  return strings.Join(MorphModes, ", ")
+}
+
+// partials further apart than this (in octaves) are never matched
+const morphMaxInterval = 1.0
+
+// Morph interpolates between the analyses of two files, A and B, following
+// Curve over the time of the output: 0 is all A, 1 is all B. Magnitudes are
+// interpolated linearly, frequencies are interpolated weighted by the
+// magnitudes, so a band or partial that is silent on one side keeps the
+// other side's frequency. With Normalize, B is stretched or squeezed to the
+// length of A, otherwise both keep their own timing and the output is as
+// long as the longer one.
+type Morph struct {
+  Curve *Envelope // 0 to 1
+  Mode string
+  Normalize bool
+}
+
+func NewMorph(curve *Envelope, mode string, normalize bool) (*Morph, error) {
+  if curve.Min() < 0.0 || curve.Max() > 1.0 {
+    return nil, fmt.Errorf("Morph curve must stay between 0 and 1, got values from %f to %f", curve.Min(), curve.Max())
+  }
+
+  if mode != MorphBins && mode != MorphPartials {
+    return nil, fmt.Errorf("Morph mode must be one of: %s, got %s", MorphModesString(), mode)
+  }
+
+  return &Morph{
+    Curve: curve,
+    Mode: mode,
+    Normalize: normalize,
+  }, nil
+}
+
+// interpolates a frequency between a and b, weighted by their amplitudes
+// and the morph position
+func morphFrequency(aFrequency, aAmplitude, bFrequency, bAmplitude, position float64) float64 {
+  aWeight := (1.0 - position) * aAmplitude
+  bWeight := position * bAmplitude
+
+  if aWeight + bWeight == 0.0 {
+    return (1.0 - position) * aFrequency + position * bFrequency
+  }
+
+  return (aWeight * aFrequency + bWeight * bFrequency) / (aWeight + bWeight)
+}
+
+// OutputSpectrogram returns whichever of a and b the morphed frames are
+// shaped like: A when B is normalized to it, otherwise the longer one
+func (m *Morph) OutputSpectrogram(a, b *Spectrogram) *Spectrogram {
+  if !m.Normalize && b.NumFrames() > a.NumFrames() {
+    return b
+  }
+
+  return a
+}
+
+// MorphFrames morphs the spectrograms band by band, returning frames shaped
+// like the OutputSpectrogram's, with as many channels as the input with the
+// most (a mono input is morphed into every channel). Both must have been
+// analyzed with the same FFT settings and sample rate. The output phases
+// are identity phase locked: the phases of the peaks of the morphed
+// magnitudes are accumulated from the morphed frequencies, the bands around
+// each peak keep the phase relationships of the side that dominates it.
+func (m *Morph) MorphFrames(a, b *Spectrogram) ([][][]float64, error) {
+  if a.Points != b.Points || a.WindowSize != b.WindowSize || a.Decimation != b.Decimation {
+    return nil, fmt.Errorf("Both files must be analyzed with the same FFT settings")
+  }
+
+  if a.SampleRate != b.SampleRate {
+    return nil, fmt.Errorf("Both files must have the same sample rate, got %d and %d", a.SampleRate, b.SampleRate)
+  }
+
+  output := m.OutputSpectrogram(a, b)
+  numFrames := output.NumFrames()
+  halfPoints := a.Points / 2
+
+  numChans := a.NumChans
+  if b.NumChans > numChans {
+    numChans = b.NumChans
+  }
+
+  // B's magnitudes at A's bit depth
+  bGain := a.MaxSampleValue() / b.MaxSampleValue()
+
+  // the frame of B (fractional) that is morphed with each output frame
+  bFrame := func(frame int) float64 {
+    if m.Normalize && a.NumFrames() > 1 {
+      return float64(frame) * float64(b.NumFrames() - 1) / float64(a.NumFrames() - 1)
+    }
+
+    return float64(frame)
+  }
+
+  // the magnitude and instantaneous frequency of a band at a fractional
+  // frame, silent outside the spectrogram
+  bandAt := func(s *Spectrogram, channel int, frame float64, bandNumber int) (float64, float64) {
+    if channel >= s.NumChans {
+      channel = s.NumChans - 1
+    }
+
+    if frame < 0.0 || frame > float64(s.NumFrames() - 1) {
+      return 0.0, s.BandFrequency(bandNumber)
+    }
+
+    first := int(frame)
+    position := frame - float64(first)
+    second := first
+    if position > 0.0 {
+      second = first + 1
+    }
+
+    amplitude := s.Frames[channel][first][bandNumber * 2] * (1.0 - position) +
+      s.Frames[channel][second][bandNumber * 2] * position
+    frequency := s.InstantaneousFrequency(channel, first, bandNumber) * (1.0 - position) +
+      s.InstantaneousFrequency(channel, second, bandNumber) * position
+
+    return amplitude, frequency
+  }
+
+  hop := twoPi * float64(a.Decimation) / float64(a.SampleRate)
+
+  // the phase rotation from the absolute input time to a window's center
+  rotation := func(bandNumber, center int) float64 {
+    center %= a.Points
+
+    if center < 0 {
+      center += a.Points
+    }
+
+    return twoPi * float64((bandNumber * center) % a.Points) / float64(a.Points)
+  }
+
+  aAmplitudes := make([]float64, halfPoints + 1, halfPoints + 1)
+  bAmplitudes := make([]float64, halfPoints + 1, halfPoints + 1)
+  frequencies := make([]float64, halfPoints + 1, halfPoints + 1)
+  regions := make([]int, halfPoints + 1, halfPoints + 1)
+
+  morphed := make([][][]float64, numChans, numChans)
+
+  for c := 0; c < numChans; c++ {
+    aChannel, bChannel := c, c
+    if aChannel >= a.NumChans {
+      aChannel = a.NumChans - 1
+    }
+    if bChannel >= b.NumChans {
+      bChannel = b.NumChans - 1
+    }
+
+    morphed[c] = make([][]float64, numFrames, numFrames)
+
+    for f := 0; f < numFrames; f++ {
+      morphed[c][f] = make([]float64, a.Points + 2, a.Points + 2)
+      position := m.Curve.Value(output.FrameTime(f))
+
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        aAmplitude, aFrequency := bandAt(a, c, float64(f), bandNumber)
+        bAmplitude, bFrequency := bandAt(b, c, bFrame(f), bandNumber)
+        bAmplitude *= bGain
+
+        aAmplitudes[bandNumber] = aAmplitude
+        bAmplitudes[bandNumber] = bAmplitude
+        frequencies[bandNumber] = morphFrequency(aFrequency, aAmplitude, bFrequency, bAmplitude, position)
+        morphed[c][f][bandNumber * 2] = (1.0 - position) * aAmplitude + position * bAmplitude
+      }
+
+      // the side, and its frame, whose phases a band follows
+      source := func(bandNumber int) (*Spectrogram, int, int) {
+        bIndex := int(math.Round(bFrame(f)))
+        aExists := f < a.NumFrames()
+        bExists := bIndex < b.NumFrames()
+
+        if bExists && (!aExists || position * bAmplitudes[bandNumber] > (1.0 - position) * aAmplitudes[bandNumber]) {
+          return b, bChannel, bIndex
+        }
+
+        return a, aChannel, f
+      }
+
+      if f == 0 {
+        // start from the phase of the side that dominates each band
+        for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+          s, channel, frame := source(bandNumber)
+          morphed[c][f][bandNumber * 2 + 1] = s.Frames[channel][frame][bandNumber * 2 + 1]
+        }
+
+        continue
+      }
+
+      FindPeaks(morphed[c][f], regions, halfPoints + 1)
+
+      // the peaks advance by their deviation from the band's center
+      // frequency, the analysis phase convention
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        if regions[bandNumber] == bandNumber {
+          deviation := frequencies[bandNumber] - a.BandFrequency(bandNumber)
+          morphed[c][f][bandNumber * 2 + 1] = princarg(morphed[c][f - 1][bandNumber * 2 + 1] + deviation * hop)
+        }
+      }
+
+      // the other bands keep their phase around the window center relative
+      // to their peak
+      center := output.Positions[f] + a.WindowSize / 2
+
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        peak := regions[bandNumber]
+
+        if peak == bandNumber {
+          continue
+        }
+
+        s, channel, frame := source(peak)
+        relative := s.CenterPhase(channel, frame, bandNumber) - s.CenterPhase(channel, frame, peak)
+        peakCenterPhase := morphed[c][f][peak * 2 + 1] + rotation(peak, center)
+
+        morphed[c][f][bandNumber * 2 + 1] = princarg(peakCenterPhase + relative - rotation(bandNumber, center))
+      }
+    }
+  }
+
+  return morphed, nil
+}
+
+// the amplitude and frequency of a partial at a time, silent outside its
+// span at its first or last frequency
+func partialAt(partial *Partial, time float64) (float64, float64) {
+  frames := partial.Frames
+  last := len(frames) - 1
+
+  if time < frames[0].Time {
+    return 0.0, frames[0].Frequency
+  }
+
+  if time > frames[last].Time {
+    return 0.0, frames[last].Frequency
+  }
+
+  i := sort.Search(len(frames), func(i int) bool {
+    return frames[i].Time >= time
+  })
+
+  if frames[i].Time == time || i == 0 {
+    return frames[i].Amplitude, frames[i].Frequency
+  }
+
+  position := (time - frames[i - 1].Time) / (frames[i].Time - frames[i - 1].Time)
+
+  return frames[i - 1].Amplitude + (frames[i].Amplitude - frames[i - 1].Amplitude) * position,
+    frames[i - 1].Frequency + (frames[i].Frequency - frames[i - 1].Frequency) * position
+}
+
+// the distance (in octaves) between two partials where they overlap in
+// time, false if they don't
+func partialInterval(a, b *Partial) (float64, bool) {
+  start := math.Max(a.Birth(), b.Birth())
+  end := math.Min(a.Death(), b.Death())
+
+  if end < start {
+    return 0.0, false
+  }
+
+  ratios := 0.0
+  count := 0
+
+  for _, frame := range a.Frames {
+    if frame.Time < start || frame.Time > end {
+      continue
+    }
+
+    _, frequency := partialAt(b, frame.Time)
+    ratios += math.Log2(frame.Frequency / frequency)
+    count++
+  }
+
+  if count == 0 {
+    _, aFrequency := partialAt(a, start)
+    _, bFrequency := partialAt(b, start)
+    return math.Abs(math.Log2(aFrequency / bFrequency)), true
+  }
+
+  return math.Abs(ratios / float64(count)), true
+}
+
+// MorphPartials morphs partials tracked in A with partials tracked in B.
+// Partials on the same channel that overlap in time are paired one to one,
+// closest in frequency first, and each pair becomes a single partial
+// spanning both. Partials without a match fade in or out with the curve.
+// aDuration and bDuration (in seconds) are the lengths of the files, for
+// normalizing B. The result is sorted, with new IDs.
+func (m *Morph) MorphPartials(a, b []*Partial, aDuration, bDuration float64) []*Partial {
+  // B on A's timeline
+  timeScale := 1.0
+  if m.Normalize && bDuration > 0 {
+    timeScale = aDuration / bDuration
+  }
+
+  scaled := make([]*Partial, 0, len(b))
+
+  for _, partial := range b {
+    if len(partial.Frames) == 0 {
+      continue
+    }
+
+    frames := make([]PartialFrame, len(partial.Frames), len(partial.Frames))
+
+    for i, frame := range partial.Frames {
+      frames[i] = frame
+      frames[i].Time *= timeScale
+    }
+
+    scaled = append(scaled, &Partial{
+      Channel: partial.Channel,
+      Frames: frames,
+    })
+  }
+
+  type pair struct {
+    a, b int
+    interval float64
+  }
+
+  pairs := []pair{}
+
+  for i, aPartial := range a {
+    if len(aPartial.Frames) == 0 {
+      continue
+    }
+
+    for j, bPartial := range scaled {
+      if aPartial.Channel != bPartial.Channel {
+        continue
+      }
+
+      if interval, overlap := partialInterval(aPartial, bPartial); overlap && interval <= morphMaxInterval {
+        pairs = append(pairs, pair{i, j, interval})
+      }
+    }
+  }
+
+  sort.SliceStable(pairs, func(i, j int) bool {
+    return pairs[i].interval < pairs[j].interval
+  })
+
+  aMatches := map[int]int{}
+  bMatched := map[int]bool{}
+
+  for _, p := range pairs {
+    if _, matched := aMatches[p.a]; matched || bMatched[p.b] {
+      continue
+    }
+
+    aMatches[p.a] = p.b
+    bMatched[p.b] = true
+  }
+
+  morphed := []*Partial{}
+
+  // morphs one partial or a pair, either can be nil
+  morph := func(aPartial, bPartial *Partial) {
+    times := []float64{}
+    channel := 0
+
+    if aPartial != nil {
+      channel = aPartial.Channel
+      for _, frame := range aPartial.Frames {
+        times = append(times, frame.Time)
+      }
+    }
+
+    if bPartial != nil {
+      channel = bPartial.Channel
+      for _, frame := range bPartial.Frames {
+        times = append(times, frame.Time)
+      }
+    }
+
+    sort.Float64s(times)
+
+    partial := &Partial{Channel: channel}
+
+    for i, time := range times {
+      if i > 0 && time == times[i - 1] {
+        continue
+      }
+
+      position := m.Curve.Value(time)
+
+      aAmplitude, aFrequency, bAmplitude, bFrequency := 0.0, 0.0, 0.0, 0.0
+
+      if aPartial != nil {
+        aAmplitude, aFrequency = partialAt(aPartial, time)
+      }
+
+      if bPartial != nil {
+        bAmplitude, bFrequency = partialAt(bPartial, time)
+      }
+
+      if aPartial == nil {
+        aFrequency = bFrequency
+      }
+
+      if bPartial == nil {
+        bFrequency = aFrequency
+      }
+
+      partial.Frames = append(partial.Frames, PartialFrame{
+        Time: time,
+        Frequency: morphFrequency(aFrequency, aAmplitude, bFrequency, bAmplitude, position),
+        Amplitude: (1.0 - position) * aAmplitude + position * bAmplitude,
+      })
+    }
+
+    // start from the phase of the partial born first, or of the side that
+    // dominates when both are
+    source := aPartial
+    if aPartial == nil {
+      source = bPartial
+    } else if bPartial != nil {
+      if bPartial.Birth() < aPartial.Birth() || (bPartial.Birth() == aPartial.Birth() && m.Curve.Value(times[0]) >= 0.5) {
+        source = bPartial
+      }
+    }
+
+    partial.Frames[0].Phase = source.Frames[0].Phase
+
+    morphed = append(morphed, partial)
+  }
+
+  for i, aPartial := range a {
+    if len(aPartial.Frames) == 0 {
+      continue
+    }
+
+    if j, matched := aMatches[i]; matched {
+      morph(aPartial, scaled[j])
+    } else {
+      morph(aPartial, nil)
+    }
+  }
+
+  for j, bPartial := range scaled {
+    if !bMatched[j] {
+      morph(nil, bPartial)
+    }
+  }
+
+  SortPartials(morphed)
+
+  for i, partial := range morphed {
+    partial.ID = i + 1
+  }
+
+  return morphed
+}
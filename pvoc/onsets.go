@@ -0,0 +1,179 @@
+package pvoc
+
+import(
+  "fmt"
+  "io"
+  "math"
+)
+
+// compression factor applied to normalized magnitudes before taking the flux,
+// keeps quiet partials from being swamped by the loudest bins
+const onsetCompression = 1000.0
+
+// minimum time between two reported onsets, in seconds
+const onsetMinimumGap = 0.05
+
+// length of the adaptive threshold history, in seconds
+const onsetHistoryLength = 1.0
+
+// OnsetDetector finds transients in the analysis frames by computing the
+// spectral flux (the half-wave rectified frame-to-frame increase of the log
+// compressed magnitudes) summed across all channels, and comparing it to an
+// adaptive threshold computed over the recent flux history.
+type OnsetDetector struct {
+  Sensitivity float64
+  Onsets []float64 // detected onset times in seconds
+  lastAmps [][]float64
+  history []float64
+  historyIndex int
+  historyFilled bool
+  lastFlux float64
+  rising bool
+  risingTime float64
+  holdOff int
+  minimumGap int
+  maxSampleValue float64
+}
+
+// sensitivity is between 0 (fewest onsets) and 1 (most onsets), frameRate is
+// the number of analysis frames per second
+func NewOnsetDetector(
+  sensitivity float64,
+  numChans,
+  points int,
+  frameRate,
+  maxSampleValue float64,
+) (*OnsetDetector, error) {
+  if sensitivity <= 0 || sensitivity > 1 {
+    return nil, fmt.Errorf("Transient sensitivity must be greater than 0 and less than or equal to 1, got %f", sensitivity)
+  }
+
+  halfPoints := points / 2
+  lastAmps := make([][]float64, numChans, numChans)
+
+  for c := 0; c < numChans; c++ {
+    lastAmps[c] = make([]float64, halfPoints + 1, halfPoints + 1)
+  }
+
+  historyLength := int(math.Ceil(frameRate * onsetHistoryLength))
+
+  if historyLength < 8 {
+    historyLength = 8
+  }
+
+  return &OnsetDetector{
+    Sensitivity: sensitivity,
+    Onsets: []float64{},
+    lastAmps: lastAmps,
+    history: make([]float64, historyLength, historyLength),
+    minimumGap: int(math.Ceil(frameRate * onsetMinimumGap)),
+    maxSampleValue: maxSampleValue,
+  }, nil
+}
+
+// computes the spectral flux of the given polar spectra (one per channel)
+// against the previous frame and saves the magnitudes for the next frame
+func (od *OnsetDetector) flux(polarSpectra [][]float64) float64 {
+  flux := 0.0
+  bins := 0
+
+  for c := 0; c < len(polarSpectra); c++ {
+    for bandNumber := 0; bandNumber < len(od.lastAmps[c]); bandNumber++ {
+      amp := math.Log1p(onsetCompression * polarSpectra[c][bandNumber * 2] / od.maxSampleValue)
+
+      if amp > od.lastAmps[c][bandNumber] {
+        flux += amp - od.lastAmps[c][bandNumber]
+      }
+
+      od.lastAmps[c][bandNumber] = amp
+      bins++
+    }
+  }
+
+  return flux / float64(bins)
+}
+
+// mean plus a sensitivity dependent number of standard deviations of the
+// flux history
+func (od *OnsetDetector) threshold() float64 {
+  count := len(od.history)
+
+  if !od.historyFilled {
+    count = od.historyIndex
+  }
+
+  if count == 0 {
+    return 0.0
+  }
+
+  mean := 0.0
+  for i := 0; i < count; i++ {
+    mean += od.history[i]
+  }
+  mean /= float64(count)
+
+  variance := 0.0
+  for i := 0; i < count; i++ {
+    variance += (od.history[i] - mean) * (od.history[i] - mean)
+  }
+  variance /= float64(count)
+
+  deviations := 0.5 + 4.0 * (1.0 - od.Sensitivity)
+
+  return mean + deviations * math.Sqrt(variance)
+}
+
+// Detect takes the polar spectra for all channels of one analysis frame and
+// the time (in seconds) the frame represents. It returns true while
+// the frame is part of a transient: from the moment the flux crosses the
+// threshold until the flux peaks. The time of the peak is appended to Onsets.
+func (od *OnsetDetector) Detect(polarSpectra [][]float64, time float64) bool {
+  flux := od.flux(polarSpectra)
+  threshold := od.threshold()
+
+  od.history[od.historyIndex] = flux
+  od.historyIndex++
+  if od.historyIndex == len(od.history) {
+    od.historyIndex = 0
+    od.historyFilled = true
+  }
+
+  lastFlux := od.lastFlux
+  od.lastFlux = flux
+
+  if od.holdOff > 0 {
+    od.holdOff--
+  }
+
+  if od.rising {
+    if flux >= lastFlux {
+      od.risingTime = time
+      return true
+    }
+
+    // flux has peaked, the previous frame was the onset
+    od.rising = false
+    od.Onsets = append(od.Onsets, od.risingTime)
+    od.holdOff = od.minimumGap
+    return false
+  }
+
+  if od.holdOff == 0 && flux > threshold && flux > lastFlux {
+    od.rising = true
+    od.risingTime = time
+    return true
+  }
+
+  return false
+}
+
+// writes the detected onset times, one per line, in seconds
+func (od *OnsetDetector) WriteOnsets(writer io.Writer) error {
+  for _, onset := range od.Onsets {
+    if _, err := fmt.Fprintf(writer, "%.6f\n", onset); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
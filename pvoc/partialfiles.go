@@ -0,0 +1,522 @@
+package pvoc
+
+import(
+  "bufio"
+  "bytes"
+  "encoding/binary"
+  "encoding/csv"
+  "encoding/json"
+  "fmt"
+  "io"
+  "math"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+)
+
+// Partial file formats
+const PartialsSDIF = "sdif"
+const PartialsJSON = "json"
+const PartialsCSV = "csv"
+
+var PartialFormats = []string{
+  PartialsSDIF,
+  PartialsJSON,
+  PartialsCSV,
+}
+
+func PartialFormatsString() string {
+  return strings.Join(PartialFormats, ", ")
+}
+
+// the partial file format for a path, from its extension
+func PartialFormat(path string) (string, error) {
+  extension := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+
+  for _, format := range PartialFormats {
+    if format == extension {
+      return format, nil
+    }
+  }
+
+  return "", fmt.Errorf("Partial files must have one of the extensions: %s, got %s", PartialFormatsString(), path)
+}
+
+type partialsJSON struct {
+  SampleRate int `json:"sampleRate"`
+  Partials []*Partial `json:"partials"`
+}
+
+// WritePartials writes the partials to path, the format is chosen by the
+// file extension. sampleRate is kept in the JSON and SDIF files so the
+// partials can be resynthesized at the rate they were analyzed at.
+func WritePartials(path string, partials []*Partial, sampleRate int) error {
+  format, err := PartialFormat(path)
+
+  if err != nil {
+    return err
+  }
+
+  file, err := os.Create(path)
+
+  if err != nil {
+    return err
+  }
+
+  defer file.Close()
+
+  writer := bufio.NewWriter(file)
+
+  switch format {
+  case PartialsSDIF:
+    err = WritePartialsSDIF(writer, partials, sampleRate)
+  case PartialsJSON:
+    err = WritePartialsJSON(writer, partials, sampleRate)
+  case PartialsCSV:
+    err = WritePartialsCSV(writer, partials)
+  }
+
+  if err != nil {
+    return err
+  }
+
+  return writer.Flush()
+}
+
+// ReadPartials reads a partial file written by WritePartials (or edited by
+// hand). The sample rate is 0 if the file doesn't have one.
+func ReadPartials(path string) ([]*Partial, int, error) {
+  format, err := PartialFormat(path)
+
+  if err != nil {
+    return nil, 0, err
+  }
+
+  file, err := os.Open(path)
+
+  if err != nil {
+    return nil, 0, err
+  }
+
+  defer file.Close()
+
+  reader := bufio.NewReader(file)
+
+  switch format {
+  case PartialsSDIF:
+    return ReadPartialsSDIF(reader)
+  case PartialsJSON:
+    return ReadPartialsJSON(reader)
+  }
+
+  partials, err := ReadPartialsCSV(reader)
+
+  return partials, 0, err
+}
+
+func WritePartialsJSON(writer io.Writer, partials []*Partial, sampleRate int) error {
+  encoder := json.NewEncoder(writer)
+  encoder.SetIndent("", "  ")
+
+  return encoder.Encode(partialsJSON{
+    SampleRate: sampleRate,
+    Partials: partials,
+  })
+}
+
+func ReadPartialsJSON(reader io.Reader) ([]*Partial, int, error) {
+  data := partialsJSON{}
+
+  if err := json.NewDecoder(reader).Decode(&data); err != nil {
+    return nil, 0, err
+  }
+
+  partials := []*Partial{}
+
+  for _, partial := range data.Partials {
+    if partial != nil && len(partial.Frames) > 0 {
+      partials = append(partials, partial)
+    }
+  }
+
+  return partials, data.SampleRate, nil
+}
+
+var partialsCSVHeader = []string{"partial", "channel", "time", "frequency", "amplitude", "phase"}
+
+// one row per breakpoint, partials can be edited by changing their rows
+func WritePartialsCSV(writer io.Writer, partials []*Partial) error {
+  csvWriter := csv.NewWriter(writer)
+
+  if err := csvWriter.Write(partialsCSVHeader); err != nil {
+    return err
+  }
+
+  format := func(value float64) string {
+    return strconv.FormatFloat(value, 'g', -1, 64)
+  }
+
+  for _, partial := range partials {
+    for _, frame := range partial.Frames {
+      err := csvWriter.Write([]string{
+        strconv.Itoa(partial.ID),
+        strconv.Itoa(partial.Channel),
+        format(frame.Time),
+        format(frame.Frequency),
+        format(frame.Amplitude),
+        format(frame.Phase),
+      })
+
+      if err != nil {
+        return err
+      }
+    }
+  }
+
+  csvWriter.Flush()
+
+  return csvWriter.Error()
+}
+
+func ReadPartialsCSV(reader io.Reader) ([]*Partial, error) {
+  csvReader := csv.NewReader(reader)
+
+  header, err := csvReader.Read()
+
+  if err != nil {
+    return nil, err
+  }
+
+  if strings.Join(header, ",") != strings.Join(partialsCSVHeader, ",") {
+    return nil, fmt.Errorf("Partial CSV header must be %s, got %s", strings.Join(partialsCSVHeader, ","), strings.Join(header, ","))
+  }
+
+  byID := map[int]*Partial{}
+  partials := []*Partial{}
+
+  for line := 2; ; line++ {
+    record, err := csvReader.Read()
+
+    if err == io.EOF {
+      break
+    }
+
+    if err != nil {
+      return nil, err
+    }
+
+    values := make([]float64, len(record), len(record))
+
+    for i, field := range record {
+      if values[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+        return nil, fmt.Errorf("Partial CSV line %d, %s: %s is not a number", line, partialsCSVHeader[i], field)
+      }
+    }
+
+    id := int(values[0])
+    partial := byID[id]
+
+    if partial == nil {
+      partial = &Partial{ID: id, Channel: int(values[1])}
+      byID[id] = partial
+      partials = append(partials, partial)
+    }
+
+    partial.Frames = append(partial.Frames, PartialFrame{
+      Time: values[2],
+      Frequency: values[3],
+      Amplitude: values[4],
+      Phase: values[5],
+    })
+  }
+
+  for _, partial := range partials {
+    sortPartialFrames(partial)
+  }
+
+  SortPartials(partials)
+
+  return partials, nil
+}
+
+func sortPartialFrames(partial *Partial) {
+  sort.SliceStable(partial.Frames, func(i, j int) bool {
+    return partial.Frames[i].Time < partial.Frames[j].Time
+  })
+}
+
+// SDIF (Sound Description Interchange Format) constants, all SDIF data is
+// big endian and padded to 8 bytes
+const sdifVersion = 3
+const sdifTypesVersion = 1
+const sdifFloat32 = 0x0004
+const sdifFloat64 = 0x0008
+const sdifTrackColumns = 4 // Index, Frequency, Amplitude, Phase
+
+func sdifPadding(size int) int {
+  return (8 - size % 8) % 8
+}
+
+// WritePartialsSDIF writes one 1TRC frame per analysis time and channel (the
+// channel is the SDIF stream ID), each with a 1TRC matrix of the partials
+// sounding at that time. The sample rate is kept in a name-value table.
+func WritePartialsSDIF(writer io.Writer, partials []*Partial, sampleRate int) error {
+  buffer := &bytes.Buffer{}
+
+  write := func(values ...interface{}) {
+    for _, value := range values {
+      binary.Write(buffer, binary.BigEndian, value)
+    }
+  }
+
+  // file header
+  buffer.WriteString("SDIF")
+  write(int32(8), int32(sdifVersion), int32(sdifTypesVersion))
+
+  // name-value table
+  table := fmt.Sprintf("{\n  SampleRate\t%d;\n}\n", sampleRate)
+  table += strings.Repeat("\x00", sdifPadding(len(table)))
+  buffer.WriteString("1NVT")
+  write(int32(len(table)))
+  buffer.WriteString(table)
+
+  type sdifKey struct {
+    time float64
+    stream int
+  }
+
+  rows := map[sdifKey][][sdifTrackColumns]float64{}
+  keys := []sdifKey{}
+
+  for _, partial := range partials {
+    for _, frame := range partial.Frames {
+      key := sdifKey{frame.Time, partial.Channel}
+
+      if _, ok := rows[key]; !ok {
+        keys = append(keys, key)
+      }
+
+      rows[key] = append(rows[key], [sdifTrackColumns]float64{
+        float64(partial.ID),
+        frame.Frequency,
+        frame.Amplitude,
+        frame.Phase,
+      })
+    }
+  }
+
+  sort.SliceStable(keys, func(i, j int) bool {
+    if keys[i].time != keys[j].time {
+      return keys[i].time < keys[j].time
+    }
+
+    return keys[i].stream < keys[j].stream
+  })
+
+  for _, key := range keys {
+    matrix := rows[key]
+    matrixSize := 16 + len(matrix) * sdifTrackColumns * 8
+
+    // frame header, the size counts everything after itself
+    buffer.WriteString("1TRC")
+    write(int32(16 + matrixSize), key.time, int32(key.stream), int32(1))
+
+    // matrix header
+    buffer.WriteString("1TRC")
+    write(int32(sdifFloat64), int32(len(matrix)), int32(sdifTrackColumns))
+
+    for _, row := range matrix {
+      write(row)
+    }
+
+    if _, err := writer.Write(buffer.Bytes()); err != nil {
+      return err
+    }
+
+    buffer.Reset()
+  }
+
+  _, err := writer.Write(buffer.Bytes())
+
+  return err
+}
+
+// ReadPartialsSDIF reads the 1TRC matrices of an SDIF file, other frame and
+// matrix types are skipped. Rows are joined into partials by stream and index.
+func ReadPartialsSDIF(reader io.Reader) ([]*Partial, int, error) {
+  read := func(value interface{}) error {
+    return binary.Read(reader, binary.BigEndian, value)
+  }
+
+  skip := func(size int) error {
+    _, err := io.CopyN(io.Discard, reader, int64(size))
+    return err
+  }
+
+  signature := make([]byte, 4, 4)
+
+  if _, err := io.ReadFull(reader, signature); err != nil || string(signature) != "SDIF" {
+    return nil, 0, fmt.Errorf("Not an SDIF file")
+  }
+
+  var headerSize int32
+  if err := read(&headerSize); err != nil {
+    return nil, 0, err
+  }
+
+  if err := skip(int(headerSize)); err != nil {
+    return nil, 0, err
+  }
+
+  type partialKey struct {
+    stream int32
+    index int
+  }
+
+  byKey := map[partialKey]*Partial{}
+  partials := []*Partial{}
+  sampleRate := 0
+
+  for {
+    if _, err := io.ReadFull(reader, signature); err == io.EOF {
+      break
+    } else if err != nil {
+      return nil, 0, err
+    }
+
+    var size int32
+    if err := read(&size); err != nil {
+      return nil, 0, err
+    }
+
+    // ASCII chunks following the header
+    if string(signature) == "1NVT" || string(signature) == "1TYP" || string(signature) == "1IDS" {
+      text := make([]byte, size, size)
+
+      if _, err := io.ReadFull(reader, text); err != nil {
+        return nil, 0, err
+      }
+
+      if string(signature) == "1NVT" {
+        for _, entry := range strings.Split(string(text), ";") {
+          fields := strings.Fields(strings.Trim(entry, "{}\x00 \n\t"))
+
+          if len(fields) == 2 && fields[0] == "SampleRate" {
+            sampleRate, _ = strconv.Atoi(fields[1])
+          }
+        }
+      }
+
+      continue
+    }
+
+    var time float64
+    var stream, matrixCount int32
+
+    if err := read(&time); err != nil {
+      return nil, 0, err
+    }
+
+    if err := read(&stream); err != nil {
+      return nil, 0, err
+    }
+
+    if err := read(&matrixCount); err != nil {
+      return nil, 0, err
+    }
+
+    remaining := int(size) - 16
+
+    if string(signature) != "1TRC" {
+      if err := skip(remaining); err != nil {
+        return nil, 0, err
+      }
+      continue
+    }
+
+    for m := int32(0); m < matrixCount; m++ {
+      matrixSignature := make([]byte, 4, 4)
+      var dataType, rowCount, columnCount int32
+
+      if _, err := io.ReadFull(reader, matrixSignature); err != nil {
+        return nil, 0, err
+      }
+
+      for _, value := range []*int32{&dataType, &rowCount, &columnCount} {
+        if err := read(value); err != nil {
+          return nil, 0, err
+        }
+      }
+
+      elementSize := int(dataType & 0xff)
+      dataSize := int(rowCount * columnCount) * elementSize
+      dataSize += sdifPadding(dataSize)
+      remaining -= 16 + dataSize
+
+      if string(matrixSignature) != "1TRC" || columnCount < sdifTrackColumns ||
+        (dataType != sdifFloat32 && dataType != sdifFloat64) {
+        if err := skip(dataSize); err != nil {
+          return nil, 0, err
+        }
+        continue
+      }
+
+      values := make([]float64, rowCount * columnCount, rowCount * columnCount)
+
+      if dataType == sdifFloat64 {
+        if err := read(values); err != nil {
+          return nil, 0, err
+        }
+      } else {
+        values32 := make([]float32, len(values), len(values))
+
+        if err := read(values32); err != nil {
+          return nil, 0, err
+        }
+
+        for i, value := range values32 {
+          values[i] = float64(value)
+        }
+      }
+
+      if err := skip(dataSize - len(values) * elementSize); err != nil {
+        return nil, 0, err
+      }
+
+      for row := 0; row < int(rowCount); row++ {
+        columns := values[row * int(columnCount):]
+        key := partialKey{stream, int(math.Round(columns[0]))}
+        partial := byKey[key]
+
+        if partial == nil {
+          partial = &Partial{ID: key.index, Channel: int(stream)}
+          byKey[key] = partial
+          partials = append(partials, partial)
+        }
+
+        partial.Frames = append(partial.Frames, PartialFrame{
+          Time: time,
+          Frequency: columns[1],
+          Amplitude: columns[2],
+          Phase: columns[3],
+        })
+      }
+    }
+
+    if remaining > 0 {
+      if err := skip(remaining); err != nil {
+        return nil, 0, err
+      }
+    }
+  }
+
+  for _, partial := range partials {
+    sortPartialFrames(partial)
+  }
+
+  SortPartials(partials)
+
+  return partials, sampleRate, nil
+}
@@ -0,0 +1,363 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+  "sort"
+)
+
+// PartialFrame is one breakpoint of a partial
+type PartialFrame struct {
+  Time float64 `json:"time"` // seconds
+  Frequency float64 `json:"frequency"` // Hz
+  Amplitude float64 `json:"amplitude"` // linear, 1.0 is full scale
+  Phase float64 `json:"phase"` // radians, at Time
+}
+
+// Partial is a sinusoidal track. Pitch and Delay are resynthesis edits: the
+// frequencies are multiplied by Pitch (0 leaves them alone) and Delay seconds
+// are added to the times after time scaling.
+type Partial struct {
+  ID int `json:"id"`
+  Channel int `json:"channel"`
+  Pitch float64 `json:"pitch,omitempty"`
+  Delay float64 `json:"delay,omitempty"`
+  Frames []PartialFrame `json:"frames"`
+}
+
+func (p *Partial) Birth() float64 {
+  return p.Frames[0].Time
+}
+
+func (p *Partial) Death() float64 {
+  return p.Frames[len(p.Frames) - 1].Time
+}
+
+// PartialTracker links the spectral peaks of a Spectrogram into partials
+// (McAulay and Quatieri, "Speech Analysis/Synthesis Based on a Sinusoidal
+// Representation", 1986). Each frame's peaks continue the partial of the
+// previous frame closest in frequency, a partial dies when no peak is close
+// enough and a peak no partial continues starts a new one.
+type PartialTracker struct {
+  ThresholdDb float64 // peaks below this (dBFS) are ignored
+  MaxDeviation float64 // cents a partial may move from one frame to the next
+  MinLength float64 // seconds, shorter partials are dropped
+  MaxPeaks int // loudest peaks kept per frame, 0 keeps all of them
+}
+
+func NewPartialTracker(thresholdDb, maxDeviation, minLength float64, maxPeaks int) (*PartialTracker, error) {
+  if thresholdDb > 0 {
+    return nil, fmt.Errorf("Partial threshold must be less than 0, got %f", thresholdDb)
+  }
+
+  if maxDeviation <= 0 {
+    return nil, fmt.Errorf("Partial frequency deviation must be greater than 0, got %f", maxDeviation)
+  }
+
+  if minLength < 0 {
+    return nil, fmt.Errorf("Minimum partial length cannot be negative, got %f", minLength)
+  }
+
+  if maxPeaks < 0 {
+    return nil, fmt.Errorf("Maximum number of peaks cannot be negative, got %d", maxPeaks)
+  }
+
+  return &PartialTracker{
+    ThresholdDb: thresholdDb,
+    MaxDeviation: maxDeviation,
+    MinLength: minLength,
+    MaxPeaks: maxPeaks,
+  }, nil
+}
+
+type spectralPeak struct {
+  bandNumber int
+  frame PartialFrame
+}
+
+// returns the peaks of a Spectrogram frame above the threshold,
+// loudest first. The amplitude is refined by parabolic interpolation of the
+// log magnitudes around the peak band, the frequency is the band's
+// instantaneous frequency.
+func (pt *PartialTracker) peaks(spectrogram *Spectrogram, channel, frame int) []spectralPeak {
+  halfPoints := spectrogram.Points / 2
+  polarSpectrum := spectrogram.Frames[channel][frame]
+  regions := make([]int, halfPoints + 1, halfPoints + 1)
+
+  threshold := math.Pow(10.0, pt.ThresholdDb / 20.0) * spectrogram.MaxSampleValue()
+  peaks := []spectralPeak{}
+
+  for _, bandNumber := range FindPeaks(polarSpectrum, regions, halfPoints + 1) {
+    if bandNumber < 1 || bandNumber >= halfPoints || polarSpectrum[bandNumber * 2] < threshold {
+      continue
+    }
+
+    left := math.Log(math.Max(polarSpectrum[bandNumber * 2 - 2], 1e-12))
+    center := math.Log(polarSpectrum[bandNumber * 2])
+    right := math.Log(math.Max(polarSpectrum[bandNumber * 2 + 2], 1e-12))
+
+    offset := 0.0
+    if denominator := left - 2.0 * center + right; denominator < 0 {
+      offset = 0.5 * (left - right) / denominator
+    }
+
+    amplitude := math.Exp(center - 0.25 * (left - right) * offset)
+
+    frequency := spectrogram.InstantaneousFrequency(channel, frame, bandNumber)
+    if frame == 0 {
+      frequency = (float64(bandNumber) + offset) * float64(spectrogram.SampleRate) / float64(spectrogram.Points)
+    }
+
+    if frequency <= 0 {
+      continue
+    }
+
+    peaks = append(peaks, spectralPeak{
+      bandNumber: bandNumber,
+      frame: PartialFrame{
+        Time: spectrogram.FrameTime(frame),
+        Frequency: frequency,
+        Amplitude: amplitude / spectrogram.MaxSampleValue(),
+        Phase: spectrogram.CenterPhase(channel, frame, bandNumber),
+      },
+    })
+  }
+
+  sort.SliceStable(peaks, func(i, j int) bool {
+    return peaks[i].frame.Amplitude > peaks[j].frame.Amplitude
+  })
+
+  if pt.MaxPeaks > 0 && len(peaks) > pt.MaxPeaks {
+    peaks = peaks[:pt.MaxPeaks]
+  }
+
+  return peaks
+}
+
+// Track returns the partials of every channel of the spectrogram, ordered by
+// birth and numbered from 1
+func (pt *PartialTracker) Track(spectrogram *Spectrogram) []*Partial {
+  partials := []*Partial{}
+
+  for c := 0; c < spectrogram.NumChans; c++ {
+    active := []*Partial{}
+
+    for frame := 0; frame < spectrogram.NumFrames(); frame++ {
+      peaks := pt.peaks(spectrogram, c, frame)
+
+      // every partial/peak pair close enough in frequency, closest first
+      type candidate struct {
+        partial int
+        peak int
+        cents float64
+      }
+
+      candidates := []candidate{}
+
+      for i, partial := range active {
+        last := partial.Frames[len(partial.Frames) - 1].Frequency
+
+        for j, peak := range peaks {
+          cents := math.Abs(1200.0 * math.Log2(peak.frame.Frequency / last))
+
+          if cents <= pt.MaxDeviation {
+            candidates = append(candidates, candidate{i, j, cents})
+          }
+        }
+      }
+
+      sort.SliceStable(candidates, func(i, j int) bool {
+        return candidates[i].cents < candidates[j].cents
+      })
+
+      continued := make([]bool, len(active), len(active))
+      taken := make([]bool, len(peaks), len(peaks))
+
+      for _, match := range candidates {
+        if continued[match.partial] || taken[match.peak] {
+          continue
+        }
+
+        continued[match.partial] = true
+        taken[match.peak] = true
+        active[match.partial].Frames = append(active[match.partial].Frames, peaks[match.peak].frame)
+      }
+
+      stillActive := []*Partial{}
+
+      for i, partial := range active {
+        if continued[i] {
+          stillActive = append(stillActive, partial)
+        } else {
+          partials = append(partials, partial)
+        }
+      }
+
+      for j, peak := range peaks {
+        if !taken[j] {
+          stillActive = append(stillActive, &Partial{
+            Channel: c,
+            Frames: []PartialFrame{peak.frame},
+          })
+        }
+      }
+
+      active = stillActive
+    }
+
+    partials = append(partials, active...)
+  }
+
+  kept := []*Partial{}
+
+  for _, partial := range partials {
+    if partial.Death() - partial.Birth() >= pt.MinLength {
+      kept = append(kept, partial)
+    }
+  }
+
+  SortPartials(kept)
+
+  for i, partial := range kept {
+    partial.ID = i + 1
+  }
+
+  return kept
+}
+
+// orders partials by birth, then channel, then ID
+func SortPartials(partials []*Partial) {
+  sort.SliceStable(partials, func(i, j int) bool {
+    if partials[i].Birth() != partials[j].Birth() {
+      return partials[i].Birth() < partials[j].Birth()
+    }
+
+    if partials[i].Channel != partials[j].Channel {
+      return partials[i].Channel < partials[j].Channel
+    }
+
+    return partials[i].ID < partials[j].ID
+  })
+}
+
+// SynthesizePartials renders the partials with an oscillator per partial,
+// interpolating amplitude and frequency linearly between breakpoints. Each
+// partial starts at the phase of its first breakpoint and fades in and out
+// over the time between its first two breakpoints. Times are multiplied by
+// timeScale and frequencies by pitchScale, on top of each partial's own
+// Pitch and Delay. Partials above the Nyquist frequency are skipped. Returns
+// one signal per channel, amplitudes scaled by maxSampleValue.
+func SynthesizePartials(
+  partials []*Partial,
+  numChans,
+  sampleRate int,
+  timeScale,
+  pitchScale,
+  maxSampleValue float64,
+) ([][]float64, error) {
+  if timeScale <= 0 {
+    return nil, fmt.Errorf("Time scale must be greater than 0, got %f", timeScale)
+  }
+
+  if pitchScale <= 0 {
+    return nil, fmt.Errorf("Pitch scale must be greater than 0, got %f", pitchScale)
+  }
+
+  sr := float64(sampleRate)
+  defaultFade := 0.005
+
+  type breakpoint struct {
+    sample float64
+    omega float64 // radians per sample
+    amplitude float64
+  }
+
+  renders := make([][]breakpoint, len(partials), len(partials))
+  fades := make([]float64, len(partials), len(partials))
+  length := 0
+
+  for i, partial := range partials {
+    if partial.Channel < 0 || partial.Channel >= numChans {
+      return nil, fmt.Errorf("Partial %d is on channel %d, only %d channels", partial.ID, partial.Channel, numChans)
+    }
+
+    if len(partial.Frames) == 0 {
+      continue
+    }
+
+    pitch := pitchScale
+    if partial.Pitch != 0 {
+      pitch *= partial.Pitch
+    }
+
+    for _, frame := range partial.Frames {
+      renders[i] = append(renders[i], breakpoint{
+        sample: (frame.Time * timeScale + partial.Delay) * sr,
+        omega: twoPi * frame.Frequency * pitch / sr,
+        amplitude: frame.Amplitude * maxSampleValue,
+      })
+    }
+
+    fades[i] = defaultFade * sr
+    if len(renders[i]) > 1 {
+      fades[i] = renders[i][1].sample - renders[i][0].sample
+    }
+
+    end := int(math.Ceil(renders[i][len(renders[i]) - 1].sample + fades[i])) + 1
+    if end > length {
+      length = end
+    }
+  }
+
+  signals := make([][]float64, numChans, numChans)
+  for c := 0; c < numChans; c++ {
+    signals[c] = make([]float64, length, length)
+  }
+
+  for i, partial := range partials {
+    points := renders[i]
+
+    if len(points) == 0 {
+      continue
+    }
+
+    output := signals[partial.Channel]
+
+    // fade in and out at the first and last frequency
+    first := points[0]
+    last := points[len(points) - 1]
+    points = append([]breakpoint{{first.sample - fades[i], first.omega, 0.0}}, points...)
+    points = append(points, breakpoint{last.sample + fades[i], last.omega, 0.0})
+
+    phase := partial.Frames[0].Phase - first.omega * fades[i]
+
+    for p := 0; p < len(points) - 1; p++ {
+      start := int(math.Round(points[p].sample))
+      end := int(math.Round(points[p + 1].sample))
+
+      if end <= start {
+        continue
+      }
+
+      samples := float64(end - start)
+      amplitude := points[p].amplitude
+      ampIncrement := (points[p + 1].amplitude - amplitude) / samples
+      omega := points[p].omega
+      omegaIncrement := (points[p + 1].omega - omega) / samples
+
+      for n := start; n < end; n++ {
+        if n >= 0 && n < length && omega < pi {
+          output[n] += amplitude * math.Cos(phase)
+        }
+
+        phase += omega
+        amplitude += ampIncrement
+        omega += omegaIncrement
+      }
+
+      phase = math.Mod(phase, twoPi)
+    }
+  }
+
+  return signals, nil
+}
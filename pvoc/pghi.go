@@ -0,0 +1,212 @@
+package pvoc
+
+import(
+  "container/heap"
+  "math"
+  "math/rand"
+  "strings"
+)
+
+// Phase reconstruction methods for TimeStretch
+const PhaseClassic = "classic"
+const PhasePGHI = "pghi"
+const PhaseGriffinLim = "griffinlim"
+
+var PhaseReconstructions = []string{
+  PhaseClassic,
+  PhasePGHI,
+  PhaseGriffinLim,
+}
+
+func PhaseReconstructionsString() string {
+  return strings.Join(PhaseReconstructions, ", ")
+}
+
+// bands more than this far below the loudest band of a frame (relative
+// amplitude) are not integrated, they get a random phase instead
+const pghiTolerance = 1e-5
+
+// a band waiting in the heap, either from the previous frame or the current
+type pghiBand struct {
+  amplitude float64
+  bandNumber int
+  previous bool
+}
+
+type pghiHeap []pghiBand
+
+func (h pghiHeap) Len() int { return len(h) }
+func (h pghiHeap) Less(i, j int) bool { return h[i].amplitude > h[j].amplitude }
+func (h pghiHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pghiHeap) Push(x interface{}) {
+  *h = append(*h, x.(pghiBand))
+}
+
+func (h *pghiHeap) Pop() interface{} {
+  old := *h
+  band := old[len(old) - 1]
+  *h = old[:len(old) - 1]
+  return band
+}
+
+// PhaseGradientHeap is an alternative to PhaseInterpolate implementing the
+// real-time variant of Phase Gradient Heap Integration (Prusa, Balazs and
+// Sondergaard, "A Noniterative Method for Reconstruction of Phase From
+// STFT Magnitude", 2017). The time direction phase gradient (instantaneous
+// frequency) and the frequency direction phase gradient (local group delay)
+// are taken from the analysis phases, the output phases are then
+// integrated along whichever direction the loudest already known neighbor
+// lies in, starting from the loudest bands. This keeps the vertical phase
+// coherence that the band-by-band accumulation of PhaseInterpolate loses.
+type PhaseGradientHeap struct {
+  lastAmps []float64
+  lastFrequencies []float64 // radians per sample, from the band's center
+  frequencies []float64
+  phases []float64
+  done []bool
+  heap pghiHeap
+  random *rand.Rand
+  frames int
+}
+
+func NewPhaseGradientHeap(points int) *PhaseGradientHeap {
+  bands := points / 2 + 1
+
+  return &PhaseGradientHeap{
+    lastAmps: make([]float64, bands, bands),
+    lastFrequencies: make([]float64, bands, bands),
+    frequencies: make([]float64, bands, bands),
+    phases: make([]float64, bands, bands),
+    done: make([]bool, bands, bands),
+    heap: make(pghiHeap, 0, bands * 2),
+    random: rand.New(rand.NewSource(1)),
+  }
+}
+
+// Interpolate replaces the phases of polarSpectrum, analyzed at inPointer
+// with a hop of decimation, for overlap-add at outPointer with a hop of
+// interpolation
+func (pg *PhaseGradientHeap) Interpolate(
+  polarSpectrum,
+  lastPhaseIn,
+  lastPhaseOut []float64,
+  points,
+  decimation,
+  interpolation,
+  inPointer,
+  outPointer int,
+) {
+  halfPoints := points / 2
+
+  maxAmplitude := 0.0
+  maxLastAmplitude := 0.0
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    maxAmplitude = math.Max(maxAmplitude, polarSpectrum[bandNumber * 2])
+    maxLastAmplitude = math.Max(maxLastAmplitude, pg.lastAmps[bandNumber])
+  }
+
+  tolerance := maxAmplitude * pghiTolerance
+  lastTolerance := maxLastAmplitude * pghiTolerance
+
+  // the analysis phases are relative to inPointer, the output ones to
+  // outPointer: moving the frame adds a linear phase across the bands
+  shift := (outPointer - inPointer) % points
+  shiftGradient := twoPi * float64(shift) / float64(points)
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    phase := polarSpectrum[bandNumber * 2 + 1]
+
+    // time direction: the analysis phases are relative to the absolute
+    // input time, so their difference is the deviation of the
+    // instantaneous frequency from the band's center, and so are the
+    // output phases
+    pg.frequencies[bandNumber] = princarg(phase - lastPhaseIn[bandNumber]) / float64(decimation)
+
+    pg.done[bandNumber] = polarSpectrum[bandNumber * 2] <= tolerance
+  }
+
+  // the frequencies of the first frame are measured against nothing, don't
+  // average them into the second frame's time integration
+  if pg.frames < 2 {
+    copy(pg.lastFrequencies, pg.frequencies)
+  }
+  pg.frames++
+
+  pg.heap = pg.heap[:0]
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    if pg.lastAmps[bandNumber] > lastTolerance {
+      pg.heap = append(pg.heap, pghiBand{pg.lastAmps[bandNumber], bandNumber, true})
+    }
+  }
+
+  heap.Init(&pg.heap)
+
+  for {
+    if pg.heap.Len() == 0 {
+      // start a new island of integration at the loudest band left, with
+      // its analysis phase moved to the output time
+      loudest := -1
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        if !pg.done[bandNumber] && (loudest < 0 || polarSpectrum[bandNumber * 2] > polarSpectrum[loudest * 2]) {
+          loudest = bandNumber
+        }
+      }
+
+      if loudest < 0 {
+        break
+      }
+
+      pg.phases[loudest] = princarg(polarSpectrum[loudest * 2 + 1] - float64(loudest) * shiftGradient)
+      pg.done[loudest] = true
+      heap.Push(&pg.heap, pghiBand{polarSpectrum[loudest * 2], loudest, false})
+      continue
+    }
+
+    band := heap.Pop(&pg.heap).(pghiBand)
+    bandNumber := band.bandNumber
+
+    if band.previous {
+      // integrate in time, from the previous frame to this one
+      if !pg.done[bandNumber] {
+        frequency := (pg.lastFrequencies[bandNumber] + pg.frequencies[bandNumber]) / 2.0
+        pg.phases[bandNumber] = princarg(lastPhaseOut[bandNumber] + frequency * float64(interpolation))
+        pg.done[bandNumber] = true
+        heap.Push(&pg.heap, pghiBand{polarSpectrum[bandNumber * 2], bandNumber, false})
+      }
+      continue
+    }
+
+    // integrate in frequency, to the bands on either side, using the
+    // analysis phase difference between the two bands
+    for _, neighbor := range [2]int{bandNumber - 1, bandNumber + 1} {
+      if neighbor < 0 || neighbor > halfPoints || pg.done[neighbor] {
+        continue
+      }
+
+      difference := princarg(polarSpectrum[neighbor * 2 + 1] - polarSpectrum[bandNumber * 2 + 1])
+      pg.phases[neighbor] = princarg(pg.phases[bandNumber] + difference - float64(neighbor - bandNumber) * shiftGradient)
+      pg.done[neighbor] = true
+      heap.Push(&pg.heap, pghiBand{polarSpectrum[neighbor * 2], neighbor, false})
+    }
+  }
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    ampIndex := bandNumber * 2
+    phaseIndex := ampIndex + 1
+
+    // too quiet to integrate
+    if polarSpectrum[ampIndex] <= tolerance {
+      pg.phases[bandNumber] = (pg.random.Float64() * 2.0 - 1.0) * pi
+    }
+
+    lastPhaseIn[bandNumber] = polarSpectrum[phaseIndex]
+    pg.lastAmps[bandNumber] = polarSpectrum[ampIndex]
+    pg.lastFrequencies[bandNumber] = pg.frequencies[bandNumber]
+
+    polarSpectrum[phaseIndex] = pg.phases[bandNumber]
+    lastPhaseOut[bandNumber] = pg.phases[bandNumber]
+  }
+}
@@ -0,0 +1,317 @@
+package pvoc
+
+import(
+  "math"
+  "strings"
+)
+
+// Phase locking modes
+const PhaseLockNone = "none"
+const PhaseLockNeighbor = "neighbor"
+const PhaseLockIdentity = "identity"
+const PhaseLockScaled = "scaled"
+
+var PhaseLockModes = []string{
+  PhaseLockNone,
+  PhaseLockNeighbor,
+  PhaseLockIdentity,
+  PhaseLockScaled,
+}
+
+func PhaseLockModesString() string {
+  return strings.Join(PhaseLockModes, ", ")
+}
+
+func isPhaseLockMode(mode string) bool {
+  for _, lockMode := range PhaseLockModes {
+    if lockMode == mode {
+      return true
+    }
+  }
+
+  return false
+}
+
+// wraps a phase into -pi to pi
+func princarg(phase float64) float64 {
+  return phase - twoPi * math.Floor((phase + pi) / twoPi)
+}
+
+// FindPeaks finds the spectral peaks of the first numberBands bands of the
+// polar spectrum: a band is a peak if its amplitude is larger than the two
+// bands on either side of it. regions is filled with the band number of the
+// peak whose region of influence each band belongs to, the boundary between
+// two peaks is the band with the lowest amplitude between them. If there
+// are no peaks, every band is its own region.
+func FindPeaks(polarSpectrum []float64, regions []int, numberBands int) (peaks []int) {
+  amp := func(bandNumber int) float64 {
+    if bandNumber < 0 || bandNumber >= numberBands {
+      return 0.0
+    }
+    return polarSpectrum[bandNumber * 2]
+  }
+
+  for bandNumber := 0; bandNumber < numberBands; bandNumber++ {
+    current := amp(bandNumber)
+
+    if current > 0.0 &&
+      current > amp(bandNumber - 1) &&
+      current > amp(bandNumber - 2) &&
+      current >= amp(bandNumber + 1) &&
+      current >= amp(bandNumber + 2) {
+      peaks = append(peaks, bandNumber)
+    }
+  }
+
+  if len(peaks) == 0 {
+    for bandNumber := 0; bandNumber < numberBands; bandNumber++ {
+      regions[bandNumber] = bandNumber
+    }
+    return peaks
+  }
+
+  bandNumber := 0
+  for i, peak := range peaks {
+    // the region ends at the trough before the next peak
+    end := numberBands
+
+    if i < len(peaks) - 1 {
+      end = peak + 1
+      for trough := peak + 1; trough < peaks[i + 1]; trough++ {
+        if amp(trough) < amp(end) {
+          end = trough
+        }
+      }
+    }
+
+    for ; bandNumber < end; bandNumber++ {
+      regions[bandNumber] = peak
+    }
+  }
+
+  return peaks
+}
+
+// PhaseLocker implements the peak-picking identity and scaled phase locking
+// of Laroche and Dolson ("Improved Phase Vocoder Time-Scale Modification of
+// Audio", 1999): only the phases of the spectral peaks are propagated, every
+// other band in a peak's region of influence is rotated by the same amount
+// as its peak, keeping the phase relationships of the analysis intact.
+// For pitch shifting the same regions lock the oscillator bank frequencies.
+type PhaseLocker struct {
+  Mode string
+  windowSize int
+  regions []int
+  lastRegions []int
+  phases []float64
+}
+
+func NewPhaseLocker(mode string, points, windowSize int) *PhaseLocker {
+  halfPoints := points / 2
+
+  locker := &PhaseLocker{
+    Mode: mode,
+    windowSize: windowSize,
+    regions: make([]int, halfPoints + 1, halfPoints + 1),
+    lastRegions: make([]int, halfPoints + 1, halfPoints + 1),
+    phases: make([]float64, halfPoints + 1, halfPoints + 1),
+  }
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    locker.lastRegions[bandNumber] = bandNumber
+  }
+
+  return locker
+}
+
+// scaled phase locking rotates the bands around a peak by a multiple of the
+// analysis phase differences, Laroche and Dolson suggest a value in between
+// 1 (identity) and the scale factor
+func (pl *PhaseLocker) beta(scaleFactor float64) float64 {
+  if pl.Mode == PhaseLockScaled {
+    return 2.0 / 3.0 + scaleFactor / 3.0
+  }
+
+  return 1.0
+}
+
+// the phase a band's center frequency accumulates over a number of samples,
+// computed in whole bands so it stays exact for large sample counts
+func bandPhase(bandNumber, samples, points int) float64 {
+  cycles := (bandNumber * samples) % points
+
+  if cycles < 0 {
+    cycles += points
+  }
+
+  return twoPi * float64(cycles) / float64(points)
+}
+
+// Interpolate is the phase locked replacement for PhaseInterpolate, the
+// frame was analyzed at inPointer and will be overlap-added at outPointer,
+// interpolation samples after the previous frame
+func (pl *PhaseLocker) Interpolate(
+  polarSpectrum,
+  lastPhaseIn,
+  lastPhaseOut []float64,
+  points,
+  decimation,
+  interpolation,
+  inPointer,
+  outPointer int,
+) {
+  halfPoints := points / 2
+  scaleFactor := float64(interpolation) / float64(decimation)
+  beta := pl.beta(scaleFactor)
+
+  // the analysis phases are relative to the absolute input time, phase
+  // differences between bands are taken relative to the center of the
+  // analysis window (where they are flat for steady sinusoids) and then
+  // moved to the center of the synthesis window
+  inCenter := inPointer + pl.windowSize / 2
+  outCenter := outPointer + pl.windowSize / 2
+  inGradient := bandPhase(1, inCenter, points)
+  outGradient := bandPhase(1, outCenter, points)
+
+  peaks := FindPeaks(polarSpectrum, pl.regions, halfPoints + 1)
+
+  // propagate the phases of the peaks, in scaled mode a peak continues the
+  // phase of the previous frame's peak whose region it moved into
+  for _, peak := range peaks {
+    previous := peak
+
+    if pl.Mode == PhaseLockScaled {
+      previous = pl.lastRegions[peak]
+    }
+
+    // the phase advance between the window centers, less the peak band's
+    // own, is the deviation of the peak's frequency from the band's center
+    advance := polarSpectrum[peak * 2 + 1] + bandPhase(peak, inCenter, points) -
+      lastPhaseIn[previous] - bandPhase(previous, inCenter - decimation, points)
+    deviation := princarg(advance - bandPhase(peak, decimation, points))
+
+    // continue from the previous output phase at the same frequency, scaled
+    // to the synthesis hop, and reference the result to the output time
+    pl.phases[peak] = princarg(
+      lastPhaseOut[previous] + bandPhase(previous, outCenter - interpolation, points) +
+      bandPhase(peak, interpolation, points) + deviation * scaleFactor -
+      bandPhase(peak, outCenter, points),
+    )
+  }
+
+  // every other band is rotated along with its peak, when there is
+  // nothing to lock to the bands keep their last output phase
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    peak := pl.regions[bandNumber]
+
+    if len(peaks) == 0 {
+      pl.phases[bandNumber] = lastPhaseOut[bandNumber]
+    } else if peak != bandNumber {
+      bands := float64(bandNumber - peak)
+      difference := princarg(polarSpectrum[bandNumber * 2 + 1] - polarSpectrum[peak * 2 + 1] + bands * inGradient)
+      pl.phases[bandNumber] = princarg(pl.phases[peak] + beta * difference - bands * outGradient)
+    }
+  }
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    phaseIndex := bandNumber * 2 + 1
+
+    lastPhaseIn[bandNumber] = polarSpectrum[phaseIndex]
+    polarSpectrum[phaseIndex] = pl.phases[bandNumber]
+    lastPhaseOut[bandNumber] = pl.phases[bandNumber]
+  }
+
+  pl.regions, pl.lastRegions = pl.lastRegions, pl.regions
+}
+
+// saves the analysis phases of a frame, analyzed at inPointer, before
+// AddSynth converts them to instantaneous frequencies in place. The phases
+// are referenced to the center of the analysis window so that their
+// differences are those of the sinusoids.
+func (pl *PhaseLocker) savePhases(polarSpectrum []float64, numberPartials, points, inPointer int) {
+  inCenter := inPointer + pl.windowSize / 2
+
+  for bandNumber := 0; bandNumber < numberPartials; bandNumber++ {
+    pl.phases[bandNumber] = polarSpectrum[bandNumber * 2 + 1] + bandPhase(bandNumber, inCenter, points)
+  }
+}
+
+// lockFrequencies runs after AddSynth has converted the first numberPartials
+// bands to instantaneous frequencies (in sine table increments). Every band
+// takes on the frequency of the band it is locked to, in identity and scaled
+// mode the oscillator phase (sineIndex) is also realigned to the peak's
+// using the analysis phase difference.
+func (pl *PhaseLocker) lockFrequencies(
+  polarSpectrum,
+  sineIndex []float64,
+  sineTableLen float64,
+  numberPartials int,
+  scaleFactor float64,
+) {
+  if pl.Mode == PhaseLockNeighbor {
+    // same neighbor selection as PhaseInterpolate: use the frequency of the
+    // loudest of the band and its direct neighbors
+    for bandNumber := 0; bandNumber < numberPartials; bandNumber++ {
+      source := bandNumber
+      maxAmplitude := 0.0
+
+      if bandNumber > 1 {
+        maxAmplitude = polarSpectrum[bandNumber * 2 - 2]
+        source = bandNumber - 1
+      }
+
+      if polarSpectrum[bandNumber * 2] > maxAmplitude {
+        maxAmplitude = polarSpectrum[bandNumber * 2]
+        source = bandNumber
+      }
+
+      if bandNumber < numberPartials - 1 && polarSpectrum[bandNumber * 2 + 2] > maxAmplitude {
+        source = bandNumber + 1
+      }
+
+      // the saved phases are not needed in this mode, reuse them to hold
+      // the locked frequencies until all bands are done
+      pl.phases[bandNumber] = polarSpectrum[source * 2 + 1]
+    }
+
+    for bandNumber := 0; bandNumber < numberPartials; bandNumber++ {
+      if polarSpectrum[bandNumber * 2] != 0.0 {
+        polarSpectrum[bandNumber * 2 + 1] = pl.phases[bandNumber]
+      }
+    }
+
+    return
+  }
+
+  peaks := FindPeaks(polarSpectrum, pl.regions, numberPartials)
+
+  if len(peaks) == 0 {
+    return
+  }
+
+  beta := pl.beta(scaleFactor)
+  cyclesPerRadian := sineTableLen / twoPi
+
+  for bandNumber := 0; bandNumber < numberPartials; bandNumber++ {
+    peak := pl.regions[bandNumber]
+
+    if peak == bandNumber || polarSpectrum[bandNumber * 2] == 0.0 {
+      continue
+    }
+
+    polarSpectrum[bandNumber * 2 + 1] = polarSpectrum[peak * 2 + 1]
+
+    difference := princarg(pl.phases[bandNumber] - pl.phases[peak])
+    address := sineIndex[peak] + beta * difference * cyclesPerRadian
+
+    for address >= sineTableLen {
+      address -= sineTableLen
+    }
+
+    for address < 0 {
+      address += sineTableLen
+    }
+
+    sineIndex[bandNumber] = address
+  }
+}
@@ -0,0 +1,246 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+)
+
+// default range and voicing threshold of the pitch detector
+const DefaultMinPitch = 60.0
+const DefaultMaxPitch = 1000.0
+const DefaultPitchConfidence = 0.5
+
+// harmonics summed per candidate fundamental, and the weight of each
+// harmonic relative to the one below it
+const pitchHarmonics = 10
+const pitchHarmonicWeight = 0.8
+
+// candidate fundamentals are this far apart (in octaves), the best one is
+// then refined with the instantaneous frequencies of its harmonics if they
+// agree with it within half a band
+const pitchCandidateStep = 1.0 / 48.0
+
+// PitchDetector estimates the fundamental frequency of monophonic sounds
+// frame by frame with a spectral harmonic sum: every candidate between
+// MinFrequency and MaxFrequency is scored by the weighted magnitudes at its
+// first harmonics, and the best one is refined with the instantaneous
+// frequencies of its lowest harmonics. The confidence is the share of the
+// frame's energy (up to the harmonics summed) that lies on the harmonics,
+// frames below Threshold are unvoiced. Channels are summed.
+type PitchDetector struct {
+  MinFrequency float64
+  MaxFrequency float64
+  Threshold float64
+  points int
+  windowSize int
+  sampleRate int
+  decimation int
+  lastPhases [][]float64 // per channel, for the instantaneous frequencies
+  magnitudes []float64
+}
+
+func NewPitchDetector(
+  minFrequency,
+  maxFrequency,
+  threshold float64,
+  points,
+  windowSize,
+  sampleRate,
+  decimation int,
+) (*PitchDetector, error) {
+  if minFrequency <= 0 || maxFrequency <= minFrequency {
+    return nil, fmt.Errorf("Pitch range must be above 0 Hz and end above its start, got %f to %f", minFrequency, maxFrequency)
+  }
+
+  if maxFrequency >= float64(sampleRate) / 2.0 {
+    return nil, fmt.Errorf("Highest pitch must be below the Nyquist frequency (%d Hz), got %f", sampleRate / 2, maxFrequency)
+  }
+
+  if threshold < 0 || threshold > 1 {
+    return nil, fmt.Errorf("Pitch confidence threshold must be between 0 and 1, got %f", threshold)
+  }
+
+  if decimation < 1 {
+    return nil, fmt.Errorf("Decimation must be at least 1, got %d", decimation)
+  }
+
+  return &PitchDetector{
+    MinFrequency: minFrequency,
+    MaxFrequency: maxFrequency,
+    Threshold: threshold,
+    points: points,
+    windowSize: windowSize,
+    sampleRate: sampleRate,
+    decimation: decimation,
+    magnitudes: make([]float64, points / 2 + 1, points / 2 + 1),
+  }, nil
+}
+
+// the magnitude at a frequency, interpolated between the bands around it
+func (pd *PitchDetector) magnitudeAt(frequency float64) float64 {
+  position := frequency * float64(pd.points) / float64(pd.sampleRate)
+  bandNumber := int(position)
+
+  if bandNumber >= pd.points / 2 {
+    return pd.magnitudes[pd.points / 2]
+  }
+
+  fraction := position - float64(bandNumber)
+
+  return pd.magnitudes[bandNumber] * (1.0 - fraction) + pd.magnitudes[bandNumber + 1] * fraction
+}
+
+// the largest magnitude within reach bands of a frequency, and its band
+func (pd *PitchDetector) peakNear(frequency float64, reach int) (float64, int) {
+  halfPoints := pd.points / 2
+  center := int(math.Round(frequency * float64(pd.points) / float64(pd.sampleRate)))
+  peak, peakBand := 0.0, center
+
+  for bandNumber := center - reach; bandNumber <= center + reach; bandNumber++ {
+    if bandNumber < 0 || bandNumber > halfPoints {
+      continue
+    }
+
+    if pd.magnitudes[bandNumber] > peak {
+      peak = pd.magnitudes[bandNumber]
+      peakBand = bandNumber
+    }
+  }
+
+  return peak, peakBand
+}
+
+// Detect estimates the fundamental of a frame from the polar spectra of all
+// channels, analyzed every decimation samples with phases referenced to the
+// input time. It returns 0 Hz for unvoiced frames. Frames must be passed in
+// order, the phases are kept for the next one.
+func (pd *PitchDetector) Detect(polarSpectra [][]float64) (frequency, confidence float64) {
+  halfPoints := pd.points / 2
+  bandWidth := float64(pd.sampleRate) / float64(pd.points)
+
+  firstFrame := len(pd.lastPhases) != len(polarSpectra)
+  if firstFrame {
+    pd.lastPhases = make([][]float64, len(polarSpectra), len(polarSpectra))
+
+    for c := range pd.lastPhases {
+      pd.lastPhases[c] = make([]float64, halfPoints + 1, halfPoints + 1)
+    }
+  }
+
+  // keeps the phases for the next frame whatever the outcome
+  defer func() {
+    for c, polarSpectrum := range polarSpectra {
+      for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+        pd.lastPhases[c][bandNumber] = polarSpectrum[bandNumber * 2 + 1]
+      }
+    }
+  }()
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    pd.magnitudes[bandNumber] = 0.0
+
+    for _, polarSpectrum := range polarSpectra {
+      pd.magnitudes[bandNumber] += polarSpectrum[bandNumber * 2]
+    }
+  }
+
+  best, bestSalience := 0.0, 0.0
+
+  for candidate := pd.MinFrequency; candidate <= pd.MaxFrequency; candidate *= math.Pow(2.0, pitchCandidateStep) {
+    salience := 0.0
+    weight := 1.0
+
+    for harmonic := 1; harmonic <= pitchHarmonics; harmonic++ {
+      if candidate * float64(harmonic) >= float64(pd.sampleRate) / 2.0 {
+        break
+      }
+
+      salience += weight * pd.magnitudeAt(candidate * float64(harmonic))
+      weight *= pitchHarmonicWeight
+    }
+
+    if salience > bestSalience {
+      best, bestSalience = candidate, salience
+    }
+  }
+
+  if bestSalience == 0.0 {
+    return 0.0, 0.0
+  }
+
+  // a harmonic's main lobe is this many bands either side of its peak, but
+  // no more than a quarter of the way to the next harmonic so that low
+  // fundamentals don't claim every band
+  lobe := int(math.Ceil(2.0 * float64(pd.points) / float64(pd.windowSize)))
+  if quarter := int(best / bandWidth / 4.0); quarter < lobe {
+    lobe = quarter
+  }
+
+  // the energy on the harmonics against the energy up to the last one
+  harmonicBands := map[int]bool{}
+  refined, refinedWeight := 0.0, 0.0
+
+  for harmonic := 1; harmonic <= pitchHarmonics; harmonic++ {
+    if best * float64(harmonic) >= float64(pd.sampleRate) / 2.0 {
+      break
+    }
+
+    peak, peakBand := pd.peakNear(best * float64(harmonic), 1)
+
+    if peak == 0.0 {
+      continue
+    }
+
+    for bandNumber := peakBand - lobe; bandNumber <= peakBand + lobe; bandNumber++ {
+      harmonicBands[bandNumber] = true
+    }
+
+    // the lowest harmonics refine the fundamental, from the channel where
+    // the harmonic is loudest
+    if harmonic > 3 || firstFrame {
+      continue
+    }
+
+    channel := 0
+    for c, polarSpectrum := range polarSpectra {
+      if polarSpectrum[peakBand * 2] > polarSpectra[channel][peakBand * 2] {
+        channel = c
+      }
+    }
+
+    deviation := princarg(polarSpectra[channel][peakBand * 2 + 1] - pd.lastPhases[channel][peakBand])
+    instantaneous := (float64(peakBand) + deviation * float64(pd.points) / (twoPi * float64(pd.decimation))) * bandWidth
+
+    refined += peak * instantaneous / float64(harmonic)
+    refinedWeight += peak
+  }
+
+  harmonicEnergy, totalEnergy := 0.0, 0.0
+  top := int(math.Ceil(best * pitchHarmonics / bandWidth)) + lobe
+
+  for bandNumber := 1; bandNumber <= halfPoints && bandNumber <= top; bandNumber++ {
+    energy := pd.magnitudes[bandNumber] * pd.magnitudes[bandNumber]
+    totalEnergy += energy
+
+    if harmonicBands[bandNumber] {
+      harmonicEnergy += energy
+    }
+  }
+
+  if totalEnergy == 0.0 {
+    return 0.0, 0.0
+  }
+
+  confidence = harmonicEnergy / totalEnergy
+
+  if confidence < pd.Threshold {
+    return 0.0, confidence
+  }
+
+  frequency = best
+  if refinedWeight > 0.0 && math.Abs(refined / refinedWeight - best) <= bandWidth / 2.0 {
+    frequency = refined / refinedWeight
+  }
+
+  return frequency, confidence
+}
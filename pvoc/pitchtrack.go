@@ -0,0 +1,444 @@
+package pvoc
+
+import(
+  "bufio"
+  "encoding/json"
+  "fmt"
+  "io"
+  "math"
+  "os"
+  "path/filepath"
+  "strings"
+  "gopvoc/audioio"
+)
+
+// Pitch tracking methods
+const PitchYIN = "yin"
+const PitchHarmonic = "harmonic"
+
+var PitchMethods = []string{
+  PitchYIN,
+  PitchHarmonic,
+}
+
+func PitchMethodsString() string {
+  return strings.Join(PitchMethods, ", ")
+}
+
+// dips of the normalized difference below this are taken as the period
+// without looking for a deeper one further on, which avoids picking multiples
+// of the period
+const yinThreshold = 0.15
+
+// the pitch of a frame, frequency is 0 Hz when the frame is unvoiced
+type PitchPoint struct {
+  Time float64 `json:"time"` // seconds, center of the frame
+  Frequency float64 `json:"frequency"` // Hz
+  Confidence float64 `json:"confidence"` // 0-1
+}
+
+// PitchTracker estimates the fundamental frequency of a monophonic file
+// frame by frame, either with YIN (the period that minimizes the normalized
+// difference between a frame and its delayed copy, on the channels mixed
+// down) or with the spectral harmonic sum of a PitchDetector. Frames whose
+// confidence is below Threshold are unvoiced.
+type PitchTracker struct {
+  Method string
+  MinFrequency float64
+  MaxFrequency float64
+  Threshold float64
+  Bands int
+  Overlap float64
+  WindowName string // harmonic only
+  Decimation int
+}
+
+func NewPitchTracker(
+  method string,
+  minFrequency,
+  maxFrequency,
+  threshold float64,
+  bands int,
+  overlap float64,
+  windowName string,
+  decimation int,
+) (*PitchTracker, error) {
+  switch method {
+  case PitchYIN, PitchHarmonic:
+  default:
+    return nil, fmt.Errorf("Pitch tracking method must be one of: %s, got %s", PitchMethodsString(), method)
+  }
+
+  if bands > 8192 || bands < 1 || (bands & (bands - 1)) != 0 {
+    return nil, fmt.Errorf("bands must be a power of 2 less than or equal to 8192, got %d", bands)
+  }
+
+  if !allowedOverlaps[overlap] {
+    return nil, fmt.Errorf("overlap must be 0.5, 1.0, 2.0 or 4.0, got %f", overlap)
+  }
+
+  if WindowFunctions[windowName] == nil {
+    return nil, fmt.Errorf("Invalid window function (%s), valid options are: %s", windowName, WindowNamesString())
+  }
+
+  if minFrequency <= 0 || maxFrequency <= minFrequency {
+    return nil, fmt.Errorf("Pitch range must be above 0 Hz and end above its start, got %f to %f", minFrequency, maxFrequency)
+  }
+
+  if threshold < 0 || threshold > 1 {
+    return nil, fmt.Errorf("Pitch confidence threshold must be between 0 and 1, got %f", threshold)
+  }
+
+  if decimation < 1 {
+    return nil, fmt.Errorf("Decimation must be at least 1, got %d", decimation)
+  }
+
+  return &PitchTracker{
+    Method: method,
+    MinFrequency: minFrequency,
+    MaxFrequency: maxFrequency,
+    Threshold: threshold,
+    Bands: bands,
+    Overlap: overlap,
+    WindowName: windowName,
+    Decimation: decimation,
+  }, nil
+}
+
+func (pt *PitchTracker) WindowSize() int {
+  return int(float64(pt.Bands) * 2.0 * pt.Overlap)
+}
+
+// yin returns the fundamental of a frame and the confidence of the estimate,
+// periods are searched between minPeriod and maxPeriod samples, difference
+// is scratch space of maxPeriod + 1 values
+func yin(frame []float64, minPeriod, maxPeriod int, sampleRate float64, difference []float64) (float64, float64) {
+  length := len(frame) - maxPeriod
+
+  // the cumulative mean normalized difference
+  difference[0] = 1.0
+  sum := 0.0
+
+  for period := 1; period <= maxPeriod; period++ {
+    d := 0.0
+
+    for j := 0; j < length; j++ {
+      delta := frame[j] - frame[j + period]
+      d += delta * delta
+    }
+
+    sum += d
+
+    if sum == 0.0 {
+      difference[period] = 1.0
+    } else {
+      difference[period] = d * float64(period) / sum
+    }
+  }
+
+  best := -1
+
+  for period := minPeriod; period <= maxPeriod; period++ {
+    if difference[period] < yinThreshold {
+      // the bottom of the dip
+      for period < maxPeriod && difference[period + 1] < difference[period] {
+        period++
+      }
+
+      best = period
+      break
+    }
+  }
+
+  if best < 0 {
+    best = minPeriod
+
+    for period := minPeriod; period <= maxPeriod; period++ {
+      if difference[period] < difference[best] {
+        best = period
+      }
+    }
+  }
+
+  confidence := math.Max(0.0, math.Min(1.0, 1.0 - difference[best]))
+
+  // parabolic interpolation of the dip
+  period := float64(best)
+
+  if best > 1 && best < maxPeriod {
+    before, at, after := difference[best - 1], difference[best], difference[best + 1]
+
+    if curvature := before - 2.0 * at + after; curvature > 0.0 {
+      period += 0.5 * (before - after) / curvature
+    }
+  }
+
+  return sampleRate / period, confidence
+}
+
+// Track reads the whole file, which must be opened with Decimation, and
+// returns the pitch of every frame whose center is within the file
+func (pt *PitchTracker) Track(audioReader *audioio.AudioReader, progress func(percent int)) ([]PitchPoint, error) {
+  numChans := audioReader.GetNumChans()
+  sampleRate := audioReader.GetSampleRate()
+  windowSize := pt.WindowSize()
+  points := pt.Bands * 2
+
+  if pt.MaxFrequency >= float64(sampleRate) / 2.0 {
+    return nil, fmt.Errorf("Highest pitch must be below the Nyquist frequency (%d Hz), got %f", sampleRate / 2, pt.MaxFrequency)
+  }
+
+  minPeriod := int(math.Floor(float64(sampleRate) / pt.MaxFrequency))
+  maxPeriod := int(math.Ceil(float64(sampleRate) / pt.MinFrequency))
+
+  if minPeriod < 1 {
+    minPeriod = 1
+  }
+
+  if pt.Method == PitchYIN && maxPeriod * 2 > windowSize {
+    return nil, fmt.Errorf(
+      "The window (%d samples) must hold two periods of the lowest pitch (%d samples), raise the bands or the lowest pitch",
+      windowSize,
+      maxPeriod,
+    )
+  }
+
+  var detector *PitchDetector
+  var analysisWindow []float64
+  var spectrum []float64
+  var polarSpectra [][]float64
+
+  if pt.Method == PitchHarmonic {
+    var err error
+
+    detector, err = NewPitchDetector(pt.MinFrequency, pt.MaxFrequency, pt.Threshold, points, windowSize, sampleRate, pt.Decimation)
+
+    if err != nil {
+      return nil, err
+    }
+
+    analysisWindow = WindowFunctions[pt.WindowName](windowSize)
+    synthesisWindow := WindowFunctions[pt.WindowName](windowSize)
+    ScaleWindowsInPlace(analysisWindow, synthesisWindow, points, pt.Decimation)
+
+    spectrum = make([]float64, points, points)
+    polarSpectra = make([][]float64, numChans, numChans)
+
+    for c := range polarSpectra {
+      polarSpectra[c] = make([]float64, points + 2, points + 2)
+    }
+  }
+
+  inputBuffers := make([]*SlidingBuffer, numChans, numChans)
+
+  for c := 0; c < numChans; c++ {
+    inputBuffers[c] = NewSlidingBuffer(windowSize)
+  }
+
+  mono := make([]float64, windowSize, windowSize)
+  difference := make([]float64, maxPeriod + 1, maxPeriod + 1)
+
+  pitchPoints := []PitchPoint{}
+  numSampleFrames := audioReader.GetNumSampleFrames()
+  inPointer := windowSize * -1
+  totalSamplesRead := 0
+
+  for {
+    inPointer += pt.Decimation
+
+    _, samplesRead, err := audioReader.ReadNext()
+    totalSamplesRead += samplesRead
+
+    if err != nil {
+      return nil, err
+    }
+
+    for c := 0; c < numChans; c++ {
+      if samplesRead > 0 {
+        channelBuffer, err := audioReader.ExtractChannel(c)
+
+        if err != nil {
+          return nil, err
+        }
+
+        if err = inputBuffers[c].ShiftIn(channelBuffer.AsFloatBuffer().Data, samplesRead); err != nil {
+          return nil, err
+        }
+      } else {
+        inputBuffers[c].ShiftOver(pt.Decimation)
+      }
+    }
+
+    point := PitchPoint{
+      Time: float64(inPointer + windowSize / 2) / float64(sampleRate),
+    }
+
+    if pt.Method == PitchYIN {
+      for i := range mono {
+        mono[i] = 0.0
+
+        for c := 0; c < numChans; c++ {
+          mono[i] += inputBuffers[c].Data[i]
+        }
+      }
+
+      point.Frequency, point.Confidence = yin(mono, minPeriod, maxPeriod, float64(sampleRate), difference)
+
+      if point.Confidence < pt.Threshold {
+        point.Frequency = 0.0
+      }
+    } else {
+      for c := 0; c < numChans; c++ {
+        WindowFold(inputBuffers[c].Data, analysisWindow, spectrum, inPointer)
+        RealFFT(spectrum, Time2Freq)
+        CartToPolar(spectrum, polarSpectra[c])
+      }
+
+      // every frame goes through the detector, it needs the phases of the
+      // previous one
+      point.Frequency, point.Confidence = detector.Detect(polarSpectra)
+    }
+
+    if point.Time >= 0.0 && inPointer + windowSize / 2 < totalSamplesRead {
+      pitchPoints = append(pitchPoints, point)
+    }
+
+    if !inputBuffers[0].HasValidSamples() {
+      break
+    }
+
+    if progress != nil && numSampleFrames > 0 {
+      progress(int((float64(totalSamplesRead) / float64(numSampleFrames)) * 100.0))
+    }
+  }
+
+  return pitchPoints, nil
+}
+
+// Pitch file formats, bpf is a pitch scale envelope (see PitchCurve)
+const PitchCSV = "csv"
+const PitchJSON = "json"
+const PitchBPF = "bpf"
+
+var PitchFormats = []string{
+  PitchCSV,
+  PitchJSON,
+  PitchBPF,
+}
+
+func PitchFormatsString() string {
+  return strings.Join(PitchFormats, ", ")
+}
+
+// the pitch file format for a path, from its extension
+func PitchFormat(path string) (string, error) {
+  extension := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+
+  for _, format := range PitchFormats {
+    if format == extension {
+      return format, nil
+    }
+  }
+
+  return "", fmt.Errorf("Pitch files must have one of the extensions: %s, got %s", PitchFormatsString(), path)
+}
+
+// WritePitch writes the pitch points to path, the format is chosen by the
+// file extension. reference and flatten are only used by bpf files.
+func WritePitch(path string, pitchPoints []PitchPoint, reference float64, flatten bool) error {
+  format, err := PitchFormat(path)
+
+  if err != nil {
+    return err
+  }
+
+  // the curve is made first so that a file without voiced frames isn't
+  // created empty
+  var curve *Envelope
+
+  if format == PitchBPF {
+    if curve, err = PitchCurve(pitchPoints, reference, flatten); err != nil {
+      return err
+    }
+  }
+
+  file, err := os.Create(path)
+
+  if err != nil {
+    return err
+  }
+
+  defer file.Close()
+
+  writer := bufio.NewWriter(file)
+
+  switch format {
+  case PitchCSV:
+    err = WritePitchCSV(writer, pitchPoints)
+  case PitchJSON:
+    err = WritePitchJSON(writer, pitchPoints)
+  case PitchBPF:
+    err = curve.Write(writer)
+  }
+
+  if err != nil {
+    return err
+  }
+
+  return writer.Flush()
+}
+
+// writes the pitch points as CSV, one line per frame
+func WritePitchCSV(writer io.Writer, pitchPoints []PitchPoint) error {
+  if _, err := fmt.Fprintln(writer, "time,frequency,confidence"); err != nil {
+    return err
+  }
+
+  for _, point := range pitchPoints {
+    if _, err := fmt.Fprintf(writer, "%.6f,%.3f,%.3f\n", point.Time, point.Frequency, point.Confidence); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+func WritePitchJSON(writer io.Writer, pitchPoints []PitchPoint) error {
+  encoder := json.NewEncoder(writer)
+  encoder.SetIndent("", "  ")
+
+  return encoder.Encode(pitchPoints)
+}
+
+// PitchCurve turns the voiced pitch points into a pitch scale envelope: the
+// ratio of every frequency to reference, or with flatten the ratio that
+// shifts every frequency to reference. Unvoiced frames are left out, the
+// envelope glides over them.
+func PitchCurve(pitchPoints []PitchPoint, reference float64, flatten bool) (*Envelope, error) {
+  if reference <= 0 {
+    return nil, fmt.Errorf("Pitch curve reference must be above 0 Hz, got %f", reference)
+  }
+
+  times := []float64{}
+  values := []float64{}
+
+  for _, point := range pitchPoints {
+    if point.Frequency == 0.0 {
+      continue
+    }
+
+    times = append(times, point.Time)
+
+    if flatten {
+      values = append(values, reference / point.Frequency)
+    } else {
+      values = append(values, point.Frequency / reference)
+    }
+  }
+
+  if len(times) == 0 {
+    return nil, fmt.Errorf("No voiced frames to make a pitch curve of")
+  }
+
+  return NewEnvelope(times, values)
+}
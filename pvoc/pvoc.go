@@ -2,9 +2,10 @@ package pvoc
 
 import(
   "fmt"
+  "io"
   "math"
   "gopvoc/audioio"
-  // "gopvoc/charter"
+  "gopvoc/charter"
 )
 
 // FFT directions
@@ -43,21 +44,35 @@ type Pvoc struct {
   Decimation int
   Interpolation int
   Operation int
-  PhaseLock bool // only useful for TimeStretch
+  PhaseLockMode string
+  PhaseReconstruction string // only useful for TimeStretch
   WindowName string
   GatingAmplitudeDb float64
   GatingThresholdDb float64
   RateLimited bool // only set for TimeStretch
+  TransientSensitivity float64 // only useful for TimeStretch, 0 disables
+  TransientKeep bool // only useful for TimeStretch
+  GriffinLimIterations int // only useful for TimeStretch with PhaseGriffinLim
+  LinkChannels bool // only useful for TimeStretch
+  LinkReference int // the channel linked channels follow, or LinkSum
   gatingAmplitude float64
   gatingThreshold float64
+  onsetDetector *OnsetDetector
+  griffinLim *GriffinLim
+  spectralOperation *SpectralOperation
+  autotune *Autotune // only used by PitchShift
+  scaleCurve *Envelope // only used by PitchShift, overrides ScaleFactor
+  charter *charter.Charter // diagnostic charts of Run
 }
 
+const DefaultGriffinLimIterations = 32
+
 func NewPvoc(
   bands int,
   overlap,
   scaleFactor float64,
   operation int,
-  phaseLock bool,
+  phaseLockMode string,
   windowName string,
   gatingAmplitudeDb,
   gatingThresholdDb float64,
@@ -74,6 +89,10 @@ func NewPvoc(
     return nil, fmt.Errorf("Operation must be either TimeStretch (%d) or PitchShift (%d), got %d", TimeStretch, PitchShift, operation)
   }
 
+  if !isPhaseLockMode(phaseLockMode) {
+    return nil, fmt.Errorf("Phase lock must be one of: %s, got %s", PhaseLockModesString(), phaseLockMode)
+  }
+
   if scaleFactor < 0 {
     return nil, fmt.Errorf("Scale multiplier cannot be negative, got %f", scaleFactor)
   }
@@ -103,7 +122,9 @@ func NewPvoc(
     Points: bands * 2,
     WindowSize: int(float64(bands) * 2.0 * overlap),
     Operation: operation,
-    PhaseLock: phaseLock,
+    PhaseLockMode: phaseLockMode,
+    PhaseReconstruction: PhaseClassic,
+    GriffinLimIterations: DefaultGriffinLimIterations,
     WindowName: windowName,
     GatingAmplitudeDb: gatingAmplitudeDb,
     GatingThresholdDb: gatingThresholdDb,
@@ -147,8 +168,25 @@ func (p *Pvoc) String() (output string) {
   output += fmt.Sprintf("%24s   %d samples\n", "Decimation Length:", p.Decimation)
   output += fmt.Sprintf("%24s   %d samples\n", "Interpolation Length:", p.Interpolation)
 
+  output += fmt.Sprintf("%24s   %s\n", "Phase Locking:", p.PhaseLockMode)
+
   if p.Operation == TimeStretch {
-    output += fmt.Sprintf("%24s   %t\n", "Phase Locking:", p.PhaseLock)
+    output += fmt.Sprintf("%24s   %s\n", "Phase Reconstruction:", p.PhaseReconstruction)
+
+    if p.LinkChannels && p.LinkReference == LinkSum {
+      output += fmt.Sprintf("%24s   sum\n", "Linked Channels:")
+    } else if p.LinkChannels {
+      output += fmt.Sprintf("%24s   channel %d\n", "Linked Channels:", p.LinkReference + 1)
+    }
+
+    if p.PhaseReconstruction == PhaseGriffinLim {
+      output += fmt.Sprintf("%24s   %d\n", "Griffin-Lim Iterations:", p.GriffinLimIterations)
+    }
+  }
+
+  if p.TransientSensitivity != 0 {
+    output += fmt.Sprintf("%24s   %.2f\n", "Transient Sensitivity:", p.TransientSensitivity)
+    output += fmt.Sprintf("%24s   %t\n", "Keep Transients:", p.TransientKeep)
   }
 
   if p.GatingAmplitudeDb != 0 {
@@ -158,9 +196,188 @@ func (p *Pvoc) String() (output string) {
   if p.GatingThresholdDb != 0 {
     output += fmt.Sprintf("%24s   %f\n", "Gating Amp Thresh <Max:", p.GatingThresholdDb)
   }
+
+  if p.spectralOperation != nil {
+    output += fmt.Sprintf("%24s   %s\n", "Spectral Operation:", p.spectralOperation)
+  }
+
+  if p.scaleCurve != nil {
+    output += fmt.Sprintf("%24s   %.2f to %.2f\n", "Scaling Curve:", p.scaleCurve.Min(), p.scaleCurve.Max())
+  }
+
+  if p.autotune != nil {
+    output += fmt.Sprintf("%24s   %s %s\n", "Pitch Correction:", keyNames[p.autotune.Key], p.autotune.Scale)
+    output += fmt.Sprintf("%24s   %.2f Hz\n", "Tuning Reference:", p.autotune.Reference)
+    output += fmt.Sprintf("%24s   %.3f s\n", "Retune Time:", p.autotune.RetuneTime)
+  }
   return
 }
 
+// Enables transient preservation for TimeStretch: phases are reset to the
+// analysis phases at detected onsets. When keep is true, transients are
+// resynthesized un-stretched and the steady-state regions following them
+// are stretched more to compensate.
+func (p *Pvoc) SetTransients(sensitivity float64, keep bool) error {
+  if sensitivity == 0 {
+    if keep {
+      return fmt.Errorf("Keeping transients requires a transient sensitivity")
+    }
+    return nil
+  }
+
+  if p.Operation != TimeStretch {
+    return fmt.Errorf("Transient preservation is only available for %s", OperationNames[TimeStretch])
+  }
+
+  if sensitivity < 0 || sensitivity > 1 {
+    return fmt.Errorf("Transient sensitivity must be between 0 and 1, got %f", sensitivity)
+  }
+
+  p.TransientSensitivity = sensitivity
+  p.TransientKeep = keep
+
+  return nil
+}
+
+// Sets a spectral rearrangement applied to every frame after gating, nil
+// disables it
+func (p *Pvoc) SetSpectralOperation(operation *SpectralOperation) {
+  p.spectralOperation = operation
+}
+
+// Enables pitch correction for PitchShift: every frame is shifted by the
+// scale factor times the correction the autotune computes for it
+func (p *Pvoc) SetAutotune(autotune *Autotune) error {
+  if p.Operation != PitchShift {
+    return fmt.Errorf("Pitch correction is only available for %s", OperationNames[PitchShift])
+  }
+
+  p.autotune = autotune
+
+  return nil
+}
+
+// Makes PitchShift follow a pitch scale envelope over the input time instead
+// of ScaleFactor, nil disables it
+func (p *Pvoc) SetScaleCurve(curve *Envelope) error {
+  if curve == nil {
+    p.scaleCurve = nil
+    return nil
+  }
+
+  if p.Operation != PitchShift {
+    return fmt.Errorf("A scaling curve is only available for %s", OperationNames[PitchShift])
+  }
+
+  if curve.Min() <= 0 {
+    return fmt.Errorf("Scaling curve values must be above 0, got %f", curve.Min())
+  }
+
+  p.scaleCurve = curve
+
+  return nil
+}
+
+// the pitch correction set with SetAutotune, nil without one
+func (p *Pvoc) Autotune() *Autotune {
+  return p.autotune
+}
+
+// Makes Run chart its windows, a selection of analysis frames, the gate
+// decisions and the peak of every output block, nil disables it
+func (p *Pvoc) SetCharter(chartWriter *charter.Charter) {
+  p.charter = chartWriter
+}
+
+// Selects how TimeStretch computes the output phases: classic phase vocoder
+// accumulation (PhaseInterpolate), phase gradient heap integration, or
+// Griffin-Lim iterations starting from the phase gradient heap integration
+func (p *Pvoc) SetPhaseReconstruction(mode string) error {
+  switch mode {
+  case PhaseClassic:
+  case PhasePGHI, PhaseGriffinLim:
+    if p.Operation != TimeStretch {
+      return fmt.Errorf("Phase reconstruction %s is only available for %s", mode, OperationNames[TimeStretch])
+    }
+
+    if p.PhaseLockMode != PhaseLockNone {
+      return fmt.Errorf("Phase reconstruction %s can't be combined with phase locking", mode)
+    }
+  default:
+    return fmt.Errorf("Phase reconstruction must be one of: %s, got %s", PhaseReconstructionsString(), mode)
+  }
+
+  p.PhaseReconstruction = mode
+
+  return nil
+}
+
+// Sets the number of Griffin-Lim iterations for PhaseGriffinLim
+func (p *Pvoc) SetGriffinLimIterations(iterations int) error {
+  if iterations < 1 {
+    return fmt.Errorf("Griffin-Lim iterations must be at least 1, got %d", iterations)
+  }
+
+  p.GriffinLimIterations = iterations
+
+  return nil
+}
+
+// Links the channels of a TimeStretch: their phases advance with the phases
+// of the reference channel (LinkSum for the sum of the channels), keeping the
+// phase differences between them from the analysis
+func (p *Pvoc) SetChannelLink(reference int) error {
+  if p.Operation != TimeStretch {
+    return fmt.Errorf("Linked channels are only available for %s", OperationNames[TimeStretch])
+  }
+
+  if p.PhaseReconstruction == PhaseGriffinLim {
+    return fmt.Errorf("Linked channels can't be combined with phase reconstruction %s", PhaseGriffinLim)
+  }
+
+  p.LinkChannels = true
+  p.LinkReference = reference
+
+  return nil
+}
+
+// spectral convergence after each Griffin-Lim iteration of the last Run
+func (p *Pvoc) GriffinLimConvergence() []float64 {
+  if p.griffinLim == nil {
+    return []float64{}
+  }
+
+  return p.griffinLim.Convergence
+}
+
+// samples the output of Run lags the input by at a scale factor of 1. Overlap
+// add starts writing a hop late, the oscillator bank reaches the amplitudes of
+// a frame half a window after its center
+func (p *Pvoc) Latency() int {
+  if p.Operation == PitchShift {
+    return p.WindowSize / 2
+  }
+
+  return p.Decimation
+}
+
+// onset times (in seconds of the input) detected during the last Run
+func (p *Pvoc) Onsets() []float64 {
+  if p.onsetDetector == nil {
+    return []float64{}
+  }
+
+  return p.onsetDetector.Onsets
+}
+
+func (p *Pvoc) WriteOnsets(writer io.Writer) error {
+  if p.onsetDetector == nil {
+    return nil
+  }
+
+  return p.onsetDetector.WriteOnsets(writer)
+}
+
 func computeTimeScaleData(windowSize int, scaleFactor float64) timeScalingData {
   var maxRate int = windowSize / 8
 
@@ -282,6 +499,12 @@ func (p *Pvoc) Run(
   sineTable := make([]float64, 16384, 16384)
   SineTable(sineTable)
 
+  // peak locking state, only for the modes PhaseInterpolate can't do itself
+  phaseLockers := make([]*PhaseLocker, audioReader.GetNumChans(), audioReader.GetNumChans())
+
+  // phase gradient heap integration state
+  phaseHeaps := make([]*PhaseGradientHeap, audioReader.GetNumChans(), audioReader.GetNumChans())
+
   halfPoints := p.Points / 2
 
   // what is the maximum ABS sample value at our BitDepth?
@@ -302,6 +525,37 @@ func (p *Pvoc) Run(
     lastAmps[c] = make([]float64, halfPoints + 1, halfPoints + 1)
     lastFreqs[c] = make([]float64, halfPoints + 1, halfPoints + 1)
     sineIndexes[c] = make([]float64, halfPoints + 1, halfPoints + 1)
+
+    if p.PhaseLockMode == PhaseLockIdentity || p.PhaseLockMode == PhaseLockScaled ||
+      (p.Operation == PitchShift && p.PhaseLockMode == PhaseLockNeighbor) {
+      phaseLockers[c] = NewPhaseLocker(p.PhaseLockMode, p.Points, p.WindowSize)
+    }
+
+    // Griffin-Lim starts from the phase gradient heap integration phases
+    if p.Operation == TimeStretch && (p.PhaseReconstruction == PhasePGHI || p.PhaseReconstruction == PhaseGriffinLim) {
+      phaseHeaps[c] = NewPhaseGradientHeap(p.Points)
+    }
+  }
+
+  // a single channel has nothing to be linked to
+  var linker *ChannelLinker
+
+  if p.Operation == TimeStretch && p.LinkChannels && audioReader.GetNumChans() > 1 {
+    var err error
+    linker, err = NewChannelLinker(p.LinkReference, audioReader.GetNumChans(), p.Points)
+
+    if err != nil {
+      errors <- err
+      return
+    }
+
+    if p.PhaseLockMode == PhaseLockIdentity || p.PhaseLockMode == PhaseLockScaled {
+      linker.PhaseLocker = NewPhaseLocker(p.PhaseLockMode, p.Points, p.WindowSize)
+    }
+
+    if p.PhaseReconstruction == PhasePGHI {
+      linker.PhaseHeap = NewPhaseGradientHeap(p.Points)
+    }
   }
 
   // setup analysis and synthesis windows
@@ -319,8 +573,6 @@ func (p *Pvoc) Run(
     p.WindowSize,
   )
 
-  // charter.MakeChart("triangle", 1, analysisWindow)
-
   // scale the windows in place
   ScaleWindowsInPlace(
     analysisWindow,
@@ -329,6 +581,81 @@ func (p *Pvoc) Run(
     p.Interpolation,
   )
 
+  var debug *runDebug
+
+  if p.charter != nil {
+    debug = newRunDebug(
+      p.charter,
+      audioReader.GetNumChans(),
+      audioReader.GetSampleRate(),
+      audioReader.GetNumSampleFrames(),
+      p.Points,
+      p.WindowSize,
+      p.Decimation,
+      p.Interpolation,
+      maxSampleValue,
+    )
+
+    if err := debug.windows(analysisWindow, synthesisWindow); err != nil {
+      errors <- err
+      return
+    }
+  }
+
+  // transient detection for TimeStretch
+  p.onsetDetector = nil
+
+  if p.Operation == TimeStretch && p.TransientSensitivity != 0 {
+    onsetDetector, err := NewOnsetDetector(
+      p.TransientSensitivity,
+      audioReader.GetNumChans(),
+      p.Points,
+      float64(audioReader.GetSampleRate()) / float64(p.Decimation),
+      maxSampleValue,
+    )
+
+    if err != nil {
+      errors <- err
+      return
+    }
+
+    p.onsetDetector = onsetDetector
+  }
+
+  // when keeping transients un-stretched: how many frames are left to
+  // protect, and how many output samples we are behind the nominal length
+  keepTransients := p.onsetDetector != nil && p.TransientKeep && p.ScaleFactor > 1.0
+  protectFrames := 0
+  hopDebt := 0
+
+  // output samples waiting to be written in blocks of interpolation length
+  pendingOutput := make([][]int, audioReader.GetNumChans(), audioReader.GetNumChans())
+
+  // Griffin-Lim needs every frame before it can resynthesize anything: keep
+  // the spectra with their output positions, and the output range that would
+  // have been written
+  p.griffinLim = nil
+  var griffinLimSpectra [][][]float64
+  griffinLimPositions := []int{}
+  griffinLimStart := 0
+  griffinLimLength := 0
+
+  // analysis is only the first half of the work with Griffin-Lim
+  progressScale := 1.0
+
+  if p.Operation == TimeStretch && p.PhaseReconstruction == PhaseGriffinLim {
+    griffinLim, err := NewGriffinLim(p.Points, p.WindowSize, p.Interpolation, p.WindowName, p.GriffinLimIterations)
+
+    if err != nil {
+      errors <- err
+      return
+    }
+
+    p.griffinLim = griffinLim
+    griffinLimSpectra = make([][][]float64, audioReader.GetNumChans(), audioReader.GetNumChans())
+    progressScale = 0.5
+  }
+
   // where we are in the input/output in samples
   inPointer := p.WindowSize * -1
   outPointer := (inPointer * p.Interpolation) / p.Decimation
@@ -337,8 +664,12 @@ func (p *Pvoc) Run(
   totalSamplesRead := 0
   progress <- 0
   for {
+    // hop is the output length of this block, it only differs from
+    // interpolation when keeping transients un-stretched
+    hop := p.Interpolation
+    frameScaleFactor := p.ScaleFactor
+
     inPointer += p.Decimation
-    outPointer += p.Interpolation
 
     _, samplesRead, err := audioReader.ReadNext()
     totalSamplesRead += samplesRead
@@ -393,26 +724,172 @@ func (p *Pvoc) Run(
 
       // gate the spectrum if need to
       if p.gatingAmplitude != 0.0 || p.gatingThreshold != 0.0 {
-        SimpleSpectralGate(
+        gated := SimpleSpectralGate(
           polarBuffers[c],
           p.Points,
           p.gatingAmplitude,
           p.gatingThreshold,
           maxSampleValue,
         )
+
+        if debug != nil {
+          debug.gate(c, gated)
+        }
       }
 
-      if p.Operation == TimeStretch {
-        // TimeStrech operations:
+      if p.spectralOperation != nil {
+        p.spectralOperation.Apply(polarBuffers[c], audioReader.GetSampleRate())
+      }
+    }
+
+    frameTime := float64(inPointer + p.WindowSize / 2) / float64(audioReader.GetSampleRate())
+
+    if debug != nil {
+      if err = debug.frame(blockCount, frameTime, polarBuffers); err != nil {
+        errors <- err
+        return
+      }
+    }
+
+    if p.scaleCurve != nil {
+      frameScaleFactor = p.scaleCurve.Value(frameTime)
+    }
+
+    // pitch correction, before AddSynth turns the phases into frequencies
+    if p.autotune != nil {
+      frameScaleFactor = p.autotune.Correct(
+        polarBuffers,
+        frameTime,
+        float64(p.Decimation) / float64(audioReader.GetSampleRate()),
+        frameScaleFactor,
+      )
+    }
+
+    // transients are detected across all channels at once so that every
+    // channel gets its phases reset on the same frame
+    transient := false
+
+    if p.onsetDetector != nil {
+      // the flux peaks while a transient is in the leading half of the
+      // window, so report onsets where the window rises the steepest
+      onsetTime := float64(inPointer + (p.WindowSize * 3) / 4) / float64(audioReader.GetSampleRate())
+
+      transient = p.onsetDetector.Detect(polarBuffers, math.Max(onsetTime, 0.0))
+
+      if keepTransients {
+        if transient {
+          protectFrames = p.WindowSize / (p.Decimation * 2)
+
+          if protectFrames < 1 {
+            protectFrames = 1
+          }
+        }
+
+        if protectFrames > 0 {
+          hop = p.Decimation
+          protectFrames--
+        } else if hopDebt > 0 {
+          // stretch the steady-state more to make up for the lost length
+          maxExtra := p.Interpolation / 2
+
+          if maxExtra < 1 {
+            maxExtra = 1
+          }
+
+          if hopDebt < maxExtra {
+            hop += hopDebt
+          } else {
+            hop += maxExtra
+          }
+        }
+
+        hopDebt += p.Interpolation - hop
+        frameScaleFactor = float64(hop) / float64(p.Decimation)
+      }
+    }
+
+    outPointer += hop
+
+    if p.griffinLim != nil {
+      griffinLimPositions = append(griffinLimPositions, outPointer)
+    }
+
+    // advances the phases of a spectrum from the last frame
+    advancePhases := func(polar, lastPhaseIn, lastPhaseOut []float64, phaseLocker *PhaseLocker, phaseHeap *PhaseGradientHeap) {
+      if phaseHeap != nil {
+        // integrating along the frequency direction keeps transients
+        // coherent without having to reset the phases
+        phaseHeap.Interpolate(
+          polar,
+          lastPhaseIn,
+          lastPhaseOut,
+          p.Points,
+          p.Decimation,
+          hop,
+          inPointer,
+          outPointer,
+        )
+      } else if transient {
+        ResetPhases(
+          polar,
+          lastPhaseIn,
+          lastPhaseOut,
+          p.Points,
+          outPointer - inPointer,
+        )
+      } else if phaseLocker != nil {
+        phaseLocker.Interpolate(
+          polar,
+          lastPhaseIn,
+          lastPhaseOut,
+          p.Points,
+          p.Decimation,
+          hop,
+          inPointer,
+          outPointer,
+        )
+      } else {
         PhaseInterpolate(
-          polarBuffers[c],
-          lastPhaseIns[c],
-          lastPhaseOuts[c],
+          polar,
+          lastPhaseIn,
+          lastPhaseOut,
           p.Points,
           p.Decimation,
-          p.ScaleFactor,
-          p.PhaseLock, // this is always false in SoundHack
+          frameScaleFactor,
+          p.PhaseLockMode == PhaseLockNeighbor, // this is always false in SoundHack
         )
+      }
+    }
+
+    // linked channels advance with the reference, except where it is silent
+    if linker != nil {
+      linker.Analyze(polarBuffers)
+      advancePhases(linker.Polar, linker.LastPhaseIn, linker.LastPhaseOut, linker.PhaseLocker, linker.PhaseHeap)
+    }
+
+    for c := 0; c < audioReader.GetNumChans(); c++ {
+      if p.Operation == TimeStretch {
+        // TimeStrech operations:
+        advancePhases(polarBuffers[c], lastPhaseIns[c], lastPhaseOuts[c], phaseLockers[c], phaseHeaps[c])
+
+        if linker != nil {
+          linker.Resynthesize(c, polarBuffers[c], lastPhaseOuts[c])
+        }
+
+        // keep the frame for Griffin-Lim, it resynthesizes everything at
+        // the end with its own window normalization
+        if p.griffinLim != nil {
+          frame := make([]float64, len(polarBuffers[c]), len(polarBuffers[c]))
+          copy(frame, polarBuffers[c])
+          griffinLimSpectra[c] = append(griffinLimSpectra[c], frame)
+          continue
+        }
+
+        // overlap-add gain is proportional to 1 / hop, compensate when
+        // the hop differs from the one the synthesis window is scaled for
+        if hop != p.Interpolation {
+          ScaleAmplitudes(polarBuffers[c], float64(hop) / float64(p.Interpolation))
+        }
 
         // convert the polar FFT result to cart
         PolarToCart(polarBuffers[c], spectrumBuffers[c])
@@ -434,10 +911,12 @@ func (p *Pvoc) Run(
           lastPhaseIns[c],
           sineTable,
           sineIndexes[c],
-          p.ScaleFactor,
+          frameScaleFactor,
           p.Interpolation,
           p.Decimation,
           p.Points,
+          inPointer,
+          phaseLockers[c],
         )
       }
     }
@@ -446,39 +925,31 @@ func (p *Pvoc) Run(
     var checkTime int
 
     if p.Operation == TimeStretch {
-      checkTime = outPointer + p.Interpolation
+      checkTime = outPointer + hop
     } else {
       checkTime = outPointer + p.WindowSize - p.Interpolation
     }
 
-    if checkTime >= 0 {
-      audioWriter.ZeroWriteBuffer()
+    if checkTime >= 0 && p.griffinLim != nil {
+      if griffinLimLength == 0 {
+        griffinLimStart = outPointer
+      }
 
+      griffinLimLength += hop
+    } else if checkTime >= 0 {
       for c := 0; c < audioReader.GetNumChans(); c++ {
-        err = audioWriter.InterleaveChannel(
-          c,
-          outputBuffers[c].DataInts()[:p.Interpolation],
-        )
-
-        // charter.MakeChart(fmt.Sprintf("interleave_chan-%d", c), blockCount, outputBuffers[c].Data)
-
-        if err != nil {
-          errors <- err
-          return
-        }
+        pendingOutput[c] = append(pendingOutput[c], outputBuffers[c].DataInts()[:hop]...)
       }
 
-      // charter.MakeChart("writeBuffer", blockCount, audioWriter.WriteBuffer.AsFloatBuffer().Data)
-
-      if err = audioWriter.WriteNext(); err != nil {
+      if err = writePending(audioWriter, pendingOutput, p.Interpolation, false, debug); err != nil {
         errors <- err
         return
       }
     }
 
-    // shift output buffers over by interpolation
+    // shift output buffers over by the block length
     for c := 0; c < audioReader.GetNumChans(); c++ {
-      outputBuffers[c].ShiftOver(p.Interpolation)
+      outputBuffers[c].ShiftOver(hop)
     }
 
     // Soundhack terminates when no more samples are read, we do this:
@@ -488,8 +959,46 @@ func (p *Pvoc) Run(
     }
 
     blockCount++;
-    progress <- int((float64(totalSamplesRead) / float64(audioReader.GetNumSampleFrames())) * 100.0)
+    progress <- int((float64(totalSamplesRead) / float64(audioReader.GetNumSampleFrames())) * 100.0 * progressScale)
+  }
+
+  if p.griffinLim != nil {
+    signals, err := p.griffinLim.Reconstruct(
+      griffinLimSpectra,
+      griffinLimPositions,
+      func(iteration int, convergence float64) {
+        progress <- 50 + (iteration * 50) / p.griffinLim.Iterations
+      },
+    )
+
+    if err != nil {
+      errors <- err
+      return
+    }
+
+    for c := 0; c < audioReader.GetNumChans(); c++ {
+      offset := griffinLimStart - griffinLimPositions[0]
+      pendingOutput[c] = make([]int, griffinLimLength, griffinLimLength)
+
+      for i := 0; i < griffinLimLength; i++ {
+        pendingOutput[c][i] = int(math.Round(signals[c][offset + i]))
+      }
+    }
   }
+
+  // flush anything left over from variable length blocks
+  if err := writePending(audioWriter, pendingOutput, p.Interpolation, true, debug); err != nil {
+    errors <- err
+    return
+  }
+
+  if debug != nil {
+    if err := debug.write(OperationNames[p.Operation]); err != nil {
+      errors <- err
+      return
+    }
+  }
+
   done <- true
 }
 
@@ -617,13 +1126,15 @@ func PolarToCart(polarSpectrum, spectrum []float64) {
   }
 }
 
+// zeroes the bands below minAmplitude or below maskRatio times the loudest
+// band, returns how many were zeroed
 func SimpleSpectralGate(
   polarSpectrum []float64,
   points int,
   minAmplitude,
   maskRatio,
   maxSampleValue float64,
-) {
+) int {
   halfPoints := points / 2
 
   maxAmplitude := 0.0
@@ -638,6 +1149,7 @@ func SimpleSpectralGate(
   }
 
   maskAmplitude := maskRatio * maxAmplitude
+  gated := 0
 
   for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
     ampIndex := bandNumber * 2
@@ -647,8 +1159,11 @@ func SimpleSpectralGate(
     /* Set for Ducking */
     if polarSpectrum[ampIndex] < maskAmplitude || normalizedAmp < minAmplitude {
       polarSpectrum[ampIndex] = 0.0
+      gated++
     }
   }
+
+  return gated
 }
 
 func PhaseInterpolate(
@@ -774,7 +1289,9 @@ func OverlapAdd(spectrum, synthesisWindow, output []float64, outPointer int) {
    scaleFactor float64,
    interpolation,
    decimation,
-   points int,
+   points,
+   inPointer int, // only used for phase locking
+   phaseLocker *PhaseLocker, // nil disables phase locking
  ) {
    halfPoints := points / 2
 
@@ -800,13 +1317,14 @@ func OverlapAdd(spectrum, synthesisWindow, output []float64, outPointer int) {
    * interpolation on the amplitude and frequency
    */
 
+   if phaseLocker != nil {
+     phaseLocker.savePhases(polarSpectrum, numberPartials, points, inPointer)
+   }
+
    for bandNumber := 0; bandNumber < numberPartials; bandNumber++ {
      ampIndex := bandNumber * 2
      freqIndex := ampIndex + 1
 
-     // Start where we left off, keep phase
-     address := sineIndex[bandNumber]
-
      if polarSpectrum[ampIndex] == 0.0 {
        polarSpectrum[freqIndex] = float64(bandNumber) * cyclesBand
      } else {
@@ -824,7 +1342,22 @@ func OverlapAdd(spectrum, synthesisWindow, output []float64, outPointer int) {
 
        // Convert to instantaneos frequency
        polarSpectrum[freqIndex] = phaseDifference * cyclesFrame + float64(bandNumber) * cyclesBand
+     }
+   }
+
+   // phase locking works on the instantaneous frequencies of all bands at once
+   if phaseLocker != nil {
+     phaseLocker.lockFrequencies(polarSpectrum, sineIndex, sineTableLen, numberPartials, scaleFactor)
+   }
 
+   for bandNumber := 0; bandNumber < numberPartials; bandNumber++ {
+     ampIndex := bandNumber * 2
+     freqIndex := ampIndex + 1
+
+     // Start where we left off, keep phase
+     address := sineIndex[bandNumber]
+
+     if polarSpectrum[ampIndex] != 0.0 {
        // Start with last amplitude
        amplitude := lastAmp[bandNumber]
 
@@ -862,4 +1395,93 @@ func OverlapAdd(spectrum, synthesisWindow, output []float64, outPointer int) {
      lastAmp[bandNumber] = polarSpectrum[ampIndex]
      sineIndex[bandNumber] = address
    }
+
+   // when the scale factor changes from frame to frame, bands above this
+   // frame's partials start from silence when they come back
+   for bandNumber := numberPartials; bandNumber < halfPoints; bandNumber++ {
+     lastAmp[bandNumber] = 0.0
+   }
  }
+
+// writes the pending output in blocks of blockLength, when flush is true any
+// remaining partial block is padded with silence and written as well
+func writePending(audioWriter *audioio.AudioWriter, pendingOutput [][]int, blockLength int, flush bool, debug *runDebug) error {
+  if flush && len(pendingOutput[0]) > 0 {
+    for c := 0; c < len(pendingOutput); c++ {
+      for len(pendingOutput[c]) % blockLength != 0 {
+        pendingOutput[c] = append(pendingOutput[c], 0)
+      }
+    }
+  }
+
+  for len(pendingOutput[0]) >= blockLength {
+    audioWriter.ZeroWriteBuffer()
+
+    for c := 0; c < len(pendingOutput); c++ {
+      if err := audioWriter.InterleaveChannel(c, pendingOutput[c][:blockLength]); err != nil {
+        return err
+      }
+
+      if debug != nil {
+        debug.blockPeak(c, pendingOutput[c][:blockLength])
+      }
+
+      pendingOutput[c] = pendingOutput[c][blockLength:]
+    }
+
+    if err := audioWriter.WriteNext(); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// Resets the output phases to the analysis phases, used at transients so
+// that the vertical phase coherence of the attack is kept intact. The analysis
+// phases are relative to the input time, shift is the distance in samples
+// from the input time to the output time the frame will be overlap-added at.
+func ResetPhases(
+  polarSpectrum,
+  lastPhaseIn,
+  lastPhaseOut []float64,
+  points,
+  shift int,
+) {
+  halfPoints := points / 2
+
+  // keep the rotation small, only shift modulo the FFT length matters
+  shift %= points
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    ampIndex := bandNumber * 2
+    phaseIndex := ampIndex + 1
+
+    if polarSpectrum[ampIndex] == 0.0 {
+      polarSpectrum[phaseIndex] = lastPhaseOut[bandNumber]
+      continue
+    }
+
+    lastPhaseIn[bandNumber] = polarSpectrum[phaseIndex]
+
+    // delaying by shift samples rotates each band's phase backwards
+    polarSpectrum[phaseIndex] -= twoPi * float64((bandNumber * shift) % points) / float64(points)
+
+    for polarSpectrum[phaseIndex] > pi {
+      polarSpectrum[phaseIndex] -= twoPi
+    }
+
+    for polarSpectrum[phaseIndex] < -pi {
+      polarSpectrum[phaseIndex] += twoPi
+    }
+
+    lastPhaseOut[bandNumber] = polarSpectrum[phaseIndex]
+  }
+}
+
+// multiplies every amplitude of the polar spectrum by gain
+func ScaleAmplitudes(polarSpectrum []float64, gain float64) {
+  for ampIndex := 0; ampIndex < len(polarSpectrum); ampIndex += 2 {
+    polarSpectrum[ampIndex] *= gain
+  }
+}
@@ -1,7 +1,17 @@
 package pvoc
 
 import(
+  "image"
+  "image/color"
+  "math"
+  "math/rand"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
   "testing"
+  "gopvoc/audioio"
+  "gopvoc/charter"
   . "gopvoc/testing_utilities"
 )
 
@@ -157,3 +167,1602 @@ func TestSlidingBufferShiftOver(t *testing.T) {
     t.Errorf("SlidingBuffer shiftOver 2 last valid Sample unexpected: %d", slidingBuffer.lastValidSample)
   }
 }
+
+func TestOnsetDetector(t *testing.T) {
+  points := 16
+  detector, err := NewOnsetDetector(0.5, 1, points, 100.0, 32768.0)
+  Ok(t, err)
+
+  polarSpectra := [][]float64{make([]float64, points + 2, points + 2)}
+
+  // quiet steady state
+  for frame := 0; frame < 50; frame++ {
+    for ampIndex := 0; ampIndex < len(polarSpectra[0]); ampIndex += 2 {
+      polarSpectra[0][ampIndex] = 10.0
+    }
+    detector.Detect(polarSpectra, float64(frame) / 100.0)
+  }
+
+  // a burst rising over two frames, then decaying
+  burst := []float64{100.0, 20000.0, 5000.0, 10.0, 10.0}
+  transients := []bool{}
+
+  for i, amp := range burst {
+    for ampIndex := 0; ampIndex < len(polarSpectra[0]); ampIndex += 2 {
+      polarSpectra[0][ampIndex] = amp
+    }
+    transients = append(transients, detector.Detect(polarSpectra, float64(50 + i) / 100.0))
+  }
+
+  Equals(t, []bool{true, true, false, false, false}, transients)
+  // the signal starting from silence is an onset as well
+  Equals(t, []float64{0.0, 0.51}, detector.Onsets)
+
+  _, err = NewOnsetDetector(1.5, 1, points, 100.0, 32768.0)
+  Assert(t, err != nil, "sensitivity above 1 should error")
+}
+
+func TestResetPhases(t *testing.T) {
+  points := 16
+  halfPoints := points / 2
+
+  // impulse at sample 3 of the frame
+  input := make([]float64, points, points)
+  input[3] = 1.0
+  window := RectangleWindow(points)
+
+  polarSpectrum := make([]float64, points + 2, points + 2)
+  spectrum := make([]float64, points, points)
+
+  WindowFold(input, window, spectrum, 0)
+  RealFFT(spectrum, Time2Freq)
+  CartToPolar(spectrum, polarSpectrum)
+
+  lastPhaseIn := make([]float64, halfPoints + 1, halfPoints + 1)
+  lastPhaseOut := make([]float64, halfPoints + 1, halfPoints + 1)
+
+  // the frame will be overlap-added 5 samples later than it was analyzed
+  ResetPhases(polarSpectrum, lastPhaseIn, lastPhaseOut, points, 5)
+
+  PolarToCart(polarSpectrum, spectrum)
+  RealFFT(spectrum, Freq2Time)
+
+  output := make([]float64, points, points)
+  OverlapAdd(spectrum, window, output, 5)
+
+  // the impulse must stay at the same place relative to the frame
+  for i := 0; i < points; i++ {
+    expected := 0.0
+    if i == 3 {
+      expected = 1.0
+    }
+    Assert(t, math.Abs(output[i] - expected) < 1e-9, "sample %d: expected %f, got %f", i, expected, output[i])
+  }
+
+  Equals(t, lastPhaseOut[2], polarSpectrum[5])
+}
+
+func TestFindPeaks(t *testing.T) {
+  // amplitude, phase pairs for 8 bands
+  polarSpectrum := []float64{
+    1, 0,
+    2, 0,
+    9, 0,
+    3, 0,
+    1, 0,
+    4, 0,
+    7, 0,
+    2, 0,
+  }
+  regions := make([]int, 8, 8)
+
+  peaks := FindPeaks(polarSpectrum, regions, 8)
+
+  Equals(t, []int{2, 6}, peaks)
+  // the trough at band 4 starts the region of the second peak
+  Equals(t, []int{2, 2, 2, 2, 6, 6, 6, 6}, regions)
+
+  // no peaks, every band is its own region
+  peaks = FindPeaks(make([]float64, 16, 16), regions, 8)
+  Equals(t, 0, len(peaks))
+  Equals(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, regions)
+}
+
+func TestPhaseLockerIdentity(t *testing.T) {
+  points := 16
+  halfPoints := points / 2
+
+  polarSpectrum := make([]float64, points + 2, points + 2)
+  analysisPhases := []float64{0.1, -0.4, 1.2, 2.9, -3.0, 0.5, 0.25, -1.5, 3.1}
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    polarSpectrum[bandNumber * 2] = float64(1 + bandNumber % 4)
+    polarSpectrum[bandNumber * 2 + 1] = analysisPhases[bandNumber]
+  }
+
+  lastPhaseIn := make([]float64, halfPoints + 1, halfPoints + 1)
+  lastPhaseOut := make([]float64, halfPoints + 1, halfPoints + 1)
+
+  // without any scaling, identity locking keeps the analysis phases
+  locker := NewPhaseLocker(PhaseLockIdentity, points, points)
+  locker.Interpolate(polarSpectrum, lastPhaseIn, lastPhaseOut, points, 2, 2, 0, 0)
+
+  for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+    Assert(
+      t,
+      math.Abs(princarg(polarSpectrum[bandNumber * 2 + 1] - analysisPhases[bandNumber])) < 1e-9,
+      "band %d: expected phase %f, got %f",
+      bandNumber,
+      analysisPhases[bandNumber],
+      polarSpectrum[bandNumber * 2 + 1],
+    )
+  }
+
+  Equals(t, analysisPhases, lastPhaseIn)
+}
+
+func TestNewPvocPhaseLockMode(t *testing.T) {
+  _, err := NewPvoc(1024, 1.0, 2.0, TimeStretch, PhaseLockScaled, "hamming", 0, 0)
+  Ok(t, err)
+
+  _, err = NewPvoc(1024, 1.0, 2.0, TimeStretch, "sideways", "hamming", 0, 0)
+  Assert(t, err != nil, "invalid phase lock mode should error")
+}
+
+func TestChannelLinker(t *testing.T) {
+  reference, err := ParseLinkReference("sum")
+  Ok(t, err)
+  Equals(t, LinkSum, reference)
+
+  reference, err = ParseLinkReference("2")
+  Ok(t, err)
+  Equals(t, 1, reference)
+
+  _, err = ParseLinkReference("0")
+  Assert(t, err != nil, "channel 0 should error")
+
+  _, err = NewChannelLinker(2, 2, 4)
+  Assert(t, err != nil, "a reference past the last channel should error")
+
+  // 3 bands of 2 channels, amplitude and phase pairs
+  polarBuffers := [][]float64{
+    {1, 0.5, 2, 0.0, 0, 0},
+    {1, -0.5, 1, pi / 2, 0, 0},
+  }
+
+  linker, err := NewChannelLinker(LinkSum, 2, 4)
+  Ok(t, err)
+  linker.Analyze(polarBuffers)
+
+  // the sum of the first band is between the channels' phases
+  Assert(t, math.Abs(linker.Polar[0] - 2 * math.Cos(0.5)) < 1e-9, "sum amplitude %f", linker.Polar[0])
+  Assert(t, math.Abs(linker.Polar[1]) < 1e-9, "sum phase %f", linker.Polar[1])
+  Assert(t, math.Abs(linker.Polar[3] - math.Atan2(1, 2)) < 1e-9, "sum phase %f", linker.Polar[3])
+
+  // advancing the reference advances every channel by as much
+  for i := 1; i < len(linker.Polar); i += 2 {
+    linker.Polar[i] += 1
+  }
+
+  // the channels' own advance, kept where the reference is silent
+  for _, polar := range polarBuffers {
+    for i := 1; i < len(polar); i += 2 {
+      polar[i] += 2
+    }
+  }
+
+  lastPhaseOut := make([]float64, 3)
+  for c, polar := range polarBuffers {
+    linker.Resynthesize(c, polar, lastPhaseOut)
+  }
+  Assert(t, math.Abs(polarBuffers[0][1] - 1.5) < 1e-9, "channel 0 phase %f", polarBuffers[0][1])
+  Assert(t, math.Abs(polarBuffers[1][1] - 0.5) < 1e-9, "channel 1 phase %f", polarBuffers[1][1])
+  Assert(t, math.Abs(polarBuffers[1][3] - princarg(pi / 2 + 1)) < 1e-9, "channel 1 phase %f", polarBuffers[1][3])
+  Equals(t, polarBuffers[1][3], lastPhaseOut[1])
+  Equals(t, 2.0, polarBuffers[0][2])
+  Equals(t, 2.0, polarBuffers[1][5])
+  Equals(t, 0.0, lastPhaseOut[2])
+}
+
+func TestPhaseGradientHeap(t *testing.T) {
+  points := 32
+  halfPoints := points / 2
+  decimation := 2
+  interpolation := 6
+  peak := 8
+  // between the peak band and the next, the analysis phases rotate
+  frequency := twoPi * (float64(peak) + 0.25) / float64(points)
+
+  lastPhaseIn := make([]float64, halfPoints + 1)
+  lastPhaseOut := make([]float64, halfPoints + 1)
+  polarSpectrum := make([]float64, points + 2)
+  analysisPhases := make([]float64, halfPoints + 1)
+  pg := NewPhaseGradientHeap(points)
+
+  for frame := 0; frame < 4; frame++ {
+    inPointer := frame * decimation
+    outPointer := frame * interpolation
+
+    // a steady sinusoid around the peak band, with phases relative to the
+    // absolute input time like Run's analysis: each band rotates by the
+    // sinusoid's distance from the band's center, and the bands around
+    // the peak alternate in phase
+    for bandNumber := 0; bandNumber <= halfPoints; bandNumber++ {
+      polarSpectrum[bandNumber * 2] = 0.0
+      polarSpectrum[bandNumber * 2 + 1] = 0.0
+    }
+    for bandNumber := peak - 1; bandNumber <= peak + 1; bandNumber++ {
+      bandFrequency := twoPi * float64(bandNumber) / float64(points)
+      polarSpectrum[bandNumber * 2] = 1.0 / (1.0 + math.Abs(float64(bandNumber - peak)))
+      polarSpectrum[bandNumber * 2 + 1] = princarg((frequency - bandFrequency) * float64(inPointer) + pi * float64(bandNumber - peak))
+      analysisPhases[bandNumber] = polarSpectrum[bandNumber * 2 + 1]
+    }
+
+    lastPeakPhase := lastPhaseOut[peak]
+    pg.Interpolate(polarSpectrum, lastPhaseIn, lastPhaseOut, points, decimation, interpolation, inPointer, outPointer)
+
+    // the peak advances by its distance from the band's center over the
+    // synthesis hop
+    if frame > 0 {
+      peakFrequency := twoPi * float64(peak) / float64(points)
+      advance := princarg(polarSpectrum[peak * 2 + 1] - lastPeakPhase - (frequency - peakFrequency) * float64(interpolation))
+      Assert(t, math.Abs(advance) < 1e-9, "peak phase advance is off by %f at frame %d", advance, frame)
+    }
+
+    // the neighbors keep their analysis phase difference, moved to the
+    // output time
+    shiftGradient := twoPi * float64((outPointer - inPointer) % points) / float64(points)
+    for _, bandNumber := range []int{peak - 1, peak + 1} {
+      bands := float64(bandNumber - peak)
+      expected := analysisPhases[bandNumber] - analysisPhases[peak] - bands * shiftGradient
+      difference := princarg(polarSpectrum[bandNumber * 2 + 1] - polarSpectrum[peak * 2 + 1] - expected)
+      Assert(t, math.Abs(difference) < 1e-9, "band %d phase difference is off by %f at frame %d", bandNumber, difference, frame)
+    }
+  }
+}
+
+// runs the processor over the input file into a WAV file and reads the
+// output back
+func runToSignals(t *testing.T, processor *Pvoc, inputPath string) [][]float64 {
+  audioReader, err := audioio.NewAudioReader(inputPath, audioio.InputFormat{})
+  Ok(t, err)
+  Ok(t, audioReader.Open(processor.Decimation))
+  defer audioReader.Close()
+
+  return runReaderToSignals(t, processor, audioReader)
+}
+
+// runs the processor over an opened audioReader into a WAV file and reads
+// the output back
+func runReaderToSignals(t *testing.T, processor *Pvoc, audioReader *audioio.AudioReader) [][]float64 {
+  path := filepath.Join(t.TempDir(), "output.wav")
+  audioWriter, err := audioio.NewAudioWriter(audioio.AudioFile{
+    Filepath: path,
+    NumChans: audioReader.GetNumChans(),
+    SampleRate: audioReader.GetSampleRate(),
+    BitDepth: audioReader.GetBitDepth(),
+  }, audioio.OutputFormat{})
+  Ok(t, err)
+  Ok(t, audioWriter.Create(processor.Interpolation))
+
+  progress := make(chan int)
+  errors := make(chan error)
+  done := make(chan bool)
+
+  go processor.Run(audioReader, audioWriter, progress, errors, done)
+
+  for running := true; running; {
+    select {
+    case <-progress:
+    case err := <-errors:
+      t.Fatal(err)
+    case <-done:
+      running = false
+    }
+  }
+
+  audioWriter.Close()
+
+  signals, _, err := audioio.ReadSignals(path, audioio.InputFormat{})
+  Ok(t, err)
+
+  return signals
+}
+
+// the spectral convergence (|| |X| - |Y| || / || |Y| ||) of a time stretched
+// output against the input frames at the matching, unstretched positions
+func stretchConvergence(output, input []float64, points int, scaleFactor float64, latency int) float64 {
+  window := WindowFunctions["hamming"](points)
+  spectrum := make([]float64, points)
+  polar := make([]float64, points + 2)
+  inputPolar := make([]float64, points + 2)
+
+  errorSum := 0.0
+  magnitudeSum := 0.0
+
+  for position := 0; position + points <= len(output); position += points / 4 {
+    inputPosition := int(math.Round(float64(position) / scaleFactor)) - latency
+    if inputPosition < 0 {
+      continue
+    }
+    if inputPosition + points > len(input) {
+      break
+    }
+
+    WindowFold(input[inputPosition:inputPosition + points], window, spectrum, 0)
+    RealFFT(spectrum, Time2Freq)
+    CartToPolar(spectrum, inputPolar)
+
+    WindowFold(output[position:position + points], window, spectrum, 0)
+    RealFFT(spectrum, Time2Freq)
+    CartToPolar(spectrum, polar)
+
+    for bandNumber := 0; bandNumber <= points / 2; bandNumber++ {
+      difference := polar[bandNumber * 2] - inputPolar[bandNumber * 2]
+      errorSum += difference * difference
+      magnitudeSum += inputPolar[bandNumber * 2] * inputPolar[bandNumber * 2]
+    }
+  }
+
+  return math.Sqrt(errorSum / magnitudeSum)
+}
+
+func TestPhaseGradientHeapConvergence(t *testing.T) {
+  bands := 256
+
+  for _, inputPath := range []string{"../fixtures/sine_1_chan.aif", "../fixtures/sine_1_chan.wav"} {
+    input, _, err := audioio.ReadSignals(inputPath, audioio.InputFormat{})
+    Ok(t, err)
+
+    for _, scaleFactor := range []float64{1.5, 2.7, 4.0} {
+      convergence := map[string]float64{}
+
+      for _, mode := range []string{PhaseClassic, PhasePGHI} {
+        processor, err := NewPvoc(bands, 1.0, scaleFactor, TimeStretch, PhaseLockNone, "hamming", 0.0, 0.0)
+        Ok(t, err)
+        Ok(t, processor.SetPhaseReconstruction(mode))
+
+        output := runToSignals(t, processor, inputPath)
+        ratio := float64(processor.Interpolation) / float64(processor.Decimation)
+        convergence[mode] = stretchConvergence(output[0], input[0], processor.Points, ratio, processor.Latency())
+      }
+
+      Assert(t, convergence[PhasePGHI] <= convergence[PhaseClassic],
+        "%s x%g: pghi convergence %f worse than classic %f", inputPath, scaleFactor, convergence[PhasePGHI], convergence[PhaseClassic])
+    }
+  }
+}
+
+// rms of the middle half of a signal
+func middleRms(signal []float64) float64 {
+  middle := signal[len(signal) / 4:len(signal) * 3 / 4]
+  energy := 0.0
+
+  for _, sample := range middle {
+    energy += sample * sample
+  }
+
+  return math.Sqrt(energy / float64(len(middle)))
+}
+
+func TestLinkQuietReference(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[16])
+  sine := func(frequency float64) []float64 {
+    signal := make([]float64, sampleRate)
+    for i := range signal {
+      signal[i] = 0.1 * maxSampleValue * math.Sin(twoPi * frequency * float64(i) / float64(sampleRate))
+    }
+    return signal
+  }
+
+  // the reference is silent, or has nothing where the other channel is
+  for _, reference := range [][]float64{make([]float64, sampleRate), sine(220.0)} {
+    path := filepath.Join(t.TempDir(), "stereo.wav")
+    Ok(t, audioio.WriteSignals(audioio.AudioFile{
+      Filepath: path,
+      NumChans: 2,
+      SampleRate: sampleRate,
+      BitDepth: 16,
+    }, audioio.OutputFormat{}, [][]float64{reference, sine(5000.0)}))
+
+    rms := []float64{}
+
+    for _, link := range []bool{false, true} {
+      processor, err := NewPvoc(1024, 1.0, 2.0, TimeStretch, PhaseLockNone, "hamming", 0.0, 0.0)
+      Ok(t, err)
+      if link {
+        Ok(t, processor.SetChannelLink(0))
+      }
+
+      output := runToSignals(t, processor, path)
+      rms = append(rms, middleRms(output[1]))
+    }
+
+    Assert(t, math.Abs(rms[1] - rms[0]) < 0.05 * rms[0], "linked rms %f, unlinked %f", rms[1], rms[0])
+  }
+}
+
+// the samples where the rms envelope of a signal first and last reaches half
+// of its level in the middle
+func halfLevelEdges(signal []float64) (int, int) {
+  envelope := make([]float64, len(signal))
+  energy := 0.0
+  radius := 200
+
+  for i := -radius; i < len(signal); i++ {
+    if i + radius < len(signal) {
+      energy += signal[i + radius] * signal[i + radius]
+    }
+    if i - radius - 1 >= 0 {
+      energy -= signal[i - radius - 1] * signal[i - radius - 1]
+    }
+    if i >= 0 {
+      envelope[i] = math.Sqrt(math.Max(energy, 0.0) / float64(2 * radius + 1))
+    }
+  }
+
+  level := envelope[len(envelope) / 2]
+  first, last := -1, -1
+
+  for i, value := range envelope {
+    if value > level / 2 {
+      if first < 0 {
+        first = i
+      }
+      last = i
+    }
+  }
+
+  return first, last
+}
+
+func TestLatency(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  // a tone fading in and out over 0.2 seconds, in the middle of a second of
+  // silence on either side
+  signal := make([]float64, sampleRate * 3)
+  for i := sampleRate; i < sampleRate * 2; i++ {
+    fade := math.Min(float64(i - sampleRate), float64(sampleRate * 2 - i)) / (0.2 * float64(sampleRate))
+    gain := 0.5 - 0.5 * math.Cos(pi * math.Min(fade, 1.0))
+    signal[i] = gain * 0.5 * maxSampleValue * math.Sin(twoPi * 440.0 * float64(i) / float64(sampleRate))
+  }
+
+  path := filepath.Join(t.TempDir(), "tone.aif")
+  Ok(t, audioio.WriteSignals(audioio.AudioFile{
+    Filepath: path,
+    NumChans: 1,
+    SampleRate: sampleRate,
+    BitDepth: 24,
+  }, audioio.OutputFormat{}, [][]float64{signal}))
+
+  inputStart, inputEnd := halfLevelEdges(signal)
+
+  // channels passed through unprocessed are delayed by Latency, they stay
+  // in time with the processed ones when it is the lag of the output
+  for _, operation := range []int{TimeStretch, PitchShift} {
+    processor, err := NewPvoc(4096, 1.0, 1.0, operation, PhaseLockNone, "hamming", 0.0, 0.0)
+    Ok(t, err)
+
+    outputStart, outputEnd := halfLevelEdges(runToSignals(t, processor, path)[0])
+    lag := float64(outputStart - inputStart + outputEnd - inputEnd) / 2.0
+    latency := float64(processor.Latency())
+
+    // the envelope of the oscillator bank beats between its bands, so the
+    // pitch shift's lag is only checked to be nearer its latency than none
+    if operation == TimeStretch {
+      Assert(t, math.Abs(lag - latency) < float64(processor.Decimation),
+        "%s output lags by %g samples, latency is %g", OperationNames[operation], lag, latency)
+    } else {
+      Assert(t, math.Abs(lag - latency) < math.Abs(lag),
+        "%s output lags by %g samples, latency is %g", OperationNames[operation], lag, latency)
+    }
+  }
+}
+
+func TestSynthesizeGriffinLim(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  signal := make([]float64, sampleRate / 4)
+  for i := range signal {
+    signal[i] = math.Round(0.5 * math.Sin(twoPi * 440.0 * float64(i) / float64(sampleRate)) * maxSampleValue)
+  }
+
+  spectrogram, err := Analyze(signalReader(t, sampleRate, 128, signal), 512, 1.0, "hamming", 128, nil)
+  Ok(t, err)
+
+  // the magnitudes without their phases
+  random := rand.New(rand.NewSource(1))
+  frames := [][][]float64{make([][]float64, spectrogram.NumFrames())}
+  for f, frame := range spectrogram.Frames[0] {
+    frames[0][f] = append([]float64{}, frame...)
+
+    for bandNumber := 0; bandNumber <= spectrogram.Points / 2; bandNumber++ {
+      frames[0][f][bandNumber * 2 + 1] = random.Float64() * twoPi
+    }
+  }
+  scrambled := append([]float64{}, frames[0][10]...)
+
+  // the level of the middle, by rms since the reconstructed phases needn't
+  // line up with the input's
+  level := func(signal []float64) float64 {
+    energy := 0.0
+    middle := signal[sampleRate / 16:sampleRate * 3 / 16]
+    for _, sample := range middle {
+      energy += sample * sample
+    }
+    return math.Sqrt(energy / float64(len(middle))) / maxSampleValue
+  }
+
+  sineRms := 0.5 / math.Sqrt(2.0)
+  randomLevel := level(spectrogram.Synthesize(frames)[0])
+  Assert(t, randomLevel < sineRms * 0.9, "random phases keep the sine at %f", randomLevel)
+
+  signals, err := spectrogram.SynthesizeGriffinLim(frames, 32)
+  Ok(t, err)
+  Equals(t, len(signal), len(signals[0]))
+  Equals(t, scrambled, frames[0][10])
+  Assert(t, math.Abs(level(signals[0]) - sineRms) < 0.01, "reconstructed sine at %f", level(signals[0]))
+
+  _, err = spectrogram.SynthesizeGriffinLim(frames, 0)
+  Assert(t, err != nil, "0 iterations should error")
+}
+
+func TestGriffinLim(t *testing.T) {
+  points := 64
+  windowSize := points
+  hop := windowSize / 4
+
+  griffinLim, err := NewGriffinLim(points, windowSize, hop, "hamming", 20)
+  Ok(t, err)
+
+  // a sine with some silence on either side
+  signal := make([]float64, windowSize * 12)
+  for i := windowSize * 2; i < windowSize * 10; i++ {
+    signal[i] = 1000.0 * math.Sin(float64(i) * 0.3)
+  }
+
+  positions := []int{}
+  spectra := [][]float64{}
+  spectrum := make([]float64, points)
+
+  for position := 0; position + windowSize <= len(signal); position += hop {
+    WindowFold(signal[position:position + windowSize], griffinLim.analysisWindow, spectrum, position)
+    RealFFT(spectrum, Time2Freq)
+
+    polarSpectrum := make([]float64, points + 2)
+    CartToPolar(spectrum, polarSpectrum)
+
+    positions = append(positions, position)
+    spectra = append(spectra, polarSpectrum)
+  }
+
+  // the analysis phases are already consistent: the signal comes back
+  signals, err := griffinLim.Reconstruct([][][]float64{spectra}, positions, nil)
+  Ok(t, err)
+
+  for i := range signal {
+    Assert(t, math.Abs(signals[0][i] - signal[i]) < 1e-6, "sample %d is %f, expected %f", i, signals[0][i], signal[i])
+  }
+
+  // without phases the magnitudes are approached iteration by iteration
+  for _, polarSpectrum := range spectra {
+    for phaseIndex := 1; phaseIndex < len(polarSpectrum); phaseIndex += 2 {
+      polarSpectrum[phaseIndex] = 0.0
+    }
+  }
+
+  iterations := 0
+  _, err = griffinLim.Reconstruct([][][]float64{spectra}, positions, func(iteration int, convergence float64) {
+    iterations = iteration
+  })
+  Ok(t, err)
+
+  Equals(t, 20, iterations)
+  Equals(t, 20, len(griffinLim.Convergence))
+  Assert(t, griffinLim.Convergence[19] < griffinLim.Convergence[0] / 4.0, "convergence went from %f to %f", griffinLim.Convergence[0], griffinLim.Convergence[19])
+
+  _, err = NewGriffinLim(points, windowSize, hop, "hamming", 0)
+  Assert(t, err != nil, "zero iterations should error")
+}
+
+// writes a test file of sines (frequency, amplitude pairs relative to full
+// scale) and opens it for analysis
+func sinesReader(t *testing.T, sampleRate, length, bufferLength int, sines ...float64) *audioio.AudioReader {
+  signal := make([]float64, length)
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  for i := range signal {
+    for s := 0; s < len(sines); s += 2 {
+      signal[i] += sines[s + 1] * maxSampleValue * math.Sin(twoPi * sines[s] * float64(i) / float64(sampleRate))
+    }
+  }
+
+  return signalReader(t, sampleRate, bufferLength, signal)
+}
+
+// writes a 24 bit mono file and opens it
+func signalReader(t *testing.T, sampleRate, bufferLength int, signal []float64) *audioio.AudioReader {
+  path := filepath.Join(t.TempDir(), "signal.aif")
+
+  err := audioio.WriteSignals(audioio.AudioFile{
+    Filepath: path,
+    NumChans: 1,
+    SampleRate: sampleRate,
+    BitDepth: 24,
+  }, audioio.OutputFormat{}, [][]float64{signal})
+  Ok(t, err)
+
+  audioReader, err := audioio.NewAudioReader(path, audioio.InputFormat{})
+  Ok(t, err)
+  Ok(t, audioReader.Open(bufferLength))
+  t.Cleanup(audioReader.Close)
+
+  return audioReader
+}
+
+func TestPartialTracker(t *testing.T) {
+  sampleRate := 44100
+  audioReader := sinesReader(t, sampleRate, sampleRate / 2, 128, 440.0, 0.5, 1000.0, 0.25)
+
+  spectrogram, err := Analyze(audioReader, 512, 1.0, "hamming", 128, nil)
+  Ok(t, err)
+
+  tracker, err := NewPartialTracker(-40, 50, 0.1, 0)
+  Ok(t, err)
+
+  partials := tracker.Track(spectrogram)
+  Equals(t, 2, len(partials))
+
+  // both partials start together, in no particular order
+  if partials[0].Frames[0].Frequency > partials[1].Frames[0].Frequency {
+    partials[0], partials[1] = partials[1], partials[0]
+  }
+
+  for i, expected := range [][2]float64{{440.0, 0.5}, {1000.0, 0.25}} {
+    partial := partials[i]
+    frame := partial.Frames[len(partial.Frames) / 2]
+
+    Assert(t, math.Abs(frame.Frequency - expected[0]) < 1.0, "partial frequency %f, expected %f", frame.Frequency, expected[0])
+    Assert(t, math.Abs(frame.Amplitude - expected[1]) < 0.01, "partial amplitude %f, expected %f", frame.Amplitude, expected[1])
+    Assert(t, partial.Death() - partial.Birth() > 0.4, "partial only lasts %f seconds", partial.Death() - partial.Birth())
+  }
+
+  // resynthesis an octave up at double length
+  signals, err := SynthesizePartials(partials, 1, sampleRate, 2.0, 2.0, 1.0)
+  Ok(t, err)
+
+  Assert(t, len(signals[0]) > sampleRate, "resynthesis is %d samples long", len(signals[0]))
+
+  // the 880 Hz partial makes 8.8 cycles every 10 ms in the middle
+  middle := signals[0][sampleRate / 2:sampleRate / 2 + sampleRate / 100]
+  energy := 0.0
+  for _, sample := range middle {
+    energy += sample * sample
+  }
+  rms := math.Sqrt(energy / float64(len(middle)))
+  Assert(t, math.Abs(rms - math.Sqrt(0.5 * 0.5 / 2 + 0.25 * 0.25 / 2)) < 0.02, "resynthesis rms %f", rms)
+
+  _, err = SynthesizePartials(partials, 1, sampleRate, 0.0, 1.0, 1.0)
+  Assert(t, err != nil, "zero time scale should error")
+}
+
+func TestPartialFiles(t *testing.T) {
+  partials := []*Partial{
+    {ID: 1, Channel: 0, Frames: []PartialFrame{{0.0, 440.0, 0.5, 0.1}, {0.01, 441.0, 0.4, -0.2}}},
+    {ID: 2, Channel: 1, Frames: []PartialFrame{{0.01, 1000.0, 0.25, 3.0}}},
+  }
+
+  for _, format := range PartialFormats {
+    path := filepath.Join(t.TempDir(), "partials." + format)
+
+    Ok(t, WritePartials(path, partials, 48000))
+
+    read, sampleRate, err := ReadPartials(path)
+    Ok(t, err)
+    Equals(t, partials, read)
+
+    if format != PartialsCSV {
+      Equals(t, 48000, sampleRate)
+    }
+  }
+
+  _, err := PartialFormat("partials.txt")
+  Assert(t, err != nil, "unknown extension should error")
+}
+
+func TestDecompose(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+  random := rand.New(rand.NewSource(1))
+
+  // a sine over uniform noise, rounded the way the file stores it
+  signal := make([]float64, sampleRate / 2)
+  for i := range signal {
+    sine := 0.5 * math.Sin(twoPi * 440.0 * float64(i) / float64(sampleRate))
+    noise := 0.05 * (random.Float64() * 2.0 - 1.0)
+    signal[i] = math.Round((sine + noise) * maxSampleValue)
+  }
+
+  spectrogram, err := Analyze(signalReader(t, sampleRate, 128, signal), 512, 1.0, "hamming", 128, nil)
+  Ok(t, err)
+
+  // unmodified frames resynthesize to the input
+  resynthesis := spectrogram.Synthesize(spectrogram.Frames)
+  for i := range signal {
+    Assert(t, math.Abs(resynthesis[0][i] - signal[i]) < 1e-6 * maxSampleValue, "resynthesis is off by %f at %d", resynthesis[0][i] - signal[i], i)
+  }
+
+  tracker, err := NewPartialTracker(-30, 50, 0.1, 0)
+  Ok(t, err)
+
+  deterministic, residual, err := Decompose(spectrogram, tracker.Track(spectrogram), [][]float64{signal})
+  Ok(t, err)
+
+  for i := range signal {
+    Assert(t, math.Abs(deterministic[0][i] + residual[0][i] - signal[i]) < 1e-9, "components don't sum to the input at %d", i)
+  }
+
+  rms := func(signal []float64) float64 {
+    energy := 0.0
+    middle := signal[len(signal) / 4:len(signal) * 3 / 4]
+    for _, sample := range middle {
+      energy += sample * sample
+    }
+    return math.Sqrt(energy / float64(len(middle))) / maxSampleValue
+  }
+
+  sineRms := 0.5 / math.Sqrt(2.0)
+  noiseRms := 0.05 / math.Sqrt(3.0)
+
+  Assert(t, math.Abs(rms(deterministic[0]) - sineRms) < 0.05 * sineRms, "deterministic rms %f, expected %f", rms(deterministic[0]), sineRms)
+  Assert(t, math.Abs(rms(residual[0]) - noiseRms) < 0.1 * noiseRms, "residual rms %f, expected %f", rms(residual[0]), noiseRms)
+
+  _, _, err = Decompose(spectrogram, nil, [][]float64{signal, signal})
+  Assert(t, err != nil, "wrong number of input signals should error")
+}
+
+func TestHarmonicPercussive(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  // a sine with a click every 100 ms
+  signal := make([]float64, sampleRate / 2)
+  for i := range signal {
+    signal[i] = math.Round(0.25 * maxSampleValue * math.Sin(twoPi * 440.0 * float64(i) / float64(sampleRate)))
+  }
+  for i := sampleRate / 20; i < len(signal); i += sampleRate / 10 {
+    signal[i] += 0.5 * maxSampleValue
+  }
+
+  spectrogram, err := Analyze(signalReader(t, sampleRate, 128, signal), 512, 1.0, "hamming", 128, nil)
+  Ok(t, err)
+
+  for _, mask := range HPSSMasks {
+    separator, err := NewHarmonicPercussive(DefaultHarmonicFrames, DefaultPercussiveBands, mask, DefaultHPSSPower)
+    Ok(t, err)
+
+    harmonicFrames, percussiveFrames := separator.Separate(spectrogram)
+    harmonic := spectrogram.Synthesize(harmonicFrames)[0]
+    percussive := spectrogram.Synthesize(percussiveFrames)[0]
+
+    // the masks split every band, the layers sum back to the input
+    for i := range signal {
+      Assert(t, math.Abs(harmonic[i] + percussive[i] - signal[i]) < 1e-6 * maxSampleValue, "%s layers don't sum to the input at %d", mask, i)
+    }
+
+    // between two clicks the harmonic layer is the sine and the percussive
+    // layer is quiet, around a click it's the other way around
+    rms := func(signal []float64, start, end int) float64 {
+      energy := 0.0
+      for _, sample := range signal[start:end] {
+        energy += sample * sample
+      }
+      return math.Sqrt(energy / float64(end - start)) / maxSampleValue
+    }
+
+    between := sampleRate / 10
+    click := sampleRate / 20 + sampleRate / 10
+
+    Assert(t, math.Abs(rms(harmonic, between - 500, between + 500) - 0.25 / math.Sqrt(2.0)) < 0.02, "%s harmonic layer rms %f", mask, rms(harmonic, between - 500, between + 500))
+    Assert(t, rms(percussive, between - 500, between + 500) < 0.02, "%s percussive layer rms %f between clicks", mask, rms(percussive, between - 500, between + 500))
+    // a single sample click of 0.5 has an rms of 0.05 over 100 samples
+    Assert(t, rms(percussive, click - 50, click + 50) > 0.04, "%s percussive layer rms %f at a click", mask, rms(percussive, click - 50, click + 50))
+    Assert(t, math.Abs(rms(harmonic, click - 50, click + 50) - 0.25 / math.Sqrt(2.0)) < 0.02, "%s harmonic layer rms %f at a click", mask, rms(harmonic, click - 50, click + 50))
+  }
+
+  _, err = NewHarmonicPercussive(17, 17, "fuzzy", 2.0)
+  Assert(t, err != nil, "unknown mask should error")
+}
+
+func TestRealignSegments(t *testing.T) {
+  signal := make([]float64, 100)
+  signal[20] = 1.0
+  signal[60] = 2.0
+
+  // the onsets move with the stretch, the segments don't
+  stretched := RealignSegments(signal, []int{20, 60}, 2.0, 2, 1)
+  Equals(t, 200, len(stretched))
+  Equals(t, 1.0, stretched[40])
+  Equals(t, 2.0, stretched[120])
+
+  compressed := RealignSegments(signal, []int{20, 60}, 0.5, 2, 1)
+  Equals(t, 50, len(compressed))
+  Equals(t, 1.0, compressed[10])
+  Equals(t, 2.0, compressed[30])
+
+  total := 0.0
+  for _, sample := range compressed {
+    total += sample
+  }
+  Equals(t, 3.0, total)
+}
+
+func TestSpliceRegion(t *testing.T) {
+  original := make([]float64, 100)
+  for i := range original {
+    original[i] = 1.0
+  }
+
+  region := make([]float64, 80)
+  for i := range region {
+    region[i] = 3.0
+  }
+
+  // 40 samples stretched to 80, crossfading over 10 at each end
+  spliced := SpliceRegion(original, region, 30, 70, 10)
+  Equals(t, 140, len(spliced))
+  Equals(t, 1.0, spliced[29])
+  Equals(t, 3.0, spliced[40])
+  Equals(t, 3.0, spliced[99])
+  Equals(t, 1.0, spliced[110])
+  Assert(t, spliced[30] > 1.0 && spliced[30] < 1.1, "crossfade should start from the original, got %g", spliced[30])
+  Assert(t, spliced[109] > 1.0 && spliced[109] < 1.1, "crossfade should end on the original, got %g", spliced[109])
+
+  // the crossfades are no longer than half the region
+  spliced = SpliceRegion(original, region[:4], 30, 70, 10)
+  Equals(t, 64, len(spliced))
+  Equals(t, 1.0, spliced[29])
+  Equals(t, 1.0, spliced[34])
+}
+
+func TestCutRegion(t *testing.T) {
+  processed := make([]float64, 100)
+  for i := range processed {
+    processed[i] = float64(i)
+  }
+
+  // 10 samples of context and 5 of latency, stretched twice as long
+  region := CutRegion(processed, 10, 20, 5, 2.0)
+  Equals(t, 40, len(region))
+  Equals(t, 30.0, region[0])
+  Equals(t, 69.0, region[39])
+
+  // padded when the processed output ends early
+  region = CutRegion(processed[:50], 10, 20, 5, 2.0)
+  Equals(t, 49.0, region[19])
+  Equals(t, 0.0, region[20])
+
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  // the same tone as TestLatency, its edges inside the region
+  signal := make([]float64, sampleRate * 3)
+  for i := sampleRate; i < sampleRate * 2; i++ {
+    fade := math.Min(float64(i - sampleRate), float64(sampleRate * 2 - i)) / (0.2 * float64(sampleRate))
+    gain := 0.5 - 0.5 * math.Cos(pi * math.Min(fade, 1.0))
+    signal[i] = gain * 0.5 * maxSampleValue * math.Sin(twoPi * 440.0 * float64(i) / float64(sampleRate))
+  }
+
+  path := filepath.Join(t.TempDir(), "tone.aif")
+  Ok(t, audioio.WriteSignals(audioio.AudioFile{
+    Filepath: path,
+    NumChans: 1,
+    SampleRate: sampleRate,
+    BitDepth: 24,
+  }, audioio.OutputFormat{}, [][]float64{signal}))
+
+  processor, err := NewPvoc(512, 1.0, 1.0, TimeStretch, PhaseLockNone, "hamming", 0.0, 0.0)
+  Ok(t, err)
+
+  start, end := sampleRate / 2, sampleRate * 5 / 2
+
+  audioReader, err := audioio.NewAudioReader(path, audioio.InputFormat{})
+  Ok(t, err)
+  Ok(t, audioReader.Open(processor.Decimation))
+  defer audioReader.Close()
+  Ok(t, audioReader.SetRange(start - processor.WindowSize, end + processor.WindowSize))
+
+  processed = runReaderToSignals(t, processor, audioReader)[0]
+  region = CutRegion(processed, processor.WindowSize, end - start, processor.Latency(), 1.0)
+
+  // the tone stays where it was in the input once the region is spliced back
+  inputStart, inputEnd := halfLevelEdges(signal)
+  outputStart, outputEnd := halfLevelEdges(SpliceRegion(signal, region, start, end, 0))
+
+  Assert(t, math.Abs(float64(outputStart - inputStart)) < float64(processor.Decimation) / 2.0,
+    "tone starts at %d in the spliced region, %d in the input", outputStart, inputStart)
+  Assert(t, math.Abs(float64(outputEnd - inputEnd)) < float64(processor.Decimation) / 2.0,
+    "tone ends at %d in the spliced region, %d in the input", outputEnd, inputEnd)
+}
+
+func TestEnvelope(t *testing.T) {
+  envelope, err := ParseEnvelope(strings.NewReader("# blur width\n0 1\n1.0, 3\n\n2\t3\n2 10\n"))
+  Ok(t, err)
+
+  Equals(t, []float64{0.0, 1.0, 2.0, 2.0}, envelope.Times)
+  Equals(t, 1.0, envelope.Value(-1.0))
+  Equals(t, 2.0, envelope.Value(0.5))
+  Equals(t, 3.0, envelope.Value(1.5))
+  // the step at 2 seconds
+  Equals(t, 10.0, envelope.Value(2.0))
+  Equals(t, 10.0, envelope.Value(5.0))
+  Equals(t, 1.0, envelope.Min())
+  Equals(t, 10.0, envelope.Max())
+
+  var written strings.Builder
+  Ok(t, envelope.Write(&written))
+  read, err := ParseEnvelope(strings.NewReader(written.String()))
+  Ok(t, err)
+  Equals(t, envelope, read)
+
+  _, err = ParseEnvelope(strings.NewReader("1 1\n0 2\n"))
+  Assert(t, err != nil, "decreasing times should error")
+
+  _, err = ParseEnvelope(strings.NewReader("0 1 2\n"))
+  Assert(t, err != nil, "three columns should error")
+
+  _, err = ParseEnvelope(strings.NewReader("# nothing\n"))
+  Assert(t, err != nil, "an empty envelope should error")
+}
+
+func TestSpectralBlur(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  // a sine with a click in the middle
+  signal := make([]float64, sampleRate / 2)
+  for i := range signal {
+    signal[i] = math.Round(0.25 * maxSampleValue * math.Sin(twoPi * 440.0 * float64(i) / float64(sampleRate)))
+  }
+  click := sampleRate / 4
+  signal[click] += 0.5 * maxSampleValue
+
+  for _, overlap := range []float64{0.5, 1.0, 2.0, 4.0} {
+    decimation := int(128.0 * overlap / 4.0)
+    spectrogram, err := Analyze(signalReader(t, sampleRate, decimation, signal), 128, overlap, "hamming", decimation, nil)
+    Ok(t, err)
+
+    // a width of 1 changes nothing
+    blur, err := NewSpectralBlur(ConstantEnvelope(1.0), true)
+    Ok(t, err)
+    Equals(t, spectrogram.Frames, blur.Blur(spectrogram))
+
+    // wider, the click is smeared over the frames around it and the sine
+    // keeps its level
+    blur, err = NewSpectralBlur(ConstantEnvelope(16.0), false)
+    Ok(t, err)
+    blurredSignals, err := blur.BlurSignals(spectrogram)
+    Ok(t, err)
+    blurred := blurredSignals[0]
+
+    peak := 0.0
+    for i := click - 10; i <= click + 10; i++ {
+      peak = math.Max(peak, math.Abs(blurred[i]))
+    }
+    Assert(t, peak < 0.5 * maxSampleValue, "overlap %f: click peak %f is not blurred", overlap, peak / maxSampleValue)
+
+    energy := 0.0
+    for _, sample := range blurred[sampleRate / 20:sampleRate / 10] {
+      energy += sample * sample
+    }
+    rms := math.Sqrt(energy / float64(sampleRate / 20)) / maxSampleValue
+    Assert(t, math.Abs(rms - 0.25 / math.Sqrt(2.0)) < 0.01, "overlap %f: sine rms %f", overlap, rms)
+
+    // the edges fade to silence
+    Assert(t, math.Abs(blurred[0]) < 1e-3 * maxSampleValue, "overlap %f: first sample %f", overlap, blurred[0])
+    Assert(t, math.Abs(blurred[len(blurred) - 1]) < 1e-3 * maxSampleValue, "overlap %f: last sample %f", overlap, blurred[len(blurred) - 1])
+
+    // with the phases reconstructed the sine keeps its level too
+    blur.GriffinLimIterations = 8
+    blurredSignals, err = blur.BlurSignals(spectrogram)
+    Ok(t, err)
+    level := sineAmplitude(blurredSignals[0][sampleRate / 20:sampleRate / 10], 440.0, sampleRate) / maxSampleValue
+    Assert(t, math.Abs(level - 0.25) < 0.01, "overlap %f: reconstructed sine at %f", overlap, level)
+  }
+
+  _, err := NewSpectralBlur(ConstantEnvelope(0.5), false)
+  Assert(t, err != nil, "a width below 1 frame should error")
+}
+
+// the amplitude of a sine at frequency in signal, by correlation
+func sineAmplitude(signal []float64, frequency float64, sampleRate int) float64 {
+  real, imag := 0.0, 0.0
+
+  for i, sample := range signal {
+    phase := twoPi * frequency * float64(i) / float64(sampleRate)
+    real += sample * math.Cos(phase)
+    imag += sample * math.Sin(phase)
+  }
+
+  return 2.0 * math.Hypot(real, imag) / float64(len(signal))
+}
+
+func TestMorph(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  a, err := Analyze(sinesReader(t, sampleRate, sampleRate / 2, 256, 440.0, 0.5), 512, 2.0, "hamming", 256, nil)
+  Ok(t, err)
+
+  b, err := Analyze(sinesReader(t, sampleRate, sampleRate / 4, 256, 660.0, 0.5), 512, 2.0, "hamming", 256, nil)
+  Ok(t, err)
+
+  // the middle of A
+  middle := func(signal []float64) []float64 {
+    return signal[sampleRate / 8:sampleRate / 8 + sampleRate / 10]
+  }
+
+  // band by band, A and B are far apart so their bands are mixed
+  for _, position := range []float64{0.0, 0.5, 1.0} {
+    morph, err := NewMorph(ConstantEnvelope(position), MorphBins, true)
+    Ok(t, err)
+
+    frames, err := morph.MorphFrames(a, b)
+    Ok(t, err)
+
+    signal := morph.OutputSpectrogram(a, b).Synthesize(frames)[0]
+    Equals(t, a.NumSampleFrames, len(signal))
+
+    aLevel := sineAmplitude(middle(signal), 440.0, sampleRate) / maxSampleValue
+    bLevel := sineAmplitude(middle(signal), 660.0, sampleRate) / maxSampleValue
+    Assert(t, math.Abs(aLevel - 0.5 * (1.0 - position)) < 0.02, "morph %f: 440 Hz at %f", position, aLevel)
+    Assert(t, math.Abs(bLevel - 0.5 * position) < 0.02, "morph %f: 660 Hz at %f", position, bLevel)
+  }
+
+  // without normalizing, B ends halfway through A
+  morph, err := NewMorph(ConstantEnvelope(1.0), MorphBins, false)
+  Ok(t, err)
+
+  frames, err := morph.MorphFrames(a, b)
+  Ok(t, err)
+
+  signal := morph.OutputSpectrogram(a, b).Synthesize(frames)[0]
+  level := sineAmplitude(signal[sampleRate / 3:sampleRate / 2 - 1000], 660.0, sampleRate) / maxSampleValue
+  Assert(t, level < 0.01, "660 Hz at %f after the end of B", level)
+
+  // partial by partial, A and B a whole tone apart glide between each other
+  tracker, err := NewPartialTracker(-40, 50, 0.05, 0)
+  Ok(t, err)
+
+  c, err := Analyze(sinesReader(t, sampleRate, sampleRate / 2, 256, 495.0, 0.25), 512, 2.0, "hamming", 256, nil)
+  Ok(t, err)
+
+  ramp, err := NewEnvelope([]float64{0.0, 0.5}, []float64{0.0, 1.0})
+  Ok(t, err)
+
+  morph, err = NewMorph(ramp, MorphPartials, false)
+  Ok(t, err)
+
+  aPartials := tracker.Track(a)
+  cPartials := tracker.Track(c)
+  partials := morph.MorphPartials(aPartials, cPartials, 0.5, 0.5)
+  Equals(t, 1, len(partials))
+
+  // halfway through the ramp
+  aAmplitude, aFrequency := partialAt(aPartials[0], 0.25)
+  cAmplitude, cFrequency := partialAt(cPartials[0], 0.25)
+  amplitude, frequency := partialAt(partials[0], 0.25)
+
+  expected := (aFrequency * aAmplitude + cFrequency * cAmplitude) / (aAmplitude + cAmplitude)
+  Assert(t, math.Abs(frequency - expected) < 0.1, "morphed frequency %f, expected %f", frequency, expected)
+  Assert(t, frequency > 450.0 && frequency < 480.0, "morphed frequency %f", frequency)
+  Assert(t, math.Abs(amplitude - (aAmplitude + cAmplitude) / 2.0) < 1e-6, "morphed amplitude %f", amplitude)
+
+  // partials that don't overlap in time are kept separate, fading out and in
+  late, err := Analyze(sinesReader(t, sampleRate, sampleRate, 256, 495.0, 0.25), 512, 2.0, "hamming", 256, nil)
+  Ok(t, err)
+
+  latePartials := tracker.Track(late)
+  for i := range latePartials[0].Frames {
+    latePartials[0].Frames[i].Time += 1.0
+  }
+
+  partials = morph.MorphPartials(aPartials, latePartials, 0.5, 2.0)
+  Equals(t, 2, len(partials))
+  amplitude, _ = partialAt(partials[1], 1.5)
+  Assert(t, math.Abs(amplitude - cAmplitude) < 0.01, "unmatched partial amplitude %f", amplitude)
+
+  // normalized, B is squeezed onto A and the partials overlap
+  normalized, err := NewMorph(ramp, MorphPartials, true)
+  Ok(t, err)
+  Equals(t, 1, len(normalized.MorphPartials(aPartials, latePartials, 0.5, 2.0)))
+
+  _, err = NewMorph(ConstantEnvelope(1.5), MorphBins, false)
+  Assert(t, err != nil, "a curve above 1 should error")
+
+  _, err = NewMorph(ConstantEnvelope(0.5), "cross", false)
+  Assert(t, err != nil, "an unknown mode should error")
+
+  d, err := Analyze(sinesReader(t, sampleRate, sampleRate / 4, 128, 660.0, 0.5), 256, 2.0, "hamming", 128, nil)
+  Ok(t, err)
+
+  _, err = morph.MorphFrames(a, d)
+  Assert(t, err != nil, "different FFT settings should error")
+}
+
+func TestSpectralOperation(t *testing.T) {
+  // 8 bands of 100 Hz at a sample rate of 1600, amplitude and phase pairs
+  spectrum := func() []float64 {
+    return []float64{
+      0, 0.0,
+      1, 0.1,
+      2, 0.2,
+      3, 0.3,
+      4, 0.4,
+      5, 0.5,
+      6, 0.6,
+      7, 0.7,
+      8, 0.0,
+    }
+  }
+
+  apply := func(operation *SpectralOperation) []float64 {
+    polarSpectrum := spectrum()
+    operation.Apply(polarSpectrum, 1600)
+    return polarSpectrum
+  }
+
+  // the whole spectrum mirrored around 400 Hz, the phases deviate the other
+  // way
+  mirror, err := NewSpectralOperation(SpectralMirror, 0, 0, 0, 0, 0, 1)
+  Ok(t, err)
+  Equals(t, []float64{8, -0.0, 7, -0.7, 6, -0.6, 5, -0.5, 4, -0.4, 3, -0.3, 2, -0.2, 1, -0.1, 0, -0.0}, apply(mirror))
+
+  // 100 to 400 Hz around 200 Hz, band 4 lands below the range
+  mirror, err = NewSpectralOperation(SpectralMirror, 100, 400, 200, 0, 0, 1)
+  Ok(t, err)
+  Equals(t, []float64{0, 0.0, 3, -0.3, 2, -0.2, 1, -0.1, 0, 0, 5, 0.5, 6, 0.6, 7, 0.7, 8, 0.0}, apply(mirror))
+
+  swap, err := NewSpectralOperation(SpectralSwap, 100, 200, 0, 500, 0, 1)
+  Ok(t, err)
+  Equals(t, []float64{0, 0.0, 5, 0.5, 6, 0.6, 3, 0.3, 4, 0.4, 1, 0.1, 2, 0.2, 7, 0.7, 8, 0.0}, apply(swap))
+
+  invert, err := NewSpectralOperation(SpectralInvert, 0, 300, 0, 0, 0, 1)
+  Ok(t, err)
+  Equals(t, []float64{3, 0.0, 2, 0.1, 1, 0.2, 0, 0.3, 4, 0.4, 5, 0.5, 6, 0.6, 7, 0.7, 8, 0.0}, apply(invert))
+
+  // shuffling moves whole blocks, the same way for the same seed
+  shuffle, err := NewSpectralOperation(SpectralShuffle, 100, 0, 0, 0, 42, 2)
+  Ok(t, err)
+  shuffled := apply(shuffle)
+
+  other, err := NewSpectralOperation(SpectralShuffle, 100, 0, 0, 0, 42, 2)
+  Ok(t, err)
+  Equals(t, shuffled, apply(other))
+
+  Equals(t, spectrum()[:2], shuffled[:2])
+  for i := 2; i < len(shuffled); i += 4 {
+    // each block starts on an odd band and keeps its order
+    Assert(t, int(shuffled[i]) % 2 == 1, "block at band %d starts with band %f", i / 2, shuffled[i])
+    Equals(t, shuffled[i] + 1, shuffled[i + 2])
+  }
+
+  // a seed that happens to give the same order is possible, not likely
+  changed := false
+  for seed := int64(1); seed < 4; seed++ {
+    other, err = NewSpectralOperation(SpectralShuffle, 100, 0, 0, 0, seed, 2)
+    Ok(t, err)
+    changed = changed || !equalSlices(shuffled, apply(other))
+  }
+  Assert(t, changed, "different seeds should shuffle differently")
+
+  // a sine is mirrored to the other side of the pivot
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  spectrogram, err := Analyze(sinesReader(t, sampleRate, sampleRate / 4, 256, 1000.0, 0.5), 512, 2.0, "hamming", 256, nil)
+  Ok(t, err)
+
+  mirror, err = NewSpectralOperation(SpectralMirror, 0, 4000, 0, 0, 0, 1)
+  Ok(t, err)
+
+  for _, frame := range spectrogram.Frames[0] {
+    mirror.Apply(frame, sampleRate)
+  }
+
+  signal := spectrogram.Synthesize(spectrogram.Frames)[0][sampleRate / 16:sampleRate / 16 + sampleRate / 10]
+  // 4000 Hz isn't on a band, the pivot is rounded to the nearest half band
+  pivot := float64(frequencyBand(4000, 1024, sampleRate)) * float64(sampleRate) / 1024.0 / 2.0
+  mirrored := sineAmplitude(signal, 2.0 * pivot - 1000.0, sampleRate) / maxSampleValue
+  Assert(t, math.Abs(mirrored - 0.5) < 0.02, "mirrored sine at %f", mirrored)
+  Assert(t, sineAmplitude(signal, 1000.0, sampleRate) / maxSampleValue < 0.01, "the original sine is left")
+
+  _, err = NewSpectralOperation("reverse", 0, 0, 0, 0, 0, 1)
+  Assert(t, err != nil, "an unknown operation should error")
+
+  _, err = NewSpectralOperation(SpectralSwap, 100, 200, 0, 150, 0, 1)
+  Assert(t, err != nil, "overlapping swap ranges should error")
+
+  _, err = NewSpectralOperation(SpectralShuffle, 0, 0, 0, 0, 0, 0)
+  Assert(t, err != nil, "a shuffle width of 0 should error")
+}
+
+func TestPitchDetector(t *testing.T) {
+  sampleRate := 44100
+
+  // a harmonic tone, its fundamental a bit below the A
+  spectrogram, err := Analyze(
+    sinesReader(t, sampleRate, sampleRate / 2, 256, 217.0, 0.3, 434.0, 0.2, 651.0, 0.1, 868.0, 0.05),
+    1024,
+    1.0,
+    "hamming",
+    256,
+    nil,
+  )
+  Ok(t, err)
+
+  detector, err := NewPitchDetector(DefaultMinPitch, DefaultMaxPitch, DefaultPitchConfidence, 2048, 2048, sampleRate, 256)
+  Ok(t, err)
+
+  autotune, err := NewAutotune("chromatic", 9, DefaultTuningReference, 0.0, detector)
+  Ok(t, err)
+
+  frameDuration := 256.0 / float64(sampleRate)
+  ratios := []float64{}
+
+  for f := 0; f < spectrogram.NumFrames(); f++ {
+    ratios = append(ratios, autotune.Correct([][]float64{spectrogram.Frames[0][f]}, spectrogram.FrameTime(f), frameDuration, 1.0))
+  }
+
+  // frames before the start of the file are corrected but not kept
+  skipped := len(ratios) - len(autotune.Frames)
+  middle := autotune.Frames[len(ratios) / 2 - skipped]
+  Assert(t, math.Abs(middle.Detected - 217.0) < 0.5, "detected %f Hz", middle.Detected)
+  Assert(t, middle.Confidence > 0.9, "confidence %f", middle.Confidence)
+  Assert(t, math.Abs(middle.Target - 220.0) < 1e-9, "target %f Hz", middle.Target)
+  Assert(t, math.Abs(middle.Corrected - 220.0) < 1e-9, "corrected to %f Hz", middle.Corrected)
+  Assert(t, math.Abs(ratios[len(ratios) / 2] - 220.0 / middle.Detected) < 1e-9, "ratio %f", ratios[len(ratios) / 2])
+
+  // with a retune time the correction takes a while to get there
+  detector, err = NewPitchDetector(DefaultMinPitch, DefaultMaxPitch, DefaultPitchConfidence, 2048, 2048, sampleRate, 256)
+  Ok(t, err)
+
+  autotune, err = NewAutotune("chromatic", 9, DefaultTuningReference, 0.05, detector)
+  Ok(t, err)
+
+  for f := 0; f < spectrogram.NumFrames(); f++ {
+    autotune.Correct([][]float64{spectrogram.Frames[0][f]}, spectrogram.FrameTime(f), frameDuration, 1.0)
+  }
+
+  early := autotune.Frames[5]
+  Assert(t, early.Corrected > early.Detected && early.Corrected < 219.5, "corrected to %f Hz after 5 frames", early.Corrected)
+  last := autotune.Frames[len(autotune.Frames) - 20]
+  Assert(t, math.Abs(last.Corrected - 220.0) < 0.5, "corrected to %f Hz at the end", last.Corrected)
+
+  var csv strings.Builder
+  Ok(t, autotune.WriteCSV(&csv))
+  Equals(t, len(autotune.Frames) + 1, strings.Count(csv.String(), "\n"))
+
+  // the first windows are centered before the start of the file, the CSV
+  // starts at it
+  Assert(t, spectrogram.FrameTime(0) < 0.0, "the first frame is at %f s", spectrogram.FrameTime(0))
+  firstTime, err := strconv.ParseFloat(strings.Split(strings.Split(csv.String(), "\n")[1], ",")[0], 64)
+  Ok(t, err)
+  Assert(t, firstTime >= 0.0, "the CSV starts at %f s", firstTime)
+
+  // noise isn't voiced
+  random := rand.New(rand.NewSource(1))
+  noise := make([]float64, sampleRate / 4)
+  for i := range noise {
+    noise[i] = (random.Float64() - 0.5) * float64(audioio.IntMaxSignedValue[24]) * 0.5
+  }
+
+  spectrogram, err = Analyze(signalReader(t, sampleRate, 256, noise), 1024, 1.0, "hamming", 256, nil)
+  Ok(t, err)
+
+  detector, err = NewPitchDetector(DefaultMinPitch, DefaultMaxPitch, DefaultPitchConfidence, 2048, 2048, sampleRate, 256)
+  Ok(t, err)
+
+  frequency, confidence := detector.Detect([][]float64{spectrogram.Frames[0][spectrogram.NumFrames() / 2]})
+  Assert(t, frequency == 0.0, "noise detected at %f Hz with confidence %f", frequency, confidence)
+
+  _, err = NewPitchDetector(500, 100, DefaultPitchConfidence, 2048, 2048, sampleRate, 256)
+  Assert(t, err != nil, "an inverted range should error")
+}
+
+func TestAutotuneScales(t *testing.T) {
+  for key, expected := range map[string]int{"C": 0, "F#": 6, "Bb": 10, "Cb": 11, "e": 4} {
+    semitones, err := ParseKey(key)
+    Ok(t, err)
+    Equals(t, expected, semitones)
+  }
+
+  _, err := ParseKey("H")
+  Assert(t, err != nil, "H is not a key")
+
+  _, err = ParseKey("C##")
+  Assert(t, err != nil, "C## is not a key")
+
+  autotune, err := NewAutotune("major", 0, DefaultTuningReference, 0.0, nil)
+  Ok(t, err)
+
+  // A# isn't in C major, A is nearer than B
+  Assert(t, math.Abs(autotune.Nearest(460.0) - 440.0) < 1e-9, "460 Hz snaps to %f", autotune.Nearest(460.0))
+  // across the octave, B3 to C4
+  Assert(t, math.Abs(autotune.Nearest(255.0) - 261.6256) < 1e-3, "255 Hz snaps to %f", autotune.Nearest(255.0))
+
+  autotune, err = NewAutotune("chromatic", 0, 442.0, 0.0, nil)
+  Ok(t, err)
+  Assert(t, math.Abs(autotune.Nearest(460.0) - 442.0 * math.Pow(2.0, 1.0 / 12.0)) < 1e-9, "460 Hz snaps to %f at A442", autotune.Nearest(460.0))
+
+  _, err = NewAutotune("lydian-augmented", 0, DefaultTuningReference, 0.0, nil)
+  Assert(t, err != nil, "an unknown scale should error")
+}
+
+func TestSimpleSpectralGate(t *testing.T) {
+  maxSampleValue := 1000.0
+
+  // magnitudes and phases of 5 bands
+  polarSpectrum := []float64{1000.0, 0.1, 5.0, 0.2, 200.0, 0.3, 0.5, 0.4, 50.0, 0.5}
+
+  // below -40 dB
+  gated := SimpleSpectralGate(polarSpectrum, 8, 0.01, 0.0, maxSampleValue)
+  Equals(t, 2, gated)
+  Equals(t, []float64{1000.0, 0.1, 0.0, 0.2, 200.0, 0.3, 0.0, 0.4, 50.0, 0.5}, polarSpectrum)
+
+  // more than 20 dB below the loudest band, bands already at 0 count again
+  gated = SimpleSpectralGate(polarSpectrum, 8, 0.0, 0.1, maxSampleValue)
+  Equals(t, 3, gated)
+  Equals(t, 1000.0, polarSpectrum[0])
+  Equals(t, 200.0, polarSpectrum[4])
+  Equals(t, 0.0, polarSpectrum[8])
+}
+
+func TestRunDebug(t *testing.T) {
+  dir := filepath.Join(t.TempDir(), "charts")
+  chartWriter, err := charter.NewCharter(dir)
+  Ok(t, err)
+
+  // 2 channels, 100 frames of 256 samples, charts every 12th frame
+  debug := newRunDebug(chartWriter, 2, 44100, 25088, 512, 512, 256, 256, 1000.0)
+  Equals(t, 12, debug.frameInterval)
+
+  Ok(t, debug.windows(make([]float64, 512), make([]float64, 512)))
+
+  polarBuffers := [][]float64{make([]float64, 514), make([]float64, 514)}
+  for frame := 0; frame < 13; frame++ {
+    Ok(t, debug.frame(frame, float64(frame) * 0.01, polarBuffers))
+    debug.gate(0, frame)
+    debug.gate(1, 0)
+  }
+
+  debug.blockPeak(0, []int{10, -100, 50})
+  debug.blockPeak(1, []int{0, 0, 0})
+  Assert(t, math.Abs(debug.blockPeaks[0][0] + 20.0) < 1e-9, "peak of channel 0 is %f dB", debug.blockPeaks[0][0])
+  Equals(t, []float64{debugFloorDb}, debug.blockPeaks[1])
+
+  Ok(t, debug.write("Test"))
+
+  for _, name := range []string{
+    "index.html",
+    "windows_0.html",
+    "magnitude_chan-0_0.html",
+    "phase_chan-1_12.html",
+    "gate_0.html",
+    "peaks_0.html",
+  } {
+    _, err := os.Stat(filepath.Join(dir, name))
+    Ok(t, err)
+  }
+
+  _, err = os.Stat(filepath.Join(dir, "magnitude_chan-0_1.html"))
+  Assert(t, os.IsNotExist(err), "frame 1 should not be charted")
+}
+
+func TestPitchTracker(t *testing.T) {
+  sampleRate := 44100
+  maxSampleValue := float64(audioio.IntMaxSignedValue[24])
+
+  // two notes with harmonics and a gap of silence between them
+  signal := make([]float64, sampleRate)
+  for i := range signal {
+    frequency := 220.0
+    if i >= sampleRate / 2 {
+      frequency = 330.0
+    } else if i >= sampleRate * 2 / 5 {
+      continue
+    }
+
+    for harmonic := 1; harmonic <= 4; harmonic++ {
+      signal[i] += 0.2 / float64(harmonic) * maxSampleValue * math.Sin(twoPi * frequency * float64(harmonic) * float64(i) / float64(sampleRate))
+    }
+  }
+
+  for _, method := range PitchMethods {
+    tracker, err := NewPitchTracker(method, DefaultMinPitch, DefaultMaxPitch, DefaultPitchConfidence, 1024, 1.0, "hamming", 256)
+    Ok(t, err)
+
+    pitchPoints, err := tracker.Track(signalReader(t, sampleRate, 256, signal), nil)
+    Ok(t, err)
+
+    // frames centered within the file
+    Assert(t, len(pitchPoints) > 160 && len(pitchPoints) <= 173, "%s tracked %d frames", method, len(pitchPoints))
+
+    for _, point := range pitchPoints {
+      switch {
+      case point.Time > 0.05 && point.Time < 0.35:
+        Assert(t, math.Abs(point.Frequency - 220.0) < 0.5, "%s detected %f Hz at %f s", method, point.Frequency, point.Time)
+      case point.Time > 0.43 && point.Time < 0.47:
+        Assert(t, point.Frequency == 0.0, "%s detected %f Hz in silence at %f s", method, point.Frequency, point.Time)
+      case point.Time > 0.55 && point.Time < 0.95:
+        Assert(t, math.Abs(point.Frequency - 330.0) < 0.5, "%s detected %f Hz at %f s", method, point.Frequency, point.Time)
+      }
+    }
+
+    // the curve skips the silence
+    curve, err := PitchCurve(pitchPoints, 440.0, false)
+    Ok(t, err)
+    Assert(t, math.Abs(curve.Value(0.2) - 0.5) < 1e-3, "%s curve is %f at 0.2 s", method, curve.Value(0.2))
+    Assert(t, math.Abs(curve.Value(0.7) - 0.75) < 1e-3, "%s curve is %f at 0.7 s", method, curve.Value(0.7))
+    Assert(t, len(curve.Times) < len(pitchPoints), "%s curve has all %d frames", method, len(curve.Times))
+
+    curve, err = PitchCurve(pitchPoints, 440.0, true)
+    Ok(t, err)
+    Assert(t, math.Abs(curve.Value(0.2) - 2.0) < 4e-3, "%s flattened curve is %f at 0.2 s", method, curve.Value(0.2))
+
+    var csv strings.Builder
+    Ok(t, WritePitchCSV(&csv, pitchPoints))
+    Equals(t, len(pitchPoints) + 1, strings.Count(csv.String(), "\n"))
+  }
+
+  _, err := PitchCurve([]PitchPoint{{Time: 0.0}}, 440.0, false)
+  Assert(t, err != nil, "a curve needs voiced frames")
+
+  _, err = NewPitchTracker("autocorrelation", DefaultMinPitch, DefaultMaxPitch, DefaultPitchConfidence, 1024, 1.0, "hamming", 256)
+  Assert(t, err != nil, "an unknown method should error")
+
+  // two periods of 60 Hz don't fit in 512 samples
+  tracker, err := NewPitchTracker(PitchYIN, DefaultMinPitch, DefaultMaxPitch, DefaultPitchConfidence, 256, 1.0, "hamming", 64)
+  Ok(t, err)
+
+  _, err = tracker.Track(signalReader(t, sampleRate, 64, signal), nil)
+  Assert(t, err != nil, "a window too short for the lowest pitch should error")
+
+  format, err := PitchFormat("curve.BPF")
+  Ok(t, err)
+  Equals(t, PitchBPF, format)
+}
+
+func TestSpectrogramImage(t *testing.T) {
+  sampleRate := 44100
+
+  spectrogram, err := Analyze(sinesReader(t, sampleRate, sampleRate / 2, 256, 1000.0, 0.5), 512, 1.0, "hamming", 256, nil)
+  Ok(t, err)
+
+  for _, scale := range FrequencyScales {
+    spectrogramImage, err := NewSpectrogramImage(200, 100, scale, 50.0, 0.0, DefaultImageRange)
+    Ok(t, err)
+
+    img, err := spectrogramImage.Render(spectrogram)
+    Ok(t, err)
+
+    width := imageMargin + imageFrequencyAxis + 200 + imagePanelGap + imageColorbarWidth + imageColorbarAxis + imageMargin
+    Equals(t, width, img.Bounds().Dx())
+    Equals(t, imageMargin * 2 + imageTitle + 100 + imageTimeAxis, img.Bounds().Dy())
+
+    // the sine is the brightest row in the middle of the file
+    left := imageMargin + imageFrequencyAxis
+    top := imageMargin + imageTitle
+    brightest, brightestRow := 0, 0
+
+    for y := 0; y < 100; y++ {
+      pixel := img.RGBAAt(left + 100, top + y)
+
+      if brightness := int(pixel.R) + int(pixel.G) + int(pixel.B); brightness > brightest {
+        brightest, brightestRow = brightness, y
+      }
+    }
+
+    fraction := float64(99 - brightestRow) / 99.0
+    frequency := spectrogramImage.frequencyAt(fraction, float64(sampleRate) / 2.0)
+    Assert(t, math.Abs(frequency - 1000.0) < 1000.0 * 0.1, "%s scale is brightest at %f Hz", scale, frequency)
+
+    // far from the sine it's at the bottom of the range
+    dark := img.RGBAAt(left + 100, top)
+    Assert(t, int(dark.R) + int(dark.G) + int(dark.B) < 100, "%s scale top row is %v", scale, dark)
+  }
+
+  // side by side, one column per frame
+  spectrogramImage, err := NewSpectrogramImage(0, 64, FrequencyLinear, 0.0, 5000.0, 60.0)
+  Ok(t, err)
+
+  img, err := spectrogramImage.Render(spectrogram, spectrogram)
+  Ok(t, err)
+
+  panelWidth := spectrogramImage.panelWidth(spectrogram)
+  Assert(t, panelWidth > 80 && panelWidth <= 87, "%d columns for %d frames", panelWidth, spectrogram.NumFrames())
+  Equals(t, imageMargin + imageFrequencyAxis + panelWidth * 2 + imagePanelGap * 2 + imageColorbarWidth + imageColorbarAxis + imageMargin, img.Bounds().Dx())
+
+  Equals(t, 0.5, niceStep(0.31))
+  Equals(t, 2000.0, niceStep(1200.0))
+  Equals(t, 10.0, niceStep(10.0))
+
+  _, err = NewSpectrogramImage(100, 100, FrequencyLog, 0.0, 0.0, DefaultImageRange)
+  Assert(t, err != nil, "a log scale can't start at 0 Hz")
+
+  _, err = NewSpectrogramImage(100, 100, "mel", 20.0, 0.0, DefaultImageRange)
+  Assert(t, err != nil, "an unknown scale should error")
+}
+
+func TestImageSynth(t *testing.T) {
+  sampleRate := 44100
+
+  // a white row on the left half, a grey row higher up on the right half
+  img := image.NewRGBA(image.Rect(0, 0, 100, 64))
+  for x := 0; x < 100; x++ {
+    if x < 50 {
+      img.Set(x, 40, color.White)
+    } else {
+      img.Set(x, 20, color.Gray{128})
+    }
+  }
+
+  for _, overlap := range []float64{0.5, 1.0, 2.0, 4.0} {
+    imageSynth, err := NewImageSynth(1.0, FrequencyLinear, 0.0, 4000.0, 40.0, DefaultImageSynthPeak, 512, overlap, "hamming", 128, sampleRate, 24)
+    Ok(t, err)
+
+    spectrogram, err := imageSynth.Spectrogram(img)
+    Ok(t, err)
+    Equals(t, sampleRate, spectrogram.NumSampleFrames)
+
+    signal := spectrogram.Synthesize(spectrogram.Frames)[0]
+    Equals(t, sampleRate, len(signal))
+
+    // rows are centered in their share of the range
+    low := 4000.0 * (64.0 - 40.0 - 0.5) / 64.0
+    high := 4000.0 * (64.0 - 20.0 - 0.5) / 64.0
+    maxSampleValue := spectrogram.MaxSampleValue()
+    grey := math.Pow(10.0, (128.0 / 255.0 - 1.0) * 40.0 / 20.0)
+
+    first := signal[sampleRate / 10:sampleRate * 4 / 10]
+    second := signal[sampleRate * 6 / 10:sampleRate * 9 / 10]
+
+    Assert(t, math.Abs(sineAmplitude(first, low, sampleRate) / maxSampleValue - 1.0) < 0.05, "overlap %g: white row at %f", overlap, sineAmplitude(first, low, sampleRate) / maxSampleValue)
+    Assert(t, sineAmplitude(first, high, sampleRate) / maxSampleValue < 0.01, "overlap %g: grey row sounds early", overlap)
+    Assert(t, math.Abs(sineAmplitude(second, high, sampleRate) / maxSampleValue - grey) < grey * 0.05, "overlap %g: grey row at %f, expected %f", overlap, sineAmplitude(second, high, sampleRate) / maxSampleValue, grey)
+    Assert(t, sineAmplitude(second, low, sampleRate) / maxSampleValue < 0.01, "overlap %g: white row sounds late", overlap)
+  }
+
+  // normalized to the peak, a column per frame without a duration
+  imageSynth, err := NewImageSynth(0.0, FrequencyLog, 100.0, 10000.0, 40.0, -6.0, 512, 1.0, "hamming", 128, sampleRate, 16)
+  Ok(t, err)
+
+  signal, err := imageSynth.Synthesize(img)
+  Ok(t, err)
+  Equals(t, 100 * 128, len(signal))
+
+  peak := 0.0
+  for _, sample := range signal {
+    peak = math.Max(peak, math.Abs(sample))
+  }
+  Assert(t, math.Abs(peak / 32768.0 - math.Pow(10.0, -6.0 / 20.0)) < 1e-9, "peak %f", peak)
+
+  // with reconstructed phases too
+  imageSynth.GriffinLimIterations = 8
+  signal, err = imageSynth.Synthesize(img)
+  Ok(t, err)
+  Equals(t, 100 * 128, len(signal))
+
+  peak = 0.0
+  for _, sample := range signal {
+    peak = math.Max(peak, math.Abs(sample))
+  }
+  Assert(t, math.Abs(peak / 32768.0 - math.Pow(10.0, -6.0 / 20.0)) < 1e-9, "reconstructed peak %f", peak)
+
+  _, err = NewImageSynth(1.0, FrequencyLog, 0.0, 4000.0, 40.0, DefaultImageSynthPeak, 512, 1.0, "hamming", 128, sampleRate, 24)
+  Assert(t, err != nil, "a log scale can't start at 0 Hz")
+}
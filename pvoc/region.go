@@ -0,0 +1,54 @@
+package pvoc
+
+import(
+  "math"
+)
+
+// CutRegion cuts the output of a region from the processed output of the
+// region with context samples before it, dropping the latency the processor
+// delays it by. Both are in input samples, scaled to the output. The region
+// is padded with zeros when the processed output is too short.
+func CutRegion(processed []float64, context, length, latency int, scale float64) []float64 {
+  from := int(math.Round(float64(context) * scale)) + int(math.Round(float64(latency) * scale))
+  region := make([]float64, int(math.Round(float64(length) * scale)))
+
+  if from < len(processed) {
+    copy(region, processed[from:])
+  }
+
+  return region
+}
+
+// SpliceRegion replaces original[start:end] with region, which can be longer
+// or shorter after processing. The region crossfades in from the original
+// over its first fade samples, and back out into the original before end
+// over its last fade samples, so the seams don't click.
+func SpliceRegion(original, region []float64, start, end, fade int) []float64 {
+  if fade > len(region) / 2 {
+    fade = len(region) / 2
+  }
+
+  if fade > (end - start) / 2 {
+    fade = (end - start) / 2
+  }
+
+  output := make([]float64, 0, len(original) - (end - start) + len(region))
+  output = append(output, original[:start]...)
+  output = append(output, region...)
+  output = append(output, original[end:]...)
+
+  fadeIn := func(i int) float64 {
+    return 0.5 - 0.5 * math.Cos(pi * (float64(i) + 0.5) / float64(fade))
+  }
+
+  for i := 0; i < fade; i++ {
+    gain := fadeIn(i)
+    head := start + i
+    tail := start + len(region) - fade + i
+
+    output[head] = output[head] * gain + original[start + i] * (1 - gain)
+    output[tail] = output[tail] * (1 - gain) + original[end - fade + i] * gain
+  }
+
+  return output
+}
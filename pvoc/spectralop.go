@@ -0,0 +1,220 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+  "math/rand"
+  "strings"
+)
+
+// Spectral rearrangement operations
+const SpectralMirror = "mirror"
+const SpectralShuffle = "shuffle"
+const SpectralSwap = "swap"
+const SpectralInvert = "invert"
+
+var SpectralOperations = []string{
+  SpectralMirror,
+  SpectralShuffle,
+  SpectralSwap,
+  SpectralInvert,
+}
+
+func SpectralOperationsString() string {
+  return strings.Join(SpectralOperations, ", ")
+}
+
+// SpectralOperation rearranges the bands of every analysis frame between
+// analysis and resynthesis, for glitchy textures. Each operation works on the
+// bands from Low to High (in Hz, a High of 0 is the Nyquist frequency):
+//
+// mirror reflects the range around Pivot (0 is the middle of the range),
+// bands reflected outside the range are dropped
+//
+// shuffle moves blocks of Width bands to places drawn from a random
+// generator seeded with Seed, the same for every frame and every run
+//
+// swap exchanges the range with the one of the same width starting at To
+//
+// invert replaces every magnitude by the frame's largest magnitude in the
+// range minus the magnitude
+//
+// Moved bands keep their deviation from their band's center frequency, so
+// their partials land at the new band's frequency. Mirrored bands deviate
+// the other way.
+type SpectralOperation struct {
+  Operation string
+  Low float64 // Hz
+  High float64 // Hz
+  Pivot float64 // Hz, mirror only
+  To float64 // Hz, swap only
+  Seed int64 // shuffle only
+  Width int // bands, shuffle only
+  permutation []int // of the shuffled blocks
+}
+
+func NewSpectralOperation(
+  operation string,
+  low,
+  high,
+  pivot,
+  to float64,
+  seed int64,
+  width int,
+) (*SpectralOperation, error) {
+  switch operation {
+  case SpectralMirror, SpectralShuffle, SpectralSwap, SpectralInvert:
+  default:
+    return nil, fmt.Errorf("Spectral operation must be one of: %s, got %s", SpectralOperationsString(), operation)
+  }
+
+  if low < 0 || high < 0 || pivot < 0 || to < 0 {
+    return nil, fmt.Errorf("Spectral operation frequencies cannot be negative")
+  }
+
+  if high != 0 && high <= low {
+    return nil, fmt.Errorf("Spectral operation range must end above its start, got %f to %f", low, high)
+  }
+
+  if operation == SpectralSwap {
+    if high == 0 {
+      return nil, fmt.Errorf("Swapping needs the end of the range")
+    }
+
+    // ranges that touch share a band
+    if to <= high && to + (high - low) >= low {
+      return nil, fmt.Errorf("Swapped ranges can't overlap, got %f to %f and %f to %f", low, high, to, to + high - low)
+    }
+  }
+
+  if width < 1 {
+    return nil, fmt.Errorf("Shuffle width must be at least 1 band, got %d", width)
+  }
+
+  return &SpectralOperation{
+    Operation: operation,
+    Low: low,
+    High: high,
+    Pivot: pivot,
+    To: to,
+    Seed: seed,
+    Width: width,
+  }, nil
+}
+
+func (so *SpectralOperation) String() string {
+  switch so.Operation {
+  case SpectralMirror:
+    if so.Pivot == 0 {
+      return fmt.Sprintf("%s around the middle", so.Operation)
+    }
+
+    return fmt.Sprintf("%s around %.1f Hz", so.Operation, so.Pivot)
+  case SpectralShuffle:
+    return fmt.Sprintf("%s (seed %d, %d bands)", so.Operation, so.Seed, so.Width)
+  case SpectralSwap:
+    return fmt.Sprintf("%s with %.1f Hz", so.Operation, so.To)
+  }
+
+  return so.Operation
+}
+
+// the band nearest to a frequency, within 0 and halfPoints
+func frequencyBand(frequency float64, points, sampleRate int) int {
+  band := int(math.Round(frequency * float64(points) / float64(sampleRate)))
+
+  if band > points / 2 {
+    return points / 2
+  }
+
+  return band
+}
+
+// Apply rearranges a polar spectrum of points + 2 values in place
+func (so *SpectralOperation) Apply(polarSpectrum []float64, sampleRate int) {
+  points := len(polarSpectrum) - 2
+  halfPoints := points / 2
+
+  low := frequencyBand(so.Low, points, sampleRate)
+  high := halfPoints
+  if so.High != 0 {
+    high = frequencyBand(so.High, points, sampleRate)
+  }
+
+  numBands := high - low + 1
+  if numBands < 1 {
+    return
+  }
+
+  original := make([]float64, numBands * 2, numBands * 2)
+  copy(original, polarSpectrum[low * 2:(high + 1) * 2])
+
+  switch so.Operation {
+  case SpectralMirror:
+    // twice the pivot band, so the pivot can fall between two bands
+    doublePivot := low + high
+    if so.Pivot != 0 {
+      doublePivot = int(math.Round(2.0 * so.Pivot * float64(points) / float64(sampleRate)))
+    }
+
+    for i := range original {
+      polarSpectrum[low * 2 + i] = 0.0
+    }
+
+    for bandNumber := low; bandNumber <= high; bandNumber++ {
+      mirrored := doublePivot - bandNumber
+
+      if mirrored < low || mirrored > high {
+        continue
+      }
+
+      polarSpectrum[mirrored * 2] = original[(bandNumber - low) * 2]
+      polarSpectrum[mirrored * 2 + 1] = -original[(bandNumber - low) * 2 + 1]
+    }
+  case SpectralShuffle:
+    // a block at the top that isn't full stays where it is
+    numBlocks := numBands / so.Width
+
+    if len(so.permutation) != numBlocks {
+      so.permutation = rand.New(rand.NewSource(so.Seed)).Perm(numBlocks)
+    }
+
+    for block, destination := range so.permutation {
+      copy(
+        polarSpectrum[(low + destination * so.Width) * 2:(low + (destination + 1) * so.Width) * 2],
+        original[block * so.Width * 2:(block + 1) * so.Width * 2],
+      )
+    }
+  case SpectralSwap:
+    to := frequencyBand(so.To, points, sampleRate)
+
+    // ranges that only overlap once rounded to bands are moved apart or cut
+    // short, as are ranges that run past the Nyquist frequency
+    if to > low && to <= high {
+      to = high + 1
+    }
+
+    if to < low && to + numBands > low {
+      numBands = low - to
+    }
+
+    if to + numBands - 1 > halfPoints {
+      numBands = halfPoints - to + 1
+    }
+
+    for i := 0; i < numBands * 2; i++ {
+      polarSpectrum[low * 2 + i] = polarSpectrum[to * 2 + i]
+      polarSpectrum[to * 2 + i] = original[i]
+    }
+  case SpectralInvert:
+    maxAmplitude := 0.0
+
+    for i := 0; i < numBands * 2; i += 2 {
+      maxAmplitude = math.Max(maxAmplitude, original[i])
+    }
+
+    for i := 0; i < numBands * 2; i += 2 {
+      polarSpectrum[low * 2 + i] = maxAmplitude - original[i]
+    }
+  }
+}
@@ -0,0 +1,306 @@
+package pvoc
+
+import(
+  "fmt"
+  "math"
+  "gopvoc/audioio"
+)
+
+// Spectrogram holds the analysis of a whole file, for the operations that
+// need to look at more than one frame at a time. The frames are analyzed the
+// same way Run analyzes them: the first window ends at the first sample of
+// the file and the last one starts after the last sample.
+type Spectrogram struct {
+  Points int
+  WindowSize int
+  Decimation int
+  WindowName string
+  NumChans int
+  SampleRate int
+  BitDepth int
+  NumSampleFrames int // sample frames actually read
+  Positions []int // input time (in samples) of the start of each frame's window
+  Frames [][][]float64 // polar spectra (Points + 2 values), [channel][frame]
+}
+
+// Analyze reads the whole file with the given FFT settings, audioReader must
+// have been opened with a buffer length of decimation. progress, if not nil,
+// is called with the percentage of the file read so far.
+func Analyze(
+  audioReader *audioio.AudioReader,
+  bands int,
+  overlap float64,
+  windowName string,
+  decimation int,
+  progress func(percent int),
+) (*Spectrogram, error) {
+  if bands > 8192 || bands < 1 || (bands & (bands - 1)) != 0 {
+    return nil, fmt.Errorf("bands must be a power of 2 less than or equal to 8192, got %d", bands)
+  }
+
+  if !allowedOverlaps[overlap] {
+    return nil, fmt.Errorf("overlap must be 0.5, 1.0, 2.0 or 4.0, got %f", overlap)
+  }
+
+  if decimation < 1 {
+    return nil, fmt.Errorf("Decimation must be at least 1, got %d", decimation)
+  }
+
+  windowFunction := WindowFunctions[windowName]
+
+  if windowFunction == nil {
+    return nil, fmt.Errorf("Invalid window function (%s), valid options are: %s", windowName, WindowNamesString())
+  }
+
+  numChans := audioReader.GetNumChans()
+
+  spectrogram := &Spectrogram{
+    Points: bands * 2,
+    WindowSize: int(float64(bands) * 2.0 * overlap),
+    Decimation: decimation,
+    WindowName: windowName,
+    NumChans: numChans,
+    SampleRate: audioReader.GetSampleRate(),
+    BitDepth: audioReader.GetBitDepth(),
+    NumSampleFrames: audioReader.GetNumSampleFrames(),
+    Positions: []int{},
+    Frames: make([][][]float64, numChans, numChans),
+  }
+
+  analysisWindow := spectrogram.AnalysisWindow()
+
+  inputBuffers := make([]*SlidingBuffer, numChans, numChans)
+  spectrum := make([]float64, spectrogram.Points, spectrogram.Points)
+
+  for c := 0; c < numChans; c++ {
+    inputBuffers[c] = NewSlidingBuffer(spectrogram.WindowSize)
+    spectrogram.Frames[c] = [][]float64{}
+  }
+
+  inPointer := spectrogram.WindowSize * -1
+  totalSamplesRead := 0
+
+  for {
+    inPointer += decimation
+
+    _, samplesRead, err := audioReader.ReadNext()
+    totalSamplesRead += samplesRead
+
+    if err != nil {
+      return nil, err
+    }
+
+    for c := 0; c < numChans; c++ {
+      if samplesRead > 0 {
+        channelBuffer, err := audioReader.ExtractChannel(c)
+
+        if err != nil {
+          return nil, err
+        }
+
+        if err = inputBuffers[c].ShiftIn(channelBuffer.AsFloatBuffer().Data, samplesRead); err != nil {
+          return nil, err
+        }
+      } else {
+        inputBuffers[c].ShiftOver(decimation)
+      }
+
+      WindowFold(
+        inputBuffers[c].Data,
+        analysisWindow,
+        spectrum,
+        inPointer,
+      )
+
+      RealFFT(spectrum, Time2Freq)
+
+      polarSpectrum := make([]float64, spectrogram.Points + 2, spectrogram.Points + 2)
+      CartToPolar(spectrum, polarSpectrum)
+
+      spectrogram.Frames[c] = append(spectrogram.Frames[c], polarSpectrum)
+    }
+
+    spectrogram.Positions = append(spectrogram.Positions, inPointer)
+
+    if !inputBuffers[0].HasValidSamples() {
+      break
+    }
+
+    if progress != nil && spectrogram.NumSampleFrames > 0 {
+      progress(int((float64(totalSamplesRead) / float64(spectrogram.NumSampleFrames)) * 100.0))
+    }
+  }
+
+  // the reader's count is estimated from the duration for some formats
+  spectrogram.NumSampleFrames = totalSamplesRead
+
+  return spectrogram, nil
+}
+
+// the analysis window, scaled the way Run scales it for a synthesis hop of
+// Decimation
+func (s *Spectrogram) AnalysisWindow() []float64 {
+  analysisWindow := WindowFunctions[s.WindowName](s.WindowSize)
+  synthesisWindow := WindowFunctions[s.WindowName](s.WindowSize)
+
+  ScaleWindowsInPlace(analysisWindow, synthesisWindow, s.Points, s.Decimation)
+
+  return analysisWindow
+}
+
+// the largest absolute sample value at the spectrogram's bit depth, the
+// magnitude of a full scale sinusoid
+func (s *Spectrogram) MaxSampleValue() float64 {
+  return math.Pow(2, float64(s.BitDepth - 1))
+}
+
+func (s *Spectrogram) NumFrames() int {
+  return len(s.Positions)
+}
+
+// the time (in seconds) of the center of a frame's window
+func (s *Spectrogram) FrameTime(frame int) float64 {
+  return float64(s.Positions[frame] + s.WindowSize / 2) / float64(s.SampleRate)
+}
+
+// the frequency (in Hz) of the center of a band
+func (s *Spectrogram) BandFrequency(bandNumber int) float64 {
+  return float64(bandNumber * s.SampleRate) / float64(s.Points)
+}
+
+// InstantaneousFrequency returns the frequency (in Hz) of a band in a frame,
+// measured from the phase difference to the previous frame. The first frame
+// has nothing to measure against and gets the band's center frequency.
+func (s *Spectrogram) InstantaneousFrequency(channel, frame, bandNumber int) float64 {
+  if frame == 0 {
+    return s.BandFrequency(bandNumber)
+  }
+
+  // the analysis phases are relative to the absolute input time, their
+  // difference is the deviation from the band's center frequency
+  phase := s.Frames[channel][frame][bandNumber * 2 + 1]
+  lastPhase := s.Frames[channel][frame - 1][bandNumber * 2 + 1]
+
+  deviation := princarg(phase - lastPhase) / float64(s.Decimation)
+
+  return s.BandFrequency(bandNumber) + deviation * float64(s.SampleRate) / twoPi
+}
+
+// the phase of a band in a frame, referenced to the center of the frame's
+// window instead of the absolute input time the analysis phases use
+func (s *Spectrogram) CenterPhase(channel, frame, bandNumber int) float64 {
+  center := (s.Positions[frame] + s.WindowSize / 2) % s.Points
+
+  if center < 0 {
+    center += s.Points
+  }
+
+  rotation := twoPi * float64((bandNumber * center) % s.Points) / float64(s.Points)
+
+  return princarg(s.Frames[channel][frame][bandNumber * 2 + 1] + rotation)
+}
+
+// Synthesize overlap-adds frames shaped like the spectrogram's (usually a
+// modified copy of them) back into one signal per channel, as long as the
+// analyzed file. Each output sample is divided by the window overlap at that
+// sample, so resynthesizing the unmodified frames gives back the input
+// (exactly for overlaps of 0.5 and 1, closely for the folded longer windows).
+func (s *Spectrogram) Synthesize(frames [][][]float64) [][]float64 {
+  analysisWindow := WindowFunctions[s.WindowName](s.WindowSize)
+  synthesisWindow := WindowFunctions[s.WindowName](s.WindowSize)
+
+  ScaleWindowsInPlace(analysisWindow, synthesisWindow, s.Points, s.Decimation)
+
+  signals := make([][]float64, len(frames), len(frames))
+
+  if s.NumFrames() == 0 {
+    for c := range signals {
+      signals[c] = make([]float64, s.NumSampleFrames, s.NumSampleFrames)
+    }
+
+    return signals
+  }
+
+  origin := s.Positions[0]
+  length := s.Positions[s.NumFrames() - 1] - origin + s.WindowSize
+  norm := make([]float64, length, length)
+
+  for _, position := range s.Positions {
+    for i := 0; i < s.WindowSize; i++ {
+      norm[position - origin + i] += analysisWindow[i] * synthesisWindow[i]
+    }
+  }
+
+  spectrum := make([]float64, s.Points, s.Points)
+
+  for c := range frames {
+    output := make([]float64, length, length)
+
+    for f, position := range s.Positions {
+      PolarToCart(frames[c][f], spectrum)
+      RealFFT(spectrum, Freq2Time)
+
+      OverlapAdd(
+        spectrum,
+        synthesisWindow,
+        output[position - origin:position - origin + s.WindowSize],
+        position,
+      )
+    }
+
+    // the file starts at input time 0
+    signals[c] = make([]float64, s.NumSampleFrames, s.NumSampleFrames)
+
+    for i := range signals[c] {
+      if norm[i - origin] > 0.0 {
+        signals[c][i] = output[i - origin] / norm[i - origin]
+      }
+    }
+  }
+
+  return signals
+}
+
+// SynthesizeGriffinLim is Synthesize for frames whose phases don't fit their
+// magnitudes, such as frames built or averaged from magnitudes alone: the
+// phases of the frames are the starting point of the given number of
+// Griffin-Lim iterations, which find phases the magnitudes are consistent
+// with before the frames are resynthesized. The given frames aren't changed.
+func (s *Spectrogram) SynthesizeGriffinLim(frames [][][]float64, iterations int) ([][]float64, error) {
+  griffinLim, err := NewGriffinLim(s.Points, s.WindowSize, s.Decimation, s.WindowName, iterations)
+
+  if err != nil {
+    return nil, err
+  }
+
+  if s.NumFrames() == 0 {
+    return s.Synthesize(frames), nil
+  }
+
+  reconstructed := make([][][]float64, len(frames), len(frames))
+
+  for c := range frames {
+    reconstructed[c] = make([][]float64, len(frames[c]), len(frames[c]))
+
+    for f := range frames[c] {
+      reconstructed[c][f] = append([]float64{}, frames[c][f]...)
+    }
+  }
+
+  output, err := griffinLim.Reconstruct(reconstructed, s.Positions, nil)
+
+  if err != nil {
+    return nil, err
+  }
+
+  // the file starts at input time 0
+  origin := s.Positions[0]
+  signals := make([][]float64, len(frames), len(frames))
+
+  for c := range output {
+    signals[c] = make([]float64, s.NumSampleFrames, s.NumSampleFrames)
+    copy(signals[c], output[c][-origin:])
+  }
+
+  return signals, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+  "fmt"
+  "math"
+  "os"
+  "gopvoc/audioio"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// the part of the input -start and -end select, in sample frames. The
+// reader is set to the region with context on both sides, so the analysis
+// windows at its edges see the input around it
+type region struct {
+  inputPath string
+  inputFormat audioio.InputFormat
+  start int
+  end int
+  readStart int
+  readEnd int
+  latency int // how far the processed output lags the input
+  numSampleFrames int // of the whole input
+  scale float64 // output length over input length
+  splice bool
+  crossfade int
+  encode [][]float64 // mixes the input into the processed channels, nil if they are the same
+  tempDir string // holds the processed region with its context
+}
+
+// limits the opened audioReader to the region and its context, latency is
+// how far the processed output lags the input
+func prepareRegion(parsedArgs *cli.Arguments, audioReader *audioio.AudioReader, context, latency int, scale float64) (*region, error) {
+  sampleRate := audioReader.GetSampleRate()
+
+  r := &region{
+    inputPath: parsedArgs.InputPath,
+    inputFormat: parsedArgs.InputFormat,
+    end: audioReader.GetNumSampleFrames(),
+    numSampleFrames: audioReader.GetNumSampleFrames(),
+    latency: latency,
+    scale: scale,
+    splice: parsedArgs.Splice,
+    crossfade: int(math.Round(parsedArgs.Crossfade * float64(sampleRate))),
+  }
+
+  if parsedArgs.RangeStart != nil {
+    r.start = parsedArgs.RangeStart.Frame(sampleRate)
+  }
+
+  // an end past the end of the input is the end of the input
+  if parsedArgs.RangeEnd != nil && parsedArgs.RangeEnd.Frame(sampleRate) < r.end {
+    r.end = parsedArgs.RangeEnd.Frame(sampleRate)
+  }
+
+  if r.start >= r.end {
+    return nil, fmt.Errorf("The region from sample frame %d to %d is empty, the input has %d", r.start, r.end, r.numSampleFrames)
+  }
+
+  r.readStart = r.start - context
+  if r.readStart < 0 {
+    r.readStart = 0
+  }
+
+  r.readEnd = r.end + context
+  if r.readEnd > r.numSampleFrames {
+    r.readEnd = r.numSampleFrames
+  }
+
+  if err := audioReader.SetRange(r.readStart, r.readEnd); err != nil {
+    return nil, err
+  }
+
+  var err error
+  r.tempDir, err = os.MkdirTemp("", "gopvoc-region")
+
+  return r, err
+}
+
+// seconds of the region in the input and in the output
+func (r *region) durations(sampleRate int) (float64, float64) {
+  input := float64(r.end - r.start) / float64(sampleRate)
+  output := input * r.scale
+
+  if r.splice {
+    output += float64(r.numSampleFrames - (r.end - r.start)) / float64(sampleRate)
+  }
+
+  return input, output
+}
+
+// cuts the context and latency off the processed region and writes it to outputPath, or
+// splices it into the input with -splice
+func (r *region) finish(processedPath, outputPath string, outputFormat audioio.OutputFormat) error {
+  processed, audioFile, err := audioio.ReadSignals(processedPath, audioio.InputFormat{})
+
+  if err != nil {
+    return err
+  }
+
+  var original [][]float64
+
+  if r.splice {
+    if original, _, err = audioio.ReadSignals(r.inputPath, r.inputFormat); err != nil {
+      return err
+    }
+
+    if r.encode != nil {
+      original = audioio.MixSignals(r.encode, original)
+    }
+  }
+
+  signals := make([][]float64, len(processed), len(processed))
+
+  for c := range processed {
+    signals[c] = pvoc.CutRegion(processed[c], r.start - r.readStart, r.end - r.start, r.latency, r.scale)
+
+    if r.splice {
+      signals[c] = pvoc.SpliceRegion(original[c], signals[c], r.start, r.end, r.crossfade)
+    }
+  }
+
+  audioFile.Filepath = outputPath
+
+  return audioio.WriteSignals(audioFile, outputFormat, signals)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+  "fmt"
+  "path/filepath"
+  "gopvoc/cli"
+  "gopvoc/pvoc"
+)
+
+// draws the spectrogram of the input, and of the compare file next to it
+func runSpectrogram(parsedArgs *cli.Arguments) error {
+  spectrogramImage, err := pvoc.NewSpectrogramImage(
+    parsedArgs.ImageWidth,
+    parsedArgs.ImageHeight,
+    parsedArgs.ImageScale,
+    parsedArgs.ImageMinFrequency,
+    parsedArgs.ImageMaxFrequency,
+    parsedArgs.ImageRange,
+  )
+
+  if err != nil {
+    return err
+  }
+
+  spectrogram, err := analyzeFile(parsedArgs, parsedArgs.InputPath, parsedArgs.InputFormat)
+
+  if err != nil {
+    return err
+  }
+
+  spectrograms := []*pvoc.Spectrogram{spectrogram}
+
+  if len(parsedArgs.ComparePath) > 0 {
+    compare, err := analyzeFile(parsedArgs, parsedArgs.ComparePath, parsedArgs.CompareFormat)
+
+    if err != nil {
+      return err
+    }
+
+    spectrograms = append(spectrograms, compare)
+  }
+
+  img, err := spectrogramImage.Render(spectrograms...)
+
+  if err != nil {
+    return err
+  }
+
+  if err = pvoc.WritePNG(parsedArgs.SpectrogramPath, img); err != nil {
+    return fmt.Errorf("Could not write spectrogram image: %s", err)
+  }
+
+  if !parsedArgs.Quiet {
+    fmt.Printf("%24s   %s\n", "Spectrogram Image:", filepath.Base(parsedArgs.SpectrogramPath))
+  }
+
+  return nil
+}